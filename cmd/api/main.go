@@ -2,18 +2,29 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/buni/scraper/internal/api/links"
 	"github.com/buni/scraper/internal/api/links/handler"
+	"github.com/buni/scraper/internal/api/links/notifier"
+	"github.com/buni/scraper/internal/api/links/queue"
 	"github.com/buni/scraper/internal/api/links/repository"
 	"github.com/buni/scraper/internal/api/links/service"
 
+	"github.com/buni/scraper/internal/pkg/config"
+	"github.com/buni/scraper/internal/pkg/ratelimit"
 	"github.com/buni/scraper/internal/pkg/scraper"
+	"github.com/buni/scraper/internal/pkg/sitemap"
+	"github.com/buni/scraper/internal/pkg/webhook"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -24,17 +35,101 @@ func main() {
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
 	r := chi.NewRouter()
 
-	scraperService, err := scraper.NewScraper()
+	policy, err := config.DialPolicy()
 	if err != nil {
 		log.Fatalln(err)
 	}
+	urlCanonicalizer, err := config.Canonicalizer()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	webhookOptions := []webhook.SenderOption{}
+	if policy != nil {
+		webhookOptions = append(webhookOptions, webhook.WithHTTPClient(policy.Client(time.Second*10)))
+	}
 
 	jobsRepository := repository.NewInMemoryRepository()
-	jobsService := service.NewService(jobsRepository, scraperService)
-	jobsHandler := handler.NewHandler(jobsService)
+	serviceOptions := []service.Option{}
+
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" { // job callbacks are rejected unless a signing secret is configured
+		webhookSender, err := webhook.NewSender([]byte(secret), webhookOptions...)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		serviceOptions = append(serviceOptions, service.WithWebhookSender(webhookSender))
+	}
+
+	// the scraper is only needed to run jobs in process
+	var scraperService scraper.ScraperService
+	var jobsNotifier links.Notifier
+	if storageDir := os.Getenv("STORAGE_DIR"); storageDir != "" { // shared storage, jobs are executed by cmd/worker
+		jobsRepository, err = repository.NewFileRepository(storageDir, config.RepositoryOptions()...)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		jobsQueue, err := queue.NewFileQueue(filepath.Join(storageDir, "queue"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		// wakes up job subscribers when the workers change their jobs
+		jobsNotifier, err = notifier.NewFileNotifier(filepath.Join(storageDir, "notify"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		serviceOptions = append(serviceOptions, service.WithQueue(jobsQueue), service.WithNotifier(jobsNotifier))
+	} else { // jobs are executed in process
+		scraperOptions, err := config.ScraperOptions(policy, urlCanonicalizer)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		scraperService, err = scraper.NewScraper(scraperOptions...)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if v := os.Getenv("IDEMPOTENCY_KEY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			log.Fatalln("bad IDEMPOTENCY_KEY_TTL value", v)
+		}
+
+		serviceOptions = append(serviceOptions, service.WithIdempotencyKeyTTL(ttl))
+	}
+
+	if option, ok := quotaOption(); ok {
+		serviceOptions = append(serviceOptions, option)
+	}
+
+	jobsService := service.NewService(jobsRepository, scraperService, serviceOptions...)
+	adminToken := os.Getenv("ADMIN_TOKEN") // api keys are required once there is an admin to create them
+	handlerOptions := append(handlerOptions(), handler.WithAdminToken(adminToken), handler.WithCanonicalizer(urlCanonicalizer))
+	if policy != nil {
+		expander, err := sitemap.NewExpander(sitemap.WithHTTPClient(policy.Client(time.Second * 30)))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		handlerOptions = append(handlerOptions, handler.WithSitemapExpander(expander))
+	}
+
+	jobsHandler := handler.NewHandler(jobsService, handlerOptions...)
 	r.Route("/api/v1/", func(r chi.Router) {
+		if adminToken != "" {
+			r.Use(jobsHandler.Authenticate)
+		}
 		jobsHandler.RegisterRoutes(r)
 	})
+	if adminToken != "" {
+		r.Route("/admin/", jobsHandler.RegisterAdminRoutes)
+	} else {
+		log.Println("ADMIN_TOKEN is not set, the api is served without authentication")
+	}
+	r.Handle("/debug/vars", expvar.Handler())
 
 	srv := &http.Server{Handler: r, Addr: ":8080"}
 	go func() {
@@ -42,7 +137,89 @@ func main() {
 		log.Println(err)
 	}()
 	<-sig
-	ctx, _ = context.WithTimeout(ctx, time.Second*30)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
 	srv.Shutdown(ctx)
-	scraperService.Close(ctx)
+	if scraperService != nil {
+		scraperService.Close(ctx)
+	}
+	if jobsNotifier != nil {
+		jobsNotifier.Close()
+	}
+}
+
+// handlerOptions - submission limits from the environment, unset ones keep the handler defaults
+func handlerOptions() []handler.Option {
+	options := []handler.Option{}
+
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		maxBodyBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBodyBytes <= 0 {
+			log.Fatalln("bad MAX_BODY_BYTES value", v)
+		}
+		options = append(options, handler.WithMaxBodyBytes(maxBodyBytes))
+	}
+
+	if v := os.Getenv("MAX_URLS_PER_JOB"); v != "" {
+		maxURLs, err := strconv.Atoi(v)
+		if err != nil || maxURLs <= 0 {
+			log.Fatalln("bad MAX_URLS_PER_JOB value", v)
+		}
+		options = append(options, handler.WithMaxURLsPerJob(maxURLs))
+	}
+
+	if v := os.Getenv("MAX_URL_LENGTH"); v != "" {
+		maxURLLength, err := strconv.Atoi(v)
+		if err != nil || maxURLLength <= 0 {
+			log.Fatalln("bad MAX_URL_LENGTH value", v)
+		}
+		options = append(options, handler.WithMaxURLLength(maxURLLength))
+	}
+
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" { // requests per second per api key (or client ip), RATE_LIMIT_BURST defaults to twice that
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatalln("bad RATE_LIMIT_RPS value", v)
+		}
+
+		burst := int(math.Ceil(rps * 2))
+		if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+			burst, err = strconv.Atoi(v)
+			if err != nil {
+				log.Fatalln("bad RATE_LIMIT_BURST value", v)
+			}
+		}
+
+		limiter, err := ratelimit.NewLimiter(rps, burst)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		options = append(options, handler.WithRateLimiter(limiter))
+	}
+
+	return options
+}
+
+// quotaOption - QUOTA_URLS_PER_DAY and QUOTA_CONCURRENT_JOBS are per tenant, so they only apply with authentication enabled
+func quotaOption() (service.Option, bool) {
+	maxURLsPerDay, maxConcurrentJobs := 0, 0
+
+	for name, value := range map[string]*int{"QUOTA_URLS_PER_DAY": &maxURLsPerDay, "QUOTA_CONCURRENT_JOBS": &maxConcurrentJobs} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalln("bad", name, "value", v)
+		}
+		*value = n
+	}
+
+	if maxURLsPerDay == 0 && maxConcurrentJobs == 0 {
+		return nil, false
+	}
+
+	return service.WithQuotas(maxURLsPerDay, maxConcurrentJobs), true
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links/notifier"
+	"github.com/buni/scraper/internal/api/links/queue"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/api/links/worker"
+
+	"github.com/buni/scraper/internal/pkg/config"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	"github.com/buni/scraper/internal/pkg/webhook"
+)
+
+func main() {
+	log.Println("Starting worker")
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	storageDir := os.Getenv("STORAGE_DIR") // has to point to the same directory as the api
+	if storageDir == "" {
+		log.Fatalln("STORAGE_DIR is required")
+	}
+
+	concurrency := 1
+	if v := os.Getenv("WORKER_CONCURRENCY"); v != "" {
+		var err error
+		concurrency, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	maxAttempts := 5
+	if v := os.Getenv("WORKER_MAX_ATTEMPTS"); v != "" {
+		var err error
+		maxAttempts, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	policy, err := config.DialPolicy()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	urlCanonicalizer, err := config.Canonicalizer()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	scraperOptions, err := config.ScraperOptions(policy, urlCanonicalizer)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	webhookOptions := []webhook.SenderOption{}
+	if policy != nil {
+		webhookOptions = append(webhookOptions, webhook.WithHTTPClient(policy.Client(time.Second*10)))
+	}
+
+	scraperService, err := scraper.NewScraper(scraperOptions...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	jobsRepository, err := repository.NewFileRepository(storageDir, config.RepositoryOptions()...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	jobsQueue, err := queue.NewFileQueue(filepath.Join(storageDir, "queue"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	jobsNotifier, err := notifier.NewFileNotifier(filepath.Join(storageDir, "notify")) // wakes up the job subscribers of the api
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	serviceOptions := []service.Option{service.WithNotifier(jobsNotifier)}
+
+	if secret := os.Getenv("WEBHOOK_SECRET"); secret != "" { // has to match the api, otherwise callbacks aren't sent
+		webhookSender, err := webhook.NewSender([]byte(secret), webhookOptions...)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		serviceOptions = append(serviceOptions, service.WithWebhookSender(webhookSender))
+	}
+
+	jobsService := service.NewService(jobsRepository, scraperService, serviceOptions...)
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	process := fmt.Sprintf("%s-%d", hostname, os.Getpid()) // the api lists the circuit breakers of every worker process
+
+	jobsWorker, err := worker.NewWorker(jobsQueue, jobsService, worker.WithConcurrency(concurrency), worker.WithMaxAttempts(maxAttempts),
+		worker.WithCircuitBreakerSnapshots(process, time.Second*10))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		jobsWorker.Run(ctx)
+		close(done)
+	}()
+	<-sig
+	cancel()
+	<-done // let running jobs finish, the queue hands over anything that is killed mid way after the lease expires
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer closeCancel()
+	scraperService.Close(closeCtx)
+	jobsNotifier.Close()
+}
@@ -2,6 +2,7 @@ package links
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"time"
 )
@@ -9,23 +10,115 @@ import (
 var (
 	ErrInternalServerError = errors.New("internal.server.error")
 	ErrEmptyJobRequest     = errors.New("empty job request")
+	ErrInvalidCallbackURL  = errors.New("invalid callback url")
+	ErrWebhooksDisabled    = errors.New("webhooks are not enabled")
+	ErrInvalidLastEventID  = errors.New("invalid last event id")
+	ErrInvalidWait         = errors.New("invalid wait duration")
+	ErrInvalidJobRequest   = errors.New("invalid job request")
+	ErrRequestTooLarge     = errors.New("request body too large")
+	ErrInvalidUpload       = errors.New("invalid upload")
+	ErrMissingUploadFile   = errors.New("multipart upload without a file part")
+
+	ErrUnsupportedContentEncoding = errors.New("unsupported content encoding")
+	ErrInvalidSitemapURL          = errors.New("invalid sitemap url")
+	ErrInvalidModifiedSince       = errors.New("invalid modified since")
+	ErrSitemapExpansion           = errors.New("failed to expand sitemap")
+	ErrUnsupportedFormat          = errors.New("unsupported results format")
+	ErrInvalidIdempotencyKey      = errors.New("invalid idempotency key")
+	ErrUnauthorized               = errors.New("missing or invalid api key")
+	ErrInvalidAPIKeyRequest       = errors.New("invalid api key request")
+	ErrRateLimited                = errors.New("too many requests")
+	ErrURLQuotaExceeded           = errors.New("daily url quota exceeded")
+	ErrJobQuotaExceeded           = errors.New("concurrent job quota exceeded")
 )
 
+// JobStatus - lifecycle state of a links job
+type JobStatus string
+
+const (
+	JobStatusPending  JobStatus = "pending"
+	JobStatusRunning  JobStatus = "running"
+	JobStatusFinished JobStatus = "finished"
+	JobStatusFailed   JobStatus = "failed"
+)
+
+// Terminal - true if the job won't change state anymore
+func (s JobStatus) Terminal() bool {
+	return s == JobStatusFinished || s == JobStatusFailed
+}
+
 // EnqueueLinksJobRequest ...
 type EnqueueLinksJobRequest struct {
-	JobID string
-	URLs  []*url.URL
+	JobID       string
+	URLs        []*url.URL
+	CallbackURL *url.URL // optional, receives a signed WebhookPayload when the job reaches a terminal state
+	Labels      map[string]string
+	Options     JobOptions
+
+	IdempotencyKey string // optional, replays of the same request with the same key return the original job
+}
+
+// JobOptions - per job scrape settings, zero values fall back to the scraper defaults
+type JobOptions struct {
+	Timeout     time.Duration     `json:"timeout,omitempty"`     // per page
+	Concurrency int               `json:"concurrency,omitempty"` // pages fetched in parallel
+	Headers     map[string]string `json:"headers,omitempty"`     // added to every page request
+	LinkPolicy  string            `json:"link_policy,omitempty"` // how links are classified, see scraper.LinkPolicy
+	Proxy       string            `json:"proxy,omitempty"`       // http, https or socks5 proxy used instead of the scraper proxies
+
+	InsecureSkipVerify bool          `json:"insecure_skip_verify,omitempty"` // accept any tls certificate
+	Login              *LoginStep    `json:"login,omitempty"`                // form login before the first page
+	MaxAge             time.Duration `json:"max_age,omitempty"`              // accept pages scraped by any job within it
+}
+
+// LoginStep - form POST run before the first page of a job, the cookies it gets are only sent by that job
+type LoginStep struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// EnqueueLinksJobBody - application/json body of an enqueue request
+type EnqueueLinksJobBody struct {
+	JobID       string            `json:"job_id"`
+	URLs        []string          `json:"urls"`
+	CallbackURL string            `json:"callback_url"`
+	Labels      map[string]string `json:"labels"`
+	Options     JobOptionsBody    `json:"options"`
+}
+
+// JobOptionsBody - JobOptions as sent by clients, the timeout is a duration string ("10s")
+type JobOptionsBody struct {
+	Timeout     string            `json:"timeout"`
+	Concurrency int               `json:"concurrency"`
+	Headers     map[string]string `json:"headers"`
+	LinkPolicy  string            `json:"link_policy"`
+	Proxy       string            `json:"proxy"`
+
+	InsecureSkipVerify bool       `json:"insecure_skip_verify"`
+	Login              *LoginStep `json:"login"`
+	MaxAge             string     `json:"max_age"`
 }
 
 // Response - generic http response structure
 type Response struct {
-	Errors []string    `json:"errors,omitempty"`
-	Data   interface{} `json:"data,omitempty"`
+	Errors      []string          `json:"errors,omitempty"`
+	FieldErrors map[string]string `json:"field_errors,omitempty"` // validation errors keyed by the offending request field
+	Data        interface{}       `json:"data,omitempty"`
 }
 
 // EnqueueLinksJobResponse ...
 type EnqueueLinksJobResponse struct {
-	JobID string `json:"job_id"`
+	JobID     string        `json:"job_id"`
+	Rejected  []RejectedURL `json:"rejected,omitempty"`  // lines skipped by a lenient upload
+	Skipped   int           `json:"skipped,omitempty"`   // sitemap pages left out by modified_since
+	Truncated bool          `json:"truncated,omitempty"` // the sitemap listed more pages than a job can have
+}
+
+// RejectedURL - a line of a lenient upload that wasn't accepted
+type RejectedURL struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
 }
 
 // JobResultsResponse ...
@@ -33,29 +126,223 @@ type JobResultsResponse struct {
 	Results []JobResult `json:"results"` // FIXME: don't reuse the "model" in the response
 }
 
+// WebhookDeliveriesResponse ...
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
 // GetJobStatusRequest ...
 type GetJobStatusRequest struct {
 	JobID string
+	Wait  time.Duration // if set and the job is not finished, wait up to this long for the job to change state
+}
+
+// SubscribeJobEventsRequest ...
+type SubscribeJobEventsRequest struct {
+	JobID       string
+	LastEventID uint // results with a sequence up to (and including) this one are not sent again
+}
+
+// JobEventType ...
+type JobEventType string
+
+const (
+	JobEventResult   JobEventType = "result"
+	JobEventProgress JobEventType = "progress"
+	JobEventState    JobEventType = "state"
+)
+
+// JobEvent - a change of a running job, only result events have an id (the result sequence)
+type JobEvent struct {
+	ID   string
+	Type JobEventType
+	Data interface{}
+}
+
+// JobProgress - data of progress events
+type JobProgress struct {
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// JobState - data of state events
+type JobState struct {
+	Status     JobStatus  `json:"status"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// WebhookPayload - body posted to the job callback url
+type WebhookPayload struct {
+	JobID      string            `json:"job_id"`
+	Status     JobStatus         `json:"status"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at"`
+	Summary    JobSummary        `json:"summary"`
+	Results    []PageResult      `json:"results"`
+}
+
+// JobSummary ...
+type JobSummary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// PageResult - JobResult as sent in webhook payloads and job events, errors are flattened to their message
+type PageResult struct {
+	Sequence           uint   `json:"sequence"`
+	PageURL            string `json:"page_url"`
+	InternalLinksCount uint   `json:"internal_links_count"`
+	ExternalLinksCount uint   `json:"external_links_count"`
+	Success            bool   `json:"success"`
+	Error              string `json:"error,omitempty"`
 }
 
 // Job model
 type Job struct {
-	ID         string
-	URLs       []*url.URL
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	FinishedAt *time.Time
+	ID          string
+	Tenant      string // owner of the job, empty when authentication is disabled
+	URLs        []*url.URL
+	Status      JobStatus
+	CallbackURL string
+	Labels      map[string]string
+	Options     JobOptions
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	FinishedAt  *time.Time
+
+	WebhookPending bool // the callback hasn't been delivered (or given up on) yet, a redelivered job resumes it
+}
+
+// QueueMessage - a claimed queue entry, it has to be acked (or extended) before its lease expires
+type QueueMessage struct {
+	ID             string
+	JobID          string
+	LeaseExpiresAt time.Time
+	Attempt        int // 1 on the first delivery, counted up on every redelivery
 }
 
 // JobResult model
 type JobResult struct {
 	ID                 string    `json:"id"`
 	JobID              string    `json:"job_id"`
+	Sequence           uint      `json:"sequence"` // 1 based position in the order results were produced
 	PageURL            string    `json:"page_url"`
 	InternalLinksCount uint      `json:"internal_links_count"`
 	ExternalLinksCount uint      `json:"external_links_count"`
 	Success            bool      `json:"success"`
 	Error              error     `json:"error"`
+	TLS                *TLSInfo  `json:"tls,omitempty"`            // nil for plain http pages and failed connections
+	FromCache          bool      `json:"from_cache"`               // the page wasn't modified since it was last scraped
+	ErrorCategory      string    `json:"error_category,omitempty"` // kind of failure, e.g. circuit_open for pages of a failing host that weren't fetched
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 }
+
+// TLSInfo - the tls connection a page was fetched over
+type TLSInfo struct {
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`    // expiry of the page certificate
+	ExpiresSoon bool      `json:"expires_soon"` // the certificate expires within the warning window of the scraper
+}
+
+// IdempotencyKey model - remembers which job a client supplied key created, until it expires
+type IdempotencyKey struct {
+	Key         string    `json:"key"`
+	RequestHash string    `json:"request_hash"` // replays have to match the original request
+	JobID       string    `json:"job_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// APIKey model - only the sha256 hash of the key is stored, the key itself is returned once when it is created
+type APIKey struct {
+	ID        string     `json:"id"`
+	Tenant    string     `json:"tenant"`
+	Name      string     `json:"name,omitempty"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyRequest - admin request for a new tenant api key
+type CreateAPIKeyRequest struct {
+	Tenant string `json:"tenant"`
+	Name   string `json:"name,omitempty"`
+}
+
+// CreateAPIKeyResponse - the created key, Key can't be retrieved again
+type CreateAPIKeyResponse struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Name      string    `json:"name,omitempty"`
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TenantUsage - what the jobs of a tenant count against its quotas
+type TenantUsage struct {
+	URLs       int // urls of the jobs created since the start of the quota period
+	ActiveJobs int // jobs that are not finished yet
+}
+
+// TenantQuota - limits of a tenant, zero limits aren't enforced
+type TenantQuota struct {
+	MaxURLsPerDay     int
+	MaxConcurrentJobs int
+}
+
+// Check - ErrURLQuotaExceeded or ErrJobQuotaExceeded if a job with urls doesn't fit next to usage
+func (q TenantQuota) Check(usage TenantUsage, urls int) error {
+	if q.MaxURLsPerDay > 0 && usage.URLs+urls > q.MaxURLsPerDay {
+		return fmt.Errorf("%d of %d urls used today, the job has %d %w", usage.URLs, q.MaxURLsPerDay, urls, ErrURLQuotaExceeded)
+	}
+
+	if q.MaxConcurrentJobs > 0 && usage.ActiveJobs >= q.MaxConcurrentJobs {
+		return fmt.Errorf("%d jobs are running %w", usage.ActiveJobs, ErrJobQuotaExceeded)
+	}
+
+	return nil
+}
+
+// QuotaUsage - quota usage of the caller, limits are omitted if they aren't enforced
+type QuotaUsage struct {
+	URLsToday         int       `json:"urls_today"`
+	MaxURLsPerDay     int       `json:"max_urls_per_day,omitempty"`
+	ActiveJobs        int       `json:"active_jobs"`
+	MaxConcurrentJobs int       `json:"max_concurrent_jobs,omitempty"`
+	ResetsAt          time.Time `json:"resets_at"` // when urls_today goes back to 0
+}
+
+// CircuitBreaker - breaker of a host whose last page failed, pages of open hosts fail fast with the circuit_open error category
+type CircuitBreaker struct {
+	Host     string     `json:"host"`
+	State    string     `json:"state"` // closed, open or half_open
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+	Process  string     `json:"process,omitempty"` // worker the breaker is in, every process has its own breakers
+}
+
+// CircuitBreakerSnapshot - breakers of a worker process, stored so the api can list the breakers of the workers
+type CircuitBreakerSnapshot struct {
+	Process   string           `json:"process"`
+	Breakers  []CircuitBreaker `json:"breakers"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// WebhookDelivery model - a single attempt to deliver a job webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	JobID      string    `json:"job_id"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+const (
+	maxTenantLen     = 63
+	maxAPIKeyNameLen = 128
+)
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._-]*[a-z0-9])?$`)
+
+// Authenticate - middleware that only lets requests with a valid api key through,
+// the key is read from an "Authorization: Bearer" or X-API-Key header and the request context is scoped to its tenant
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawKey := r.Header.Get("X-API-Key")
+		if rawKey == "" {
+			rawKey = bearerToken(r)
+		}
+
+		if rawKey == "" {
+			unauthorized(w, r)
+			return
+		}
+
+		key, err := h.service.AuthenticateAPIKey(r.Context(), rawKey)
+		if err != nil {
+			if errors.Is(err, links.ErrUnauthorized) {
+				unauthorized(w, r)
+				return
+			}
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+			return
+		}
+
+		ctx := withAPIKeyID(tenant.NewContext(r.Context(), key.Tenant), key.ID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireAdmin - middleware that only lets requests with the admin token through
+func (h *Handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if h.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			unauthorized(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateAPIKey - admin handler, the key is only part of this response
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	req := links.CreateAPIKeyRequest{}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&req)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInvalidAPIKeyRequest.Error()}, FieldErrors: map[string]string{"body": err.Error()}})
+		return
+	}
+
+	fieldErrors := map[string]string{}
+	if len(req.Tenant) > maxTenantLen || !tenantPattern.MatchString(req.Tenant) {
+		fieldErrors["tenant"] = fmt.Sprintf("must be at most %d lower case letters, digits, '.', '_' or '-'", maxTenantLen)
+	}
+	if len(req.Name) > maxAPIKeyNameLen {
+		fieldErrors["name"] = fmt.Sprintf("must be at most %d bytes", maxAPIKeyNameLen)
+	}
+	if len(fieldErrors) > 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInvalidAPIKeyRequest.Error()}, FieldErrors: fieldErrors})
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(r.Context(), req)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, links.Response{Data: key})
+}
+
+// RevokeAPIKey - admin handler
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeAPIKey(r.Context(), chi.URLParam(r, "keyID"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrAPIKeyNotFound):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, links.Response{Errors: []string{repository.ErrAPIKeyNotFound.Error()}})
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCircuitBreakers - admin handler, breakers of the hosts that recently failed
+func (h *Handler) GetCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	breakers, err := h.service.GetCircuitBreakers(r.Context())
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, links.Response{Data: breakers})
+}
+
+// RegisterAdminRoutes - api key management and scraper state, guarded by the admin token
+func (h *Handler) RegisterAdminRoutes(r chi.Router) {
+	r.Route("/api-keys", func(r chi.Router) {
+		r.Use(h.requireAdmin)
+		r.Post("/", h.CreateAPIKey)
+		r.Delete("/{keyID}", h.RevokeAPIKey)
+	})
+	r.Route("/circuit-breakers", func(r chi.Router) {
+		r.Use(h.requireAdmin)
+		r.Get("/", h.GetCircuitBreakers)
+	})
+}
+
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	render.Status(r, http.StatusUnauthorized)
+	render.JSON(w, r, links.Response{Errors: []string{links.ErrUnauthorized.Error()}})
+}
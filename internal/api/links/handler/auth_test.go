@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Authenticate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		statusCode int
+		wantTenant string
+		setup      func(*mock.MockService)
+	}{
+		{
+			name:       "successfully authenticate bearer key",
+			headers:    map[string]string{"Authorization": "Bearer sk_valid"},
+			statusCode: http.StatusOK,
+			wantTenant: "acme",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().AuthenticateAPIKey(gomock.Any(), "sk_valid").Return(links.APIKey{Tenant: "acme"}, nil)
+			},
+		},
+		{
+			name:       "successfully authenticate x-api-key",
+			headers:    map[string]string{"X-API-Key": "sk_valid"},
+			statusCode: http.StatusOK,
+			wantTenant: "acme",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().AuthenticateAPIKey(gomock.Any(), "sk_valid").Return(links.APIKey{Tenant: "acme"}, nil)
+			},
+		},
+		{
+			name:       "missing key",
+			statusCode: http.StatusUnauthorized,
+			setup:      func(ms *mock.MockService) {},
+		},
+		{
+			name:       "invalid key",
+			headers:    map[string]string{"Authorization": "Bearer sk_revoked"},
+			statusCode: http.StatusUnauthorized,
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().AuthenticateAPIKey(gomock.Any(), "sk_revoked").Return(links.APIKey{}, links.ErrUnauthorized)
+			},
+		},
+		{
+			name:       "internal error",
+			headers:    map[string]string{"Authorization": "Bearer sk_valid"},
+			statusCode: http.StatusInternalServerError,
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().AuthenticateAPIKey(gomock.Any(), "sk_valid").Return(links.APIKey{}, errors.New("some error"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service)
+			tt.setup(service)
+			gotTenant := ""
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotTenant, _ = tenant.FromContext(r.Context())
+			})
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			recorder := httptest.NewRecorder()
+			h.Authenticate(next).ServeHTTP(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			assert.Equal(t, tt.wantTenant, gotTenant)
+			if tt.statusCode == http.StatusUnauthorized {
+				assert.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestHandler_AdminRoutes(t *testing.T) {
+	t.Parallel()
+	epoch := time.Unix(0, 0).UTC()
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		token        string
+		body         string
+		statusCode   int
+		responseBody *links.Response
+		setup        func(*mock.MockService)
+	}{
+		{
+			name:       "successfully create api key",
+			method:     http.MethodPost,
+			path:       "/api-keys/",
+			token:      "admin",
+			body:       `{"tenant":"acme","name":"ci"}`,
+			statusCode: http.StatusCreated,
+			responseBody: &links.Response{Data: links.CreateAPIKeyResponse{
+				ID: "id", Tenant: "acme", Name: "ci", Key: "sk_key", CreatedAt: epoch,
+			}},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().CreateAPIKey(gomock.Any(), links.CreateAPIKeyRequest{Tenant: "acme", Name: "ci"}).Return(links.CreateAPIKeyResponse{
+					ID: "id", Tenant: "acme", Name: "ci", Key: "sk_key", CreatedAt: epoch,
+				}, nil)
+			},
+		},
+		{
+			name:       "invalid tenant",
+			method:     http.MethodPost,
+			path:       "/api-keys/",
+			token:      "admin",
+			body:       `{"tenant":"Acme Inc"}`,
+			statusCode: http.StatusBadRequest,
+			responseBody: &links.Response{
+				Errors:      []string{links.ErrInvalidAPIKeyRequest.Error()},
+				FieldErrors: map[string]string{"tenant": "must be at most 63 lower case letters, digits, '.', '_' or '-'"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "wrong admin token",
+			method:     http.MethodPost,
+			path:       "/api-keys/",
+			token:      "guess",
+			body:       `{"tenant":"acme"}`,
+			statusCode: http.StatusUnauthorized,
+			responseBody: &links.Response{
+				Errors: []string{links.ErrUnauthorized.Error()},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "successfully revoke api key",
+			method:     http.MethodDelete,
+			path:       "/api-keys/id",
+			token:      "admin",
+			statusCode: http.StatusNoContent,
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().RevokeAPIKey(gomock.Any(), "id").Return(nil)
+			},
+		},
+		{
+			name:       "revoke missing api key",
+			method:     http.MethodDelete,
+			path:       "/api-keys/missing",
+			token:      "admin",
+			statusCode: http.StatusNotFound,
+			responseBody: &links.Response{
+				Errors: []string{repository.ErrAPIKeyNotFound.Error()},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().RevokeAPIKey(gomock.Any(), "missing").Return(repository.ErrAPIKeyNotFound)
+			},
+		},
+		{
+			name:       "successfully get circuit breakers",
+			method:     http.MethodGet,
+			path:       "/circuit-breakers/",
+			token:      "admin",
+			statusCode: http.StatusOK,
+			responseBody: &links.Response{Data: []links.CircuitBreaker{
+				{Host: "example.com", State: "open", Failures: 5, OpenedAt: &epoch, RetryAt: &epoch},
+			}},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetCircuitBreakers(gomock.Any()).Return([]links.CircuitBreaker{
+					{Host: "example.com", State: "open", Failures: 5, OpenedAt: &epoch, RetryAt: &epoch},
+				}, nil)
+			},
+		},
+		{
+			name:       "circuit breakers without admin token",
+			method:     http.MethodGet,
+			path:       "/circuit-breakers/",
+			statusCode: http.StatusUnauthorized,
+			responseBody: &links.Response{
+				Errors: []string{links.ErrUnauthorized.Error()},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service, WithAdminToken("admin"))
+			tt.setup(service)
+			router := chi.NewRouter()
+			h.RegisterAdminRoutes(router)
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+
+			if tt.responseBody == nil {
+				assert.Empty(t, recorder.Body.String())
+				return
+			}
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+)
+
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// formatMediaTypes - content type of every results format
+var formatMediaTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatCSV:    "text/csv",
+	formatNDJSON: "application/x-ndjson",
+}
+
+// resultColumns - csv header, the column order is part of the api and only ever appended to
+var resultColumns = []string{
+	"id",
+	"job_id",
+	"sequence",
+	"page_url",
+	"internal_links_count",
+	"external_links_count",
+	"success",
+	"error",
+	"created_at",
+	"updated_at",
+	"tls_version",
+	"tls_cipher_suite",
+	"tls_issuer",
+	"tls_not_after",
+	"tls_expires_soon",
+	"from_cache",
+	"error_category",
+}
+
+// resultRow - ndjson representation of links.JobResult, the error is rendered as its message
+type resultRow struct {
+	ID                 string         `json:"id"`
+	JobID              string         `json:"job_id"`
+	Sequence           uint           `json:"sequence"`
+	PageURL            string         `json:"page_url"`
+	InternalLinksCount uint           `json:"internal_links_count"`
+	ExternalLinksCount uint           `json:"external_links_count"`
+	Success            bool           `json:"success"`
+	Error              string         `json:"error"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	TLS                *links.TLSInfo `json:"tls,omitempty"`
+	FromCache          bool           `json:"from_cache"`
+	ErrorCategory      string         `json:"error_category,omitempty"`
+}
+
+func toResultRow(result links.JobResult) resultRow {
+	row := resultRow{
+		ID:                 result.ID,
+		JobID:              result.JobID,
+		Sequence:           result.Sequence,
+		PageURL:            result.PageURL,
+		InternalLinksCount: result.InternalLinksCount,
+		ExternalLinksCount: result.ExternalLinksCount,
+		Success:            result.Success,
+		CreatedAt:          result.CreatedAt,
+		UpdatedAt:          result.UpdatedAt,
+		TLS:                result.TLS,
+		FromCache:          result.FromCache,
+		ErrorCategory:      result.ErrorCategory,
+	}
+	if result.Error != nil {
+		row.Error = result.Error.Error()
+	}
+
+	return row
+}
+
+// resultsFormat - ?format= takes precedence over the Accept header, an Accept header without a supported type means json
+// media ranges are taken in the order they are listed, quality values are not weighed
+func resultsFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		format = strings.ToLower(format)
+		if _, ok := formatMediaTypes[format]; !ok {
+			return "", links.ErrUnsupportedFormat
+		}
+		return format, nil
+	}
+
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json":
+			return formatJSON, nil
+		case "text/csv":
+			return formatCSV, nil
+		case "application/x-ndjson", "application/ndjson":
+			return formatNDJSON, nil
+		}
+	}
+
+	return formatJSON, nil
+}
+
+// exportJobResults - streams the results of a finished job as csv or ndjson rows, as they are read from the repository
+// the status is only written with the first row, so errors before it still get a proper error response,
+// an error after it can only cut the response short
+func (h *Handler) exportJobResults(w http.ResponseWriter, r *http.Request, req links.GetJobStatusRequest, format string) {
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	started := false
+
+	start := func() error {
+		if started {
+			return nil
+		}
+		started = true
+		w.Header().Set("Content-Type", formatMediaTypes[format]+"; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Vary", "Accept")
+		w.WriteHeader(http.StatusOK)
+
+		if format == formatCSV {
+			return csvWriter.Write(resultColumns)
+		}
+		return nil
+	}
+
+	err := h.service.ExportLinksJobResults(r.Context(), req, func(result links.JobResult) error {
+		if err := start(); err != nil {
+			return err
+		}
+		if format == formatCSV {
+			return csvWriter.Write(csvRecord(result))
+		}
+		return encoder.Encode(toResultRow(result))
+	})
+	if err != nil {
+		if !started {
+			renderJobStatusError(w, r, err)
+		}
+		return
+	}
+
+	if err := start(); err != nil { // a job without results still gets the csv header
+		return
+	}
+	csvWriter.Flush()
+}
+
+func csvRecord(result links.JobResult) []string {
+	row := toResultRow(result)
+
+	record := []string{
+		row.ID,
+		row.JobID,
+		strconv.FormatUint(uint64(row.Sequence), 10),
+		row.PageURL,
+		strconv.FormatUint(uint64(row.InternalLinksCount), 10),
+		strconv.FormatUint(uint64(row.ExternalLinksCount), 10),
+		strconv.FormatBool(row.Success),
+		row.Error,
+		row.CreatedAt.Format(time.RFC3339Nano),
+		row.UpdatedAt.Format(time.RFC3339Nano),
+	}
+
+	if row.TLS != nil {
+		record = append(record,
+			row.TLS.Version,
+			row.TLS.CipherSuite,
+			row.TLS.Issuer,
+			row.TLS.NotAfter.Format(time.RFC3339),
+			strconv.FormatBool(row.TLS.ExpiresSoon),
+		)
+	} else {
+		record = append(record, "", "", "", "", "")
+	}
+
+	return append(record, strconv.FormatBool(row.FromCache), row.ErrorCategory)
+}
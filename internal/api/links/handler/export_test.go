@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func exportHelper(results ...links.JobResult) func(ctx context.Context, req links.GetJobStatusRequest, fn func(result links.JobResult) error) error {
+	return func(ctx context.Context, req links.GetJobStatusRequest, fn func(result links.JobResult) error) error {
+		for _, result := range results {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestHandler_GetJobStatusExport(t *testing.T) {
+	t.Parallel()
+	epoch := time.Unix(0, 0).UTC()
+	results := []links.JobResult{
+		{ID: "1", JobID: "job", Sequence: 1, PageURL: "http://localhost/", InternalLinksCount: 2, ExternalLinksCount: 1, Success: true, CreatedAt: epoch, UpdatedAt: epoch,
+			TLS: &links.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", Issuer: "CN=R3,O=Let's Encrypt,C=US", NotAfter: epoch.AddDate(0, 3, 0)}, FromCache: true},
+		{ID: "2", JobID: "job", Sequence: 2, PageURL: "http://localhost/a,b", Error: errors.New("bad status code 404"), ErrorCategory: "client_error", CreatedAt: epoch, UpdatedAt: epoch},
+	}
+	tests := []struct {
+		name        string
+		query       string
+		accept      string
+		statusCode  int
+		contentType string
+		body        string
+		setup       func(*mock.MockService)
+	}{
+		{
+			name:        "successfully export csv via accept",
+			accept:      "text/csv",
+			statusCode:  200,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,job_id,sequence,page_url,internal_links_count,external_links_count,success,error,created_at,updated_at,tls_version,tls_cipher_suite,tls_issuer,tls_not_after,tls_expires_soon,from_cache,error_category\n" +
+				"1,job,1,http://localhost/,2,1,true,,1970-01-01T00:00:00Z,1970-01-01T00:00:00Z,TLS 1.3,TLS_AES_128_GCM_SHA256,\"CN=R3,O=Let's Encrypt,C=US\",1970-04-01T00:00:00Z,false,true,\n" +
+				"2,job,2,\"http://localhost/a,b\",0,0,false,bad status code 404,1970-01-01T00:00:00Z,1970-01-01T00:00:00Z,,,,,,false,client_error\n",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().ExportLinksJobResults(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(exportHelper(results...))
+			},
+		},
+		{
+			name:        "successfully export ndjson via format",
+			query:       "format=ndjson",
+			accept:      "application/json",
+			statusCode:  200,
+			contentType: "application/x-ndjson; charset=utf-8",
+			body: `{"id":"1","job_id":"job","sequence":1,"page_url":"http://localhost/","internal_links_count":2,"external_links_count":1,"success":true,"error":"","created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z","tls":{"version":"TLS 1.3","cipher_suite":"TLS_AES_128_GCM_SHA256","issuer":"CN=R3,O=Let's Encrypt,C=US","not_after":"1970-04-01T00:00:00Z","expires_soon":false},"from_cache":true}` + "\n" +
+				`{"id":"2","job_id":"job","sequence":2,"page_url":"http://localhost/a,b","internal_links_count":0,"external_links_count":0,"success":false,"error":"bad status code 404","created_at":"1970-01-01T00:00:00Z","updated_at":"1970-01-01T00:00:00Z","from_cache":false,"error_category":"client_error"}` + "\n",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().ExportLinksJobResults(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(exportHelper(results...))
+			},
+		},
+		{
+			name:        "successfully export csv header without results",
+			query:       "format=csv",
+			statusCode:  200,
+			contentType: "text/csv; charset=utf-8",
+			body:        "id,job_id,sequence,page_url,internal_links_count,external_links_count,success,error,created_at,updated_at,tls_version,tls_cipher_suite,tls_issuer,tls_not_after,tls_expires_soon,from_cache,error_category\n",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().ExportLinksJobResults(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(exportHelper())
+			},
+		},
+		{
+			name:        "successfully pass wait to the service",
+			query:       "format=csv&wait=30s",
+			statusCode:  202,
+			contentType: "application/json; charset=utf-8",
+			body:        "{}\n",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().ExportLinksJobResults(gomock.Any(), links.GetJobStatusRequest{Wait: time.Second * 30}, gomock.Any()).Return(repository.ErrJobResultsNotFound)
+			},
+		},
+		{
+			name:        "job not found",
+			accept:      "application/x-ndjson",
+			statusCode:  404,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"errors":["job not found"]}` + "\n",
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().ExportLinksJobResults(gomock.Any(), gomock.Any(), gomock.Any()).Return(repository.ErrJobNotFound)
+			},
+		},
+		{
+			name:        "unsupported format",
+			query:       "format=xml",
+			statusCode:  406,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"errors":["unsupported results format"]}` + "\n",
+			setup:       func(ms *mock.MockService) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service)
+			tt.setup(service)
+			req, err := http.NewRequest("GET", "/?"+tt.query, nil)
+			assert.NoError(t, err)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			recorder := httptest.NewRecorder()
+			h.GetJobStatus(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			assert.Equal(t, tt.contentType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tt.body, recorder.Body.String())
+		})
+	}
+}
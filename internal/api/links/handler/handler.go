@@ -1,46 +1,232 @@
 package handler
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/buni/scraper/internal/api/links"
 	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"github.com/buni/scraper/internal/pkg/ratelimit"
+	"github.com/buni/scraper/internal/pkg/sitemap"
 	"github.com/buni/scraper/internal/pkg/urls"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 )
 
 type Handler struct {
-	service links.Service
+	service           links.Service
+	keepAliveInterval time.Duration
+	maxWait           time.Duration
+	maxBodyBytes      int64
+	maxURLsPerJob     int
+	maxURLLength      int
+	sitemapExpander   *sitemap.Expander
+	canonicalizer     *canonical.Canonicalizer
+	adminToken        string
+	rateLimiter       *ratelimit.Limiter
 }
 
-func NewHandler(service links.Service) *Handler {
-	return &Handler{service: service}
+type Option func(h *Handler)
+
+// WithRateLimiter limits the requests each client can make to the links routes
+func WithRateLimiter(limiter *ratelimit.Limiter) Option {
+	return func(h *Handler) {
+		h.rateLimiter = limiter
+	}
+}
+
+// WithAdminToken sets the bearer token of the admin routes, without it every admin request is rejected
+func WithAdminToken(token string) Option {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+// WithMaxBodyBytes sets the maximum size of an enqueue request body, larger requests get a 413
+func WithMaxBodyBytes(max int64) Option {
+	return func(h *Handler) {
+		h.maxBodyBytes = max
+	}
+}
+
+// WithMaxURLsPerJob sets the maximum number of urls in a single job, larger jobs get a 413
+func WithMaxURLsPerJob(max int) Option {
+	return func(h *Handler) {
+		h.maxURLsPerJob = max
+	}
+}
+
+// WithMaxURLLength sets the maximum length of a single url in bytes
+func WithMaxURLLength(max int) Option {
+	return func(h *Handler) {
+		h.maxURLLength = max
+	}
+}
+
+// WithSitemapExpander sets the expander used for sitemap jobs
+func WithSitemapExpander(expander *sitemap.Expander) Option {
+	return func(h *Handler) {
+		h.sitemapExpander = expander
+	}
+}
+
+// WithCanonicalizer sets how duplicate urls of a submission are found, canonical.Default is used without it
+func WithCanonicalizer(canonicalizer *canonical.Canonicalizer) Option {
+	return func(h *Handler) {
+		h.canonicalizer = canonicalizer
+	}
+}
+
+func NewHandler(service links.Service, options ...Option) *Handler {
+	h := &Handler{
+		service:           service,
+		keepAliveInterval: time.Second * 15,
+		maxWait:           time.Minute,
+		maxBodyBytes:      10 << 20,
+		maxURLsPerJob:     10000,
+		maxURLLength:      2048,
+		canonicalizer:     canonical.Default,
+	}
+
+	for _, option := range options {
+		option(h)
+	}
+
+	if h.sitemapExpander == nil {
+		h.sitemapExpander, _ = sitemap.NewExpander() // can't fail without options
+	}
+
+	return h
 }
 
 // EnqueueLinksJob - handler
+// accepts either line delimited urls (the default) or an application/json EnqueueLinksJobBody
+// ?lenient=true makes line delimited uploads skip bad lines instead of rejecting the whole upload
 func (h *Handler) EnqueueLinksJob(w http.ResponseWriter, r *http.Request) {
-	urls, err := urls.ParseURLs(r.Body)
-	if err != nil {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, links.Response{Errors: []string{err.Error()}}) // this is treated sorta like a validation error, so it is fine to return it "naked" in the response
+	var req links.EnqueueLinksJobRequest
+	var rejected []links.RejectedURL
+
+	if !h.limitBody(w, r) {
 		return
 	}
 
-	if len(urls) == 0 {
-		render.Status(r, http.StatusBadRequest)
-		render.JSON(w, r, links.Response{Errors: []string{links.ErrEmptyJobRequest.Error()}}) // this is treated sorta like a validation error, so it is fine to return it "naked" in the response
-		return
+	if isJSON(r) {
+		body := links.EnqueueLinksJobBody{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&body)
+		if err != nil {
+			if h.rejectLimit(w, r, err) {
+				return
+			}
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrInvalidJobRequest.Error()}, FieldErrors: map[string]string{"body": err.Error()}})
+			return
+		}
+
+		if len(body.URLs) > h.maxURLsPerJob {
+			h.rejectLimit(w, r, urls.ErrTooManyURLs)
+			return
+		}
+
+		var fieldErrors map[string]string
+		req, fieldErrors = h.parseEnqueueLinksJobBody(body)
+		if len(fieldErrors) > 0 {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrInvalidJobRequest.Error()}, FieldErrors: fieldErrors})
+			return
+		}
+	} else {
+		var err error
+		req.URLs, rejected, err = h.parseURLList(r)
+		if err != nil {
+			if h.rejectLimit(w, r, err) {
+				return
+			}
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{err.Error()}}) // this is treated sorta like a validation error, so it is fine to return it "naked" in the response
+			return
+		}
+
+		if len(req.URLs) == 0 {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrEmptyJobRequest.Error()}, FieldErrors: rejectedFieldErrors(rejected)}) // this is treated sorta like a validation error, so it is fine to return it "naked" in the response
+			return
+		}
+	}
+
+	if callbackURL := r.URL.Query().Get("callback_url"); callbackURL != "" && req.CallbackURL == nil { // the body field wins over the query param
+		callback, err := parseCallbackURL(callbackURL)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, links.Response{Errors: []string{err.Error()}})
+			return
+		}
+		req.CallbackURL = callback
+	}
+
+	h.enqueue(w, r, req, links.EnqueueLinksJobResponse{Rejected: rejected})
+}
+
+// limitBody - limits and decodes the request body, renders the error and returns false if that fails
+func (h *Handler) limitBody(w http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength > h.maxBodyBytes { // no point in reading it
+		h.rejectLimit(w, r, links.ErrRequestTooLarge)
+		return false
+	}
+	r.Body = newMaxBytesReader(r.Body, h.maxBodyBytes)
+
+	body, err := h.decodeBody(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, links.ErrUnsupportedContentEncoding) {
+			status = http.StatusUnsupportedMediaType
+		}
+		h.rejectSubmission(w, r, status, rejectReasonInvalid, links.Response{Errors: []string{err.Error()}})
+		return false
+	}
+	r.Body = body
+
+	return true
+}
+
+// enqueue - hands req over to the service and renders response (with the job id set) if it is accepted
+// an Idempotency-Key header is passed on with req, a replay gets the original job id
+func (h *Handler) enqueue(w http.ResponseWriter, r *http.Request, req links.EnqueueLinksJobRequest, response links.EnqueueLinksJobResponse) {
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if !validIdempotencyKey(key) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, links.Response{
+				Errors:      []string{links.ErrInvalidIdempotencyKey.Error()},
+				FieldErrors: map[string]string{"Idempotency-Key": fmt.Sprintf("must be at most %d printable ascii characters", maxIdempotencyKeyLen)},
+			})
+			return
+		}
+		req.IdempotencyKey = key
 	}
 
-	job, err := h.service.EnqueueLinksJob(r.Context(), links.EnqueueLinksJobRequest{URLs: urls})
+	job, err := h.service.EnqueueLinksJob(r.Context(), req)
 	if err != nil {
+		if rejectQuota(w, r, err) {
+			return
+		}
+
 		switch {
 		case errors.Is(err, repository.ErrJobAlreadyExists): //
 			render.Status(r, http.StatusConflict)
 			render.JSON(w, r, links.Response{Errors: []string{repository.ErrJobAlreadyExists.Error()}})
 			return
+		case errors.Is(err, links.ErrWebhooksDisabled):
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, links.Response{Errors: []string{links.ErrWebhooksDisabled.Error()}})
+			return
 		default:
 			render.Status(r, http.StatusInternalServerError) // all other errors are treated as ise, the error message is also generic as to not leak details about the back-end
 			render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
@@ -48,26 +234,94 @@ func (h *Handler) EnqueueLinksJob(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	response.JobID = job.ID
 	render.Status(r, http.StatusAccepted)
-	render.JSON(w, r, links.Response{Data: links.EnqueueLinksJobResponse{JobID: job.ID}})
+	render.JSON(w, r, links.Response{Data: response})
+}
+
+// renderJobStatusError - renders the response for errors of a job results request
+func renderJobStatusError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrJobNotFound): // job not found
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, links.Response{Errors: []string{repository.ErrJobNotFound.Error()}})
+	case errors.Is(err, repository.ErrJobResultsNotFound): // job exists but is not still completed
+		render.Status(r, http.StatusAccepted) // in that case we return status 202
+		render.JSON(w, r, links.Response{})   // and empty body
+	default: // all other errors are treated as ise, the error message is also generic as to not leak details about the back-end
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+	}
 }
 
 // GetJobStatus - handler
+// ?wait=30s long polls an unfinished job, finished job results come with an ETag so unchanged polls can get a 304
+// results are exported as csv or ndjson with ?format=csv|ndjson or the matching Accept header
 func (h *Handler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobID")
 
-	results, err := h.service.GetLinksJobStatus(r.Context(), links.GetJobStatusRequest{JobID: jobID})
+	wait, err := parseWait(r.URL.Query().Get("wait"), h.maxWait)
+	if err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInvalidWait.Error()}})
+		return
+	}
+
+	format, err := resultsFormat(r)
+	if err != nil {
+		render.Status(r, http.StatusNotAcceptable)
+		render.JSON(w, r, links.Response{Errors: []string{err.Error()}})
+		return
+	}
+
+	req := links.GetJobStatusRequest{JobID: jobID, Wait: wait}
+	if format != formatJSON {
+		h.exportJobResults(w, r, req, format)
+		return
+	}
+
+	results, err := h.service.GetLinksJobStatus(r.Context(), req)
+	if err != nil {
+		renderJobStatusError(w, r, err)
+		return
+	}
+
+	body := &bytes.Buffer{}
+	err = json.NewEncoder(body).Encode(links.Response{Data: links.JobResultsResponse{Results: results}})
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		return
+	}
+
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache") // clients may cache, but have to revalidate
+	w.Header().Set("Vary", "Accept")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// GetWebhookDeliveries - handler
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	deliveries, err := h.service.GetWebhookDeliveries(r.Context(), links.GetJobStatusRequest{JobID: jobID})
 	if err != nil {
 		switch {
-		case errors.Is(err, repository.ErrJobNotFound): // job not found
+		case errors.Is(err, repository.ErrJobNotFound):
 			render.Status(r, http.StatusNotFound)
 			render.JSON(w, r, links.Response{Errors: []string{repository.ErrJobNotFound.Error()}})
 			return
-		case errors.Is(err, repository.ErrJobResultsNotFound): // job exists but is not still completed
-			render.Status(r, http.StatusAccepted) // in that case we return status 202
-			render.JSON(w, r, links.Response{})   // and empty body
-			return
-		default: // all other errors are treated as ise, the error message is also generic as to not leak details about the back-end
+		default:
 			render.Status(r, http.StatusInternalServerError)
 			render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
 			return
@@ -75,12 +329,149 @@ func (h *Handler) GetJobStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, links.Response{Data: links.JobResultsResponse{Results: results}})
+	render.JSON(w, r, links.Response{Data: links.WebhookDeliveriesResponse{Deliveries: deliveries}})
+}
+
+// StreamJobEvents - handler, streams job events as server sent events
+// clients resume after a reconnect by sending the id of the last received event in the Last-Event-ID header
+func (h *Handler) StreamJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		return
+	}
+
+	lastEventID := uint64(0)
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		var err error
+		lastEventID, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, links.Response{Errors: []string{links.ErrInvalidLastEventID.Error()}})
+			return
+		}
+	}
+
+	events, err := h.service.SubscribeLinksJobEvents(r.Context(), links.SubscribeJobEventsRequest{JobID: jobID, LastEventID: uint(lastEventID)})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrJobNotFound):
+			render.Status(r, http.StatusNotFound)
+			render.JSON(w, r, links.Response{Errors: []string{repository.ErrJobNotFound.Error()}})
+			return
+		default:
+			render.Status(r, http.StatusInternalServerError)
+			render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n") // comments are ignored by clients, but keep proxies from closing idle connections
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			err = writeEvent(w, event)
+		}
+
+		if err != nil {
+			return // client went away
+		}
+		flusher.Flush()
+	}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Route("/links", func(r chi.Router) {
+		r.Use(h.rateLimit)
+		r.Get("/quota", h.GetQuotaUsage)
 		r.Post("/", h.EnqueueLinksJob)
+		r.Post("/sitemap", h.EnqueueSitemapJob)
 		r.Get("/status/{jobID}", h.GetJobStatus)
+		r.Get("/jobs/{jobID}/deliveries", h.GetWebhookDeliveries)
+		r.Get("/jobs/{jobID}/events", h.StreamJobEvents)
 	})
 }
+
+// parseCallbackURL - callbacks are only posted to absolute http(s) urls
+func parseCallbackURL(raw string) (*url.URL, error) {
+	callbackURL, err := url.Parse(raw)
+	if err != nil || callbackURL.Host == "" || (callbackURL.Scheme != "http" && callbackURL.Scheme != "https") {
+		return nil, links.ErrInvalidCallbackURL
+	}
+
+	return callbackURL, nil
+}
+
+// writeEvent - writes event in the text/event-stream format, data is always single line json
+func writeEvent(w io.Writer, event links.JobEvent) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.ID != "" {
+		_, err = fmt.Fprintf(w, "id: %s\n", event.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+	return err
+}
+
+// parseWait - accepts go durations ("30s") or plain seconds ("30"), longer waits are capped to max
+func parseWait(raw string, max time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+
+	wait, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	if wait < 0 {
+		return 0, links.ErrInvalidWait
+	}
+
+	if wait > max {
+		wait = max
+	}
+
+	return wait, nil
+}
+
+// etagMatches - weak comparison as per RFC 7232, If-None-Match can carry a list of tags or *
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
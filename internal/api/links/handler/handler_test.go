@@ -2,9 +2,19 @@ package handler
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"expvar"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +22,7 @@ import (
 	"github.com/buni/scraper/internal/api/links/mock"
 	"github.com/buni/scraper/internal/api/links/repository"
 	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/buni/scraper/internal/pkg/urls"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -20,12 +31,48 @@ import (
 func TestHandler_EnqueueLinksJob(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
-		name         string
-		statusCode   int
-		responseBody links.Response
-		request      []string
-		setup        func(*mock.MockService)
+		name           string
+		statusCode     int
+		responseBody   links.Response
+		request        []string
+		query          string
+		idempotencyKey string
+		setup          func(*mock.MockService)
 	}{
+		{
+			name:           "successfully pass idempotency key",
+			statusCode:     http.StatusAccepted,
+			request:        []string{"https://localhost"},
+			idempotencyKey: "retry-1",
+			responseBody:   links.Response{Data: links.EnqueueLinksJobResponse{JobID: uuid.Nil.String()}},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{
+					URLs:           test.StrToURL(t, []string{"https://localhost"}),
+					IdempotencyKey: "retry-1",
+				}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			},
+		},
+		{
+			name:           "idempotency key reused for a different request",
+			statusCode:     http.StatusConflict,
+			request:        []string{"https://localhost"},
+			idempotencyKey: "retry-1",
+			responseBody:   links.Response{Errors: []string{repository.ErrJobAlreadyExists.Error()}},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, fmt.Errorf("idempotency key was used for a different request %w", repository.ErrJobAlreadyExists))
+			},
+		},
+		{
+			name:           "invalid idempotency key",
+			statusCode:     http.StatusBadRequest,
+			request:        []string{"https://localhost"},
+			idempotencyKey: strings.Repeat("k", 256),
+			responseBody: links.Response{
+				Errors:      []string{links.ErrInvalidIdempotencyKey.Error()},
+				FieldErrors: map[string]string{"Idempotency-Key": "must be at most 255 printable ascii characters"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
 		{
 			name:       "successfully enqueue job",
 			statusCode: http.StatusAccepted,
@@ -46,6 +93,109 @@ func TestHandler_EnqueueLinksJob(t *testing.T) {
 				)
 			},
 		},
+		{
+			name:       "successfully enqueue lenient job",
+			statusCode: http.StatusAccepted,
+			request: []string{
+				"# seeds",
+				"https://localhost",
+				"",
+				"ftp://localhost",
+				"localhost/page1",
+			},
+			query: "?lenient=true&default_scheme=https",
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{
+					JobID: uuid.Nil.String(),
+					Rejected: []links.RejectedURL{
+						{Line: 4, Text: "ftp://localhost", Reason: urls.ErrUnsupportedScheme.Error()},
+					},
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{
+					URLs: test.StrToURL(t, []string{"https://localhost", "https://localhost/page1"}),
+				}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			},
+		},
+		{
+			name:       "lenient job without valid urls",
+			statusCode: http.StatusBadRequest,
+			request: []string{
+				"ftp://localhost",
+				"localhost",
+			},
+			query: "?lenient=1",
+			responseBody: links.Response{
+				Errors: []string{links.ErrEmptyJobRequest.Error()},
+				FieldErrors: map[string]string{
+					"line 1": urls.ErrUnsupportedScheme.Error(),
+					"line 2": urls.ErrInvalidURL.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "lenient job with bad default scheme",
+			statusCode: http.StatusBadRequest,
+			request: []string{
+				"localhost",
+			},
+			query: "?lenient=true&default_scheme=gopher",
+			responseBody: links.Response{
+				Errors: []string{"failed to apply parse option " + urls.ErrBadDefaultScheme.Error()},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "successfully enqueue job with callback",
+			statusCode: http.StatusAccepted,
+			request: []string{
+				"https://localhost",
+			},
+			query: "?callback_url=https://localhost/callback",
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{
+					JobID: uuid.Nil.String(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, req links.EnqueueLinksJobRequest) (links.Job, error) {
+					assert.Equal(t, "https://localhost/callback", req.CallbackURL.String())
+					return links.Job{ID: uuid.Nil.String()}, nil
+				})
+			},
+		},
+		{
+			name:       "invalid callback url",
+			statusCode: http.StatusBadRequest,
+			request: []string{
+				"https://localhost",
+			},
+			query: "?callback_url=ftp://localhost/callback",
+			responseBody: links.Response{
+				Errors: []string{
+					links.ErrInvalidCallbackURL.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "webhooks disabled",
+			statusCode: http.StatusBadRequest,
+			request: []string{
+				"https://localhost",
+			},
+			query: "?callback_url=https://localhost/callback",
+			responseBody: links.Response{
+				Errors: []string{
+					links.ErrWebhooksDisabled.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, links.ErrWebhooksDisabled)
+			},
+		},
 		{
 			name: "job  already exists",
 			request: []string{
@@ -116,8 +266,11 @@ func TestHandler_EnqueueLinksJob(t *testing.T) {
 			for _, v := range tt.request {
 				body.WriteString(v + "\n")
 			}
-			req, err := http.NewRequest("GET", "/", body)
+			req, err := http.NewRequest("GET", "/"+tt.query, body)
 			assert.NoError(t, err)
+			if tt.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
 			recorder := httptest.NewRecorder()
 			h.EnqueueLinksJob(recorder, req)
 			assert.Equal(t, tt.statusCode, recorder.Code)
@@ -127,19 +280,195 @@ func TestHandler_EnqueueLinksJob(t *testing.T) {
 	}
 }
 
+func TestHandler_EnqueueLinksJobJSON(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		statusCode   int
+		responseBody links.Response
+		body         string
+		query        string
+		setup        func(*mock.MockService)
+	}{
+		{
+			name:       "successfully enqueue job",
+			statusCode: http.StatusAccepted,
+			body: `{
+				"job_id": "crawl-2022.03.01",
+				"urls": ["https://localhost", "http://localhost/page1"],
+				"callback_url": "https://localhost/callback",
+				"labels": {"team": "growth"},
+				"options": {"timeout": "10s", "max_age": "30m", "concurrency": 5, "headers": {"Accept-Language": "en"}, "link_policy": "domain", "proxy": "socks5://egress:1080", "insecure_skip_verify": true,
+					"login": {"url": "https://localhost/login", "fields": {"user": "qa", "password": "hunter2"}}}
+			}`,
+			query: "?callback_url=https://localhost/ignored",
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{
+					JobID: "crawl-2022.03.01",
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{
+					JobID:       "crawl-2022.03.01",
+					URLs:        test.StrToURL(t, []string{"https://localhost", "http://localhost/page1"}),
+					CallbackURL: test.StrToURL(t, []string{"https://localhost/callback"})[0],
+					Labels:      map[string]string{"team": "growth"},
+					Options: links.JobOptions{
+						Timeout:     time.Second * 10,
+						MaxAge:      time.Minute * 30,
+						Concurrency: 5,
+						Headers:     map[string]string{"Accept-Language": "en"},
+						LinkPolicy:  "domain",
+						Proxy:       "socks5://egress:1080",
+
+						InsecureSkipVerify: true,
+						Login:              &links.LoginStep{URL: "https://localhost/login", Fields: map[string]string{"user": "qa", "password": "hunter2"}},
+					},
+				}).Return(links.Job{ID: "crawl-2022.03.01"}, nil)
+			},
+		},
+		{
+			name:       "successfully drop duplicate urls",
+			statusCode: http.StatusAccepted,
+			body:       `{"urls": ["http://Localhost:80/a/../b?utm_source=x#top", "http://localhost/b", "http://localhost/c"]}`,
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{
+					JobID: uuid.Nil.String(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{
+					URLs: test.StrToURL(t, []string{"http://Localhost:80/a/../b?utm_source=x#top", "http://localhost/c"}),
+				}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			},
+		},
+		{
+			name:       "successfully enqueue job with only urls",
+			statusCode: http.StatusAccepted,
+			body:       `{"urls": ["https://localhost"]}`,
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{
+					JobID: uuid.Nil.String(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{
+					URLs: test.StrToURL(t, []string{"https://localhost"}),
+				}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			},
+		},
+		{
+			name:       "malformed body",
+			statusCode: http.StatusBadRequest,
+			body:       `{"urls": "https://localhost"}`,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrInvalidJobRequest.Error()},
+				FieldErrors: map[string]string{"body": "json: cannot unmarshal string into Go struct field EnqueueLinksJobBody.urls of type []string"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "unknown field",
+			statusCode: http.StatusBadRequest,
+			body:       `{"urls": ["https://localhost"], "priority": 1}`,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrInvalidJobRequest.Error()},
+				FieldErrors: map[string]string{"body": `json: unknown field "priority"`},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "invalid fields",
+			statusCode: http.StatusBadRequest,
+			body: `{
+				"job_id": "../etc",
+				"urls": ["https://localhost", "localhost"],
+				"callback_url": "ftp://localhost",
+				"labels": {"Team": "growth"},
+				"options": {"timeout": "forever", "max_age": "48h", "concurrency": -1, "headers": {"Host": "localhost", "Bad Header": "x"}, "link_policy": "sideways", "proxy": "egress:1080",
+					"login": {"url": "/login", "fields": {"": "x"}}}
+			}`,
+			responseBody: links.Response{
+				Errors: []string{links.ErrInvalidJobRequest.Error()},
+				FieldErrors: map[string]string{
+					"job_id":                     "must be at most 128 letters, digits, '.', '_', ':' or '-' and start with a letter or digit",
+					"urls[1]":                    "invalid url",
+					"callback_url":               links.ErrInvalidCallbackURL.Error(),
+					"labels.Team":                "key must be at most 63 lower case letters, digits, '.', '_', '/' or '-'",
+					"options.timeout":            "must be a duration like 10s",
+					"options.max_age":            "must be between 0 and 24h0m0s",
+					"options.concurrency":        "must be between 1 and 100",
+					"options.headers.Host":       "header can't be overridden",
+					"options.headers.Bad Header": "invalid header name",
+					"options.link_policy":        "must be one of host, domain",
+					"options.login.url":          "must be an absolute http or https url",
+					"options.login.fields":       "field names can't be empty",
+					"options.proxy":              "proxy must be an http, https or socks5 url",
+				},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "empty urls",
+			statusCode: http.StatusBadRequest,
+			body:       `{"urls": []}`,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrInvalidJobRequest.Error()},
+				FieldErrors: map[string]string{"urls": links.ErrEmptyJobRequest.Error()},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "job already exists",
+			statusCode: http.StatusConflict,
+			body:       `{"job_id": "crawl", "urls": ["https://localhost"]}`,
+			responseBody: links.Response{
+				Errors: []string{repository.ErrJobAlreadyExists.Error()},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, repository.ErrJobAlreadyExists)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service)
+			tt.setup(service)
+			req, err := http.NewRequest("POST", "/"+tt.query, strings.NewReader(tt.body))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+			recorder := httptest.NewRecorder()
+			h.EnqueueLinksJob(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
+
+func etagHelper(t *testing.T, response links.Response) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(test.ToJSON(t, response) + "\n"))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
 func TestHandler_GetJobStatus(t *testing.T) {
 	t.Parallel()
 	epoch := time.Unix(0, 0)
 	tests := []struct {
 		name         string
+		query        string
+		ifNoneMatch  string
 		statusCode   int
-		responseBody links.Response
+		responseBody *links.Response
 		setup        func(*mock.MockService)
 	}{
 		{
 			name:       "successfully get job status",
 			statusCode: 200,
-			responseBody: links.Response{
+			responseBody: &links.Response{
 				Data: links.JobResultsResponse{
 					Results: []links.JobResult{
 						{
@@ -169,7 +498,7 @@ func TestHandler_GetJobStatus(t *testing.T) {
 		{
 			name:       "job not found",
 			statusCode: 404,
-			responseBody: links.Response{
+			responseBody: &links.Response{
 				Errors: []string{
 					repository.ErrJobNotFound.Error(),
 				},
@@ -181,7 +510,7 @@ func TestHandler_GetJobStatus(t *testing.T) {
 		{
 			name:         "results not ready",
 			statusCode:   202,
-			responseBody: links.Response{},
+			responseBody: &links.Response{},
 			setup: func(ms *mock.MockService) {
 				ms.EXPECT().GetLinksJobStatus(gomock.Any(), gomock.Any()).Return(nil, repository.ErrJobResultsNotFound)
 			},
@@ -189,7 +518,7 @@ func TestHandler_GetJobStatus(t *testing.T) {
 		{
 			name:       "internal error",
 			statusCode: 500,
-			responseBody: links.Response{
+			responseBody: &links.Response{
 				Errors: []string{
 					links.ErrInternalServerError.Error(),
 				},
@@ -198,6 +527,43 @@ func TestHandler_GetJobStatus(t *testing.T) {
 				ms.EXPECT().GetLinksJobStatus(gomock.Any(), gomock.Any()).Return(nil, errors.New("some internal error"))
 			},
 		},
+		{
+			name:         "successfully pass wait to the service",
+			query:        "wait=30s",
+			statusCode:   202,
+			responseBody: &links.Response{},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetLinksJobStatus(gomock.Any(), links.GetJobStatusRequest{Wait: time.Second * 30}).Return(nil, repository.ErrJobResultsNotFound)
+			},
+		},
+		{
+			name:         "successfully parse wait in seconds and cap it",
+			query:        "wait=3600",
+			statusCode:   202,
+			responseBody: &links.Response{},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetLinksJobStatus(gomock.Any(), links.GetJobStatusRequest{Wait: time.Minute}).Return(nil, repository.ErrJobResultsNotFound)
+			},
+		},
+		{
+			name:       "invalid wait",
+			query:      "wait=soon",
+			statusCode: 400,
+			responseBody: &links.Response{
+				Errors: []string{
+					links.ErrInvalidWait.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:        "not modified",
+			ifNoneMatch: etagHelper(t, links.Response{Data: links.JobResultsResponse{Results: []links.JobResult{{ID: uuid.Nil.String(), CreatedAt: epoch, UpdatedAt: epoch}}}}),
+			statusCode:  304,
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetLinksJobStatus(gomock.Any(), gomock.Any()).Return([]links.JobResult{{ID: uuid.Nil.String(), CreatedAt: epoch, UpdatedAt: epoch}}, nil)
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -205,12 +571,480 @@ func TestHandler_GetJobStatus(t *testing.T) {
 			service := mock.NewMockService(ctrl)
 			h := NewHandler(service)
 			tt.setup(service)
-			req, err := http.NewRequest("GET", "/", nil)
+			req, err := http.NewRequest("GET", "/?"+tt.query, nil)
 			assert.NoError(t, err)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
 			recorder := httptest.NewRecorder()
 			h.GetJobStatus(recorder, req)
 			assert.Equal(t, tt.statusCode, recorder.Code)
 
+			if tt.responseBody == nil {
+				assert.Empty(t, recorder.Body.String())
+				return
+			}
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_GetWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+	epoch := time.Unix(0, 0)
+	tests := []struct {
+		name         string
+		statusCode   int
+		responseBody links.Response
+		setup        func(*mock.MockService)
+	}{
+		{
+			name:       "successfully get deliveries",
+			statusCode: http.StatusOK,
+			responseBody: links.Response{
+				Data: links.WebhookDeliveriesResponse{
+					Deliveries: []links.WebhookDelivery{
+						{
+							ID:         uuid.Nil.String(),
+							JobID:      uuid.Nil.String(),
+							URL:        "http://localhost/callback",
+							Attempt:    1,
+							StatusCode: http.StatusOK,
+							Success:    true,
+							CreatedAt:  epoch,
+						},
+					},
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetWebhookDeliveries(gomock.Any(), gomock.Any()).Return([]links.WebhookDelivery{
+					{
+						ID:         uuid.Nil.String(),
+						JobID:      uuid.Nil.String(),
+						URL:        "http://localhost/callback",
+						Attempt:    1,
+						StatusCode: http.StatusOK,
+						Success:    true,
+						CreatedAt:  epoch,
+					},
+				}, nil)
+			},
+		},
+		{
+			name:       "job not found",
+			statusCode: http.StatusNotFound,
+			responseBody: links.Response{
+				Errors: []string{
+					repository.ErrJobNotFound.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetWebhookDeliveries(gomock.Any(), gomock.Any()).Return(nil, repository.ErrJobNotFound)
+			},
+		},
+		{
+			name:       "internal error",
+			statusCode: http.StatusInternalServerError,
+			responseBody: links.Response{
+				Errors: []string{
+					links.ErrInternalServerError.Error(),
+				},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().GetWebhookDeliveries(gomock.Any(), gomock.Any()).Return(nil, errors.New("some internal error"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service)
+			tt.setup(service)
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			h.GetWebhookDeliveries(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_StreamJobEvents(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		statusCode   int
+		lastEventID  string
+		wantBody     string
+		responseBody links.Response
+		setup        func(*mock.MockService)
+	}{
+		{
+			name:       "successfully stream events",
+			statusCode: http.StatusOK,
+			wantBody: "id: 1\nevent: result\ndata: {\"sequence\":1,\"page_url\":\"http://localhost\",\"internal_links_count\":1,\"external_links_count\":0,\"success\":true}\n\n" +
+				"event: progress\ndata: {\"completed\":1,\"total\":1}\n\n" +
+				"event: state\ndata: {\"status\":\"finished\"}\n\n",
+			setup: func(ms *mock.MockService) {
+				events := make(chan links.JobEvent, 3)
+				events <- links.JobEvent{ID: "1", Type: links.JobEventResult, Data: links.PageResult{Sequence: 1, PageURL: "http://localhost", InternalLinksCount: 1, Success: true}}
+				events <- links.JobEvent{Type: links.JobEventProgress, Data: links.JobProgress{Completed: 1, Total: 1}}
+				events <- links.JobEvent{Type: links.JobEventState, Data: links.JobState{Status: links.JobStatusFinished}}
+				close(events)
+				ms.EXPECT().SubscribeLinksJobEvents(gomock.Any(), links.SubscribeJobEventsRequest{JobID: ""}).Return((<-chan links.JobEvent)(events), nil)
+			},
+		},
+		{
+			name:        "successfully resume from last event id",
+			statusCode:  http.StatusOK,
+			lastEventID: "41",
+			setup: func(ms *mock.MockService) {
+				events := make(chan links.JobEvent)
+				close(events)
+				ms.EXPECT().SubscribeLinksJobEvents(gomock.Any(), links.SubscribeJobEventsRequest{JobID: "", LastEventID: 41}).Return((<-chan links.JobEvent)(events), nil)
+			},
+		},
+		{
+			name:         "invalid last event id",
+			statusCode:   http.StatusBadRequest,
+			lastEventID:  "abc",
+			responseBody: links.Response{Errors: []string{links.ErrInvalidLastEventID.Error()}},
+			setup:        func(ms *mock.MockService) {},
+		},
+		{
+			name:         "job not found",
+			statusCode:   http.StatusNotFound,
+			responseBody: links.Response{Errors: []string{repository.ErrJobNotFound.Error()}},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().SubscribeLinksJobEvents(gomock.Any(), gomock.Any()).Return(nil, repository.ErrJobNotFound)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service)
+			tt.setup(service)
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			recorder := httptest.NewRecorder()
+			h.StreamJobEvents(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+				assert.Equal(t, tt.wantBody, recorder.Body.String())
+				return
+			}
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
+
+func TestHandler_EnqueueLinksJobLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		statusCode    int
+		responseBody  links.Response
+		body          string
+		json          bool
+		unknownLength bool
+		reason        string
+		setup         func(*mock.MockService)
+	}{
+		{
+			name:       "successfully enqueue job at the limits",
+			statusCode: http.StatusAccepted,
+			body:       "https://localhost/0123456789012345678901\nhttps://localhost/1\n",
+			responseBody: links.Response{
+				Data: links.EnqueueLinksJobResponse{JobID: uuid.Nil.String()},
+			},
+			setup: func(ms *mock.MockService) {
+				ms.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			},
+		},
+		{
+			name:       "body too large",
+			statusCode: http.StatusRequestEntityTooLarge,
+			body:       strings.Repeat("https://localhost/\n", 4),
+			reason:     rejectReasonBodyTooLarge,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrRequestTooLarge.Error()},
+				FieldErrors: map[string]string{"body": "must be at most 64 bytes"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:          "body too large without content length",
+			statusCode:    http.StatusRequestEntityTooLarge,
+			body:          strings.Repeat("https://localhost/01234567890123456789\n", 2),
+			unknownLength: true,
+			reason:        rejectReasonBodyTooLarge,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrRequestTooLarge.Error()},
+				FieldErrors: map[string]string{"body": "must be at most 64 bytes"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "too many urls",
+			statusCode: http.StatusRequestEntityTooLarge,
+			body:       "https://a.io\nhttps://b.io\nhttps://c.io\n",
+			reason:     rejectReasonTooManyURLs,
+			responseBody: links.Response{
+				Errors:      []string{urls.ErrTooManyURLs.Error()},
+				FieldErrors: map[string]string{"urls": "at most 2 urls are allowed per job"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "too many json urls",
+			statusCode: http.StatusRequestEntityTooLarge,
+			body:       `{"urls":["https://a.io","https://b.io","https://c.io"]}`,
+			json:       true,
+			reason:     rejectReasonTooManyURLs,
+			responseBody: links.Response{
+				Errors:      []string{urls.ErrTooManyURLs.Error()},
+				FieldErrors: map[string]string{"urls": "at most 2 urls are allowed per job"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "url too long",
+			statusCode: http.StatusBadRequest,
+			body:       "https://localhost/01234567890123456789012\n",
+			reason:     rejectReasonURLTooLong,
+			responseBody: links.Response{
+				Errors:      []string{"url on line 1 is longer than 40 bytes " + urls.ErrURLTooLong.Error()},
+				FieldErrors: map[string]string{"urls": "urls must be at most 40 bytes"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+		{
+			name:       "json url too long",
+			statusCode: http.StatusBadRequest,
+			body:       `{"urls":["https://localhost/01234567890123456789012"]}`,
+			json:       true,
+			reason:     rejectReasonInvalid,
+			responseBody: links.Response{
+				Errors:      []string{links.ErrInvalidJobRequest.Error()},
+				FieldErrors: map[string]string{"urls[0]": "must be at most 40 bytes"},
+			},
+			setup: func(ms *mock.MockService) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service, WithMaxBodyBytes(64), WithMaxURLsPerJob(2), WithMaxURLLength(40))
+			tt.setup(service)
+			req, err := http.NewRequest("POST", "/", strings.NewReader(tt.body))
+			assert.NoError(t, err)
+			if tt.json {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+
+			var rejectedBefore int64
+			if tt.reason != "" && tt.reason != rejectReasonInvalid { // invalid submissions are counted by other parallel tests too
+				if v, ok := rejectedSubmissions.Get(tt.reason).(*expvar.Int); ok {
+					rejectedBefore = v.Value()
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			h.EnqueueLinksJob(recorder, req)
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+
+			if tt.reason != "" && tt.reason != rejectReasonInvalid {
+				assert.Equal(t, rejectedBefore+1, rejectedSubmissions.Get(tt.reason).(*expvar.Int).Value())
+			}
+		})
+	}
+}
+
+func gzipHelper(t *testing.T, body string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(body))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func multipartHelper(t *testing.T, fields map[string]string, fileName, contentType string, file []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for name, value := range fields {
+		assert.NoError(t, mw.WriteField(name, value))
+	}
+	if fileName != "" {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, fileName))
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		assert.NoError(t, err)
+		_, err = part.Write(file)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, mw.Close())
+	return buf, mw.FormDataContentType()
+}
+
+func TestHandler_EnqueueLinksJobUploads(t *testing.T) {
+	t.Parallel()
+	twoURLs := test.StrToURL(t, []string{"https://localhost", "https://localhost/page1"})
+	tests := []struct {
+		name         string
+		statusCode   int
+		responseBody links.Response
+		options      []Option
+		request      func(t *testing.T) *http.Request
+		wantURLs     []*url.URL
+	}{
+		{
+			name:       "successfully enqueue gzip body",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/", bytes.NewReader(gzipHelper(t, "https://localhost\nhttps://localhost/page1\n")))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+			wantURLs: twoURLs,
+		},
+		{
+			name:       "successfully enqueue gzip json body",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/", bytes.NewReader(gzipHelper(t, `{"urls":["https://localhost","https://localhost/page1"]}`)))
+				req.Header.Set("Content-Encoding", "gzip")
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			wantURLs: twoURLs,
+		},
+		{
+			name:       "successfully enqueue csv body",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/?url_column=Link", strings.NewReader("title,link\nhome,https://localhost\npage,https://localhost/page1\n"))
+				req.Header.Set("Content-Type", "text/csv")
+				return req
+			},
+			wantURLs: twoURLs,
+		},
+		{
+			name:       "successfully enqueue multipart file",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				body, contentType := multipartHelper(t, map[string]string{"note": "weekly"}, "urls.txt", "text/plain", []byte("https://localhost\nhttps://localhost/page1\n"))
+				req := httptest.NewRequest("POST", "/", body)
+				req.Header.Set("Content-Type", contentType)
+				return req
+			},
+			wantURLs: twoURLs,
+		},
+		{
+			name:       "successfully enqueue multipart gzip csv file",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				file := gzipHelper(t, "url,title\nhttps://localhost,home\nhttps://localhost/page1,page\n")
+				body, contentType := multipartHelper(t, nil, "export.CSV.gz", "application/octet-stream", file)
+				req := httptest.NewRequest("POST", "/", body)
+				req.Header.Set("Content-Type", contentType)
+				return req
+			},
+			wantURLs: twoURLs,
+		},
+		{
+			name:       "multipart without file",
+			statusCode: http.StatusBadRequest,
+			responseBody: links.Response{
+				Errors: []string{links.ErrMissingUploadFile.Error()},
+			},
+			request: func(t *testing.T) *http.Request {
+				body, contentType := multipartHelper(t, map[string]string{"note": "weekly"}, "", "", nil)
+				req := httptest.NewRequest("POST", "/", body)
+				req.Header.Set("Content-Type", contentType)
+				return req
+			},
+		},
+		{
+			name:       "csv without url column",
+			statusCode: http.StatusBadRequest,
+			responseBody: links.Response{
+				Errors: []string{urls.ErrCSVColumnNotFound.Error() + ` "url"`},
+			},
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/?format=csv", strings.NewReader("title,link\nhome,https://localhost\n"))
+				return req
+			},
+		},
+		{
+			name:       "bad gzip body",
+			statusCode: http.StatusBadRequest,
+			responseBody: links.Response{
+				Errors: []string{links.ErrInvalidUpload.Error() + " gzip: invalid header"},
+			},
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("https://localhost\n"))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+		},
+		{
+			name:       "unsupported content encoding",
+			statusCode: http.StatusUnsupportedMediaType,
+			responseBody: links.Response{
+				Errors: []string{links.ErrUnsupportedContentEncoding.Error()},
+			},
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/", strings.NewReader("https://localhost\n"))
+				req.Header.Set("Content-Encoding", "br")
+				return req
+			},
+		},
+		{
+			name:       "decompressed body too large",
+			statusCode: http.StatusRequestEntityTooLarge,
+			options:    []Option{WithMaxBodyBytes(1024)},
+			responseBody: links.Response{
+				Errors:      []string{links.ErrRequestTooLarge.Error()},
+				FieldErrors: map[string]string{"body": "must be at most 1024 bytes"},
+			},
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/", bytes.NewReader(gzipHelper(t, strings.Repeat("https://localhost/\n", 1000))))
+				req.Header.Set("Content-Encoding", "gzip")
+				return req
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service, tt.options...)
+			if tt.wantURLs != nil {
+				service.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{URLs: tt.wantURLs}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+				tt.responseBody = links.Response{Data: links.EnqueueLinksJobResponse{JobID: uuid.Nil.String()}}
+			}
+			recorder := httptest.NewRecorder()
+			h.EnqueueLinksJob(recorder, tt.request(t))
+			assert.Equal(t, tt.statusCode, recorder.Code)
 			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
 		})
 	}
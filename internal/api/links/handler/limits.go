@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/urls"
+	"github.com/go-chi/render"
+)
+
+const (
+	rejectReasonInvalid      = "invalid"
+	rejectReasonBodyTooLarge = "body_too_large"
+	rejectReasonTooManyURLs  = "too_many_urls"
+	rejectReasonURLTooLong   = "url_too_long"
+)
+
+// rejectedSubmissions - enqueue requests that were turned down, by reason, exposed on /debug/vars
+var rejectedSubmissions = expvar.NewMap("links_rejected_submissions")
+
+// rejectSubmission - renders response with status and counts the rejection
+func (h *Handler) rejectSubmission(w http.ResponseWriter, r *http.Request, status int, reason string, response links.Response) {
+	rejectedSubmissions.Add(reason, 1)
+	render.Status(r, status)
+	render.JSON(w, r, response)
+}
+
+// rejectLimit - renders the response for err if it is caused by a submission limit,
+// returns false (and renders nothing) for other errors
+func (h *Handler) rejectLimit(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, links.ErrRequestTooLarge):
+		h.rejectSubmission(w, r, http.StatusRequestEntityTooLarge, rejectReasonBodyTooLarge, links.Response{
+			Errors:      []string{links.ErrRequestTooLarge.Error()},
+			FieldErrors: map[string]string{"body": fmt.Sprintf("must be at most %d bytes", h.maxBodyBytes)},
+		})
+	case errors.Is(err, urls.ErrTooManyURLs):
+		h.rejectSubmission(w, r, http.StatusRequestEntityTooLarge, rejectReasonTooManyURLs, links.Response{
+			Errors:      []string{urls.ErrTooManyURLs.Error()},
+			FieldErrors: map[string]string{"urls": fmt.Sprintf("at most %d urls are allowed per job", h.maxURLsPerJob)},
+		})
+	case errors.Is(err, urls.ErrURLTooLong):
+		h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonURLTooLong, links.Response{
+			Errors:      []string{err.Error()},
+			FieldErrors: map[string]string{"urls": fmt.Sprintf("urls must be at most %d bytes", h.maxURLLength)},
+		})
+	default:
+		return false
+	}
+
+	return true
+}
+
+// maxBytesReader - like http.MaxBytesReader, but the error can be matched with errors.Is
+type maxBytesReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func newMaxBytesReader(body io.ReadCloser, max int64) io.ReadCloser {
+	return &maxBytesReader{ReadCloser: body, remaining: max}
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 { // the limit is reached, a body that fits exactly ends here so probe for one more byte
+		var probe [1]byte
+		n, err := r.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, links.ErrRequestTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+
+	return n, err
+}
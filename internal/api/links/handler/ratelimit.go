@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/go-chi/render"
+)
+
+// jobQuotaRetryAfter - Retry-After of a submission over the concurrent job quota, there is no telling when a job finishes
+const jobQuotaRetryAfter = time.Second * 30
+
+type apiKeyContextKey struct{}
+
+// rateLimitKey - requests are limited per api key, or per client ip when they are not authenticated
+func rateLimitKey(r *http.Request) string {
+	if keyID, ok := r.Context().Value(apiKeyContextKey{}).(string); ok {
+		return "key:" + keyID
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// rateLimit - middleware that rejects requests over the rate limit with a 429, every response gets the X-RateLimit-* headers
+func (h *Handler) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := h.rateLimiter.Allow(rateLimitKey(r))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("X-RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			tooManyRequests(w, r, result.RetryAfter, links.Response{Errors: []string{links.ErrRateLimited.Error()}})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rejectQuota - renders a 429 if err is caused by a quota, returns false (and renders nothing) for other errors
+// the details are left to the quota endpoint
+func rejectQuota(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, links.ErrURLQuotaExceeded):
+		now := time.Now().UTC()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		tooManyRequests(w, r, tomorrow.Sub(now), links.Response{Errors: []string{links.ErrURLQuotaExceeded.Error()}})
+	case errors.Is(err, links.ErrJobQuotaExceeded):
+		tooManyRequests(w, r, jobQuotaRetryAfter, links.Response{Errors: []string{links.ErrJobQuotaExceeded.Error()}})
+	default:
+		return false
+	}
+
+	return true
+}
+
+// GetQuotaUsage - handler
+func (h *Handler) GetQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.service.GetQuotaUsage(r.Context())
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, links.Response{Errors: []string{links.ErrInternalServerError.Error()}})
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, links.Response{Data: usage})
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, response links.Response) {
+	w.Header().Set("Retry-After", seconds(retryAfter))
+	render.Status(r, http.StatusTooManyRequests)
+	render.JSON(w, r, response)
+}
+
+// seconds - rounded up, so clients that wait that long are not rejected again
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func withAPIKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, keyID)
+}
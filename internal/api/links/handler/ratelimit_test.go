@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/pkg/ratelimit"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_RateLimit(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	service := mock.NewMockService(ctrl)
+	service.EXPECT().GetQuotaUsage(gomock.Any()).Return(links.QuotaUsage{}, nil).Times(3)
+	limiter, err := ratelimit.NewLimiter(0.001, 2)
+	assert.NoError(t, err)
+	router := chi.NewRouter()
+	NewHandler(service, WithRateLimiter(limiter)).RegisterRoutes(router)
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/links/quota", nil)
+		assert.NoError(t, err)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	first := get("10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "2", first.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", first.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1235").Code)
+
+	limited := get("10.0.0.1:1236")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "1000", limited.Header().Get("Retry-After"))
+	assert.Equal(t, "0", limited.Header().Get("X-RateLimit-Remaining"))
+	assert.JSONEq(t, test.ToJSON(t, links.Response{Errors: []string{links.ErrRateLimited.Error()}}), limited.Body.String())
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1234").Code, "other clients are not limited")
+}
+
+func TestHandler_EnqueueLinksJobQuota(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		err        error
+		retryAfter string
+	}{
+		{name: "concurrent job quota", err: fmt.Errorf("1 jobs are running %w", links.ErrJobQuotaExceeded), retryAfter: "30"},
+		{name: "daily url quota", err: fmt.Errorf("quota %w", links.ErrURLQuotaExceeded)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			service.EXPECT().EnqueueLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, tt.err)
+			h := NewHandler(service)
+			req, err := http.NewRequest("POST", "/", bytes.NewBufferString("http://localhost/\n"))
+			assert.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			h.EnqueueLinksJob(recorder, req)
+			assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			assert.NotEmpty(t, recorder.Header().Get("Retry-After"))
+			if tt.retryAfter != "" {
+				assert.Equal(t, tt.retryAfter, recorder.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
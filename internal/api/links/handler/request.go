@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	"github.com/buni/scraper/internal/pkg/urls"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	maxJobIDLength   = 128
+	maxLabels        = 32
+	maxLabelKeyLen   = 63
+	maxLabelValueLen = 256
+	maxJobTimeout    = time.Minute * 5
+	maxJobMaxAge     = time.Hour * 24
+	maxJobHeaders    = 32
+	maxConcurrency   = 100
+	maxLoginFields   = 32
+
+	maxIdempotencyKeyLen = 255
+)
+
+var (
+	jobIDPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]*$`)
+	labelKeyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]*[a-z0-9])?$`)
+
+	// reservedHeaders are managed by the http client, letting clients set them would only break requests
+	reservedHeaders = map[string]bool{
+		"Host":              true,
+		"Content-Length":    true,
+		"Connection":        true,
+		"Transfer-Encoding": true,
+		"Upgrade":           true,
+		"Te":                true,
+		"Trailer":           true,
+		"Keep-Alive":        true,
+	}
+)
+
+// isJSON - true if the request body is declared as json, everything else is treated as line delimited urls
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// parseURLList - parses a line delimited url upload, strictly unless ?lenient=true is set
+// in lenient mode ?default_scheme= adds a scheme to lines without one
+func (h *Handler) parseURLList(r *http.Request) ([]*url.URL, []links.RejectedURL, error) {
+	query := r.URL.Query()
+	options := []urls.ParseOption{urls.WithMaxURLs(h.maxURLsPerJob), urls.WithMaxURLLength(h.maxURLLength), urls.WithCanonicalizer(h.canonicalizer)}
+
+	list, err := h.urlList(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if list.csvColumn != "" {
+		options = append(options, urls.WithCSVColumn(list.csvColumn))
+	}
+
+	lenient, _ := strconv.ParseBool(query.Get("lenient"))
+	if !lenient {
+		parsedURLs, err := urls.ParseURLs(list.body, options...)
+		return parsedURLs, nil, err
+	}
+
+	if scheme := query.Get("default_scheme"); scheme != "" {
+		options = append(options, urls.WithDefaultScheme(scheme))
+	}
+
+	accepted, rejectedLines, err := urls.ParseURLList(list.body, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accepted, rejectedURLs(rejectedLines), nil
+}
+
+func rejectedURLs(lines []urls.RejectedLine) []links.RejectedURL {
+	rejected := make([]links.RejectedURL, 0, len(lines))
+	for _, line := range lines {
+		rejected = append(rejected, links.RejectedURL{Line: line.Line, Text: line.Text, Reason: line.Reason.Error()})
+	}
+
+	return rejected
+}
+
+// validIdempotencyKey - keys are opaque to the server, but have to be printable ascii
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLen {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rejectedFieldErrors - rejected lines keyed by their line number
+func rejectedFieldErrors(rejected []links.RejectedURL) map[string]string {
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	fieldErrors := make(map[string]string, len(rejected))
+	for _, line := range rejected {
+		fieldErrors[fmt.Sprintf("line %d", line.Line)] = line.Reason
+	}
+
+	return fieldErrors
+}
+
+// parseEnqueueLinksJobBody - validates body and converts it to a service request
+// every invalid field is reported, keyed by its json path
+func (h *Handler) parseEnqueueLinksJobBody(body links.EnqueueLinksJobBody) (links.EnqueueLinksJobRequest, map[string]string) {
+	fieldErrors := map[string]string{}
+	req := links.EnqueueLinksJobRequest{JobID: body.JobID, Labels: body.Labels}
+
+	if body.JobID != "" && (len(body.JobID) > maxJobIDLength || !jobIDPattern.MatchString(body.JobID)) {
+		fieldErrors["job_id"] = fmt.Sprintf("must be at most %d letters, digits, '.', '_', ':' or '-' and start with a letter or digit", maxJobIDLength)
+	}
+
+	if len(body.URLs) == 0 {
+		fieldErrors["urls"] = links.ErrEmptyJobRequest.Error()
+	}
+
+	seen := map[string]bool{}
+	for i, raw := range body.URLs {
+		if len(raw) > h.maxURLLength {
+			fieldErrors[fmt.Sprintf("urls[%d]", i)] = fmt.Sprintf("must be at most %d bytes", h.maxURLLength)
+			continue
+		}
+
+		parsedURL, err := url.Parse(raw)
+		if err != nil || parsedURL.Scheme == "" || parsedURL.Host == "" {
+			fieldErrors[fmt.Sprintf("urls[%d]", i)] = "invalid url"
+			continue
+		}
+
+		key := h.canonicalizer.String(parsedURL)
+		if seen[key] { // the same page is scraped once
+			continue
+		}
+		seen[key] = true
+		req.URLs = append(req.URLs, parsedURL)
+	}
+
+	if body.CallbackURL != "" {
+		callbackURL, err := parseCallbackURL(body.CallbackURL)
+		if err != nil {
+			fieldErrors["callback_url"] = err.Error()
+		}
+		req.CallbackURL = callbackURL
+	}
+
+	if len(body.Labels) > maxLabels {
+		fieldErrors["labels"] = fmt.Sprintf("at most %d labels are allowed", maxLabels)
+	}
+
+	for key, value := range body.Labels {
+		if len(key) > maxLabelKeyLen || !labelKeyPattern.MatchString(key) {
+			fieldErrors["labels."+key] = fmt.Sprintf("key must be at most %d lower case letters, digits, '.', '_', '/' or '-'", maxLabelKeyLen)
+			continue
+		}
+		if len(value) > maxLabelValueLen {
+			fieldErrors["labels."+key] = fmt.Sprintf("value must be at most %d bytes", maxLabelValueLen)
+		}
+	}
+
+	req.Options = parseJobOptionsBody(body.Options, fieldErrors)
+
+	return req, fieldErrors
+}
+
+func parseJobOptionsBody(body links.JobOptionsBody, fieldErrors map[string]string) links.JobOptions {
+	options := links.JobOptions{Concurrency: body.Concurrency, Headers: body.Headers, LinkPolicy: body.LinkPolicy, Proxy: body.Proxy, InsecureSkipVerify: body.InsecureSkipVerify, Login: body.Login}
+
+	if body.Timeout != "" {
+		timeout, err := time.ParseDuration(body.Timeout)
+		switch {
+		case err != nil:
+			fieldErrors["options.timeout"] = "must be a duration like 10s"
+		case timeout <= 0 || timeout > maxJobTimeout:
+			fieldErrors["options.timeout"] = fmt.Sprintf("must be between 0 and %s", maxJobTimeout)
+		}
+		options.Timeout = timeout
+	}
+
+	if body.MaxAge != "" {
+		maxAge, err := time.ParseDuration(body.MaxAge)
+		switch {
+		case err != nil:
+			fieldErrors["options.max_age"] = "must be a duration like 10m"
+		case maxAge <= 0 || maxAge > maxJobMaxAge:
+			fieldErrors["options.max_age"] = fmt.Sprintf("must be between 0 and %s", maxJobMaxAge)
+		}
+		options.MaxAge = maxAge
+	}
+
+	if body.Concurrency < 0 || body.Concurrency > maxConcurrency {
+		fieldErrors["options.concurrency"] = fmt.Sprintf("must be between 1 and %d", maxConcurrency)
+	}
+
+	if len(body.Headers) > maxJobHeaders {
+		fieldErrors["options.headers"] = fmt.Sprintf("at most %d headers are allowed", maxJobHeaders)
+	}
+
+	for key, value := range body.Headers {
+		switch {
+		case !httpguts.ValidHeaderFieldName(key):
+			fieldErrors["options.headers."+key] = "invalid header name"
+		case reservedHeaders[http.CanonicalHeaderKey(key)]:
+			fieldErrors["options.headers."+key] = "header can't be overridden"
+		case !httpguts.ValidHeaderFieldValue(value):
+			fieldErrors["options.headers."+key] = "invalid header value"
+		}
+	}
+
+	if body.LinkPolicy != "" && !scraper.LinkPolicy(body.LinkPolicy).Valid() {
+		fieldErrors["options.link_policy"] = fmt.Sprintf("must be one of %s, %s", scraper.LinkPolicyHost, scraper.LinkPolicyDomain)
+	}
+
+	if body.Login != nil {
+		loginURL, err := url.Parse(body.Login.URL)
+		if err != nil || loginURL.Host == "" || (loginURL.Scheme != "http" && loginURL.Scheme != "https") {
+			fieldErrors["options.login.url"] = "must be an absolute http or https url"
+		}
+		if len(body.Login.Fields) > maxLoginFields {
+			fieldErrors["options.login.fields"] = fmt.Sprintf("at most %d fields are allowed", maxLoginFields)
+		}
+		if _, ok := body.Login.Fields[""]; ok {
+			fieldErrors["options.login.fields"] = "field names can't be empty"
+		}
+	}
+
+	if body.Proxy != "" {
+		if _, err := scraper.ParseProxyURL(body.Proxy); err != nil {
+			fieldErrors["options.proxy"] = err.Error()
+		}
+	}
+
+	return options
+}
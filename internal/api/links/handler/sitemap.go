@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/sitemap"
+	"github.com/buni/scraper/internal/pkg/urls"
+)
+
+// EnqueueSitemapJob - handler
+// scrapes every page listed by a sitemap, fetched from ?sitemap_url= or uploaded as the body (or the multipart file),
+// ?modified_since= (a sitemap lastmod value, e.g. 2022-03-01) leaves out pages that were not modified since
+func (h *Handler) EnqueueSitemapJob(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := links.EnqueueLinksJobRequest{}
+
+	var modifiedSince time.Time
+	if raw := query.Get("modified_since"); raw != "" {
+		var ok bool
+		modifiedSince, ok = sitemap.ParseLastMod(raw)
+		if !ok {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrInvalidModifiedSince.Error()}})
+			return
+		}
+	}
+
+	if callbackURL := query.Get("callback_url"); callbackURL != "" {
+		callback, err := parseCallbackURL(callbackURL)
+		if err != nil {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{err.Error()}})
+			return
+		}
+		req.CallbackURL = callback
+	}
+
+	var result sitemap.Result
+	var err error
+
+	if sitemapURL := query.Get("sitemap_url"); sitemapURL != "" {
+		parsedURL, parseErr := url.Parse(sitemapURL)
+		if parseErr != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrInvalidSitemapURL.Error()}})
+			return
+		}
+
+		result, err = h.sitemapExpander.Expand(r.Context(), parsedURL.String(), modifiedSince)
+	} else {
+		if !h.limitBody(w, r) {
+			return
+		}
+
+		list, listErr := h.urlList(r)
+		if listErr != nil {
+			h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{listErr.Error()}})
+			return
+		}
+
+		result, err = h.sitemapExpander.ExpandReader(r.Context(), list.body, modifiedSince)
+	}
+
+	if err != nil {
+		if h.rejectLimit(w, r, err) {
+			return
+		}
+
+		status := http.StatusBadRequest
+		if errors.Is(err, sitemap.ErrSitemapTooLarge) || errors.Is(err, sitemap.ErrTooManySitemaps) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		h.rejectSubmission(w, r, status, rejectReasonInvalid, links.Response{Errors: []string{links.ErrSitemapExpansion.Error() + ": " + err.Error()}})
+		return
+	}
+
+	if len(result.URLs) > h.maxURLsPerJob { // the job limit is usually lower than the sitemap one
+		result.URLs = result.URLs[:h.maxURLsPerJob]
+		result.Truncated = true
+	}
+
+	// the expanded list goes through the same (lenient) checks as uploaded ones
+	accepted, rejectedLines, err := urls.ParseURLList(strings.NewReader(strings.Join(result.URLs, "\n")), urls.WithMaxURLLength(h.maxURLLength), urls.WithCanonicalizer(h.canonicalizer))
+	if err != nil {
+		h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{err.Error()}})
+		return
+	}
+
+	rejected := rejectedURLs(rejectedLines)
+
+	if len(accepted) == 0 {
+		h.rejectSubmission(w, r, http.StatusBadRequest, rejectReasonInvalid, links.Response{Errors: []string{links.ErrEmptyJobRequest.Error()}, FieldErrors: rejectedFieldErrors(rejected)})
+		return
+	}
+
+	req.URLs = accepted
+
+	h.enqueue(w, r, req, links.EnqueueLinksJobResponse{Rejected: rejected, Skipped: result.Skipped, Truncated: result.Truncated})
+}
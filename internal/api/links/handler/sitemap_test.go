@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/buni/scraper/internal/pkg/urls"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://localhost/</loc><lastmod>2022-03-01</lastmod></url>
+	<url><loc>https://localhost/page1</loc><lastmod>2021-01-01</lastmod></url>
+	<url><loc>ftp://localhost/files</loc></url>
+</urlset>`
+
+func TestHandler_EnqueueSitemapJob(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sitemap.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testSitemap))
+	}))
+	t.Cleanup(srv.Close)
+
+	ftpRejected := links.RejectedURL{Line: 3, Text: "ftp://localhost/files", Reason: urls.ErrUnsupportedScheme.Error()}
+	tests := []struct {
+		name         string
+		statusCode   int
+		responseBody links.Response
+		options      []Option
+		request      func(t *testing.T) *http.Request
+		wantURLs     []string
+	}{
+		{
+			name:       "successfully enqueue fetched sitemap",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/?sitemap_url="+srv.URL+"/sitemap.xml", nil)
+			},
+			wantURLs: []string{"https://localhost/", "https://localhost/page1"},
+			responseBody: links.Response{Data: links.EnqueueLinksJobResponse{
+				JobID:    uuid.Nil.String(),
+				Rejected: []links.RejectedURL{ftpRejected},
+			}},
+		},
+		{
+			name:       "successfully enqueue uploaded gzip sitemap modified since",
+			statusCode: http.StatusAccepted,
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest("POST", "/?modified_since=2022-01-01", bytes.NewReader(gzipHelper(t, testSitemap)))
+				req.Header.Set("Content-Type", "application/xml")
+				return req
+			},
+			wantURLs: []string{"https://localhost/"},
+			responseBody: links.Response{Data: links.EnqueueLinksJobResponse{
+				JobID:    uuid.Nil.String(),
+				Rejected: []links.RejectedURL{{Line: 2, Text: "ftp://localhost/files", Reason: urls.ErrUnsupportedScheme.Error()}},
+				Skipped:  1,
+			}},
+		},
+		{
+			name:       "successfully truncate to the job limit",
+			statusCode: http.StatusAccepted,
+			options:    []Option{WithMaxURLsPerJob(1)},
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/", strings.NewReader(testSitemap))
+			},
+			wantURLs: []string{"https://localhost/"},
+			responseBody: links.Response{Data: links.EnqueueLinksJobResponse{
+				JobID:     uuid.Nil.String(),
+				Truncated: true,
+			}},
+		},
+		{
+			name:       "invalid sitemap url",
+			statusCode: http.StatusBadRequest,
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/?sitemap_url=file:///etc/passwd", nil)
+			},
+			responseBody: links.Response{Errors: []string{links.ErrInvalidSitemapURL.Error()}},
+		},
+		{
+			name:       "invalid modified since",
+			statusCode: http.StatusBadRequest,
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/?modified_since=yesterday", strings.NewReader(testSitemap))
+			},
+			responseBody: links.Response{Errors: []string{links.ErrInvalidModifiedSince.Error()}},
+		},
+		{
+			name:       "sitemap not found",
+			statusCode: http.StatusBadRequest,
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/?sitemap_url="+srv.URL+"/missing.xml", nil)
+			},
+			responseBody: links.Response{Errors: []string{
+				links.ErrSitemapExpansion.Error() + ": failed to fetch sitemap " + srv.URL + "/missing.xml bad status code 404",
+			}},
+		},
+		{
+			name:       "sitemap without valid urls",
+			statusCode: http.StatusBadRequest,
+			request: func(t *testing.T) *http.Request {
+				return httptest.NewRequest("POST", "/", strings.NewReader(`<urlset><url><loc>ftp://localhost/files</loc></url></urlset>`))
+			},
+			responseBody: links.Response{
+				Errors:      []string{links.ErrEmptyJobRequest.Error()},
+				FieldErrors: map[string]string{"line 1": urls.ErrUnsupportedScheme.Error()},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			service := mock.NewMockService(ctrl)
+			h := NewHandler(service, tt.options...)
+			if tt.wantURLs != nil {
+				service.EXPECT().EnqueueLinksJob(gomock.Any(), links.EnqueueLinksJobRequest{URLs: test.StrToURL(t, tt.wantURLs)}).Return(links.Job{ID: uuid.Nil.String()}, nil)
+			}
+			recorder := httptest.NewRecorder()
+			h.EnqueueSitemapJob(recorder, tt.request(t))
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			assert.JSONEq(t, test.ToJSON(t, tt.responseBody), recorder.Body.String())
+		})
+	}
+}
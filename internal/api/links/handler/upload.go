@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/buni/scraper/internal/api/links"
+)
+
+const (
+	uploadFormField  = "file"
+	defaultURLColumn = "url"
+)
+
+// urlList - an uploaded url list, ready to be parsed
+type urlList struct {
+	body      io.ReadCloser
+	csvColumn string // set if the list is csv
+}
+
+// decodeBody - undoes Content-Encoding, the decoded body is limited to maxBodyBytes as well
+// so a small compressed request can't expand into an arbitrarily large one
+func (h *Handler) decodeBody(r *http.Request) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		return h.gunzip(r.Body)
+	default:
+		return nil, links.ErrUnsupportedContentEncoding
+	}
+}
+
+func (h *Handler) gunzip(body io.ReadCloser) (io.ReadCloser, error) {
+	decompressed, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", links.ErrInvalidUpload, err)
+	}
+
+	return newMaxBytesReader(decompressed, h.maxBodyBytes), nil
+}
+
+// urlList - finds the url list in r, either the body itself or the "file" part of a multipart/form-data upload,
+// everything is streamed, multipart parts are read in order and only up to the file
+// csv is used if ?format=csv is set or the body/file is declared (or named) as csv, ?url_column= picks the column
+func (h *Handler) urlList(r *http.Request) (urlList, error) {
+	list := urlList{body: r.Body}
+	query := r.URL.Query()
+
+	column := query.Get("url_column")
+	if column == "" {
+		column = defaultURLColumn
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "multipart/form-data" {
+		part, err := findFilePart(multipart.NewReader(r.Body, params["boundary"]))
+		if err != nil {
+			return urlList{}, err
+		}
+
+		list.body = part
+		mediaType, _, _ = mime.ParseMediaType(part.Header.Get("Content-Type"))
+		fileName := strings.ToLower(part.FileName())
+
+		if mediaType == "application/gzip" || mediaType == "application/x-gzip" || path.Ext(fileName) == ".gz" {
+			list.body, err = h.gunzip(part)
+			if err != nil {
+				return urlList{}, err
+			}
+			fileName = strings.TrimSuffix(fileName, ".gz")
+		}
+
+		if path.Ext(fileName) == ".csv" {
+			mediaType = "text/csv"
+		}
+	}
+
+	if mediaType == "text/csv" || strings.EqualFold(query.Get("format"), "csv") {
+		list.csvColumn = column
+	}
+
+	return list, nil
+}
+
+func findFilePart(reader *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, links.ErrMissingUploadFile
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w %v", links.ErrInvalidUpload, err)
+		}
+
+		if part.FormName() == uploadFormField {
+			return part, nil
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: queue.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	links "github.com/buni/scraper/internal/api/links"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockQueue is a mock of Queue interface.
+type MockQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockQueueMockRecorder
+}
+
+// MockQueueMockRecorder is the mock recorder for MockQueue.
+type MockQueueMockRecorder struct {
+	mock *MockQueue
+}
+
+// NewMockQueue creates a new mock instance.
+func NewMockQueue(ctrl *gomock.Controller) *MockQueue {
+	mock := &MockQueue{ctrl: ctrl}
+	mock.recorder = &MockQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQueue) EXPECT() *MockQueueMockRecorder {
+	return m.recorder
+}
+
+// Ack mocks base method.
+func (m *MockQueue) Ack(ctx context.Context, msg links.QueueMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ack", ctx, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack.
+func (mr *MockQueueMockRecorder) Ack(ctx, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*MockQueue)(nil).Ack), ctx, msg)
+}
+
+// Dequeue mocks base method.
+func (m *MockQueue) Dequeue(ctx context.Context) (links.QueueMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Dequeue", ctx)
+	ret0, _ := ret[0].(links.QueueMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Dequeue indicates an expected call of Dequeue.
+func (mr *MockQueueMockRecorder) Dequeue(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Dequeue", reflect.TypeOf((*MockQueue)(nil).Dequeue), ctx)
+}
+
+// Enqueue mocks base method.
+func (m *MockQueue) Enqueue(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enqueue", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Enqueue indicates an expected call of Enqueue.
+func (mr *MockQueueMockRecorder) Enqueue(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enqueue", reflect.TypeOf((*MockQueue)(nil).Enqueue), ctx, jobID)
+}
+
+// Extend mocks base method.
+func (m *MockQueue) Extend(ctx context.Context, msg links.QueueMessage) (links.QueueMessage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Extend", ctx, msg)
+	ret0, _ := ret[0].(links.QueueMessage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Extend indicates an expected call of Extend.
+func (mr *MockQueueMockRecorder) Extend(ctx, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Extend", reflect.TypeOf((*MockQueue)(nil).Extend), ctx, msg)
+}
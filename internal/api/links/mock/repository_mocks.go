@@ -7,6 +7,7 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	links "github.com/buni/scraper/internal/api/links"
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,50 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CompleteLinksJobWebhook mocks base method.
+func (m *MockRepository) CompleteLinksJobWebhook(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteLinksJobWebhook", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CompleteLinksJobWebhook indicates an expected call of CompleteLinksJobWebhook.
+func (mr *MockRepositoryMockRecorder) CompleteLinksJobWebhook(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteLinksJobWebhook", reflect.TypeOf((*MockRepository)(nil).CompleteLinksJobWebhook), ctx, jobID)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockRepository) CreateAPIKey(ctx context.Context, key links.APIKey) (links.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, key)
+	ret0, _ := ret[0].(links.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockRepositoryMockRecorder) CreateAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockRepository)(nil).CreateAPIKey), ctx, key)
+}
+
+// CreateIdempotencyKey mocks base method.
+func (m *MockRepository) CreateIdempotencyKey(ctx context.Context, key links.IdempotencyKey) (links.IdempotencyKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateIdempotencyKey", ctx, key)
+	ret0, _ := ret[0].(links.IdempotencyKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateIdempotencyKey indicates an expected call of CreateIdempotencyKey.
+func (mr *MockRepositoryMockRecorder) CreateIdempotencyKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateIdempotencyKey", reflect.TypeOf((*MockRepository)(nil).CreateIdempotencyKey), ctx, key)
+}
+
 // CreateLinksJob mocks base method.
 func (m *MockRepository) CreateLinksJob(ctx context.Context, job links.Job) (links.Job, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +109,63 @@ func (mr *MockRepositoryMockRecorder) CreateLinksJobResult(ctx, results interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLinksJobResult", reflect.TypeOf((*MockRepository)(nil).CreateLinksJobResult), ctx, results)
 }
 
+// CreateLinksJobWithinQuota mocks base method.
+func (m *MockRepository) CreateLinksJobWithinQuota(ctx context.Context, job links.Job, quota links.TenantQuota) (links.Job, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateLinksJobWithinQuota", ctx, job, quota)
+	ret0, _ := ret[0].(links.Job)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateLinksJobWithinQuota indicates an expected call of CreateLinksJobWithinQuota.
+func (mr *MockRepositoryMockRecorder) CreateLinksJobWithinQuota(ctx, job, quota interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateLinksJobWithinQuota", reflect.TypeOf((*MockRepository)(nil).CreateLinksJobWithinQuota), ctx, job, quota)
+}
+
+// CreateWebhookDelivery mocks base method.
+func (m *MockRepository) CreateWebhookDelivery(ctx context.Context, delivery links.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhookDelivery", ctx, delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWebhookDelivery indicates an expected call of CreateWebhookDelivery.
+func (mr *MockRepositoryMockRecorder) CreateWebhookDelivery(ctx, delivery interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhookDelivery", reflect.TypeOf((*MockRepository)(nil).CreateWebhookDelivery), ctx, delivery)
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *MockRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockRepositoryMockRecorder) DeleteIdempotencyKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*MockRepository)(nil).DeleteIdempotencyKey), ctx, key)
+}
+
+// FailLinksJob mocks base method.
+func (m *MockRepository) FailLinksJob(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailLinksJob", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailLinksJob indicates an expected call of FailLinksJob.
+func (mr *MockRepositoryMockRecorder) FailLinksJob(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailLinksJob", reflect.TypeOf((*MockRepository)(nil).FailLinksJob), ctx, jobID)
+}
+
 // FinishLinksJob mocks base method.
 func (m *MockRepository) FinishLinksJob(ctx context.Context, jobID string) error {
 	m.ctrl.T.Helper()
@@ -78,6 +180,36 @@ func (mr *MockRepositoryMockRecorder) FinishLinksJob(ctx, jobID interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FinishLinksJob", reflect.TypeOf((*MockRepository)(nil).FinishLinksJob), ctx, jobID)
 }
 
+// GetAPIKeyByHash mocks base method.
+func (m *MockRepository) GetAPIKeyByHash(ctx context.Context, hash string) (links.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAPIKeyByHash", ctx, hash)
+	ret0, _ := ret[0].(links.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAPIKeyByHash indicates an expected call of GetAPIKeyByHash.
+func (mr *MockRepositoryMockRecorder) GetAPIKeyByHash(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAPIKeyByHash", reflect.TypeOf((*MockRepository)(nil).GetAPIKeyByHash), ctx, hash)
+}
+
+// GetCircuitBreakerSnapshots mocks base method.
+func (m *MockRepository) GetCircuitBreakerSnapshots(ctx context.Context, since time.Time) ([]links.CircuitBreakerSnapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCircuitBreakerSnapshots", ctx, since)
+	ret0, _ := ret[0].([]links.CircuitBreakerSnapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCircuitBreakerSnapshots indicates an expected call of GetCircuitBreakerSnapshots.
+func (mr *MockRepositoryMockRecorder) GetCircuitBreakerSnapshots(ctx, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCircuitBreakerSnapshots", reflect.TypeOf((*MockRepository)(nil).GetCircuitBreakerSnapshots), ctx, since)
+}
+
 // GetLinksJob mocks base method.
 func (m *MockRepository) GetLinksJob(ctx context.Context, jobID string) (links.Job, error) {
 	m.ctrl.T.Helper()
@@ -107,3 +239,105 @@ func (mr *MockRepositoryMockRecorder) GetLinksJobResult(ctx, jobID interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinksJobResult", reflect.TypeOf((*MockRepository)(nil).GetLinksJobResult), ctx, jobID)
 }
+
+// GetLinksJobResultsAfter mocks base method.
+func (m *MockRepository) GetLinksJobResultsAfter(ctx context.Context, jobID string, cursor int64) ([]links.JobResult, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinksJobResultsAfter", ctx, jobID, cursor)
+	ret0, _ := ret[0].([]links.JobResult)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLinksJobResultsAfter indicates an expected call of GetLinksJobResultsAfter.
+func (mr *MockRepositoryMockRecorder) GetLinksJobResultsAfter(ctx, jobID, cursor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinksJobResultsAfter", reflect.TypeOf((*MockRepository)(nil).GetLinksJobResultsAfter), ctx, jobID, cursor)
+}
+
+// GetTenantUsage mocks base method.
+func (m *MockRepository) GetTenantUsage(ctx context.Context, tenant string, since time.Time) (links.TenantUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenantUsage", ctx, tenant, since)
+	ret0, _ := ret[0].(links.TenantUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTenantUsage indicates an expected call of GetTenantUsage.
+func (mr *MockRepositoryMockRecorder) GetTenantUsage(ctx, tenant, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenantUsage", reflect.TypeOf((*MockRepository)(nil).GetTenantUsage), ctx, tenant, since)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockRepository) GetWebhookDeliveries(ctx context.Context, jobID string) ([]links.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", ctx, jobID)
+	ret0, _ := ret[0].([]links.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockRepositoryMockRecorder) GetWebhookDeliveries(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockRepository)(nil).GetWebhookDeliveries), ctx, jobID)
+}
+
+// IterateLinksJobResults mocks base method.
+func (m *MockRepository) IterateLinksJobResults(ctx context.Context, jobID string, fn func(links.JobResult) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IterateLinksJobResults", ctx, jobID, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IterateLinksJobResults indicates an expected call of IterateLinksJobResults.
+func (mr *MockRepositoryMockRecorder) IterateLinksJobResults(ctx, jobID, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IterateLinksJobResults", reflect.TypeOf((*MockRepository)(nil).IterateLinksJobResults), ctx, jobID, fn)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockRepository) RevokeAPIKey(ctx context.Context, keyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, keyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockRepositoryMockRecorder) RevokeAPIKey(ctx, keyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockRepository)(nil).RevokeAPIKey), ctx, keyID)
+}
+
+// SaveCircuitBreakerSnapshot mocks base method.
+func (m *MockRepository) SaveCircuitBreakerSnapshot(ctx context.Context, snapshot links.CircuitBreakerSnapshot) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCircuitBreakerSnapshot", ctx, snapshot)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCircuitBreakerSnapshot indicates an expected call of SaveCircuitBreakerSnapshot.
+func (mr *MockRepositoryMockRecorder) SaveCircuitBreakerSnapshot(ctx, snapshot interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCircuitBreakerSnapshot", reflect.TypeOf((*MockRepository)(nil).SaveCircuitBreakerSnapshot), ctx, snapshot)
+}
+
+// StartLinksJob mocks base method.
+func (m *MockRepository) StartLinksJob(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartLinksJob", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StartLinksJob indicates an expected call of StartLinksJob.
+func (mr *MockRepositoryMockRecorder) StartLinksJob(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartLinksJob", reflect.TypeOf((*MockRepository)(nil).StartLinksJob), ctx, jobID)
+}
@@ -35,6 +35,36 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
+// AuthenticateAPIKey mocks base method.
+func (m *MockService) AuthenticateAPIKey(ctx context.Context, key string) (links.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AuthenticateAPIKey", ctx, key)
+	ret0, _ := ret[0].(links.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AuthenticateAPIKey indicates an expected call of AuthenticateAPIKey.
+func (mr *MockServiceMockRecorder) AuthenticateAPIKey(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthenticateAPIKey", reflect.TypeOf((*MockService)(nil).AuthenticateAPIKey), ctx, key)
+}
+
+// CreateAPIKey mocks base method.
+func (m *MockService) CreateAPIKey(ctx context.Context, req links.CreateAPIKeyRequest) (links.CreateAPIKeyResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAPIKey", ctx, req)
+	ret0, _ := ret[0].(links.CreateAPIKeyResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateAPIKey indicates an expected call of CreateAPIKey.
+func (mr *MockServiceMockRecorder) CreateAPIKey(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAPIKey", reflect.TypeOf((*MockService)(nil).CreateAPIKey), ctx, req)
+}
+
 // EnqueueLinksJob mocks base method.
 func (m *MockService) EnqueueLinksJob(ctx context.Context, req links.EnqueueLinksJobRequest) (links.Job, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +94,49 @@ func (mr *MockServiceMockRecorder) ExecuteLinksJob(ctx, jobID interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteLinksJob", reflect.TypeOf((*MockService)(nil).ExecuteLinksJob), ctx, jobID)
 }
 
+// ExportLinksJobResults mocks base method.
+func (m *MockService) ExportLinksJobResults(ctx context.Context, req links.GetJobStatusRequest, fn func(links.JobResult) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportLinksJobResults", ctx, req, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportLinksJobResults indicates an expected call of ExportLinksJobResults.
+func (mr *MockServiceMockRecorder) ExportLinksJobResults(ctx, req, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportLinksJobResults", reflect.TypeOf((*MockService)(nil).ExportLinksJobResults), ctx, req, fn)
+}
+
+// FailLinksJob mocks base method.
+func (m *MockService) FailLinksJob(ctx context.Context, jobID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FailLinksJob", ctx, jobID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// FailLinksJob indicates an expected call of FailLinksJob.
+func (mr *MockServiceMockRecorder) FailLinksJob(ctx, jobID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FailLinksJob", reflect.TypeOf((*MockService)(nil).FailLinksJob), ctx, jobID)
+}
+
+// GetCircuitBreakers mocks base method.
+func (m *MockService) GetCircuitBreakers(ctx context.Context) ([]links.CircuitBreaker, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCircuitBreakers", ctx)
+	ret0, _ := ret[0].([]links.CircuitBreaker)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCircuitBreakers indicates an expected call of GetCircuitBreakers.
+func (mr *MockServiceMockRecorder) GetCircuitBreakers(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCircuitBreakers", reflect.TypeOf((*MockService)(nil).GetCircuitBreakers), ctx)
+}
+
 // GetLinksJobStatus mocks base method.
 func (m *MockService) GetLinksJobStatus(ctx context.Context, req links.GetJobStatusRequest) ([]links.JobResult, error) {
 	m.ctrl.T.Helper()
@@ -78,3 +151,76 @@ func (mr *MockServiceMockRecorder) GetLinksJobStatus(ctx, req interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinksJobStatus", reflect.TypeOf((*MockService)(nil).GetLinksJobStatus), ctx, req)
 }
+
+// GetQuotaUsage mocks base method.
+func (m *MockService) GetQuotaUsage(ctx context.Context) (links.QuotaUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuotaUsage", ctx)
+	ret0, _ := ret[0].(links.QuotaUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuotaUsage indicates an expected call of GetQuotaUsage.
+func (mr *MockServiceMockRecorder) GetQuotaUsage(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaUsage", reflect.TypeOf((*MockService)(nil).GetQuotaUsage), ctx)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockService) GetWebhookDeliveries(ctx context.Context, req links.GetJobStatusRequest) ([]links.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", ctx, req)
+	ret0, _ := ret[0].([]links.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockServiceMockRecorder) GetWebhookDeliveries(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockService)(nil).GetWebhookDeliveries), ctx, req)
+}
+
+// PublishCircuitBreakers mocks base method.
+func (m *MockService) PublishCircuitBreakers(ctx context.Context, process string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublishCircuitBreakers", ctx, process)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PublishCircuitBreakers indicates an expected call of PublishCircuitBreakers.
+func (mr *MockServiceMockRecorder) PublishCircuitBreakers(ctx, process interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublishCircuitBreakers", reflect.TypeOf((*MockService)(nil).PublishCircuitBreakers), ctx, process)
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockService) RevokeAPIKey(ctx context.Context, keyID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", ctx, keyID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockServiceMockRecorder) RevokeAPIKey(ctx, keyID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockService)(nil).RevokeAPIKey), ctx, keyID)
+}
+
+// SubscribeLinksJobEvents mocks base method.
+func (m *MockService) SubscribeLinksJobEvents(ctx context.Context, req links.SubscribeJobEventsRequest) (<-chan links.JobEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SubscribeLinksJobEvents", ctx, req)
+	ret0, _ := ret[0].(<-chan links.JobEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscribeLinksJobEvents indicates an expected call of SubscribeLinksJobEvents.
+func (mr *MockServiceMockRecorder) SubscribeLinksJobEvents(ctx, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeLinksJobEvents", reflect.TypeOf((*MockService)(nil).SubscribeLinksJobEvents), ctx, req)
+}
@@ -0,0 +1,12 @@
+package links
+
+//go:generate mockgen -source=notifier.go -destination=mock/notifier_mocks.go -package mock
+
+// Notifier - signals the subscribers of a job that it changed. The signal carries no data, subscribers read
+// the changes from the repository, so wake ups that come in while one is pending are coalesced into it
+type Notifier interface {
+	Notify(jobID string)
+	// Subscribe - the returned func has to be called to release the subscription
+	Subscribe(jobID string) (<-chan struct{}, func())
+	Close() error
+}
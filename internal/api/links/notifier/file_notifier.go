@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/google/uuid"
+)
+
+const (
+	pipeSuffix   = ".fifo"
+	writeTimeout = time.Second
+)
+
+// fileNotifier signals the subscribers of every process sharing a directory. Each process reads its own named pipe
+// in the directory, notifications are written to the pipes of the other processes, so subscribers are woken up as soon
+// as a job changes instead of polling for it. Named pipes only reach the processes of the same host
+type fileNotifier struct {
+	dir   string
+	name  string // pipe of this process
+	pipe  *os.File
+	local *localNotifier
+	done  chan struct{}
+}
+
+// NewFileNotifier - creates a notifier listening on a pipe in dir, the directory is created if it doesn't exist.
+// Close has to be called to remove the pipe
+func NewFileNotifier(dir string) (links.Notifier, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifier directory %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s%s", os.Getpid(), uuid.NewString(), pipeSuffix)
+	tmp := filepath.Join(dir, "."+name)
+
+	err = syscall.Mkfifo(tmp, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifier pipe %w", err)
+	}
+
+	pipe, err := os.OpenFile(tmp, os.O_RDWR, 0) // opened for writing too, so reads don't end while no other process writes
+	if err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to open notifier pipe %w", err)
+	}
+
+	// the pipe is only published once it is read, writers remove the pipes nobody reads
+	err = os.Rename(tmp, filepath.Join(dir, name))
+	if err != nil {
+		pipe.Close()
+		os.Remove(tmp)
+		return nil, fmt.Errorf("failed to publish notifier pipe %w", err)
+	}
+
+	n := &fileNotifier{dir: dir, name: name, pipe: pipe, local: newLocal(), done: make(chan struct{})}
+	go n.listen()
+
+	return n, nil
+}
+
+// listen wakes up the local subscribers of the jobs the other processes notified about, until the pipe is closed
+func (n *fileNotifier) listen() {
+	defer close(n.done)
+
+	scanner := bufio.NewScanner(n.pipe)
+	for scanner.Scan() {
+		jobID, err := hex.DecodeString(scanner.Text())
+		if err != nil {
+			log.Println("failed to decode job notification", err)
+			continue
+		}
+
+		n.local.Notify(string(jobID))
+	}
+
+	err := scanner.Err()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		log.Println("failed to read job notifications", err)
+	}
+}
+
+func (n *fileNotifier) Subscribe(jobID string) (<-chan struct{}, func()) {
+	return n.local.Subscribe(jobID)
+}
+
+// Notify wakes up the subscribers of this and the other processes, failures are logged,
+// the subscribers of a process that misses a notification are woken up by the next one
+func (n *fileNotifier) Notify(jobID string) {
+	n.local.Notify(jobID)
+
+	entries, err := os.ReadDir(n.dir)
+	if err != nil {
+		log.Println("failed to list notifier pipes", err)
+		return
+	}
+
+	// job ids are hex encoded so they can't contain the separator, lines stay below PIPE_BUF and aren't interleaved
+	line := []byte(hex.EncodeToString([]byte(jobID)) + "\n")
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == n.name || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, pipeSuffix) {
+			continue
+		}
+
+		err = n.write(filepath.Join(n.dir, name), line)
+		if err != nil {
+			log.Println("failed to notify", name, err)
+		}
+	}
+}
+
+// write writes line to the pipe at path, pipes of processes that stopped without removing them are removed
+func (n *fileNotifier) write(path string, line []byte) error {
+	pipe, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) { // nobody reads it
+		os.Remove(path)
+		return nil
+	}
+	if errors.Is(err, os.ErrNotExist) { // the process stopped since the pipes were listed
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer pipe.Close()
+
+	err = pipe.SetWriteDeadline(time.Now().Add(writeTimeout)) // the pipe is full, its reader is stuck
+	if err != nil {
+		return err
+	}
+
+	_, err = pipe.Write(line)
+	return err
+}
+
+// Close stops listening and removes the pipe of this process
+func (n *fileNotifier) Close() error {
+	err := os.Remove(filepath.Join(n.dir, n.name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove notifier pipe %w", err)
+	}
+
+	err = n.pipe.Close()
+	<-n.done
+	if err != nil {
+		return fmt.Errorf("failed to close notifier pipe %w", err)
+	}
+
+	return nil
+}
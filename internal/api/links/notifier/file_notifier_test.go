@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileNotifierHelper(t *testing.T, dir string) links.Notifier {
+	t.Helper()
+	n, err := NewFileNotifier(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		n.Close()
+	})
+	return n
+}
+
+func woken(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(time.Second):
+		return false
+	}
+}
+
+func TestLocal(t *testing.T) {
+	t.Parallel()
+	n := NewLocal()
+	changed, unsubscribe := n.Subscribe("job")
+	other, unsubscribeOther := n.Subscribe("other")
+	defer unsubscribeOther()
+
+	n.Notify("job")
+	n.Notify("job") // coalesced into the pending wake up
+	assert.True(t, woken(changed))
+	select {
+	case <-changed:
+		t.Error("woken up twice")
+	case <-other:
+		t.Error("other job woken up")
+	default:
+	}
+
+	unsubscribe()
+	n.Notify("job") // no subscribers left, nothing to block on
+}
+
+func TestFileNotifier(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully notify other processes", func(t *testing.T) {
+		dir := t.TempDir()
+		api, worker := fileNotifierHelper(t, dir), fileNotifierHelper(t, dir)
+
+		changed, unsubscribe := api.Subscribe("acme/job\n1")
+		defer unsubscribe()
+		local, unsubscribeLocal := worker.Subscribe("acme/job\n1")
+		defer unsubscribeLocal()
+
+		worker.Notify("acme/job\n1")
+		assert.True(t, woken(changed))
+		assert.True(t, woken(local))
+	})
+	t.Run("remove pipes nobody reads", func(t *testing.T) {
+		dir := t.TempDir()
+		n := fileNotifierHelper(t, dir)
+		stale := filepath.Join(dir, "1-stale"+pipeSuffix)
+		assert.NoError(t, syscall.Mkfifo(stale, 0o600))
+
+		n.Notify("job")
+		_, err := os.Stat(stale)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+	t.Run("close removes the pipe", func(t *testing.T) {
+		dir := t.TempDir()
+		n, err := NewFileNotifier(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, n.Close())
+
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		fileNotifierHelper(t, dir).Notify("job") // nobody to notify
+	})
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"sync"
+
+	"github.com/buni/scraper/internal/api/links"
+)
+
+// localNotifier signals subscribers in this process
+type localNotifier struct {
+	mu          *sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+// NewLocal - notifier for jobs that are executed in the process of their subscribers
+func NewLocal() links.Notifier {
+	return newLocal()
+}
+
+func newLocal() *localNotifier {
+	return &localNotifier{mu: &sync.Mutex{}, subscribers: map[string]map[chan struct{}]struct{}{}}
+}
+
+// Subscribe - the returned func has to be called to release the subscription
+func (n *localNotifier) Subscribe(jobID string) (<-chan struct{}, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if n.subscribers[jobID] == nil {
+		n.subscribers[jobID] = map[chan struct{}]struct{}{}
+	}
+	n.subscribers[jobID][ch] = struct{}{}
+
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		delete(n.subscribers[jobID], ch)
+		if len(n.subscribers[jobID]) == 0 {
+			delete(n.subscribers, jobID)
+		}
+	}
+}
+
+func (n *localNotifier) Notify(jobID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for ch := range n.subscribers[jobID] {
+		select {
+		case ch <- struct{}{}:
+		default: // a wake up is already pending
+		}
+	}
+}
+
+func (n *localNotifier) Close() error {
+	return nil
+}
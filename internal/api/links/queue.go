@@ -0,0 +1,19 @@
+package links
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMessageLost - the lease of a message expired and it was handed to another consumer
+var ErrMessageLost = errors.New("queue message lease lost")
+
+//go:generate mockgen -source=queue.go -destination=mock/queue_mocks.go -package mock
+
+// Queue - jobs queue shared between the api and the workers
+type Queue interface {
+	Enqueue(ctx context.Context, jobID string) error
+	Dequeue(ctx context.Context) (QueueMessage, error)
+	Extend(ctx context.Context, msg QueueMessage) (QueueMessage, error)
+	Ack(ctx context.Context, msg QueueMessage) error
+}
@@ -0,0 +1,267 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMessageLost         = links.ErrMessageLost
+	ErrBadLeaseDuration    = errors.New("bad lease duration value")
+	ErrBadPollInterval     = errors.New("bad poll interval value")
+	errMalformedClaimEntry = errors.New("malformed claimed queue entry")
+)
+
+const (
+	pendingDir = "pending"
+	claimedDir = "claimed"
+	tmpDir     = "tmp"
+)
+
+// fileQueue is a queue backed by a directory, it is safe to use from multiple processes sharing the same directory.
+// Every state transition is a rename, which is atomic, so only one consumer can claim a given entry.
+// Claimed entries carry their lease deadline in the file name: <enqueued at>-<id>.<lease deadline>, and entries that were
+// delivered before carry their delivery count: <enqueued at>-<id>_<deliveries>
+type fileQueue struct {
+	dir           string
+	leaseDuration time.Duration
+	pollInterval  time.Duration
+}
+
+type FileQueueOption func(q *fileQueue) error
+
+// WithLeaseDuration sets for how long a dequeued message is hidden from other consumers
+func WithLeaseDuration(d time.Duration) FileQueueOption {
+	return func(q *fileQueue) error {
+		if d <= 0 {
+			return ErrBadLeaseDuration
+		}
+		q.leaseDuration = d
+		return nil
+	}
+}
+
+// WithPollInterval sets how often Dequeue checks for new messages when the queue is empty
+func WithPollInterval(d time.Duration) FileQueueOption {
+	return func(q *fileQueue) error {
+		if d <= 0 {
+			return ErrBadPollInterval
+		}
+		q.pollInterval = d
+		return nil
+	}
+}
+
+// NewFileQueue - creates a queue rooted at dir, the directory is created if it doesn't exist
+func NewFileQueue(dir string, options ...FileQueueOption) (links.Queue, error) {
+	q := &fileQueue{dir: dir, leaseDuration: time.Second * 30, pollInterval: time.Millisecond * 500}
+
+	for _, option := range options {
+		err := option(q)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply queue option %w", err)
+		}
+	}
+
+	for _, sub := range []string{pendingDir, claimedDir, tmpDir} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create queue directory %w", err)
+		}
+	}
+
+	return q, nil
+}
+
+// Enqueue - add job to the queue
+// the entry is written to a temp file first so consumers never see partial writes
+func (q *fileQueue) Enqueue(ctx context.Context, jobID string) error {
+	name := fmt.Sprintf("%020d-%s", time.Now().UTC().UnixNano(), uuid.NewString())
+
+	tmp := filepath.Join(q.dir, tmpDir, name)
+	err := os.WriteFile(tmp, []byte(jobID), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write queue entry %w", err)
+	}
+
+	err = os.Rename(tmp, filepath.Join(q.dir, pendingDir, name))
+	if err != nil {
+		return fmt.Errorf("failed to publish queue entry %w", err)
+	}
+
+	return nil
+}
+
+// Dequeue - claims the oldest pending message
+// blocks until a message is available or the context is done
+func (q *fileQueue) Dequeue(ctx context.Context) (links.QueueMessage, error) {
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		msg, ok, err := q.claim()
+		if err != nil {
+			return links.QueueMessage{}, err
+		}
+
+		if ok {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return links.QueueMessage{}, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Extend - pushes back the lease deadline of a claimed message
+// returns ErrMessageLost if the lease already expired and the message was requeued
+func (q *fileQueue) Extend(ctx context.Context, msg links.QueueMessage) (links.QueueMessage, error) {
+	leaseExpiresAt := time.Now().UTC().Add(q.leaseDuration)
+
+	err := os.Rename(q.claimedPath(msg.ID, msg.LeaseExpiresAt), q.claimedPath(msg.ID, leaseExpiresAt))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return links.QueueMessage{}, ErrMessageLost
+		}
+		return links.QueueMessage{}, fmt.Errorf("failed to extend queue message lease %w", err)
+	}
+
+	msg.LeaseExpiresAt = leaseExpiresAt
+
+	return msg, nil
+}
+
+// Ack - removes a claimed message from the queue
+func (q *fileQueue) Ack(ctx context.Context, msg links.QueueMessage) error {
+	err := os.Remove(q.claimedPath(msg.ID, msg.LeaseExpiresAt))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrMessageLost
+		}
+		return fmt.Errorf("failed to ack queue message %w", err)
+	}
+
+	return nil
+}
+
+func (q *fileQueue) claim() (links.QueueMessage, bool, error) {
+	err := q.requeueExpired()
+	if err != nil {
+		return links.QueueMessage{}, false, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(q.dir, pendingDir))
+	if err != nil {
+		return links.QueueMessage{}, false, fmt.Errorf("failed to list pending queue entries %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() }) // names are prefixed with a zero padded timestamp
+
+	for _, entry := range entries {
+		leaseExpiresAt := time.Now().UTC().Add(q.leaseDuration)
+		claimed := q.claimedPath(entry.Name(), leaseExpiresAt)
+
+		err = os.Rename(filepath.Join(q.dir, pendingDir, entry.Name()), claimed)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) { // another consumer was faster
+				continue
+			}
+			return links.QueueMessage{}, false, fmt.Errorf("failed to claim queue entry %w", err)
+		}
+
+		jobID, err := os.ReadFile(claimed)
+		if err != nil {
+			return links.QueueMessage{}, false, fmt.Errorf("failed to read queue entry %w", err)
+		}
+
+		_, deliveries := parsePendingName(entry.Name())
+
+		return links.QueueMessage{ID: entry.Name(), JobID: string(jobID), LeaseExpiresAt: leaseExpiresAt, Attempt: deliveries + 1}, true, nil
+	}
+
+	return links.QueueMessage{}, false, nil
+}
+
+// requeueExpired moves claimed messages with an expired lease back to pending
+// so jobs owned by crashed consumers are eventually picked up by someone else
+func (q *fileQueue) requeueExpired() error {
+	entries, err := os.ReadDir(filepath.Join(q.dir, claimedDir))
+	if err != nil {
+		return fmt.Errorf("failed to list claimed queue entries %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	for _, entry := range entries {
+		id, leaseExpiresAt, err := parseClaimedName(entry.Name())
+		if err != nil {
+			continue // not ours, leave it alone
+		}
+
+		if leaseExpiresAt.After(now) {
+			continue
+		}
+
+		base, deliveries := parsePendingName(id)
+		err = os.Rename(filepath.Join(q.dir, claimedDir, entry.Name()), filepath.Join(q.dir, pendingDir, pendingName(base, deliveries+1)))
+		if err != nil && !errors.Is(err, os.ErrNotExist) { // not exist means the owner acked/extended it or another consumer requeued it
+			return fmt.Errorf("failed to requeue expired queue entry %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (q *fileQueue) claimedPath(id string, leaseExpiresAt time.Time) string {
+	return filepath.Join(q.dir, claimedDir, id+"."+strconv.FormatInt(leaseExpiresAt.UnixNano(), 10))
+}
+
+// parsePendingName - name of the entry before its first delivery and how many times it was delivered
+func parsePendingName(name string) (base string, deliveries int) {
+	i := strings.LastIndexByte(name, '_')
+	if i < 0 {
+		return name, 0
+	}
+
+	deliveries, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return name, 0
+	}
+
+	return name[:i], deliveries
+}
+
+func pendingName(base string, deliveries int) string {
+	if deliveries == 0 {
+		return base
+	}
+
+	return base + "_" + strconv.Itoa(deliveries)
+}
+
+func parseClaimedName(name string) (id string, leaseExpiresAt time.Time, err error) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 {
+		return "", time.Time{}, errMalformedClaimEntry
+	}
+
+	deadline, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, errMalformedClaimEntry
+	}
+
+	return name[:i], time.Unix(0, deadline).UTC(), nil
+}
@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileQueue(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully enqueue, dequeue and ack in order", func(t *testing.T) {
+		q, err := NewFileQueue(t.TempDir())
+		assert.NoError(t, err)
+
+		for _, jobID := range []string{"1", "2", "3"} {
+			assert.NoError(t, q.Enqueue(context.Background(), jobID))
+		}
+
+		for _, wantJobID := range []string{"1", "2", "3"} {
+			msg, err := q.Dequeue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, wantJobID, msg.JobID)
+			assert.NoError(t, q.Ack(context.Background(), msg))
+		}
+	})
+	t.Run("dequeue blocks until context is done", func(t *testing.T) {
+		q, err := NewFileQueue(t.TempDir(), WithPollInterval(time.Millisecond))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		_, err = q.Dequeue(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("expired lease is handed to another consumer", func(t *testing.T) {
+		dir := t.TempDir()
+		first, err := NewFileQueue(dir, WithLeaseDuration(time.Millisecond*10), WithPollInterval(time.Millisecond))
+		assert.NoError(t, err)
+		second, err := NewFileQueue(dir, WithLeaseDuration(time.Minute), WithPollInterval(time.Millisecond))
+		assert.NoError(t, err)
+
+		assert.NoError(t, first.Enqueue(context.Background(), "1"))
+		lost, err := first.Dequeue(context.Background())
+		assert.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 20)
+		msg, err := second.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "1", msg.JobID)
+
+		assert.ErrorIs(t, first.Ack(context.Background(), lost), ErrMessageLost)
+		_, err = first.Extend(context.Background(), lost)
+		assert.ErrorIs(t, err, ErrMessageLost)
+		assert.NoError(t, second.Ack(context.Background(), msg))
+	})
+	t.Run("only readable by the owner", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "queue")
+		q, err := NewFileQueue(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, q.Enqueue(context.Background(), "1"))
+
+		assert.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			assert.NoError(t, err)
+			info, err := d.Info()
+			assert.NoError(t, err)
+			assert.Zero(t, info.Mode().Perm()&0o077, path)
+			return nil
+		}))
+	})
+	t.Run("redeliveries count the attempts", func(t *testing.T) {
+		q, err := NewFileQueue(t.TempDir(), WithLeaseDuration(time.Millisecond*10), WithPollInterval(time.Millisecond))
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Enqueue(context.Background(), "1"))
+		for attempt := 1; attempt <= 3; attempt++ {
+			msg, err := q.Dequeue(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "1", msg.JobID)
+			assert.Equal(t, attempt, msg.Attempt)
+			time.Sleep(time.Millisecond * 20) // not acked, the lease runs out
+		}
+
+		msg, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 4, msg.Attempt)
+		msg, err = q.Extend(context.Background(), msg)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, msg.Attempt)
+		assert.NoError(t, q.Ack(context.Background(), msg))
+	})
+	t.Run("extend keeps the message claimed", func(t *testing.T) {
+		q, err := NewFileQueue(t.TempDir(), WithLeaseDuration(time.Millisecond*50), WithPollInterval(time.Millisecond))
+		assert.NoError(t, err)
+
+		assert.NoError(t, q.Enqueue(context.Background(), "1"))
+		msg, err := q.Dequeue(context.Background())
+		assert.NoError(t, err)
+
+		time.Sleep(time.Millisecond * 30)
+		msg, err = q.Extend(context.Background(), msg)
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond * 30)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+		defer cancel()
+		_, err = q.Dequeue(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoError(t, q.Ack(context.Background(), msg))
+	})
+	t.Run("every message is claimed exactly once by concurrent consumers", func(t *testing.T) {
+		dir := t.TempDir()
+		producer, err := NewFileQueue(dir)
+		assert.NoError(t, err)
+		for i := 0; i < 50; i++ {
+			assert.NoError(t, producer.Enqueue(context.Background(), "job"))
+		}
+
+		mu := &sync.Mutex{}
+		claimed := map[string]int{}
+		wg := &sync.WaitGroup{}
+		for i := 0; i < 4; i++ {
+			consumer, err := NewFileQueue(dir, WithPollInterval(time.Millisecond))
+			assert.NoError(t, err)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+					msg, err := consumer.Dequeue(ctx)
+					cancel()
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					claimed[msg.ID]++
+					mu.Unlock()
+					assert.NoError(t, consumer.Ack(context.Background(), msg))
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, claimed, 50)
+		for id, count := range claimed {
+			assert.Equal(t, 1, count, id)
+		}
+	})
+	t.Run("bad options", func(t *testing.T) {
+		_, err := NewFileQueue(t.TempDir(), WithLeaseDuration(0))
+		assert.ErrorIs(t, err, ErrBadLeaseDuration)
+		_, err = NewFileQueue(t.TempDir(), WithPollInterval(-1))
+		assert.ErrorIs(t, err, ErrBadPollInterval)
+	})
+}
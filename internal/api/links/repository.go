@@ -1,15 +1,33 @@
 package links
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 //go:generate mockgen -source=repository.go -destination=mock/repository_mocks.go -package mock
 
 // Repository
 type Repository interface {
 	CreateLinksJob(ctx context.Context, job Job) (Job, error)
+	CreateLinksJobWithinQuota(ctx context.Context, job Job, quota TenantQuota) (Job, error)
+	StartLinksJob(ctx context.Context, jobID string) error
 	FinishLinksJob(ctx context.Context, jobID string) error
+	FailLinksJob(ctx context.Context, jobID string) error
+	CompleteLinksJobWebhook(ctx context.Context, jobID string) error
 	CreateLinksJobResult(ctx context.Context, results []JobResult) error
 	GetLinksJobResult(ctx context.Context, jobID string) ([]JobResult, error)
+	IterateLinksJobResults(ctx context.Context, jobID string, fn func(result JobResult) error) error
+	GetLinksJobResultsAfter(ctx context.Context, jobID string, cursor int64) ([]JobResult, int64, error)
 	GetLinksJob(ctx context.Context, jobID string) (Job, error)
-	
+	CreateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, jobID string) ([]WebhookDelivery, error)
+	CreateIdempotencyKey(ctx context.Context, key IdempotencyKey) (IdempotencyKey, error)
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	CreateAPIKey(ctx context.Context, key APIKey) (APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+	RevokeAPIKey(ctx context.Context, keyID string) error
+	GetTenantUsage(ctx context.Context, tenant string, since time.Time) (TenantUsage, error)
+	SaveCircuitBreakerSnapshot(ctx context.Context, snapshot CircuitBreakerSnapshot) error
+	GetCircuitBreakerSnapshots(ctx context.Context, since time.Time) ([]CircuitBreakerSnapshot, error)
 }
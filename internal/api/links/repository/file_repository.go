@@ -0,0 +1,1116 @@
+package repository
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	jobsDir       = "jobs"
+	resultsDir    = "results"
+	deliveriesDir = "deliveries"
+	keysDir       = "idempotency"
+	apiKeysDir    = "apikeys"
+	usageDir      = "usage"
+	breakersDir   = "breakers"
+	lockFile      = ".lock"
+
+	keySweepInterval = time.Hour // how often expired idempotency keys are removed from disk
+)
+
+// fileRepository stores every record as a json file under dir
+// it is meant to be shared between the api and worker processes, so all
+// read-modify-write operations are serialized with an flock on dir/.lock
+type fileRepository struct {
+	dir     string
+	secrets cipher.AEAD // seals the secrets of jobs, nil without a secret key
+
+	sweepMu   sync.Mutex
+	lastSweep time.Time
+}
+
+// jobRecord - on disk representation of links.Job
+type jobRecord struct {
+	ID          string            `json:"id"`
+	Tenant      string            `json:"tenant,omitempty"`
+	URLs        []string          `json:"urls"`
+	Status      links.JobStatus   `json:"status"`
+	CallbackURL string            `json:"callback_url,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Options     links.JobOptions  `json:"options"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	FinishedAt  *time.Time        `json:"finished_at,omitempty"`
+
+	WebhookPending bool `json:"webhook_pending,omitempty"`
+}
+
+// tenantUsageRecord - quota counters of a tenant, kept up to date as its jobs are created and finished
+type tenantUsageRecord struct {
+	Day        time.Time `json:"day"`  // utc day the urls were counted on
+	URLs       int       `json:"urls"` // urls of the jobs created on day
+	ActiveJobs int       `json:"active_jobs"`
+}
+
+// jobResultRecord - on disk representation of links.JobResult
+type jobResultRecord struct {
+	ID                 string         `json:"id"`
+	JobID              string         `json:"job_id"`
+	Sequence           uint           `json:"sequence"`
+	PageURL            string         `json:"page_url"`
+	InternalLinksCount uint           `json:"internal_links_count"`
+	ExternalLinksCount uint           `json:"external_links_count"`
+	Success            bool           `json:"success"`
+	Error              string         `json:"error,omitempty"`
+	TLS                *links.TLSInfo `json:"tls,omitempty"`
+	FromCache          bool           `json:"from_cache,omitempty"`
+	ErrorCategory      string         `json:"error_category,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+}
+
+// NewFileRepository - creates a repository rooted at dir, the directory is created if it doesn't exist.
+// Everything is only readable by the owner, job options can carry credentials
+func NewFileRepository(dir string, options ...FileRepositoryOption) (links.Repository, error) {
+	r := &fileRepository{dir: dir}
+	for _, option := range options {
+		err := option(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply repository option %w", err)
+		}
+	}
+
+	for _, sub := range []string{jobsDir, resultsDir, deliveriesDir, keysDir, apiKeysDir, usageDir, breakersDir} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create repository directory %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// CreateLinksJob - creates new links job
+// if job id exists returns ErrJobAlreadyExists
+func (r *fileRepository) CreateLinksJob(ctx context.Context, job links.Job) (links.Job, error) {
+	return r.createLinksJob(job, nil)
+}
+
+// CreateLinksJobWithinQuota - CreateLinksJob if job fits in quota next to the other jobs of its tenant,
+// ErrURLQuotaExceeded or ErrJobQuotaExceeded otherwise. The check and the create happen under the same flock,
+// so api processes sharing the directory can't both fit a job in the last slot
+func (r *fileRepository) CreateLinksJobWithinQuota(ctx context.Context, job links.Job, quota links.TenantQuota) (links.Job, error) {
+	return r.createLinksJob(job, &quota)
+}
+
+func (r *fileRepository) createLinksJob(job links.Job, quota *links.TenantQuota) (links.Job, error) {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return links.Job{}, err
+	}
+	defer unlock()
+
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+
+	if job.UpdatedAt.IsZero() {
+		job.UpdatedAt = time.Now().UTC()
+	}
+
+	if job.ID == "" {
+		job.ID = uuid.NewString()
+	}
+
+	_, err = os.Stat(r.jobPath(job.ID))
+	if err == nil {
+		return links.Job{}, ErrJobAlreadyExists
+	}
+
+	usage, err := r.readTenantUsage(job.Tenant) // before the job is written, counters that are missing are counted from the jobs
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	if quota != nil {
+		current := links.TenantUsage{ActiveJobs: usage.ActiveJobs}
+		if !usageDay(time.Now()).After(usage.Day) {
+			current.URLs = usage.URLs
+		}
+
+		err = quota.Check(current, len(job.URLs))
+		if err != nil {
+			return links.Job{}, err
+		}
+	}
+
+	err = r.writeJob(job)
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	err = r.writeTenantUsage(job.Tenant, addJobUsage(usage, job))
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	return job, nil
+}
+
+// addJobUsage - usage with job counted
+func addJobUsage(usage tenantUsageRecord, job links.Job) tenantUsageRecord {
+	day := usageDay(job.CreatedAt)
+	if day.After(usage.Day) {
+		usage.Day, usage.URLs = day, 0
+	}
+	if day.Equal(usage.Day) {
+		usage.URLs += len(job.URLs)
+	}
+	if job.FinishedAt == nil {
+		usage.ActiveJobs++
+	}
+
+	return usage
+}
+
+// GetLinksJob - get links job by id
+// if it doesn't exists (or belongs to another tenant than the one of ctx) returns ErrJobNotFound
+func (r *fileRepository) GetLinksJob(ctx context.Context, jobID string) (links.Job, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return links.Job{}, err
+	}
+	defer unlock()
+
+	job, err := r.readJob(jobID)
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	if !tenant.Allowed(ctx, job.Tenant) {
+		return links.Job{}, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+// StartLinksJob - mark links job as running
+func (r *fileRepository) StartLinksJob(ctx context.Context, jobID string) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	job, err := r.readJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	job.Status = links.JobStatusRunning
+	job.UpdatedAt = time.Now().UTC()
+
+	return r.writeJob(job)
+}
+
+// FinishLinksJob - mark links job as finished
+func (r *fileRepository) FinishLinksJob(ctx context.Context, jobID string) error {
+	return r.finishLinksJob(jobID, links.JobStatusFinished)
+}
+
+// FailLinksJob - mark links job as failed
+func (r *fileRepository) FailLinksJob(ctx context.Context, jobID string) error {
+	return r.finishLinksJob(jobID, links.JobStatusFailed)
+}
+
+func (r *fileRepository) finishLinksJob(jobID string, status links.JobStatus) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	job, err := r.readJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	wasActive := job.FinishedAt == nil
+	finishedAt := time.Now().UTC()
+	job.Status = status
+	job.FinishedAt = &finishedAt
+	job.UpdatedAt = finishedAt
+
+	err = r.writeJob(stripJobSecrets(job))
+	if err != nil || !wasActive {
+		return err
+	}
+
+	usage, err := r.readTenantUsage(job.Tenant)
+	if err != nil {
+		return err
+	}
+	if usage.ActiveJobs > 0 {
+		usage.ActiveJobs--
+	}
+
+	return r.writeTenantUsage(job.Tenant, usage)
+}
+
+// CompleteLinksJobWebhook - marks the webhook of a job as delivered or given up on
+func (r *fileRepository) CompleteLinksJobWebhook(ctx context.Context, jobID string) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	job, err := r.readJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	job.WebhookPending = false
+	job.UpdatedAt = time.Now().UTC()
+
+	return r.writeJob(job)
+}
+
+// CreateLinksJobResult - create links job results
+// results are appended to a per job ndjson file, so storing results one by one stays cheap for big jobs
+func (r *fileRepository) CreateLinksJobResult(ctx context.Context, results []links.JobResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	files := map[string]*os.File{}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, result := range results {
+		path := r.resultsPath(result.JobID)
+		f, ok := files[path]
+		if !ok {
+			f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+			if err != nil {
+				return fmt.Errorf("failed to open results file %w", err)
+			}
+			files[path] = f
+		}
+
+		b, err := json.Marshal(toJobResultRecord(result))
+		if err != nil {
+			return fmt.Errorf("failed to marshal record %w", err)
+		}
+
+		_, err = f.Write(append(b, '\n'))
+		if err != nil {
+			return fmt.Errorf("failed to write record %w", err)
+		}
+	}
+
+	for _, f := range files {
+		err = f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write record %w", err)
+		}
+	}
+	files = nil
+
+	return nil
+}
+
+// GetLinksJobResult - get links job by job id
+// if it doesn't exists an error is returned, results of another tenant's job are reported as ErrJobNotFound
+func (r *fileRepository) GetLinksJobResult(ctx context.Context, jobID string) ([]links.JobResult, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = r.checkTenant(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(r.resultsPath(jobID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrJobResultsNotFound
+		}
+		return nil, fmt.Errorf("failed to open results file %w", err)
+	}
+	defer f.Close()
+
+	results := []links.JobResult{}
+	decoder := json.NewDecoder(f)
+
+	for {
+		record := jobResultRecord{}
+
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal record %w", err)
+		}
+
+		results = upsertJobResult(results, record.toJobResult())
+	}
+
+	return results, nil
+}
+
+// GetLinksJobResultsAfter - results stored after cursor (0 for all of them) and the cursor to pass next time,
+// the cursor is the offset in the results file so only the records appended since the last call are read.
+// A result that is stored again (e.g. by a redelivered job) shows up again with its sequence
+func (r *fileRepository) GetLinksJobResultsAfter(ctx context.Context, jobID string, cursor int64) ([]links.JobResult, int64, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer unlock()
+
+	err = r.checkTenant(ctx, jobID)
+	if err != nil {
+		return nil, cursor, err
+	}
+
+	f, err := os.Open(r.resultsPath(jobID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, cursor, ErrJobResultsNotFound
+		}
+		return nil, cursor, fmt.Errorf("failed to open results file %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Seek(cursor, io.SeekStart)
+	if err != nil {
+		return nil, cursor, fmt.Errorf("failed to seek results file %w", err)
+	}
+
+	results := []links.JobResult{}
+	decoder := json.NewDecoder(f)
+
+	for {
+		record := jobResultRecord{}
+
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, cursor, fmt.Errorf("failed to unmarshal record %w", err)
+		}
+
+		results = append(results, record.toJobResult())
+	}
+
+	return results, cursor + decoder.InputOffset(), nil
+}
+
+// IterateLinksJobResults - calls fn for every result of a job, in the same order GetLinksJobResult returns them
+// only the offsets of the records are collected under the lock, the file is append only so they stay valid
+// after it is released and a slow fn doesn't block writers
+func (r *fileRepository) IterateLinksJobResults(ctx context.Context, jobID string, fn func(result links.JobResult) error) error {
+	offsets, err := r.resultOffsets(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(r.resultsPath(jobID))
+	if err != nil {
+		return fmt.Errorf("failed to open results file %w", err)
+	}
+	defer f.Close()
+
+	var decoder *json.Decoder
+	var base int64
+
+	for _, offset := range offsets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if decoder == nil || base+decoder.InputOffset() != offset { // only seek if a record was replaced later in the file
+			_, err = f.Seek(offset, io.SeekStart)
+			if err != nil {
+				return fmt.Errorf("failed to seek results file %w", err)
+			}
+			decoder, base = json.NewDecoder(f), offset
+		}
+
+		record := jobResultRecord{}
+		err = decoder.Decode(&record)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal record %w", err)
+		}
+
+		err = fn(record.toJobResult())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resultOffsets - offsets of the result records that make up the job results, see upsertJobResult
+func (r *fileRepository) resultOffsets(ctx context.Context, jobID string) ([]int64, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	err = r.checkTenant(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(r.resultsPath(jobID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrJobResultsNotFound
+		}
+		return nil, fmt.Errorf("failed to open results file %w", err)
+	}
+	defer f.Close()
+
+	offsets := []int64{}
+	sequences := []uint{}
+	decoder := json.NewDecoder(f)
+
+	for {
+		offset := decoder.InputOffset()
+		record := struct {
+			Sequence uint `json:"sequence"`
+		}{}
+
+		err = decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal record %w", err)
+		}
+
+		seq := record.Sequence
+		if seq > 0 && int(seq) <= len(sequences) && sequences[seq-1] == seq {
+			offsets[seq-1] = offset
+			continue
+		}
+		offsets = append(offsets, offset)
+		sequences = append(sequences, seq)
+	}
+
+	return offsets, nil
+}
+
+// CreateWebhookDelivery - record a webhook delivery attempt
+func (r *fileRepository) CreateWebhookDelivery(ctx context.Context, delivery links.WebhookDelivery) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if delivery.ID == "" {
+		delivery.ID = uuid.NewString()
+	}
+
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now().UTC()
+	}
+
+	deliveries, err := r.readDeliveries(delivery.JobID)
+	if err != nil {
+		return err
+	}
+
+	return r.writeJSON(r.deliveriesPath(delivery.JobID), append(deliveries, delivery))
+}
+
+// GetWebhookDeliveries - get webhook delivery attempts of a job, oldest first
+func (r *fileRepository) GetWebhookDeliveries(ctx context.Context, jobID string) ([]links.WebhookDelivery, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return r.readDeliveries(jobID)
+}
+
+func (r *fileRepository) readDeliveries(jobID string) ([]links.WebhookDelivery, error) {
+	deliveries := []links.WebhookDelivery{}
+
+	err := r.readJSON(r.deliveriesPath(jobID), &deliveries)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *fileRepository) readJob(jobID string) (links.Job, error) {
+	record := jobRecord{}
+
+	err := r.readJSON(r.jobPath(jobID), &record)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return links.Job{}, ErrJobNotFound
+		}
+		return links.Job{}, err
+	}
+
+	job, err := record.toJob()
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	return r.openJob(job)
+}
+
+// writeJob - stores job with its secrets sealed, has to be called with the exclusive lock held
+func (r *fileRepository) writeJob(job links.Job) error {
+	sealed, err := r.sealJob(job)
+	if err != nil {
+		return err
+	}
+
+	return r.writeJSON(r.jobPath(job.ID), toJobRecord(sealed))
+}
+
+// checkTenant - ErrJobNotFound if ctx is scoped to a tenant that doesn't own the job, has to be called under the lock
+func (r *fileRepository) checkTenant(ctx context.Context, jobID string) error {
+	if _, scoped := tenant.FromContext(ctx); !scoped {
+		return nil
+	}
+
+	job, err := r.readJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	if !tenant.Allowed(ctx, job.Tenant) {
+		return ErrJobNotFound
+	}
+
+	return nil
+}
+
+// lock takes an flock on the repository lock file, the returned func releases it
+func (r *fileRepository) lock(how int) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(r.dir, lockFile), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository lock %w", err)
+	}
+
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to acquire repository lock %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// CreateIdempotencyKey - stores key, if an unexpired key with the same name exists it is returned with ErrIdempotencyKeyUsed
+// an expired key is overwritten, the ones that are never reused are swept every keySweepInterval
+func (r *fileRepository) CreateIdempotencyKey(ctx context.Context, key links.IdempotencyKey) (links.IdempotencyKey, error) {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return links.IdempotencyKey{}, err
+	}
+	defer unlock()
+
+	now := time.Now().UTC()
+	r.sweepKeys(now)
+
+	stored := links.IdempotencyKey{}
+	err = r.readJSON(r.keyPath(key.Key), &stored)
+	switch {
+	case err == nil && stored.ExpiresAt.After(now):
+		return stored, ErrIdempotencyKeyUsed
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return links.IdempotencyKey{}, err
+	}
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = now
+	}
+
+	err = r.writeJSON(r.keyPath(key.Key), key)
+	if err != nil {
+		return links.IdempotencyKey{}, err
+	}
+
+	return key, nil
+}
+
+// DeleteIdempotencyKey - deletes key, deleting a missing key is not an error
+func (r *fileRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(r.keyPath(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete idempotency key %w", err)
+	}
+
+	return nil
+}
+
+// sweepKeys - removes expired idempotency keys, at most once every keySweepInterval, has to be called under the exclusive lock
+// it is best effort, keys that can't be read or removed are left for the next sweep
+func (r *fileRepository) sweepKeys(now time.Time) {
+	r.sweepMu.Lock()
+	defer r.sweepMu.Unlock()
+
+	if now.Sub(r.lastSweep) < keySweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, keysDir))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(r.dir, keysDir, entry.Name())
+		key := links.IdempotencyKey{}
+		if r.readJSON(path, &key) == nil && !key.ExpiresAt.After(now) {
+			os.Remove(path)
+		}
+	}
+}
+
+// CreateAPIKey - stores key, keys are looked up by their hash
+func (r *fileRepository) CreateAPIKey(ctx context.Context, key links.APIKey) (links.APIKey, error) {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return links.APIKey{}, err
+	}
+	defer unlock()
+
+	if key.ID == "" {
+		key.ID = uuid.NewString()
+	}
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+
+	err = r.writeJSON(r.apiKeyPath(key.Hash), key)
+	if err != nil {
+		return links.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash - get api key by the hash of the key, revoked keys are returned as well
+func (r *fileRepository) GetAPIKeyByHash(ctx context.Context, hash string) (links.APIKey, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return links.APIKey{}, err
+	}
+	defer unlock()
+
+	key := links.APIKey{}
+	err = r.readJSON(r.apiKeyPath(hash), &key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return links.APIKey{}, ErrAPIKeyNotFound
+		}
+		return links.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey - marks api key as revoked, revoking an already revoked key keeps the original revocation time
+// keys are stored by hash, so the key is searched for, revoking is rare enough for that
+func (r *fileRepository) RevokeAPIKey(ctx context.Context, keyID string) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, apiKeysDir))
+	if err != nil {
+		return fmt.Errorf("failed to list api keys %w", err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") { // temp files of writeJSON
+			continue
+		}
+
+		key := links.APIKey{}
+		err = r.readJSON(filepath.Join(r.dir, apiKeysDir, entry.Name()), &key)
+		if err != nil {
+			return err
+		}
+
+		if key.ID != keyID {
+			continue
+		}
+
+		if key.RevokedAt != nil {
+			return nil
+		}
+
+		revokedAt := time.Now().UTC()
+		key.RevokedAt = &revokedAt
+
+		return r.writeJSON(r.apiKeyPath(key.Hash), key)
+	}
+
+	return ErrAPIKeyNotFound
+}
+
+// GetTenantUsage - urls of the tenant's jobs created on the utc day of since, and its unfinished jobs.
+// Read from the counters of the tenant, the jobs are only counted once for tenants without counters (e.g. after an upgrade)
+func (r *fileRepository) GetTenantUsage(ctx context.Context, tenant string, since time.Time) (links.TenantUsage, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return links.TenantUsage{}, err
+	}
+	defer unlock()
+
+	usage, err := r.readTenantUsage(tenant)
+	if err != nil {
+		return links.TenantUsage{}, err
+	}
+
+	if usageDay(since).After(usage.Day) { // nothing was created since
+		usage.URLs = 0
+	}
+
+	return links.TenantUsage{URLs: usage.URLs, ActiveJobs: usage.ActiveJobs}, nil
+}
+
+// writeTenantUsage - stores the counters of tenant, jobs without a tenant aren't counted.
+// Has to be called with the exclusive lock held
+func (r *fileRepository) writeTenantUsage(tenant string, usage tenantUsageRecord) error {
+	if tenant == "" {
+		return nil
+	}
+
+	return r.writeJSON(r.usagePath(tenant), usage)
+}
+
+// readTenantUsage - counters of tenant, counted from its jobs if they were never stored, has to be called under the lock
+func (r *fileRepository) readTenantUsage(tenant string) (tenantUsageRecord, error) {
+	usage := tenantUsageRecord{}
+	if tenant == "" {
+		return usage, nil
+	}
+
+	err := r.readJSON(r.usagePath(tenant), &usage)
+	if err == nil {
+		return usage, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return tenantUsageRecord{}, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, jobsDir))
+	if err != nil {
+		return tenantUsageRecord{}, fmt.Errorf("failed to list jobs %w", err)
+	}
+
+	usage.Day = usageDay(time.Now())
+	counted := links.TenantUsage{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") { // temp files of writeJSON
+			continue
+		}
+
+		record := jobRecord{}
+		err = r.readJSON(filepath.Join(r.dir, jobsDir, entry.Name()), &record)
+		if err != nil {
+			return tenantUsageRecord{}, err
+		}
+
+		job, err := record.toJob()
+		if err != nil {
+			return tenantUsageRecord{}, err
+		}
+
+		addTenantUsage(&counted, job, tenant, usage.Day)
+	}
+	usage.URLs, usage.ActiveJobs = counted.URLs, counted.ActiveJobs
+
+	return usage, nil
+}
+
+// usageDay - utc day of t, urls count against the quota of the day their job was created on
+func usageDay(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour * 24)
+}
+
+// SaveCircuitBreakerSnapshot - replaces the snapshot of the process
+func (r *fileRepository) SaveCircuitBreakerSnapshot(ctx context.Context, snapshot links.CircuitBreakerSnapshot) error {
+	unlock, err := r.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if snapshot.UpdatedAt.IsZero() {
+		snapshot.UpdatedAt = time.Now().UTC()
+	}
+
+	return r.writeJSON(r.breakersPath(snapshot.Process), snapshot)
+}
+
+// GetCircuitBreakerSnapshots - snapshots updated since, sorted by process. Processes that stopped are left out
+// once their last snapshot is older than since
+func (r *fileRepository) GetCircuitBreakerSnapshots(ctx context.Context, since time.Time) ([]links.CircuitBreakerSnapshot, error) {
+	unlock, err := r.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := os.ReadDir(filepath.Join(r.dir, breakersDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list circuit breaker snapshots %w", err)
+	}
+
+	snapshots := []links.CircuitBreakerSnapshot{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") { // temp files of writeJSON
+			continue
+		}
+
+		snapshot := links.CircuitBreakerSnapshot{}
+		err = r.readJSON(filepath.Join(r.dir, breakersDir, entry.Name()), &snapshot)
+		if err != nil {
+			return nil, err
+		}
+
+		if snapshot.UpdatedAt.Before(since) {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Process < snapshots[j].Process })
+
+	return snapshots, nil
+}
+
+// writeJSON writes to a temp file and renames it, so readers never see partial writes
+func (r *fileRepository) writeJSON(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write record %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write record %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to write record %w", err)
+	}
+
+	return nil
+}
+
+func (r *fileRepository) readJSON(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read record %w", err)
+	}
+
+	err = json.Unmarshal(b, v)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal record %w", err)
+	}
+
+	return nil
+}
+
+// job ids can be supplied by callers, so they are hex encoded to keep them safe to use as file names
+func (r *fileRepository) jobPath(jobID string) string {
+	return filepath.Join(r.dir, jobsDir, hex.EncodeToString([]byte(jobID))+".json")
+}
+
+func (r *fileRepository) resultsPath(jobID string) string {
+	return filepath.Join(r.dir, resultsDir, hex.EncodeToString([]byte(jobID))+".ndjson")
+}
+
+func (r *fileRepository) deliveriesPath(jobID string) string {
+	return filepath.Join(r.dir, deliveriesDir, hex.EncodeToString([]byte(jobID))+".json")
+}
+
+func (r *fileRepository) usagePath(tenant string) string {
+	return filepath.Join(r.dir, usageDir, hex.EncodeToString([]byte(tenant))+".json")
+}
+
+func (r *fileRepository) breakersPath(process string) string {
+	return filepath.Join(r.dir, breakersDir, hex.EncodeToString([]byte(process))+".json")
+}
+
+func (r *fileRepository) apiKeyPath(hash string) string {
+	return filepath.Join(r.dir, apiKeysDir, hex.EncodeToString([]byte(hash))+".json")
+}
+
+// keys are hashed instead, hex encoding a long key would get past the file name length limit
+func (r *fileRepository) keyPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(r.dir, keysDir, hex.EncodeToString(sum[:])+".json")
+}
+
+func toJobRecord(job links.Job) jobRecord {
+	record := jobRecord{
+		ID:          job.ID,
+		Tenant:      job.Tenant,
+		URLs:        make([]string, 0, len(job.URLs)),
+		Status:      job.Status,
+		CallbackURL: job.CallbackURL,
+		Labels:      job.Labels,
+		Options:     job.Options,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		FinishedAt:  job.FinishedAt,
+
+		WebhookPending: job.WebhookPending,
+	}
+
+	for _, u := range job.URLs {
+		record.URLs = append(record.URLs, u.String())
+	}
+
+	return record
+}
+
+func (record jobRecord) toJob() (links.Job, error) {
+	job := links.Job{
+		ID:          record.ID,
+		Tenant:      record.Tenant,
+		URLs:        make([]*url.URL, 0, len(record.URLs)),
+		Status:      record.Status,
+		CallbackURL: record.CallbackURL,
+		Labels:      record.Labels,
+		Options:     record.Options,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+		FinishedAt:  record.FinishedAt,
+
+		WebhookPending: record.WebhookPending,
+	}
+
+	for _, v := range record.URLs {
+		u, err := url.Parse(v)
+		if err != nil {
+			return links.Job{}, fmt.Errorf("failed to parse stored job url %w", err)
+		}
+		job.URLs = append(job.URLs, u)
+	}
+
+	return job, nil
+}
+
+func toJobResultRecord(result links.JobResult) jobResultRecord {
+	record := jobResultRecord{
+		ID:                 result.ID,
+		JobID:              result.JobID,
+		Sequence:           result.Sequence,
+		PageURL:            result.PageURL,
+		InternalLinksCount: result.InternalLinksCount,
+		ExternalLinksCount: result.ExternalLinksCount,
+		Success:            result.Success,
+		TLS:                result.TLS,
+		FromCache:          result.FromCache,
+		ErrorCategory:      result.ErrorCategory,
+		CreatedAt:          result.CreatedAt,
+		UpdatedAt:          result.UpdatedAt,
+	}
+
+	if result.Error != nil {
+		record.Error = result.Error.Error()
+	}
+
+	return record
+}
+
+func (record jobResultRecord) toJobResult() links.JobResult {
+	result := links.JobResult{
+		ID:                 record.ID,
+		JobID:              record.JobID,
+		Sequence:           record.Sequence,
+		PageURL:            record.PageURL,
+		InternalLinksCount: record.InternalLinksCount,
+		ExternalLinksCount: record.ExternalLinksCount,
+		Success:            record.Success,
+		TLS:                record.TLS,
+		FromCache:          record.FromCache,
+		ErrorCategory:      record.ErrorCategory,
+		CreatedAt:          record.CreatedAt,
+		UpdatedAt:          record.UpdatedAt,
+	}
+
+	if record.Error != "" {
+		result.Error = errors.New(record.Error)
+	}
+
+	return result
+}
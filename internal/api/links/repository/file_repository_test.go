@@ -0,0 +1,529 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func fileRepositoryHelper(t *testing.T) links.Repository {
+	t.Helper()
+	r, err := NewFileRepository(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func Test_fileRepository_CreateLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		wantJob := links.Job{
+			ID:        "test",
+			URLs:      test.StrToURL(t, []string{"http://localhost", "https://localhost"}),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+		}
+		gotJob, err := r.CreateLinksJob(context.Background(), wantJob)
+		assert.NoError(t, err)
+		assert.Equal(t, wantJob, gotJob)
+	})
+	t.Run("duplicate job err", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		wantJob := links.Job{
+			ID:   "test",
+			URLs: test.StrToURL(t, []string{"http://localhost", "https://localhost"}),
+		}
+		_, err := r.CreateLinksJob(context.Background(), wantJob)
+		assert.NoError(t, err)
+		_, err = r.CreateLinksJob(context.Background(), wantJob)
+		assert.ErrorIs(t, err, ErrJobAlreadyExists)
+	})
+}
+
+func Test_fileRepository_GetLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully get job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		wantJob := links.Job{
+			ID:        "../test/job",
+			URLs:      test.StrToURL(t, []string{"http://localhost", "https://localhost/path?q=1"}),
+			CreatedAt: time.Now().UTC(),
+			UpdatedAt: time.Now().UTC(),
+		}
+		_, err := r.CreateLinksJob(context.Background(), wantJob)
+		assert.NoError(t, err)
+		gotJob, err := r.GetLinksJob(context.Background(), wantJob.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, wantJob.ID, gotJob.ID)
+		assert.Equal(t, wantJob.URLs, gotJob.URLs)
+		assert.True(t, wantJob.CreatedAt.Equal(gotJob.CreatedAt))
+	})
+	t.Run("successfully get job labels and options", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		wantJob := links.Job{
+			ID:     "test",
+			URLs:   test.StrToURL(t, []string{"http://localhost"}),
+			Labels: map[string]string{"team": "growth"},
+			Options: links.JobOptions{
+				Timeout:     time.Second * 10,
+				Concurrency: 5,
+				Headers:     map[string]string{"Accept-Language": "en"},
+				LinkPolicy:  "domain",
+			},
+		}
+		_, err := r.CreateLinksJob(context.Background(), wantJob)
+		assert.NoError(t, err)
+		gotJob, err := r.GetLinksJob(context.Background(), wantJob.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, wantJob.Labels, gotJob.Labels)
+		assert.Equal(t, wantJob.Options, gotJob.Options)
+	})
+	t.Run("fail get job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		gotJob, err := r.GetLinksJob(context.Background(), "")
+		assert.Empty(t, gotJob)
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_fileRepository_FinishLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully finish job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "test"})
+		assert.NoError(t, err)
+
+		err = r.FinishLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.NotNil(t, gotJob.FinishedAt)
+	})
+	t.Run("fail finish - job not found", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		err := r.FinishLinksJob(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_fileRepository_GetLinksJobResult(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully get job results", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		epoch := time.Unix(0, 0).UTC()
+		wantResults := []links.JobResult{
+			{ID: "1", JobID: "test", PageURL: "test", InternalLinksCount: 1, ExternalLinksCount: 2, Success: true, CreatedAt: epoch, UpdatedAt: epoch,
+				TLS: &links.TLSInfo{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", Issuer: "CN=test", NotAfter: epoch, ExpiresSoon: true}, FromCache: true},
+			{ID: "2", JobID: "test", PageURL: "test", Error: errors.New("bad status code"), CreatedAt: epoch, UpdatedAt: epoch},
+		}
+		err := r.CreateLinksJobResult(context.Background(), wantResults)
+		assert.NoError(t, err)
+		got, err := r.GetLinksJobResult(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, wantResults, got)
+	})
+	t.Run("results not found", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		got, err := r.GetLinksJobResult(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobResultsNotFound)
+		assert.Empty(t, got)
+	})
+	t.Run("shared between instances", func(t *testing.T) {
+		dir := t.TempDir()
+		writer, err := NewFileRepository(dir)
+		assert.NoError(t, err)
+		reader, err := NewFileRepository(dir)
+		assert.NoError(t, err)
+
+		err = writer.CreateLinksJobResult(context.Background(), []links.JobResult{{ID: "1", JobID: "test"}})
+		assert.NoError(t, err)
+		got, err := reader.GetLinksJobResult(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Len(t, got, 1)
+	})
+}
+
+func Test_fileRepository_StartLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully start job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "test", Status: links.JobStatusPending})
+		assert.NoError(t, err)
+
+		err = r.StartLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, links.JobStatusRunning, gotJob.Status)
+		assert.Nil(t, gotJob.FinishedAt)
+	})
+	t.Run("fail - job not found", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		err := r.StartLinksJob(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_fileRepository_FailLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully fail job", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "test", Status: links.JobStatusPending})
+		assert.NoError(t, err)
+
+		err = r.FailLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, links.JobStatusFailed, gotJob.Status)
+		assert.NotNil(t, gotJob.FinishedAt)
+	})
+	t.Run("fail - job not found", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		err := r.FailLinksJob(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_fileRepository_WebhookDeliveries(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create and get deliveries", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		for i := 1; i <= 2; i++ {
+			err := r.CreateWebhookDelivery(context.Background(), links.WebhookDelivery{JobID: "test", Attempt: i})
+			assert.NoError(t, err)
+		}
+
+		got, err := r.GetWebhookDeliveries(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Len(t, got, 2)
+		assert.Equal(t, 1, got[0].Attempt)
+		assert.Equal(t, 2, got[1].Attempt)
+		assert.NotEmpty(t, got[0].ID)
+		assert.False(t, got[0].CreatedAt.IsZero())
+	})
+	t.Run("no deliveries", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		got, err := r.GetWebhookDeliveries(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
+
+func Test_fileRepository_CompleteLinksJobWebhook(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	job, err := r.CreateLinksJob(context.Background(), links.Job{CallbackURL: "http://localhost/callback", WebhookPending: true})
+	assert.NoError(t, err)
+
+	got, err := r.GetLinksJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.WebhookPending)
+
+	assert.NoError(t, r.CompleteLinksJobWebhook(context.Background(), job.ID))
+	got, err = r.GetLinksJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.WebhookPending)
+
+	assert.ErrorIs(t, r.CompleteLinksJobWebhook(context.Background(), "missing"), ErrJobNotFound)
+}
+
+func Test_fileRepository_GetLinksJobResultsAfter(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	ctx := context.Background()
+	ids := func(results []links.JobResult) []string {
+		ids := []string{}
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		return ids
+	}
+
+	_, cursor, err := r.GetLinksJobResultsAfter(ctx, "test", 0)
+	assert.ErrorIs(t, err, ErrJobResultsNotFound)
+	assert.Zero(t, cursor)
+
+	assert.NoError(t, r.CreateLinksJobResult(ctx, []links.JobResult{{ID: "1", JobID: "test", Sequence: 1}, {ID: "2", JobID: "test", Sequence: 2}}))
+	results, cursor, err := r.GetLinksJobResultsAfter(ctx, "test", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids(results))
+
+	results, cursor, err = r.GetLinksJobResultsAfter(ctx, "test", cursor)
+	assert.NoError(t, err)
+	assert.Empty(t, results, "nothing new")
+
+	assert.NoError(t, r.CreateLinksJobResult(ctx, []links.JobResult{{ID: "3", JobID: "test", Sequence: 1}, {ID: "4", JobID: "test", Sequence: 3}}))
+	results, _, err = r.GetLinksJobResultsAfter(ctx, "test", cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, ids(results))
+}
+
+func Test_fileRepository_CreateLinksJobResultIncrementally(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	for _, result := range []links.JobResult{
+		{ID: "1", JobID: "test", Sequence: 1},
+		{ID: "2", JobID: "test", Sequence: 2},
+		{ID: "3", JobID: "test", Sequence: 1}, // job executed again, replaces the first result
+		{ID: "4", JobID: "test", Sequence: 3},
+	} {
+		err := r.CreateLinksJobResult(context.Background(), []links.JobResult{result})
+		assert.NoError(t, err)
+	}
+
+	got, err := r.GetLinksJobResult(context.Background(), "test")
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, result := range got {
+		ids = append(ids, result.ID)
+	}
+	assert.Equal(t, []string{"3", "2", "4"}, ids)
+}
+
+func Test_fileRepository_IterateLinksJobResults(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully iterate replaced results in order", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		for _, result := range []links.JobResult{
+			{ID: "1", JobID: "test", Sequence: 1},
+			{ID: "2", JobID: "test", Sequence: 2},
+			{ID: "3", JobID: "test", Sequence: 1}, // job executed again, replaces the first result
+			{ID: "4", JobID: "test", Sequence: 3},
+		} {
+			err := r.CreateLinksJobResult(context.Background(), []links.JobResult{result})
+			assert.NoError(t, err)
+		}
+
+		want, err := r.GetLinksJobResult(context.Background(), "test")
+		assert.NoError(t, err)
+		got := []links.JobResult{}
+		err = r.IterateLinksJobResults(context.Background(), "test", func(result links.JobResult) error {
+			got = append(got, result)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+	t.Run("stop on fn error", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		err := r.CreateLinksJobResult(context.Background(), []links.JobResult{{ID: "1", JobID: "test"}, {ID: "2", JobID: "test"}})
+		assert.NoError(t, err)
+
+		errStop := errors.New("stop")
+		calls := 0
+		err = r.IterateLinksJobResults(context.Background(), "test", func(result links.JobResult) error {
+			calls++
+			return errStop
+		})
+		assert.ErrorIs(t, err, errStop)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("results not found", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		err := r.IterateLinksJobResults(context.Background(), "test", func(result links.JobResult) error { return nil })
+		assert.ErrorIs(t, err, ErrJobResultsNotFound)
+	})
+}
+
+func Test_fileRepository_IdempotencyKeys(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create and reuse key", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		key := links.IdempotencyKey{Key: strings.Repeat("k", 255), RequestHash: "hash", JobID: "job", ExpiresAt: time.Now().Add(time.Hour).UTC()}
+		created, err := r.CreateIdempotencyKey(context.Background(), key)
+		assert.NoError(t, err)
+
+		stored, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: key.Key, JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.ErrorIs(t, err, ErrIdempotencyKeyUsed)
+		assert.Equal(t, created.JobID, stored.JobID)
+		assert.Equal(t, created.RequestHash, stored.RequestHash)
+	})
+	t.Run("successfully replace expired key", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		_, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "job", ExpiresAt: time.Now().Add(-time.Second)})
+		assert.NoError(t, err)
+		created, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+		assert.Equal(t, "other", created.JobID)
+	})
+	t.Run("successfully delete key", func(t *testing.T) {
+		r := fileRepositoryHelper(t)
+		_, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "job", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+		assert.NoError(t, r.DeleteIdempotencyKey(context.Background(), "key"))
+		assert.NoError(t, r.DeleteIdempotencyKey(context.Background(), "key"))
+		_, err = r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+	})
+}
+
+func Test_fileRepository_TenantScoping(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "job", Tenant: "acme"})
+	assert.NoError(t, err)
+	assert.NoError(t, r.CreateLinksJobResult(context.Background(), []links.JobResult{{ID: "1", JobID: "job"}}))
+
+	owner := tenant.NewContext(context.Background(), "acme")
+	other := tenant.NewContext(context.Background(), "globex")
+
+	job, err := r.GetLinksJob(owner, "job")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", job.Tenant)
+	_, err = r.GetLinksJobResult(owner, "job")
+	assert.NoError(t, err)
+
+	_, err = r.GetLinksJob(other, "job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = r.GetLinksJobResult(other, "job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	err = r.IterateLinksJobResults(other, "job", func(result links.JobResult) error { return nil })
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func Test_fileRepository_APIKeys(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	created, err := r.CreateAPIKey(context.Background(), links.APIKey{Tenant: "acme", Hash: "hash"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+
+	got, err := r.GetAPIKeyByHash(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Equal(t, "acme", got.Tenant)
+
+	assert.NoError(t, r.RevokeAPIKey(context.Background(), created.ID))
+	got, err = r.GetAPIKeyByHash(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	assert.ErrorIs(t, r.RevokeAPIKey(context.Background(), "missing"), ErrAPIKeyNotFound)
+	_, err = r.GetAPIKeyByHash(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func Test_fileRepository_GetTenantUsage(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	now := time.Now().UTC()
+	for _, job := range []links.Job{
+		{ID: "today", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/", "http://b/"}), CreatedAt: now},
+		{ID: "finished", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://c/"}), CreatedAt: now},
+		{ID: "yesterday", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://d/"}), CreatedAt: now.Add(-time.Hour * 24)},
+		{ID: "other", Tenant: "globex", URLs: test.StrToURL(t, []string{"http://e/"}), CreatedAt: now},
+	} {
+		_, err := r.CreateLinksJob(context.Background(), job)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, r.FinishLinksJob(context.Background(), "finished"))
+
+	got, err := r.GetTenantUsage(context.Background(), "acme", now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, links.TenantUsage{URLs: 3, ActiveJobs: 2}, got)
+
+	got, err = r.GetTenantUsage(context.Background(), "acme", now.Add(time.Hour*24))
+	assert.NoError(t, err)
+	assert.Equal(t, links.TenantUsage{URLs: 0, ActiveJobs: 2}, got, "nothing created since")
+}
+
+func Test_fileRepository_GetTenantUsageWithoutCounters(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	r, err := NewFileRepository(dir)
+	assert.NoError(t, err)
+	for _, job := range []links.Job{
+		{ID: "first", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/", "http://b/"})},
+		{ID: "second", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://c/"})},
+	} {
+		_, err := r.CreateLinksJob(context.Background(), job)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, usageDir))) // stored before the counters were kept
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, usageDir), 0o755))
+
+	got, err := r.GetTenantUsage(context.Background(), "acme", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, links.TenantUsage{URLs: 3, ActiveJobs: 2}, got, "counted from the jobs")
+
+	_, err = r.CreateLinksJob(context.Background(), links.Job{ID: "third", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://d/"})})
+	assert.NoError(t, err)
+	assert.NoError(t, r.FinishLinksJob(context.Background(), "first"))
+	got, err = r.GetTenantUsage(context.Background(), "acme", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, links.TenantUsage{URLs: 4, ActiveJobs: 2}, got)
+}
+
+func Test_fileRepository_CreateLinksJobWithinQuota(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	quota := links.TenantQuota{MaxURLsPerDay: 3, MaxConcurrentJobs: 2}
+
+	created := int32(0)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		r, err := NewFileRepository(dir) // a repository per api process, sharing the directory
+		assert.NoError(t, err)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/"})}, quota)
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+				return
+			}
+			assert.ErrorIs(t, err, links.ErrJobQuotaExceeded)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), created, "only the jobs that fit are created")
+
+	r := fileRepositoryHelper(t)
+	_, err := r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/", "http://b/", "http://c/", "http://d/"})}, quota)
+	assert.ErrorIs(t, err, links.ErrURLQuotaExceeded)
+	_, err = r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/", "http://b/", "http://c/"})}, quota)
+	assert.NoError(t, err)
+}
+
+func Test_fileRepository_CircuitBreakerSnapshots(t *testing.T) {
+	t.Parallel()
+	r := fileRepositoryHelper(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	fresh := links.CircuitBreakerSnapshot{
+		Process:   "worker-b",
+		Breakers:  []links.CircuitBreaker{{Host: "down.example.com", State: "closed", Failures: 2}},
+		UpdatedAt: now,
+	}
+	stale := links.CircuitBreakerSnapshot{Process: "worker-a", Breakers: []links.CircuitBreaker{}, UpdatedAt: now.Add(-time.Hour)}
+
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), stale))
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), fresh))
+
+	snapshots, err := r.GetCircuitBreakerSnapshots(context.Background(), now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreakerSnapshot{fresh}, snapshots)
+
+	stale.UpdatedAt = now // the process published again
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), stale))
+	snapshots, err = r.GetCircuitBreakerSnapshots(context.Background(), now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreakerSnapshot{stale, fresh}, snapshots)
+}
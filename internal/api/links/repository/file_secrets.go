@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/buni/scraper/internal/api/links"
+)
+
+var (
+	ErrEmptySecretKey   = errors.New("empty secret key")
+	ErrSecretKeyMissing = errors.New("job secrets are sealed but the repository has no secret key")
+)
+
+const sealedPrefix = "sealed:v1:"
+
+type FileRepositoryOption func(r *fileRepository) error
+
+// WithSecretKey seals the login fields and the header values of jobs with AES-256-GCM before they are written,
+// the key can be any non empty string (it is hashed to the AES key), the api and the workers have to share it
+func WithSecretKey(key []byte) FileRepositoryOption {
+	return func(r *fileRepository) error {
+		if len(key) == 0 {
+			return ErrEmptySecretKey
+		}
+
+		sum := sha256.Sum256(key)
+		block, err := aes.NewCipher(sum[:])
+		if err != nil {
+			return fmt.Errorf("failed to create cipher %w", err)
+		}
+
+		r.secrets, err = cipher.NewGCM(block)
+		if err != nil {
+			return fmt.Errorf("failed to create cipher %w", err)
+		}
+
+		return nil
+	}
+}
+
+// sealJob - job with its secrets sealed, unchanged without a secret key
+func (r *fileRepository) sealJob(job links.Job) (links.Job, error) {
+	if r.secrets == nil {
+		return job, nil
+	}
+
+	return mapJobSecrets(job, func(value string) (string, error) {
+		nonce := make([]byte, r.secrets.NonceSize())
+		_, err := rand.Read(nonce)
+		if err != nil {
+			return "", fmt.Errorf("failed to create nonce %w", err)
+		}
+
+		return sealedPrefix + base64.RawStdEncoding.EncodeToString(r.secrets.Seal(nonce, nonce, []byte(value), nil)), nil
+	})
+}
+
+// openJob - job with its sealed secrets opened
+func (r *fileRepository) openJob(job links.Job) (links.Job, error) {
+	return mapJobSecrets(job, func(value string) (string, error) {
+		if !strings.HasPrefix(value, sealedPrefix) {
+			return value, nil // stored without a secret key
+		}
+		if r.secrets == nil {
+			return "", ErrSecretKeyMissing
+		}
+
+		sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+		if err != nil || len(sealed) < r.secrets.NonceSize() {
+			return "", fmt.Errorf("failed to decode job secret %w", err)
+		}
+
+		opened, err := r.secrets.Open(nil, sealed[:r.secrets.NonceSize()], sealed[r.secrets.NonceSize():], nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to open job secret %w", err)
+		}
+
+		return string(opened), nil
+	})
+}
+
+// mapJobSecrets - job with fn applied to the login fields and header values, the maps are copied
+func mapJobSecrets(job links.Job, fn func(value string) (string, error)) (links.Job, error) {
+	var err error
+
+	job.Options.Headers, err = mapValues(job.Options.Headers, fn)
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	if job.Options.Login != nil {
+		login := *job.Options.Login
+		login.Fields, err = mapValues(login.Fields, fn)
+		if err != nil {
+			return links.Job{}, err
+		}
+		job.Options.Login = &login
+	}
+
+	return job, nil
+}
+
+func mapValues(values map[string]string, fn func(value string) (string, error)) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	mapped := make(map[string]string, len(values))
+	for name, value := range values {
+		v, err := fn(value)
+		if err != nil {
+			return nil, err
+		}
+		mapped[name] = v
+	}
+
+	return mapped, nil
+}
+
+// stripJobSecrets - finished jobs don't need their secrets anymore, so they aren't kept at all
+func stripJobSecrets(job links.Job) links.Job {
+	job.Options.Headers = nil
+	if job.Options.Login != nil {
+		job.Options.Login = &links.LoginStep{URL: job.Options.Login.URL}
+	}
+
+	return job
+}
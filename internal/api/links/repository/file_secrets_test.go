@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fileRepository_JobSecrets(t *testing.T) {
+	t.Parallel()
+	secretJob := func() links.Job {
+		return links.Job{
+			ID: "test",
+			Options: links.JobOptions{
+				Headers: map[string]string{"Authorization": "Bearer hunter2"},
+				Login:   &links.LoginStep{URL: "http://localhost/login", Fields: map[string]string{"password": "hunter2"}},
+			},
+		}
+	}
+	jobFile := func(t *testing.T, dir string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, jobsDir, hex.EncodeToString([]byte("test"))+".json"))
+		assert.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("successfully seal and open secrets", func(t *testing.T) {
+		dir := t.TempDir()
+		r, err := NewFileRepository(dir, WithSecretKey([]byte("secret")))
+		assert.NoError(t, err)
+
+		_, err = r.CreateLinksJob(context.Background(), secretJob())
+		assert.NoError(t, err)
+		assert.NotContains(t, jobFile(t, dir), "hunter2")
+
+		info, err := os.Stat(filepath.Join(dir, jobsDir, hex.EncodeToString([]byte("test"))+".json"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, secretJob().Options, gotJob.Options)
+
+		other, err := NewFileRepository(dir, WithSecretKey([]byte("other")))
+		assert.NoError(t, err)
+		_, err = other.GetLinksJob(context.Background(), "test")
+		assert.Error(t, err)
+
+		keyless, err := NewFileRepository(dir)
+		assert.NoError(t, err)
+		_, err = keyless.GetLinksJob(context.Background(), "test")
+		assert.ErrorIs(t, err, ErrSecretKeyMissing)
+	})
+	t.Run("secrets are removed once the job finishes", func(t *testing.T) {
+		dir := t.TempDir()
+		r, err := NewFileRepository(dir)
+		assert.NoError(t, err)
+
+		_, err = r.CreateLinksJob(context.Background(), secretJob())
+		assert.NoError(t, err)
+		err = r.FinishLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.NotContains(t, jobFile(t, dir), "hunter2")
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Nil(t, gotJob.Options.Headers)
+		assert.Equal(t, &links.LoginStep{URL: "http://localhost/login"}, gotJob.Options.Login)
+	})
+	t.Run("fail empty secret key", func(t *testing.T) {
+		_, err := NewFileRepository(t.TempDir(), WithSecretKey(nil))
+		assert.ErrorIs(t, err, ErrEmptySecretKey)
+	})
+}
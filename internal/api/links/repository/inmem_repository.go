@@ -3,10 +3,12 @@ package repository
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/tenant"
 	"github.com/google/uuid"
 )
 
@@ -14,16 +16,30 @@ var (
 	ErrJobAlreadyExists   = errors.New("job already exists")
 	ErrJobNotFound        = errors.New("job not found")
 	ErrJobResultsNotFound = errors.New("job results found")
+	ErrIdempotencyKeyUsed = errors.New("idempotency key already used")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
 )
 
 type inMemRepository struct {
 	jobs       map[string]links.Job
 	jobResults map[string][]links.JobResult
+	deliveries map[string][]links.WebhookDelivery
+	keys       map[string]links.IdempotencyKey
+	apiKeys    map[string]links.APIKey // by hash
+	breakers   map[string]links.CircuitBreakerSnapshot
 	rw         *sync.RWMutex
 }
 
 func NewInMemoryRepository() links.Repository {
-	return &inMemRepository{jobs: map[string]links.Job{}, jobResults: map[string][]links.JobResult{}, rw: &sync.RWMutex{}}
+	return &inMemRepository{
+		jobs:       map[string]links.Job{},
+		jobResults: map[string][]links.JobResult{},
+		deliveries: map[string][]links.WebhookDelivery{},
+		keys:       map[string]links.IdempotencyKey{},
+		apiKeys:    map[string]links.APIKey{},
+		breakers:   map[string]links.CircuitBreakerSnapshot{},
+		rw:         &sync.RWMutex{},
+	}
 }
 
 // CreateLinksJob - creates new links job
@@ -32,6 +48,30 @@ func (r *inMemRepository) CreateLinksJob(ctx context.Context, job links.Job) (li
 	r.rw.Lock()
 	defer r.rw.Unlock()
 
+	return r.createLinksJob(job)
+}
+
+// CreateLinksJobWithinQuota - CreateLinksJob if job fits in quota next to the other jobs of its tenant,
+// ErrURLQuotaExceeded or ErrJobQuotaExceeded otherwise. The check and the create happen under the same lock
+func (r *inMemRepository) CreateLinksJobWithinQuota(ctx context.Context, job links.Job, quota links.TenantQuota) (links.Job, error) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	usage := links.TenantUsage{}
+	today := time.Now().UTC().Truncate(time.Hour * 24)
+	for _, other := range r.jobs {
+		addTenantUsage(&usage, other, job.Tenant, today)
+	}
+
+	err := quota.Check(usage, len(job.URLs))
+	if err != nil {
+		return links.Job{}, err
+	}
+
+	return r.createLinksJob(job)
+}
+
+func (r *inMemRepository) createLinksJob(job links.Job) (links.Job, error) {
 	if job.CreatedAt.IsZero() {
 		job.CreatedAt = time.Now().UTC()
 	}
@@ -54,21 +94,47 @@ func (r *inMemRepository) CreateLinksJob(ctx context.Context, job links.Job) (li
 }
 
 // GetLinksJob - get links job by id
-// if it doesn't exists returns  ErrJobNotFound
+// if it doesn't exists (or belongs to another tenant than the one of ctx) returns  ErrJobNotFound
 func (r *inMemRepository) GetLinksJob(ctx context.Context, jobID string) (links.Job, error) {
 	r.rw.Lock()
 	defer r.rw.Unlock()
 
 	job, ok := r.jobs[jobID]
-	if !ok {
+	if !ok || !tenant.Allowed(ctx, job.Tenant) {
 		return links.Job{}, ErrJobNotFound
 	}
 
 	return job, nil
 }
 
+// StartLinksJob - mark links job as running
+func (r *inMemRepository) StartLinksJob(ctx context.Context, jobID string) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	job.Status = links.JobStatusRunning
+	job.UpdatedAt = time.Now().UTC()
+	r.jobs[jobID] = job
+
+	return nil
+}
+
 // FinishLinksJob - mark links job as finished
 func (r *inMemRepository) FinishLinksJob(ctx context.Context, jobID string) error {
+	return r.finishLinksJob(jobID, links.JobStatusFinished)
+}
+
+// FailLinksJob - mark links job as failed
+func (r *inMemRepository) FailLinksJob(ctx context.Context, jobID string) error {
+	return r.finishLinksJob(jobID, links.JobStatusFailed)
+}
+
+func (r *inMemRepository) finishLinksJob(jobID string, status links.JobStatus) error {
 	r.rw.Lock()
 	defer r.rw.Unlock()
 
@@ -79,36 +145,293 @@ func (r *inMemRepository) FinishLinksJob(ctx context.Context, jobID string) erro
 
 	finishedAt := time.Now().UTC()
 
+	job.Status = status
 	job.FinishedAt = &finishedAt
+	job.UpdatedAt = finishedAt
 	r.jobs[jobID] = job
 
 	return nil
 }
 
-// CreateLinksJobResult - create links job result
-func (r *inMemRepository) CreateLinksJobResult(ctx context.Context, results []links.JobResult) error {
+// CompleteLinksJobWebhook - marks the webhook of a job as delivered or given up on
+func (r *inMemRepository) CompleteLinksJobWebhook(ctx context.Context, jobID string) error {
 	r.rw.Lock()
 	defer r.rw.Unlock()
 
-	if len(results) == 0 {
-		return nil
+	job, ok := r.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
 	}
 
-	r.jobResults[results[0].JobID] = results // assume all results have the same job id and job already exists
+	job.WebhookPending = false
+	job.UpdatedAt = time.Now().UTC()
+	r.jobs[jobID] = job
+
+	return nil
+}
+
+// CreateLinksJobResult - create links job results
+// results are appended, a result with the same sequence as an already stored one replaces it,
+// so executing a job again doesn't duplicate its results
+func (r *inMemRepository) CreateLinksJobResult(ctx context.Context, results []links.JobResult) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	for _, result := range results {
+		r.jobResults[result.JobID] = upsertJobResult(r.jobResults[result.JobID], result)
+	}
 
 	return nil
 }
 
 // GetLinksJobResult - get links job by job id
-// if it doesn't exists an error is returned
+// if it doesn't exists an error is returned, results of another tenant's job are reported as ErrJobNotFound
 func (r *inMemRepository) GetLinksJobResult(ctx context.Context, jobID string) ([]links.JobResult, error) {
 	r.rw.RLock()
 	defer r.rw.RUnlock()
 
+	if _, scoped := tenant.FromContext(ctx); scoped {
+		job, ok := r.jobs[jobID]
+		if !ok || !tenant.Allowed(ctx, job.Tenant) {
+			return nil, ErrJobNotFound
+		}
+	}
+
 	results, ok := r.jobResults[jobID]
 	if !ok {
 		return nil, ErrJobResultsNotFound
 	}
 
-	return results, nil
+	return append([]links.JobResult(nil), results...), nil // copy, results keep being appended while the job runs
+}
+
+// GetLinksJobResultsAfter - results stored after cursor (0 for all of them) and the cursor to pass next time,
+// results replaced after they were read don't show up again
+func (r *inMemRepository) GetLinksJobResultsAfter(ctx context.Context, jobID string, cursor int64) ([]links.JobResult, int64, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	if _, scoped := tenant.FromContext(ctx); scoped {
+		job, ok := r.jobs[jobID]
+		if !ok || !tenant.Allowed(ctx, job.Tenant) {
+			return nil, cursor, ErrJobNotFound
+		}
+	}
+
+	results, ok := r.jobResults[jobID]
+	if !ok {
+		return nil, cursor, ErrJobResultsNotFound
+	}
+
+	if cursor < 0 || cursor > int64(len(results)) {
+		cursor = int64(len(results))
+	}
+
+	return append([]links.JobResult(nil), results[cursor:]...), int64(len(results)), nil
+}
+
+// IterateLinksJobResults - calls fn for every result of a job, fn is called on a copy so it doesn't hold the lock
+func (r *inMemRepository) IterateLinksJobResults(ctx context.Context, jobID string, fn func(result links.JobResult) error) error {
+	results, err := r.GetLinksJobResult(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = fn(result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateWebhookDelivery - record a webhook delivery attempt
+func (r *inMemRepository) CreateWebhookDelivery(ctx context.Context, delivery links.WebhookDelivery) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	if delivery.ID == "" {
+		delivery.ID = uuid.NewString()
+	}
+
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = time.Now().UTC()
+	}
+
+	r.deliveries[delivery.JobID] = append(r.deliveries[delivery.JobID], delivery)
+
+	return nil
+}
+
+// GetWebhookDeliveries - get webhook delivery attempts of a job, oldest first
+func (r *inMemRepository) GetWebhookDeliveries(ctx context.Context, jobID string) ([]links.WebhookDelivery, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	deliveries := make([]links.WebhookDelivery, len(r.deliveries[jobID]))
+	copy(deliveries, r.deliveries[jobID])
+
+	return deliveries, nil
+}
+
+// CreateIdempotencyKey - stores key, if an unexpired key with the same name exists it is returned with ErrIdempotencyKeyUsed
+// expired keys are dropped on every call
+func (r *inMemRepository) CreateIdempotencyKey(ctx context.Context, key links.IdempotencyKey) (links.IdempotencyKey, error) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	now := time.Now().UTC()
+	for name, stored := range r.keys {
+		if !stored.ExpiresAt.After(now) {
+			delete(r.keys, name)
+		}
+	}
+
+	if stored, ok := r.keys[key.Key]; ok {
+		return stored, ErrIdempotencyKeyUsed
+	}
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = now
+	}
+
+	r.keys[key.Key] = key
+
+	return key, nil
+}
+
+// DeleteIdempotencyKey - deletes key, deleting a missing key is not an error
+func (r *inMemRepository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	delete(r.keys, key)
+
+	return nil
+}
+
+// CreateAPIKey - stores key, keys are looked up by their hash
+func (r *inMemRepository) CreateAPIKey(ctx context.Context, key links.APIKey) (links.APIKey, error) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	if key.ID == "" {
+		key.ID = uuid.NewString()
+	}
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+
+	r.apiKeys[key.Hash] = key
+
+	return key, nil
+}
+
+// GetAPIKeyByHash - get api key by the hash of the key, revoked keys are returned as well
+func (r *inMemRepository) GetAPIKeyByHash(ctx context.Context, hash string) (links.APIKey, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	key, ok := r.apiKeys[hash]
+	if !ok {
+		return links.APIKey{}, ErrAPIKeyNotFound
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey - marks api key as revoked, revoking an already revoked key keeps the original revocation time
+func (r *inMemRepository) RevokeAPIKey(ctx context.Context, keyID string) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	for hash, key := range r.apiKeys {
+		if key.ID != keyID {
+			continue
+		}
+
+		if key.RevokedAt == nil {
+			revokedAt := time.Now().UTC()
+			key.RevokedAt = &revokedAt
+			r.apiKeys[hash] = key
+		}
+
+		return nil
+	}
+
+	return ErrAPIKeyNotFound
+}
+
+// GetTenantUsage - counts the urls of the tenant's jobs created since since, and its unfinished jobs
+func (r *inMemRepository) GetTenantUsage(ctx context.Context, tenant string, since time.Time) (links.TenantUsage, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	usage := links.TenantUsage{}
+	for _, job := range r.jobs {
+		addTenantUsage(&usage, job, tenant, since)
+	}
+
+	return usage, nil
+}
+
+// SaveCircuitBreakerSnapshot - replaces the snapshot of the process
+func (r *inMemRepository) SaveCircuitBreakerSnapshot(ctx context.Context, snapshot links.CircuitBreakerSnapshot) error {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+
+	if snapshot.UpdatedAt.IsZero() {
+		snapshot.UpdatedAt = time.Now().UTC()
+	}
+	r.breakers[snapshot.Process] = snapshot
+
+	return nil
+}
+
+// GetCircuitBreakerSnapshots - snapshots updated since, sorted by process
+func (r *inMemRepository) GetCircuitBreakerSnapshots(ctx context.Context, since time.Time) ([]links.CircuitBreakerSnapshot, error) {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+
+	snapshots := []links.CircuitBreakerSnapshot{}
+	for _, snapshot := range r.breakers {
+		if !snapshot.UpdatedAt.Before(since) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Process < snapshots[j].Process })
+
+	return snapshots, nil
+}
+
+func addTenantUsage(usage *links.TenantUsage, job links.Job, tenant string, since time.Time) {
+	if job.Tenant != tenant {
+		return
+	}
+
+	if !job.CreatedAt.Before(since) {
+		usage.URLs += len(job.URLs)
+	}
+
+	if job.FinishedAt == nil {
+		usage.ActiveJobs++
+	}
+}
+
+// upsertJobResult - sequences are 1 based and produced in order, so the stored position of a sequence is sequence-1
+func upsertJobResult(results []links.JobResult, result links.JobResult) []links.JobResult {
+	if result.Sequence > 0 && int(result.Sequence) <= len(results) && results[result.Sequence-1].Sequence == result.Sequence {
+		results[result.Sequence-1] = result
+		return results
+	}
+
+	return append(results, result)
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/tenant"
 	"github.com/buni/scraper/internal/pkg/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -113,3 +114,301 @@ func Test_inMemRepository_GetLinksJobResult(t *testing.T) {
 		assert.Empty(t, got)
 	})
 }
+
+func Test_inMemRepository_StartLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully start job", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "test", Status: links.JobStatusPending})
+		assert.NoError(t, err)
+
+		err = r.StartLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, links.JobStatusRunning, gotJob.Status)
+		assert.Nil(t, gotJob.FinishedAt)
+	})
+	t.Run("fail - job not found", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		err := r.StartLinksJob(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_inMemRepository_FailLinksJob(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully fail job", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "test", Status: links.JobStatusPending})
+		assert.NoError(t, err)
+
+		err = r.FailLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+
+		gotJob, err := r.GetLinksJob(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Equal(t, links.JobStatusFailed, gotJob.Status)
+		assert.NotNil(t, gotJob.FinishedAt)
+	})
+	t.Run("fail - job not found", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		err := r.FailLinksJob(context.Background(), "")
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+}
+
+func Test_inMemRepository_WebhookDeliveries(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create and get deliveries", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		for i := 1; i <= 2; i++ {
+			err := r.CreateWebhookDelivery(context.Background(), links.WebhookDelivery{JobID: "test", Attempt: i})
+			assert.NoError(t, err)
+		}
+
+		got, err := r.GetWebhookDeliveries(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Len(t, got, 2)
+		assert.Equal(t, 1, got[0].Attempt)
+		assert.Equal(t, 2, got[1].Attempt)
+		assert.NotEmpty(t, got[0].ID)
+		assert.False(t, got[0].CreatedAt.IsZero())
+	})
+	t.Run("no deliveries", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		got, err := r.GetWebhookDeliveries(context.Background(), "test")
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+}
+
+func Test_inMemRepository_CompleteLinksJobWebhook(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	job, err := r.CreateLinksJob(context.Background(), links.Job{CallbackURL: "http://localhost/callback", WebhookPending: true})
+	assert.NoError(t, err)
+
+	got, err := r.GetLinksJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.True(t, got.WebhookPending)
+
+	assert.NoError(t, r.CompleteLinksJobWebhook(context.Background(), job.ID))
+	got, err = r.GetLinksJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.False(t, got.WebhookPending)
+
+	assert.ErrorIs(t, r.CompleteLinksJobWebhook(context.Background(), "missing"), ErrJobNotFound)
+}
+
+func Test_inMemRepository_GetLinksJobResultsAfter(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	ctx := context.Background()
+	ids := func(results []links.JobResult) []string {
+		ids := []string{}
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		return ids
+	}
+
+	_, cursor, err := r.GetLinksJobResultsAfter(ctx, "test", 0)
+	assert.ErrorIs(t, err, ErrJobResultsNotFound)
+	assert.Zero(t, cursor)
+
+	assert.NoError(t, r.CreateLinksJobResult(ctx, []links.JobResult{{ID: "1", JobID: "test", Sequence: 1}, {ID: "2", JobID: "test", Sequence: 2}}))
+	results, cursor, err := r.GetLinksJobResultsAfter(ctx, "test", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids(results))
+
+	results, cursor, err = r.GetLinksJobResultsAfter(ctx, "test", cursor)
+	assert.NoError(t, err)
+	assert.Empty(t, results, "nothing new")
+
+	assert.NoError(t, r.CreateLinksJobResult(ctx, []links.JobResult{{ID: "3", JobID: "test", Sequence: 1}, {ID: "4", JobID: "test", Sequence: 3}}))
+	results, _, err = r.GetLinksJobResultsAfter(ctx, "test", cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"4"}, ids(results))
+}
+
+func Test_inMemRepository_CreateLinksJobResultIncrementally(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	for _, result := range []links.JobResult{
+		{ID: "1", JobID: "test", Sequence: 1},
+		{ID: "2", JobID: "test", Sequence: 2},
+		{ID: "3", JobID: "test", Sequence: 1}, // job executed again, replaces the first result
+		{ID: "4", JobID: "test", Sequence: 3},
+	} {
+		err := r.CreateLinksJobResult(context.Background(), []links.JobResult{result})
+		assert.NoError(t, err)
+	}
+
+	got, err := r.GetLinksJobResult(context.Background(), "test")
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, result := range got {
+		ids = append(ids, result.ID)
+	}
+	assert.Equal(t, []string{"3", "2", "4"}, ids)
+}
+
+func Test_inMemRepository_IterateLinksJobResults(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully iterate job results", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		wantResults := []links.JobResult{{ID: "1", JobID: "test", Sequence: 1}, {ID: "2", JobID: "test", Sequence: 2}}
+		r.CreateLinksJobResult(context.Background(), wantResults)
+		got := []links.JobResult{}
+		err := r.IterateLinksJobResults(context.Background(), "test", func(result links.JobResult) error {
+			got = append(got, result)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, wantResults, got)
+	})
+	t.Run("results not found", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		err := r.IterateLinksJobResults(context.Background(), "test", func(result links.JobResult) error { return nil })
+		assert.ErrorIs(t, err, ErrJobResultsNotFound)
+	})
+}
+
+func Test_inMemRepository_IdempotencyKeys(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create and reuse key", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		key := links.IdempotencyKey{Key: "key", RequestHash: "hash", JobID: "job", ExpiresAt: time.Now().Add(time.Hour)}
+		created, err := r.CreateIdempotencyKey(context.Background(), key)
+		assert.NoError(t, err)
+		assert.False(t, created.CreatedAt.IsZero())
+
+		stored, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.ErrorIs(t, err, ErrIdempotencyKeyUsed)
+		assert.Equal(t, created, stored)
+	})
+	t.Run("successfully replace expired key", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		_, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "job", ExpiresAt: time.Now().Add(-time.Second)})
+		assert.NoError(t, err)
+		created, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+		assert.Equal(t, "other", created.JobID)
+	})
+	t.Run("successfully delete key", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		_, err := r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "job", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+		assert.NoError(t, r.DeleteIdempotencyKey(context.Background(), "key"))
+		_, err = r.CreateIdempotencyKey(context.Background(), links.IdempotencyKey{Key: "key", JobID: "other", ExpiresAt: time.Now().Add(time.Hour)})
+		assert.NoError(t, err)
+	})
+}
+
+func Test_inMemRepository_TenantScoping(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	_, err := r.CreateLinksJob(context.Background(), links.Job{ID: "job", Tenant: "acme"})
+	assert.NoError(t, err)
+	assert.NoError(t, r.CreateLinksJobResult(context.Background(), []links.JobResult{{ID: "1", JobID: "job"}}))
+
+	owner := tenant.NewContext(context.Background(), "acme")
+	other := tenant.NewContext(context.Background(), "globex")
+
+	_, err = r.GetLinksJob(owner, "job")
+	assert.NoError(t, err)
+	_, err = r.GetLinksJobResult(owner, "job")
+	assert.NoError(t, err)
+
+	_, err = r.GetLinksJob(other, "job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	_, err = r.GetLinksJobResult(other, "job")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	err = r.IterateLinksJobResults(other, "job", func(result links.JobResult) error { return nil })
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func Test_inMemRepository_APIKeys(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	created, err := r.CreateAPIKey(context.Background(), links.APIKey{Tenant: "acme", Hash: "hash"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+
+	got, err := r.GetAPIKeyByHash(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	assert.NoError(t, r.RevokeAPIKey(context.Background(), created.ID))
+	got, err = r.GetAPIKeyByHash(context.Background(), "hash")
+	assert.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+
+	assert.ErrorIs(t, r.RevokeAPIKey(context.Background(), "missing"), ErrAPIKeyNotFound)
+	_, err = r.GetAPIKeyByHash(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func Test_inMemRepository_GetTenantUsage(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	now := time.Now().UTC()
+	for _, job := range []links.Job{
+		{ID: "today", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/", "http://b/"}), CreatedAt: now},
+		{ID: "finished", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://c/"}), CreatedAt: now},
+		{ID: "yesterday", Tenant: "acme", URLs: test.StrToURL(t, []string{"http://d/"}), CreatedAt: now.Add(-time.Hour * 24)},
+		{ID: "other", Tenant: "globex", URLs: test.StrToURL(t, []string{"http://e/"}), CreatedAt: now},
+	} {
+		_, err := r.CreateLinksJob(context.Background(), job)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, r.FinishLinksJob(context.Background(), "finished"))
+
+	got, err := r.GetTenantUsage(context.Background(), "acme", now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, links.TenantUsage{URLs: 3, ActiveJobs: 2}, got)
+}
+
+func Test_inMemRepository_CreateLinksJobWithinQuota(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	quota := links.TenantQuota{MaxURLsPerDay: 3, MaxConcurrentJobs: 1}
+
+	job, err := r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://a/"})}, quota)
+	assert.NoError(t, err)
+	_, err = r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://b/"})}, quota)
+	assert.ErrorIs(t, err, links.ErrJobQuotaExceeded)
+	_, err = r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "globex", URLs: test.StrToURL(t, []string{"http://b/"})}, quota)
+	assert.NoError(t, err, "other tenants have their own quota")
+
+	assert.NoError(t, r.FinishLinksJob(context.Background(), job.ID))
+	_, err = r.CreateLinksJobWithinQuota(context.Background(), links.Job{Tenant: "acme", URLs: test.StrToURL(t, []string{"http://b/", "http://c/", "http://d/"})}, quota)
+	assert.ErrorIs(t, err, links.ErrURLQuotaExceeded)
+}
+
+func Test_inMemRepository_CircuitBreakerSnapshots(t *testing.T) {
+	t.Parallel()
+	r := NewInMemoryRepository()
+	now := time.Now().UTC().Truncate(time.Second)
+	fresh := links.CircuitBreakerSnapshot{
+		Process:   "worker-b",
+		Breakers:  []links.CircuitBreaker{{Host: "down.example.com", State: "closed", Failures: 2}},
+		UpdatedAt: now,
+	}
+	stale := links.CircuitBreakerSnapshot{Process: "worker-a", Breakers: []links.CircuitBreaker{}, UpdatedAt: now.Add(-time.Hour)}
+
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), stale))
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), fresh))
+
+	snapshots, err := r.GetCircuitBreakerSnapshots(context.Background(), now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreakerSnapshot{fresh}, snapshots)
+
+	stale.UpdatedAt = now // the process published again
+	assert.NoError(t, r.SaveCircuitBreakerSnapshot(context.Background(), stale))
+	snapshots, err = r.GetCircuitBreakerSnapshots(context.Background(), now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreakerSnapshot{stale, fresh}, snapshots)
+}
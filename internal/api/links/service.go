@@ -8,5 +8,15 @@ import "context"
 type Service interface {
 	EnqueueLinksJob(ctx context.Context, req EnqueueLinksJobRequest) (job Job, err error)
 	GetLinksJobStatus(ctx context.Context, req GetJobStatusRequest) ([]JobResult, error)
+	ExportLinksJobResults(ctx context.Context, req GetJobStatusRequest, fn func(result JobResult) error) error
 	ExecuteLinksJob(ctx context.Context, jobID string) error
+	FailLinksJob(ctx context.Context, jobID string) error
+	GetWebhookDeliveries(ctx context.Context, req GetJobStatusRequest) ([]WebhookDelivery, error)
+	SubscribeLinksJobEvents(ctx context.Context, req SubscribeJobEventsRequest) (<-chan JobEvent, error)
+	CreateAPIKey(ctx context.Context, req CreateAPIKeyRequest) (CreateAPIKeyResponse, error)
+	RevokeAPIKey(ctx context.Context, keyID string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (APIKey, error)
+	GetQuotaUsage(ctx context.Context) (QuotaUsage, error)
+	GetCircuitBreakers(ctx context.Context) ([]CircuitBreaker, error)
+	PublishCircuitBreakers(ctx context.Context, process string) error
 }
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/repository"
+)
+
+// apiKeyPrefix - makes keys recognizable, e.g. for secret scanners
+const apiKeyPrefix = "sk_"
+
+// CreateAPIKey - creates a new api key for req.Tenant, the key is only part of the response, the repository only gets its hash
+func (s *service) CreateAPIKey(ctx context.Context, req links.CreateAPIKeyRequest) (links.CreateAPIKeyResponse, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return links.CreateAPIKeyResponse{}, fmt.Errorf("failed to generate api key %w", err)
+	}
+
+	rawKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key, err := s.repository.CreateAPIKey(ctx, links.APIKey{Tenant: req.Tenant, Name: req.Name, Hash: hashAPIKey(rawKey)})
+	if err != nil {
+		return links.CreateAPIKeyResponse{}, fmt.Errorf("failed to create api key %w", err)
+	}
+
+	return links.CreateAPIKeyResponse{ID: key.ID, Tenant: key.Tenant, Name: key.Name, Key: rawKey, CreatedAt: key.CreatedAt}, nil
+}
+
+// RevokeAPIKey - revokes the api key with keyID, requests with it are rejected from then on
+func (s *service) RevokeAPIKey(ctx context.Context, keyID string) error {
+	err := s.repository.RevokeAPIKey(ctx, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key %w", err)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey - returns the api key matching rawKey, unknown and revoked keys are an ErrUnauthorized
+func (s *service) AuthenticateAPIKey(ctx context.Context, rawKey string) (links.APIKey, error) {
+	key, err := s.repository.GetAPIKeyByHash(ctx, hashAPIKey(rawKey))
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return links.APIKey{}, links.ErrUnauthorized
+		}
+		return links.APIKey{}, fmt.Errorf("failed to get api key %w", err)
+	}
+
+	if key.RevokedAt != nil {
+		return links.APIKey{}, links.ErrUnauthorized
+	}
+
+	return key, nil
+}
+
+// hashAPIKey - keys are random 256 bit values, so a plain (unsalted) sha256 is enough and lets keys be looked up by hash
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_APIKeys(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully create, authenticate and revoke key", func(t *testing.T) {
+		s := service.NewService(repository.NewInMemoryRepository(), nil)
+
+		created, err := s.CreateAPIKey(context.Background(), links.CreateAPIKeyRequest{Tenant: "acme", Name: "ci"})
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(created.Key, "sk_"))
+
+		key, err := s.AuthenticateAPIKey(context.Background(), created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, "acme", key.Tenant)
+		assert.NotContains(t, key.Hash, created.Key)
+
+		assert.NoError(t, s.RevokeAPIKey(context.Background(), created.ID))
+		_, err = s.AuthenticateAPIKey(context.Background(), created.Key)
+		assert.ErrorIs(t, err, links.ErrUnauthorized)
+	})
+	t.Run("fail unknown key", func(t *testing.T) {
+		s := service.NewService(repository.NewInMemoryRepository(), nil)
+		_, err := s.AuthenticateAPIKey(context.Background(), "sk_unknown")
+		assert.ErrorIs(t, err, links.ErrUnauthorized)
+	})
+}
+
+func Test_service_EnqueueLinksJobTenant(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	queue := mock.NewMockQueue(ctrl)
+	queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	r := repository.NewInMemoryRepository()
+	s := service.NewService(r, nil, service.WithQueue(queue))
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+	req := links.EnqueueLinksJobRequest{URLs: test.StrToURL(t, []string{"http://localhost/"}), IdempotencyKey: "key"}
+
+	job, err := s.EnqueueLinksJob(acme, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", job.Tenant)
+
+	other, err := s.EnqueueLinksJob(globex, req) // idempotency keys are per tenant
+	assert.NoError(t, err)
+	assert.NotEqual(t, job.ID, other.ID)
+
+	_, err = s.GetLinksJobStatus(globex, links.GetJobStatusRequest{JobID: job.ID})
+	assert.ErrorIs(t, err, repository.ErrJobNotFound)
+}
+
+func Test_service_EnqueueLinksJobTenantJobID(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	queue := mock.NewMockQueue(ctrl)
+	queue.EXPECT().Enqueue(gomock.Any(), "acme/report").Return(nil)
+	queue.EXPECT().Enqueue(gomock.Any(), "globex/report").Return(nil)
+	r := repository.NewInMemoryRepository()
+	s := service.NewService(r, nil, service.WithQueue(queue))
+	acme := tenant.NewContext(context.Background(), "acme")
+	globex := tenant.NewContext(context.Background(), "globex")
+	req := links.EnqueueLinksJobRequest{JobID: "report", URLs: test.StrToURL(t, []string{"http://localhost/"})}
+
+	job, err := s.EnqueueLinksJob(acme, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "report", job.ID)
+
+	other, err := s.EnqueueLinksJob(globex, req) // job ids are per tenant, the one of acme doesn't get in the way
+	assert.NoError(t, err)
+	assert.Equal(t, "report", other.ID)
+
+	_, err = s.EnqueueLinksJob(acme, req)
+	assert.ErrorIs(t, err, repository.ErrJobAlreadyExists)
+
+	assert.NoError(t, r.CreateLinksJobResult(context.Background(), []links.JobResult{{JobID: "acme/report", Sequence: 1}}))
+	assert.NoError(t, r.FinishLinksJob(context.Background(), "acme/report"))
+	results, err := s.GetLinksJobStatus(acme, links.GetJobStatusRequest{JobID: "report"})
+	assert.NoError(t, err)
+	assert.Equal(t, "report", results[0].JobID)
+
+	_, err = s.GetLinksJobStatus(globex, links.GetJobStatusRequest{JobID: "report"})
+	assert.ErrorIs(t, err, repository.ErrJobResultsNotFound, "the job of globex is still running")
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/scraper"
+)
+
+// circuitBreakerSnapshotTTL - snapshots older than this are of workers that stopped, workers have to publish more often
+const circuitBreakerSnapshotTTL = time.Minute
+
+// GetCircuitBreakers - breakers of the hosts that recently failed. With a queue the jobs are scraped by the workers,
+// so the breakers are the ones the workers published, otherwise they are the breakers of this process's scraper
+func (s *service) GetCircuitBreakers(ctx context.Context) ([]links.CircuitBreaker, error) {
+	if s.queue == nil {
+		return s.circuitBreakers(), nil
+	}
+
+	now := time.Now().UTC()
+	snapshots, err := s.repository.GetCircuitBreakerSnapshots(ctx, now.Add(-circuitBreakerSnapshotTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get circuit breaker snapshots %w", err)
+	}
+
+	breakers := []links.CircuitBreaker{}
+	for _, snapshot := range snapshots {
+		for _, breaker := range snapshot.Breakers {
+			if breaker.State == string(scraper.CircuitOpen) && breaker.RetryAt != nil && !now.Before(*breaker.RetryAt) { // the cooldown ran out since
+				breaker.State = string(scraper.CircuitHalfOpen)
+			}
+			breaker.Process = snapshot.Process
+			breakers = append(breakers, breaker)
+		}
+	}
+
+	sort.SliceStable(breakers, func(i, j int) bool { return breakers[i].Host < breakers[j].Host })
+
+	return breakers, nil
+}
+
+// PublishCircuitBreakers - stores the breakers of this process's scraper for the api, called periodically by the workers
+func (s *service) PublishCircuitBreakers(ctx context.Context, process string) error {
+	snapshot := links.CircuitBreakerSnapshot{Process: process, Breakers: s.circuitBreakers(), UpdatedAt: time.Now().UTC()}
+
+	err := s.repository.SaveCircuitBreakerSnapshot(ctx, snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to save circuit breaker snapshot %w", err)
+	}
+
+	return nil
+}
+
+// circuitBreakers - breakers of this process's scraper, none without one
+func (s *service) circuitBreakers() []links.CircuitBreaker {
+	if s.scraperClient == nil {
+		return []links.CircuitBreaker{}
+	}
+
+	statuses := s.scraperClient.CircuitBreakers()
+
+	breakers := make([]links.CircuitBreaker, 0, len(statuses))
+	for _, status := range statuses {
+		breaker := links.CircuitBreaker{Host: status.Host, State: string(status.State), Failures: status.Failures}
+		if !status.OpenedAt.IsZero() {
+			openedAt, retryAt := status.OpenedAt.UTC(), status.RetryAt.UTC()
+			breaker.OpenedAt, breaker.RetryAt = &openedAt, &retryAt
+		}
+		breakers = append(breakers, breaker)
+	}
+
+	return breakers
+}
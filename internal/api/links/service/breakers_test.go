@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	scraperMock "github.com/buni/scraper/internal/pkg/scraper/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_GetCircuitBreakers(t *testing.T) {
+	t.Parallel()
+	openedAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	retryAt := openedAt.Add(time.Second * 30)
+
+	ctrl := gomock.NewController(t)
+	mockScraper := scraperMock.NewMockScraperService(ctrl)
+	mockScraper.EXPECT().CircuitBreakers().Return([]scraper.CircuitBreakerStatus{
+		{Host: "down.example.com", State: scraper.CircuitOpen, Failures: 5, OpenedAt: openedAt, RetryAt: retryAt},
+		{Host: "flaky.example.com", State: scraper.CircuitClosed, Failures: 2},
+	})
+	s := service.NewService(repository.NewInMemoryRepository(), mockScraper)
+
+	breakers, err := s.GetCircuitBreakers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreaker{
+		{Host: "down.example.com", State: "open", Failures: 5, OpenedAt: &openedAt, RetryAt: &retryAt},
+		{Host: "flaky.example.com", State: "closed", Failures: 2},
+	}, breakers)
+}
+
+func Test_service_GetCircuitBreakersWithQueue(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	openedAt, retryAt := now.Add(-time.Minute), now.Add(-time.Second) // the cooldown ran out after the snapshot
+	repo := repository.NewInMemoryRepository()
+	assert.NoError(t, repo.SaveCircuitBreakerSnapshot(context.Background(), links.CircuitBreakerSnapshot{
+		Process: "worker-1",
+		Breakers: []links.CircuitBreaker{
+			{Host: "down.example.com", State: "open", Failures: 5, OpenedAt: &openedAt, RetryAt: &retryAt},
+		},
+		UpdatedAt: now,
+	}))
+	assert.NoError(t, repo.SaveCircuitBreakerSnapshot(context.Background(), links.CircuitBreakerSnapshot{
+		Process:   "worker-2",
+		Breakers:  []links.CircuitBreaker{{Host: "flaky.example.com", State: "closed", Failures: 1}},
+		UpdatedAt: now,
+	}))
+	assert.NoError(t, repo.SaveCircuitBreakerSnapshot(context.Background(), links.CircuitBreakerSnapshot{
+		Process:   "stopped",
+		Breakers:  []links.CircuitBreaker{{Host: "gone.example.com", State: "closed", Failures: 1}},
+		UpdatedAt: now.Add(-time.Hour),
+	}))
+
+	ctrl := gomock.NewController(t)
+	s := service.NewService(repo, nil, service.WithQueue(mock.NewMockQueue(ctrl)))
+
+	breakers, err := s.GetCircuitBreakers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []links.CircuitBreaker{
+		{Host: "down.example.com", State: "half_open", Failures: 5, OpenedAt: &openedAt, RetryAt: &retryAt, Process: "worker-1"},
+		{Host: "flaky.example.com", State: "closed", Failures: 1, Process: "worker-2"},
+	}, breakers)
+}
+
+func Test_service_PublishCircuitBreakers(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	mockScraper := scraperMock.NewMockScraperService(ctrl)
+	mockScraper.EXPECT().CircuitBreakers().Return([]scraper.CircuitBreakerStatus{
+		{Host: "flaky.example.com", State: scraper.CircuitClosed, Failures: 2},
+	})
+	repo := repository.NewInMemoryRepository()
+	s := service.NewService(repo, mockScraper)
+
+	assert.NoError(t, s.PublishCircuitBreakers(context.Background(), "worker-1"))
+
+	snapshots, err := repo.GetCircuitBreakerSnapshots(context.Background(), time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+	assert.Equal(t, "worker-1", snapshots[0].Process)
+	assert.Equal(t, []links.CircuitBreaker{{Host: "flaky.example.com", State: "closed", Failures: 2}}, snapshots[0].Breakers)
+}
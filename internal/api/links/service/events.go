@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/repository"
+)
+
+// waitForJobChange - returns the job once its status differs from the one it had when the wait started,
+// the job is finished, or wait is over (then the unchanged job is returned)
+func (s *service) waitForJobChange(ctx context.Context, jobID string, wait time.Duration) (links.Job, error) {
+	changed, unsubscribe := s.notifier.Subscribe(jobID) // subscribe before the first read so no change is missed
+	defer unsubscribe()
+
+	job, err := s.repository.GetLinksJob(ctx, jobID)
+	if err != nil || job.FinishedAt != nil {
+		return job, err
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-timeout.C:
+			return job, nil
+		case <-changed:
+		}
+
+		current, err := s.repository.GetLinksJob(ctx, jobID)
+		if err != nil {
+			return links.Job{}, err
+		}
+
+		if current.Status != job.Status || current.FinishedAt != nil {
+			return current, nil
+		}
+	}
+}
+
+// SubscribeLinksJobEvents - streams the results of a job as they are stored, followed by progress events
+// and a final state event once the job is finished, the channel is closed after the state event or when ctx is done
+func (s *service) SubscribeLinksJobEvents(ctx context.Context, req links.SubscribeJobEventsRequest) (<-chan links.JobEvent, error) {
+	req.JobID = scopedJobID(ctx, req.JobID)
+	_, err := s.repository.GetLinksJob(ctx, req.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links job %w", err)
+	}
+
+	changed, unsubscribe := s.notifier.Subscribe(req.JobID) // subscribe before the first read so no change is missed
+	events := make(chan links.JobEvent)
+
+	go func() {
+		defer close(events)
+		defer unsubscribe()
+
+		state := &jobEventsState{lastSequence: req.LastEventID, reported: -1}
+
+		for {
+			done, err := s.sendJobEvents(ctx, req.JobID, events, state)
+			if err != nil {
+				log.Println("failed to send job events #", req.JobID, err)
+				return
+			}
+
+			if done {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// jobEventsState - what a subscription has read and sent so far
+type jobEventsState struct {
+	cursor       int64 // repository cursor of the results read so far
+	lastSequence uint  // sequence of the last result sent
+	stored       uint  // results stored so far, the highest sequence read
+	reported     int   // completed count of the last progress event, -1 before the first one
+}
+
+// sendJobEvents sends everything that changed since the last call, returns true once the final state was sent.
+// Only the results stored since the last call are read
+func (s *service) sendJobEvents(ctx context.Context, jobID string, events chan<- links.JobEvent, state *jobEventsState) (bool, error) {
+	job, err := s.repository.GetLinksJob(ctx, jobID) // the job is read before the results, so a finished job always comes with all of its results
+	if err != nil {
+		return false, err
+	}
+
+	results, cursor, err := s.repository.GetLinksJobResultsAfter(ctx, jobID, state.cursor)
+	if err != nil && !errors.Is(err, repository.ErrJobResultsNotFound) {
+		return false, err
+	}
+	state.cursor = cursor
+
+	for _, result := range results {
+		if result.Sequence == 0 { // results stored without a sequence are numbered by position
+			result.Sequence = state.stored + 1
+		}
+
+		if result.Sequence > state.stored {
+			state.stored = result.Sequence
+		}
+
+		if result.Sequence <= state.lastSequence { // already sent, or stored again by a redelivered job
+			continue
+		}
+
+		if !send(ctx, events, links.JobEvent{ID: strconv.FormatUint(uint64(result.Sequence), 10), Type: links.JobEventResult, Data: newPageResult(result)}) {
+			return true, nil
+		}
+		state.lastSequence = result.Sequence
+	}
+
+	if int(state.stored) != state.reported {
+		state.reported = int(state.stored)
+		if !send(ctx, events, links.JobEvent{Type: links.JobEventProgress, Data: links.JobProgress{Completed: state.reported, Total: len(job.URLs)}}) {
+			return true, nil
+		}
+	}
+
+	if job.FinishedAt == nil {
+		return false, nil
+	}
+
+	status := job.Status
+	if status == "" { // jobs created without a status, FinishedAt is what marks them as done
+		status = links.JobStatusFinished
+	}
+
+	send(ctx, events, links.JobEvent{Type: links.JobEventState, Data: links.JobState{Status: status, FinishedAt: job.FinishedAt}})
+
+	return true, nil
+}
+
+func send(ctx context.Context, events chan<- links.JobEvent, event links.JobEvent) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case events <- event:
+		return true
+	}
+}
@@ -0,0 +1,243 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/notifier"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	scraperMock "github.com/buni/scraper/internal/pkg/scraper/mock"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEventHelper(t *testing.T, events <-chan links.JobEvent) links.JobEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(time.Second * 5):
+		t.Fatal("no event received")
+	}
+	return links.JobEvent{}
+}
+
+func Test_service_SubscribeLinksJobEvents(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully stream events while the job runs", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockScraper := scraperMock.NewMockScraperService(ctrl)
+		stream := make(chan scraper.Result)
+		mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(stream)
+
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, mockScraper)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/", "http://localhost/page1"})})
+		assert.NoError(t, err)
+
+		events, err := s.SubscribeLinksJobEvents(context.Background(), links.SubscribeJobEventsRequest{JobID: job.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, links.JobEvent{Type: links.JobEventProgress, Data: links.JobProgress{Completed: 0, Total: 2}}, receiveEventHelper(t, events))
+
+		executed := make(chan error)
+		go func() {
+			executed <- s.ExecuteLinksJob(context.Background(), job.ID)
+		}()
+
+		stream <- scraper.Result{PageURL: "http://localhost/", Success: true}
+		event := receiveEventHelper(t, events)
+		assert.Equal(t, "1", event.ID)
+		assert.Equal(t, links.JobEventResult, event.Type)
+		assert.Equal(t, links.PageResult{Sequence: 1, PageURL: "http://localhost/", Success: true}, event.Data)
+		assert.Equal(t, links.JobEvent{Type: links.JobEventProgress, Data: links.JobProgress{Completed: 1, Total: 2}}, receiveEventHelper(t, events))
+
+		stream <- scraper.Result{PageURL: "http://localhost/page1", Error: scraper.ErrBadStatusCode}
+		close(stream)
+		assert.NoError(t, <-executed)
+
+		event = receiveEventHelper(t, events)
+		assert.Equal(t, "2", event.ID)
+		assert.Equal(t, links.PageResult{Sequence: 2, PageURL: "http://localhost/page1", Error: scraper.ErrBadStatusCode.Error()}, event.Data)
+		assert.Equal(t, links.JobEvent{Type: links.JobEventProgress, Data: links.JobProgress{Completed: 2, Total: 2}}, receiveEventHelper(t, events))
+
+		event = receiveEventHelper(t, events)
+		assert.Equal(t, links.JobEventState, event.Type)
+		assert.Equal(t, links.JobStatusFinished, event.Data.(links.JobState).Status)
+
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+	t.Run("successfully resume from last event id", func(t *testing.T) {
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, nil)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/", "http://localhost/page1"})})
+		assert.NoError(t, err)
+		assert.NoError(t, repo.CreateLinksJobResult(context.Background(), []links.JobResult{
+			{JobID: job.ID, Sequence: 1, PageURL: "http://localhost/"},
+			{JobID: job.ID, Sequence: 2, PageURL: "http://localhost/page1"},
+		}))
+		assert.NoError(t, repo.FinishLinksJob(context.Background(), job.ID))
+
+		events, err := s.SubscribeLinksJobEvents(context.Background(), links.SubscribeJobEventsRequest{JobID: job.ID, LastEventID: 1})
+		assert.NoError(t, err)
+
+		got := []links.JobEvent{}
+		for event := range events {
+			got = append(got, event)
+		}
+		assert.Len(t, got, 3)
+		assert.Equal(t, "2", got[0].ID)
+		assert.Equal(t, links.JobEventProgress, got[1].Type)
+		assert.Equal(t, links.JobEventState, got[2].Type)
+	})
+	t.Run("results stored again by a redelivered job are sent once", func(t *testing.T) {
+		repo, err := repository.NewFileRepository(t.TempDir())
+		assert.NoError(t, err)
+		s := service.NewService(repo, nil)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/", "http://localhost/page1"})})
+		assert.NoError(t, err)
+		assert.NoError(t, repo.CreateLinksJobResult(context.Background(), []links.JobResult{
+			{JobID: job.ID, Sequence: 1, PageURL: "http://localhost/"},
+			{JobID: job.ID, Sequence: 1, PageURL: "http://localhost/"},
+			{JobID: job.ID, Sequence: 2, PageURL: "http://localhost/page1"},
+		}))
+		assert.NoError(t, repo.FinishLinksJob(context.Background(), job.ID))
+
+		events, err := s.SubscribeLinksJobEvents(context.Background(), links.SubscribeJobEventsRequest{JobID: job.ID})
+		assert.NoError(t, err)
+
+		got := []links.JobEvent{}
+		for event := range events {
+			got = append(got, event)
+		}
+		assert.Len(t, got, 4)
+		assert.Equal(t, "1", got[0].ID)
+		assert.Equal(t, "2", got[1].ID)
+		assert.Equal(t, links.JobProgress{Completed: 2, Total: 2}, got[2].Data)
+		assert.Equal(t, links.JobEventState, got[3].Type)
+	})
+	t.Run("wake up on changes made by other processes", func(t *testing.T) {
+		dir := t.TempDir()
+		apiNotifier, err := notifier.NewFileNotifier(dir)
+		assert.NoError(t, err)
+		defer apiNotifier.Close()
+		workerNotifier, err := notifier.NewFileNotifier(dir)
+		assert.NoError(t, err)
+		defer workerNotifier.Close()
+
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, nil, service.WithNotifier(apiNotifier))
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/"})})
+		assert.NoError(t, err)
+
+		events, err := s.SubscribeLinksJobEvents(context.Background(), links.SubscribeJobEventsRequest{JobID: job.ID})
+		assert.NoError(t, err)
+		receiveEventHelper(t, events) // initial progress
+
+		assert.NoError(t, repo.CreateLinksJobResult(context.Background(), []links.JobResult{{JobID: job.ID, Sequence: 1}}))
+		assert.NoError(t, repo.FinishLinksJob(context.Background(), job.ID))
+		workerNotifier.Notify(job.ID)
+
+		assert.Equal(t, "1", receiveEventHelper(t, events).ID)
+		assert.Equal(t, links.JobEventProgress, receiveEventHelper(t, events).Type)
+		assert.Equal(t, links.JobEventState, receiveEventHelper(t, events).Type)
+	})
+	t.Run("stop when context is done", func(t *testing.T) {
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, nil)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events, err := s.SubscribeLinksJobEvents(ctx, links.SubscribeJobEventsRequest{JobID: job.ID})
+		assert.NoError(t, err)
+		receiveEventHelper(t, events)
+		cancel()
+
+		_, ok := <-events
+		assert.False(t, ok)
+	})
+	t.Run("job not found", func(t *testing.T) {
+		s := service.NewService(repository.NewInMemoryRepository(), nil)
+		_, err := s.SubscribeLinksJobEvents(context.Background(), links.SubscribeJobEventsRequest{JobID: "missing"})
+		assert.ErrorIs(t, err, repository.ErrJobNotFound)
+	})
+}
+
+func Test_service_GetLinksJobStatusWait(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully wake up when the job finishes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mockScraper := scraperMock.NewMockScraperService(ctrl)
+		mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(resultsChanHelper([]scraper.Result{{PageURL: "http://localhost/", Success: true}}))
+
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, mockScraper)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/"})})
+		assert.NoError(t, err)
+
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			assert.NoError(t, s.ExecuteLinksJob(context.Background(), job.ID))
+		}()
+
+		// the first wake up is the job starting, the status endpoint is polled again until it finishes
+		start := time.Now()
+		results, err := s.GetLinksJobStatus(context.Background(), links.GetJobStatusRequest{JobID: job.ID, Wait: time.Second * 5})
+		for errors.Is(err, repository.ErrJobResultsNotFound) && time.Since(start) < time.Second*5 {
+			results, err = s.GetLinksJobStatus(context.Background(), links.GetJobStatusRequest{JobID: job.ID, Wait: time.Second * 5})
+		}
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Less(t, int64(time.Since(start)), int64(time.Second*5))
+	})
+	t.Run("fail - wait times out", func(t *testing.T) {
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, nil)
+		job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/"})})
+		assert.NoError(t, err)
+
+		start := time.Now()
+		_, err = s.GetLinksJobStatus(context.Background(), links.GetJobStatusRequest{JobID: job.ID, Wait: time.Millisecond * 100})
+		assert.ErrorIs(t, err, repository.ErrJobResultsNotFound)
+		assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*100))
+	})
+	t.Run("fail - job not found", func(t *testing.T) {
+		s := service.NewService(repository.NewInMemoryRepository(), nil)
+		_, err := s.GetLinksJobStatus(context.Background(), links.GetJobStatusRequest{JobID: "missing", Wait: time.Second})
+		assert.ErrorIs(t, err, repository.ErrJobNotFound)
+	})
+}
+
+func Test_service_ExecuteLinksJobAbandoned(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	mockScraper := scraperMock.NewMockScraperService(ctrl)
+	mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(resultsChanHelper([]scraper.Result{
+		{PageURL: "http://localhost/1", Success: true},
+		{PageURL: "http://localhost/2", Success: true},
+	}))
+
+	repo := repository.NewInMemoryRepository()
+	s := service.NewService(repo, mockScraper)
+	job, err := repo.CreateLinksJob(context.Background(), links.Job{URLs: test.StrToURL(t, []string{"http://localhost/1", "http://localhost/2"})})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // the lease was lost
+	err = s.ExecuteLinksJob(ctx, job.ID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	job, err = repo.GetLinksJob(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, job.FinishedAt, "left to the worker that holds the lease")
+}
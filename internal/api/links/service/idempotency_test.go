@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_EnqueueLinksJobIdempotency(t *testing.T) {
+	t.Parallel()
+	request := func(t *testing.T, rawURL string) links.EnqueueLinksJobRequest {
+		return links.EnqueueLinksJobRequest{URLs: test.StrToURL(t, []string{rawURL}), IdempotencyKey: "key"}
+	}
+
+	t.Run("successfully replay the same request", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue))
+
+		first, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		replayed, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		assert.Equal(t, first.ID, replayed.ID)
+	})
+	t.Run("fail same key with a different request", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue))
+
+		_, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		_, err = s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/other"))
+		assert.ErrorIs(t, err, repository.ErrJobAlreadyExists)
+	})
+	t.Run("successfully retry after a failed enqueue", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		gomock.InOrder(
+			queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(errors.New("some error")),
+			queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil),
+		)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue))
+
+		_, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.Error(t, err)
+		_, err = s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+	})
+	t.Run("successfully replay a request of an empty tenant as unscoped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		repo := repository.NewInMemoryRepository()
+		s := service.NewService(repo, nil, service.WithQueue(queue))
+
+		first, err := s.EnqueueLinksJob(tenant.NewContext(context.Background(), ""), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		replayed, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		assert.Equal(t, first.ID, replayed.ID, "the key and the job id are scoped the same way")
+		_, err = repo.GetLinksJob(context.Background(), first.ID)
+		assert.NoError(t, err)
+	})
+	t.Run("successfully create new jobs with different keys", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue))
+
+		first, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		req := request(t, "http://localhost/")
+		req.IdempotencyKey = "other"
+		second, err := s.EnqueueLinksJob(context.Background(), req)
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ID, second.ID)
+	})
+}
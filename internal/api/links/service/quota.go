@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/tenant"
+)
+
+// GetQuotaUsage - quota usage of the tenant of ctx, callers that aren't scoped to a tenant have no quotas
+func (s *service) GetQuotaUsage(ctx context.Context) (links.QuotaUsage, error) {
+	owner, _ := tenant.FromContext(ctx)
+	dayStart := startOfDay(time.Now().UTC())
+
+	usage, err := s.repository.GetTenantUsage(ctx, owner, dayStart)
+	if err != nil {
+		return links.QuotaUsage{}, fmt.Errorf("failed to get quota usage %w", err)
+	}
+
+	return links.QuotaUsage{
+		URLsToday:         usage.URLs,
+		MaxURLsPerDay:     s.maxURLsPerDay,
+		ActiveJobs:        usage.ActiveJobs,
+		MaxConcurrentJobs: s.maxConcurrentJobs,
+		ResetsAt:          dayStart.Add(time.Hour * 24),
+	}, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,72 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_Quotas(t *testing.T) {
+	t.Parallel()
+	request := func(t *testing.T, rawURLs ...string) links.EnqueueLinksJobRequest {
+		return links.EnqueueLinksJobRequest{URLs: test.StrToURL(t, rawURLs)}
+	}
+
+	t.Run("fail over the daily url quota", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue), service.WithQuotas(3, 0))
+		ctx := tenant.NewContext(context.Background(), "acme")
+
+		_, err := s.EnqueueLinksJob(ctx, request(t, "http://localhost/1", "http://localhost/2"))
+		assert.NoError(t, err)
+		_, err = s.EnqueueLinksJob(ctx, request(t, "http://localhost/3", "http://localhost/4"))
+		assert.ErrorIs(t, err, links.ErrURLQuotaExceeded)
+
+		usage, err := s.GetQuotaUsage(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, usage.URLsToday)
+		assert.Equal(t, 3, usage.MaxURLsPerDay)
+		assert.Equal(t, 1, usage.ActiveJobs)
+	})
+	t.Run("fail over the concurrent job quota", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+		r := repository.NewInMemoryRepository()
+		s := service.NewService(r, nil, service.WithQueue(queue), service.WithQuotas(0, 1))
+		ctx := tenant.NewContext(context.Background(), "acme")
+
+		job, err := s.EnqueueLinksJob(ctx, request(t, "http://localhost/"))
+		assert.NoError(t, err)
+		_, err = s.EnqueueLinksJob(ctx, request(t, "http://localhost/"))
+		assert.ErrorIs(t, err, links.ErrJobQuotaExceeded)
+
+		_, err = s.EnqueueLinksJob(tenant.NewContext(context.Background(), "globex"), request(t, "http://localhost/"))
+		assert.NoError(t, err, "other tenants have their own quota")
+
+		assert.NoError(t, r.FinishLinksJob(context.Background(), "acme/"+job.ID)) // stored scoped to its tenant
+		_, err = s.EnqueueLinksJob(ctx, request(t, "http://localhost/"))
+		assert.NoError(t, err)
+	})
+	t.Run("successfully skip quotas without a tenant", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := mock.NewMockQueue(ctrl)
+		queue.EXPECT().Enqueue(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		s := service.NewService(repository.NewInMemoryRepository(), nil, service.WithQueue(queue), service.WithQuotas(1, 1))
+
+		_, err := s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/1", "http://localhost/2"))
+		assert.NoError(t, err)
+		_, err = s.EnqueueLinksJob(context.Background(), request(t, "http://localhost/1", "http://localhost/2"))
+		assert.NoError(t, err)
+	})
+}
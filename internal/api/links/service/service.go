@@ -2,44 +2,264 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/notifier"
+	"github.com/buni/scraper/internal/api/links/repository"
 	"github.com/buni/scraper/internal/pkg/scraper"
+	"github.com/buni/scraper/internal/pkg/tenant"
+	"github.com/buni/scraper/internal/pkg/webhook"
 	"github.com/google/uuid"
 )
 
 type service struct {
-	scraperClient scraper.ScraperService
-	repository    links.Repository
+	scraperClient     scraper.ScraperService
+	repository        links.Repository
+	queue             links.Queue
+	webhookSender     *webhook.Sender
+	notifier          links.Notifier
+	idempotencyKeyTTL time.Duration
+	maxURLsPerDay     int
+	maxConcurrentJobs int
 }
 
-func NewService(repository links.Repository, scraperClient scraper.ScraperService) links.Service {
-	return &service{scraperClient: scraperClient, repository: repository}
+type Option func(s *service)
+
+// WithQueue makes the service publish new jobs to the queue instead of executing them in process
+// the jobs are then picked up by the workers sharing the same queue and repository
+func WithQueue(queue links.Queue) Option {
+	return func(s *service) {
+		s.queue = queue
+	}
+}
+
+// WithWebhookSender enables job callbacks, without it jobs with a callback url are rejected
+func WithWebhookSender(sender *webhook.Sender) Option {
+	return func(s *service) {
+		s.webhookSender = sender
+	}
+}
+
+// WithNotifier sets how job subscribers (event streams and status waiters) are woken up when a job changes,
+// jobs executed by workers in other processes need a notifier that reaches them, notifier.NewLocal is used without it
+func WithNotifier(n links.Notifier) Option {
+	return func(s *service) {
+		s.notifier = n
+	}
+}
+
+// WithIdempotencyKeyTTL sets how long idempotency keys are remembered, 24 hours by default
+func WithIdempotencyKeyTTL(ttl time.Duration) Option {
+	return func(s *service) {
+		s.idempotencyKeyTTL = ttl
+	}
 }
 
-// EnqueueLinksJob - create links job and start executing it
+// WithQuotas limits the urls each tenant can submit per (UTC) day and how many of its jobs can run at once, 0 means unlimited
+// callers that aren't scoped to a tenant (authentication disabled) are not limited
+func WithQuotas(maxURLsPerDay, maxConcurrentJobs int) Option {
+	return func(s *service) {
+		s.maxURLsPerDay = maxURLsPerDay
+		s.maxConcurrentJobs = maxConcurrentJobs
+	}
+}
+
+func NewService(repository links.Repository, scraperClient scraper.ScraperService, options ...Option) links.Service {
+	s := &service{scraperClient: scraperClient, repository: repository, notifier: notifier.NewLocal(), idempotencyKeyTTL: time.Hour * 24}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+// EnqueueLinksJob - create links job and start executing it (or hand it over to the queue)
 func (s *service) EnqueueLinksJob(ctx context.Context, req links.EnqueueLinksJobRequest) (job links.Job, err error) {
-	job = links.Job{ID: req.JobID, URLs: req.URLs}
+	job = links.Job{ID: req.JobID, URLs: req.URLs, Status: links.JobStatusPending, Labels: req.Labels, Options: req.Options}
+	job.Tenant, _ = tenant.FromContext(ctx)
+	if job.ID == "" && (req.IdempotencyKey != "" || job.Tenant != "") { // the key has to point to the job before the job exists
+		job.ID = uuid.NewString()
+	}
+	job.ID = scopedJobID(ctx, job.ID)
+
+	if req.CallbackURL != nil {
+		if s.webhookSender == nil {
+			return links.Job{}, links.ErrWebhooksDisabled
+		}
+		job.CallbackURL = req.CallbackURL.String()
+		job.WebhookPending = true
+	}
+
+	if req.IdempotencyKey != "" {
+		replayed, ok, err := s.claimIdempotencyKey(ctx, req, job.ID)
+		if err != nil {
+			return links.Job{}, err
+		}
+		if ok {
+			replayed.ID = publicJobID(job.Tenant, replayed.ID)
+			return replayed, nil
+		}
+	}
 
-	job, err = s.repository.CreateLinksJob(ctx, job)
+	job, err = s.createLinksJob(ctx, job)
 	if err != nil {
-		return links.Job{}, fmt.Errorf("failed to create links job %w", err)
+		s.releaseIdempotencyKey(ctx, req.IdempotencyKey)
+		return links.Job{}, err
+	}
+
+	if s.queue != nil {
+		err = s.queue.Enqueue(ctx, job.ID)
+		if err != nil {
+			s.releaseIdempotencyKey(ctx, req.IdempotencyKey)
+			return links.Job{}, fmt.Errorf("failed to enqueue links job %w", err)
+		}
+
+		job.ID = publicJobID(job.Tenant, job.ID)
+		return job, nil
 	}
 
-	go func() { // since we are not using some sort of distributed scheduler, start doing work in a go routine
-		err := s.ExecuteLinksJob(context.Background(), job.ID)
+	go func(jobID string) { // since we are not using some sort of distributed scheduler, start doing work in a go routine
+		err := s.ExecuteLinksJob(context.Background(), jobID)
 		if err != nil {
-			log.Println("failed to execute job #", job.ID)
+			log.Println("failed to execute job #", jobID)
 		}
-	}()
+	}(job.ID)
 
-	return
+	job.ID = publicJobID(job.Tenant, job.ID)
+	return job, nil
+}
+
+// createLinksJob - stores job if it fits in the quotas of its tenant, callers that aren't scoped to a tenant have no quotas
+func (s *service) createLinksJob(ctx context.Context, job links.Job) (links.Job, error) {
+	var err error
+	if _, scoped := tenant.FromContext(ctx); scoped && (s.maxURLsPerDay > 0 || s.maxConcurrentJobs > 0) {
+		job, err = s.repository.CreateLinksJobWithinQuota(ctx, job, links.TenantQuota{MaxURLsPerDay: s.maxURLsPerDay, MaxConcurrentJobs: s.maxConcurrentJobs})
+	} else {
+		job, err = s.repository.CreateLinksJob(ctx, job)
+	}
+	if err != nil {
+		return links.Job{}, fmt.Errorf("failed to create links job %w", err)
+	}
+
+	return job, nil
+}
+
+// claimIdempotencyKey - stores req.IdempotencyKey for jobID, if the key was already used for the same request
+// the job it points to is returned with ok set, a key used for a different request is an ErrJobAlreadyExists
+func (s *service) claimIdempotencyKey(ctx context.Context, req links.EnqueueLinksJobRequest, jobID string) (job links.Job, ok bool, err error) {
+	hash, err := requestHash(req)
+	if err != nil {
+		return links.Job{}, false, err
+	}
+
+	now := time.Now().UTC()
+	key, err := s.repository.CreateIdempotencyKey(ctx, links.IdempotencyKey{
+		Key:         scopedIdempotencyKey(ctx, req.IdempotencyKey),
+		RequestHash: hash,
+		JobID:       jobID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.idempotencyKeyTTL),
+	})
+	if err == nil {
+		return links.Job{}, false, nil
+	}
+	if !errors.Is(err, repository.ErrIdempotencyKeyUsed) {
+		return links.Job{}, false, fmt.Errorf("failed to create idempotency key %w", err)
+	}
+
+	if key.RequestHash != hash {
+		return links.Job{}, false, fmt.Errorf("idempotency key was used for a different request %w", repository.ErrJobAlreadyExists)
+	}
+
+	job, err = s.repository.GetLinksJob(ctx, key.JobID)
+	if errors.Is(err, repository.ErrJobNotFound) { // the original request is still creating it
+		return links.Job{ID: key.JobID}, true, nil
+	}
+	if err != nil {
+		return links.Job{}, false, fmt.Errorf("failed to get links job %w", err)
+	}
+
+	return job, true, nil
+}
+
+// releaseIdempotencyKey - lets a request that failed to create its job be retried with the same key
+func (s *service) releaseIdempotencyKey(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+
+	err := s.repository.DeleteIdempotencyKey(context.Background(), scopedIdempotencyKey(ctx, key)) // not ctx, the request may be cancelled already
+	if err != nil {
+		log.Println("failed to delete idempotency key", err)
+	}
+}
+
+// scopedJobID - job ids are unique per tenant, so a tenant can pick any job id without learning about the jobs of
+// the others. The jobs of a tenant are stored as "<tenant>/<job id>", job ids can't contain a "/"
+func scopedJobID(ctx context.Context, jobID string) string {
+	if owner, ok := tenant.FromContext(ctx); ok && owner != "" {
+		return owner + "/" + jobID
+	}
+
+	return jobID
+}
+
+// publicJobID - the id of a job stored with scopedJobID as its tenant knows it
+func publicJobID(owner, jobID string) string {
+	if owner == "" {
+		return jobID
+	}
+
+	return strings.TrimPrefix(jobID, owner+"/")
+}
+
+// scopedIdempotencyKey - keys are chosen by clients, so they are kept apart per tenant
+func scopedIdempotencyKey(ctx context.Context, key string) string {
+	if owner, ok := tenant.FromContext(ctx); ok && owner != "" {
+		return owner + "/" + key
+	}
+
+	return key
+}
+
+// requestHash - identifies a job request, map keys are sorted by json so equal requests hash the same
+func requestHash(req links.EnqueueLinksJobRequest) (string, error) {
+	canonical := struct {
+		JobID       string            `json:"job_id"`
+		URLs        []string          `json:"urls"`
+		CallbackURL string            `json:"callback_url"`
+		Labels      map[string]string `json:"labels"`
+		Options     links.JobOptions  `json:"options"`
+	}{JobID: req.JobID, Labels: req.Labels, Options: req.Options}
+
+	for _, u := range req.URLs {
+		canonical.URLs = append(canonical.URLs, u.String())
+	}
+	if req.CallbackURL != nil {
+		canonical.CallbackURL = req.CallbackURL.String()
+	}
+
+	b, err := json.Marshal(canonical)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
 }
 
 // ExecuteJob - execute links job
+// every result is stored (and subscribers are notified) as soon as the scraper produces it
 func (s *service) ExecuteLinksJob(ctx context.Context, jobID string) error {
 	jobResults := []links.JobResult{}
 
@@ -48,39 +268,122 @@ func (s *service) ExecuteLinksJob(ctx context.Context, jobID string) error {
 		return fmt.Errorf("failed to fetch links job %w", err)
 	}
 
-	results := s.scraperClient.ScrapePages(context.Background(), job.URLs)
+	if job.FinishedAt != nil { // queues deliver at least once, the job could have been finished by a previous delivery
+		if !job.WebhookPending {
+			return nil
+		}
+
+		jobResults, err = s.repository.GetLinksJobResult(ctx, job.ID)
+		if err != nil && !errors.Is(err, repository.ErrJobResultsNotFound) { // failed before its first result was stored
+			return fmt.Errorf("failed to fetch links job results %w", err)
+		}
+
+		return s.deliverWebhook(ctx, job, jobResults)
+	}
+
+	err = s.repository.StartLinksJob(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to mark links job as running %w", err)
+	}
+	s.notifier.Notify(job.ID)
+
+	scrapeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := s.scraperClient.StreamPages(scrapeCtx, job.URLs, scrapeOptions(job.Options)...)
 
-	for _, result := range results {
-		jobResults = append(jobResults, links.JobResult{
+	for result := range results {
+		if ctx.Err() != nil { // abandoned, e.g. the lease of the job was lost and another worker runs it now
+			cancel()
+			for range results {
+			}
+			return fmt.Errorf("links job abandoned %w", ctx.Err())
+		}
+
+		jobResult := links.JobResult{
 			ID:                 uuid.NewString(),
 			JobID:              job.ID,
+			Sequence:           uint(len(jobResults) + 1),
 			PageURL:            result.PageURL,
 			InternalLinksCount: result.InternalLinksCount,
 			ExternalLinksCount: result.ExternalLinksCount,
 			Success:            result.Success,
 			Error:              result.Error,
+			TLS:                toTLSInfo(result.TLS),
+			FromCache:          result.FromCache,
+			ErrorCategory:      string(result.ErrorCategory),
 			CreatedAt:          time.Now().UTC(),
 			UpdatedAt:          time.Now().UTC(),
-		})
+		}
+
+		err = s.repository.CreateLinksJobResult(ctx, []links.JobResult{jobResult})
+		if err != nil {
+			cancel()
+			for range results { // let the scrape pipeline wind down
+			}
+
+			failErr := s.repository.FailLinksJob(ctx, job.ID)
+			if failErr != nil {
+				log.Println("failed to mark job as failed #", job.ID, failErr)
+			}
+			s.notifier.Notify(job.ID)
+			webhookErr := s.deliverWebhook(ctx, job, jobResults)
+			if webhookErr != nil {
+				log.Println("failed to deliver webhook #", job.ID, webhookErr)
+			}
+			return fmt.Errorf("failed to create links job results %w", err)
+		}
+
+		jobResults = append(jobResults, jobResult)
+		s.notifier.Notify(job.ID)
 	}
 
-	err = s.repository.CreateLinksJobResult(ctx, jobResults)
-	if err != nil {
-		return fmt.Errorf("failed to create links job results %w", err)
+	if ctx.Err() != nil {
+		return fmt.Errorf("links job abandoned %w", ctx.Err())
 	}
 
 	err = s.repository.FinishLinksJob(ctx, job.ID)
 	if err != nil {
 		return fmt.Errorf("failed to mark links job as finished %w", err)
 	}
-	return nil
+
+	s.notifier.Notify(job.ID)
+
+	return s.deliverWebhook(ctx, job, jobResults)
+}
+
+// FailLinksJob - marks a job that can't be executed (e.g. it failed on every delivery) as failed,
+// its subscribers are woken up and its webhook is delivered with the results stored so far
+func (s *service) FailLinksJob(ctx context.Context, jobID string) error {
+	job, err := s.repository.GetLinksJob(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch links job %w", err)
+	}
+
+	if job.FinishedAt == nil {
+		err = s.repository.FailLinksJob(ctx, job.ID)
+		if err != nil {
+			return fmt.Errorf("failed to mark links job as failed %w", err)
+		}
+		s.notifier.Notify(job.ID)
+	}
+
+	jobResults, err := s.repository.GetLinksJobResult(ctx, job.ID)
+	if err != nil && !errors.Is(err, repository.ErrJobResultsNotFound) {
+		return fmt.Errorf("failed to fetch links job results %w", err)
+	}
+
+	return s.deliverWebhook(ctx, job, jobResults)
 }
 
 // GetJobStatus - get links job status
+// results are only returned once the job is finished, running jobs already have some of their results stored
+// with req.Wait set, an unfinished job is waited on until it changes state or the wait is over
 func (s *service) GetLinksJobStatus(ctx context.Context, req links.GetJobStatusRequest) ([]links.JobResult, error) {
-	_, err := s.repository.GetLinksJob(ctx, req.JobID)
+	req.JobID = scopedJobID(ctx, req.JobID)
+	err := s.finishedJob(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get links job results %w", err)
+		return nil, err
 	}
 
 	results, err := s.repository.GetLinksJobResult(ctx, req.JobID)
@@ -88,5 +391,125 @@ func (s *service) GetLinksJobStatus(ctx context.Context, req links.GetJobStatusR
 		return nil, fmt.Errorf("failed to get links job results %w", err)
 	}
 
+	owner, _ := tenant.FromContext(ctx)
+	for i := range results {
+		results[i].JobID = publicJobID(owner, results[i].JobID)
+	}
+
 	return results, nil
 }
+
+// ExportLinksJobResults - same as GetLinksJobStatus, but results are passed to fn one by one as they are read from the repository
+// fn errors stop the export and are returned
+func (s *service) ExportLinksJobResults(ctx context.Context, req links.GetJobStatusRequest, fn func(result links.JobResult) error) error {
+	req.JobID = scopedJobID(ctx, req.JobID)
+	err := s.finishedJob(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	owner, _ := tenant.FromContext(ctx)
+	err = s.repository.IterateLinksJobResults(ctx, req.JobID, func(result links.JobResult) error {
+		result.JobID = publicJobID(owner, result.JobID)
+		return fn(result)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export links job results %w", err)
+	}
+
+	return nil
+}
+
+// finishedJob - returns ErrJobResultsNotFound if the job is not finished (after waiting for it, if req.Wait is set)
+func (s *service) finishedJob(ctx context.Context, req links.GetJobStatusRequest) error {
+	var job links.Job
+	var err error
+
+	if req.Wait > 0 {
+		job, err = s.waitForJobChange(ctx, req.JobID, req.Wait)
+	} else {
+		job, err = s.repository.GetLinksJob(ctx, req.JobID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get links job results %w", err)
+	}
+
+	if job.FinishedAt == nil {
+		return fmt.Errorf("links job is still running %w", repository.ErrJobResultsNotFound)
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries - get the webhook delivery attempts of a links job
+func (s *service) GetWebhookDeliveries(ctx context.Context, req links.GetJobStatusRequest) ([]links.WebhookDelivery, error) {
+	req.JobID = scopedJobID(ctx, req.JobID)
+	job, err := s.repository.GetLinksJob(ctx, req.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get links job %w", err)
+	}
+
+	deliveries, err := s.repository.GetWebhookDeliveries(ctx, req.JobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries %w", err)
+	}
+
+	for i := range deliveries {
+		deliveries[i].JobID = publicJobID(job.Tenant, deliveries[i].JobID)
+	}
+
+	return deliveries, nil
+}
+
+// scrapeOptions - maps job options to scraper options, unset options are left to the scraper defaults
+func scrapeOptions(options links.JobOptions) []scraper.ScrapeOption {
+	opts := []scraper.ScrapeOption{}
+
+	if options.Timeout > 0 {
+		opts = append(opts, scraper.WithTimeout(options.Timeout))
+	}
+
+	if options.Concurrency > 0 {
+		opts = append(opts, scraper.WithScrapeConcurrency(options.Concurrency))
+	}
+
+	if options.LinkPolicy != "" {
+		opts = append(opts, scraper.WithLinkPolicy(scraper.LinkPolicy(options.LinkPolicy)))
+	}
+
+	if options.InsecureSkipVerify {
+		opts = append(opts, scraper.WithInsecureSkipVerify())
+	}
+
+	if options.MaxAge > 0 {
+		opts = append(opts, scraper.WithMaxAge(options.MaxAge))
+	}
+
+	if options.Login != nil {
+		opts = append(opts, scraper.WithLogin(options.Login.URL, options.Login.Fields))
+	}
+
+	if options.Proxy != "" {
+		opts = append(opts, scraper.WithScrapeProxy(options.Proxy))
+	}
+
+	for key, value := range options.Headers {
+		opts = append(opts, scraper.WithRequestOptions(scraper.WithHeader(key, value)))
+	}
+
+	return opts
+}
+
+func toTLSInfo(info *scraper.TLSInfo) *links.TLSInfo {
+	if info == nil {
+		return nil
+	}
+
+	return &links.TLSInfo{
+		Version:     info.Version,
+		CipherSuite: info.CipherSuite,
+		Issuer:      info.Issuer,
+		NotAfter:    info.NotAfter,
+		ExpiresSoon: info.ExpiresSoon,
+	}
+}
@@ -19,6 +19,15 @@ import (
 	"github.com/golang/mock/gomock"
 )
 
+func resultsChanHelper(results []scraper.Result) <-chan scraper.Result {
+	resultsChan := make(chan scraper.Result, len(results))
+	for _, result := range results {
+		resultsChan <- result
+	}
+	close(resultsChan)
+	return resultsChan
+}
+
 func Test_service_EnqueueLinksJob(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -63,12 +72,13 @@ func Test_service_EnqueueLinksJob(t *testing.T) {
 				}, nil)
 
 				// []string{"http://localhost/", "http://localhost/page2"}
-				mockScraper.EXPECT().ScrapePages(gomock.Any(), test.StrToURL(t,
+				mockRepo.EXPECT().StartLinksJob(gomock.Any(), gomock.Any()).Return(nil)
+				mockScraper.EXPECT().StreamPages(gomock.Any(), test.StrToURL(t,
 					[]string{
 						"http://localhost/",
 						"http://localhost/page1",
 					},
-				)).Return([]scraper.Result{
+				)).Return(resultsChanHelper([]scraper.Result{
 					{
 						PageURL:            "http://localhost/",
 						InternalLinksCount: 1,
@@ -83,8 +93,8 @@ func Test_service_EnqueueLinksJob(t *testing.T) {
 						Success:            true,
 						Error:              nil,
 					},
-				})
-				mockRepo.EXPECT().CreateLinksJobResult(gomock.Any(), gomock.Any()).Return(nil)
+				}))
+				mockRepo.EXPECT().CreateLinksJobResult(gomock.Any(), gomock.Any()).Return(nil).Times(2)
 				mockRepo.EXPECT().FinishLinksJob(gomock.Any(), uuid.Nil.String()).Return(nil)
 			},
 			wantJob: links.Job{
@@ -174,8 +184,10 @@ func Test_service_EnqueueLinksJob(t *testing.T) {
 					),
 				}, nil)
 				mockRepo.EXPECT().GetLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, nil)
-				mockScraper.EXPECT().ScrapePages(gomock.Any(), gomock.Any()).Return([]scraper.Result{})
+				mockRepo.EXPECT().StartLinksJob(gomock.Any(), gomock.Any()).Return(nil)
+				mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(resultsChanHelper([]scraper.Result{{PageURL: "http://localhost/"}}))
 				mockRepo.EXPECT().CreateLinksJobResult(gomock.Any(), gomock.Any()).Return(errors.New("some error"))
+				mockRepo.EXPECT().FailLinksJob(gomock.Any(), gomock.Any()).Return(nil)
 			},
 			wantJob: links.Job{
 				ID: uuid.Nil.String(),
@@ -211,8 +223,8 @@ func Test_service_EnqueueLinksJob(t *testing.T) {
 					),
 				}, nil)
 				mockRepo.EXPECT().GetLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{}, nil)
-				mockScraper.EXPECT().ScrapePages(gomock.Any(), gomock.Any()).Return([]scraper.Result{})
-				mockRepo.EXPECT().CreateLinksJobResult(gomock.Any(), gomock.Any()).Return(nil)
+				mockRepo.EXPECT().StartLinksJob(gomock.Any(), gomock.Any()).Return(nil)
+				mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(resultsChanHelper([]scraper.Result{}))
 				mockRepo.EXPECT().FinishLinksJob(gomock.Any(), gomock.Any()).Return(errors.New("some error"))
 			},
 			wantJob: links.Job{
@@ -248,8 +260,56 @@ func Test_service_EnqueueLinksJob(t *testing.T) {
 	}
 }
 
+func Test_service_EnqueueLinksJobWithQueue(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, mockRepo *mock.MockRepository, mockQueue *mock.MockQueue)
+		wantJob links.Job
+		wantErr bool
+	}{
+		{
+			name: "successfully enqueue links job",
+			setup: func(t *testing.T, mockRepo *mock.MockRepository, mockQueue *mock.MockQueue) {
+				mockRepo.EXPECT().CreateLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{ID: uuid.Nil.String()}, nil)
+				mockQueue.EXPECT().Enqueue(gomock.Any(), uuid.Nil.String()).Return(nil)
+			},
+			wantJob: links.Job{ID: uuid.Nil.String()},
+		},
+		{
+			name: "fail to enqueue links job",
+			setup: func(t *testing.T, mockRepo *mock.MockRepository, mockQueue *mock.MockQueue) {
+				mockRepo.EXPECT().CreateLinksJob(gomock.Any(), gomock.Any()).Return(links.Job{ID: uuid.Nil.String()}, nil)
+				mockQueue.EXPECT().Enqueue(gomock.Any(), uuid.Nil.String()).Return(errors.New("some error"))
+			},
+			wantJob: links.Job{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crtl := gomock.NewController(t)
+			repository := mock.NewMockRepository(crtl)
+			queue := mock.NewMockQueue(crtl)
+			scraper := scraperMock.NewMockScraperService(crtl) // no expectations, the job must not be executed in process
+			tt.setup(t, repository, queue)
+			s := service.NewService(repository, scraper, service.WithQueue(queue))
+			gotJob, err := s.EnqueueLinksJob(context.Background(), links.EnqueueLinksJobRequest{URLs: test.StrToURL(t, []string{"http://localhost/"})})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("service.EnqueueLinksJob() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotJob, tt.wantJob) {
+				t.Errorf("service.EnqueueLinksJob() = %v, want %v", gotJob, tt.wantJob)
+			}
+		})
+	}
+}
+
 func Test_service_GetLinksJobStatus(t *testing.T) {
 	t.Parallel()
+	epoch := time.Unix(0, 0)
 	tests := []struct {
 		name    string
 		ctx     context.Context
@@ -263,7 +323,7 @@ func Test_service_GetLinksJobStatus(t *testing.T) {
 			ctx:  context.Background(),
 			req:  links.GetJobStatusRequest{JobID: uuid.Nil.String()},
 			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
-				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{}, nil)
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{FinishedAt: &epoch}, nil)
 				mockRepo.EXPECT().GetLinksJobResult(gomock.Any(), uuid.Nil.String()).Return([]links.JobResult{
 					{
 						ID:                 uuid.Nil.String(),
@@ -322,12 +382,22 @@ func Test_service_GetLinksJobStatus(t *testing.T) {
 			ctx:  context.Background(),
 			req:  links.GetJobStatusRequest{JobID: uuid.Nil.String()},
 			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
-				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{}, nil)
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{FinishedAt: &epoch}, nil)
 				mockRepo.EXPECT().GetLinksJobResult(gomock.Any(), uuid.Nil.String()).Return(nil, repository.ErrJobNotFound)
 			},
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "job still running error",
+			ctx:  context.Background(),
+			req:  links.GetJobStatusRequest{JobID: uuid.Nil.String()},
+			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{}, nil)
+			},
+			want:    nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -347,3 +417,70 @@ func Test_service_GetLinksJobStatus(t *testing.T) {
 		})
 	}
 }
+
+func Test_service_ExportLinksJobResults(t *testing.T) {
+	t.Parallel()
+	epoch := time.Unix(0, 0)
+	results := []links.JobResult{
+		{ID: "1", JobID: uuid.Nil.String(), Sequence: 1, PageURL: "http://localhost/", Success: true},
+		{ID: "2", JobID: uuid.Nil.String(), Sequence: 2, PageURL: "http://localhost/page2", Success: true},
+	}
+	iterate := func(ctx context.Context, jobID string, fn func(result links.JobResult) error) error {
+		for _, result := range results {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, mockRepo *mock.MockRepository)
+		want    []links.JobResult
+		wantErr error
+	}{
+		{
+			name: "successfully export job results",
+			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{FinishedAt: &epoch}, nil)
+				mockRepo.EXPECT().IterateLinksJobResults(gomock.Any(), uuid.Nil.String(), gomock.Any()).DoAndReturn(iterate)
+			},
+			want: results,
+		},
+		{
+			name: "job still running error",
+			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{}, nil)
+			},
+			wantErr: repository.ErrJobResultsNotFound,
+		},
+		{
+			name: "job not found error",
+			setup: func(t *testing.T, mockRepo *mock.MockRepository) {
+				mockRepo.EXPECT().GetLinksJob(gomock.Any(), uuid.Nil.String()).Return(links.Job{}, repository.ErrJobNotFound)
+			},
+			wantErr: repository.ErrJobNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crtl := gomock.NewController(t)
+			repository := mock.NewMockRepository(crtl)
+			tt.setup(t, repository)
+			s := service.NewService(repository, nil)
+
+			got := []links.JobResult{}
+			err := s.ExportLinksJobResults(context.Background(), links.GetJobStatusRequest{JobID: uuid.Nil.String()}, func(result links.JobResult) error {
+				got = append(got, result)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("service.ExportLinksJobResults() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("service.ExportLinksJobResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/pkg/webhook"
+)
+
+// deliverWebhook posts the final job state to the job callback url (if any) and records every attempt.
+// The delivery stays pending until it succeeds or is given up on, a delivery cut short by ctx (or by the storage)
+// fails with an error so the job is redelivered and the delivery resumed from the attempts recorded so far.
+// The receiver rejecting the payload doesn't affect the job itself
+func (s *service) deliverWebhook(ctx context.Context, job links.Job, results []links.JobResult) error {
+	if !job.WebhookPending || job.CallbackURL == "" || s.webhookSender == nil {
+		return nil
+	}
+
+	job, err := s.repository.GetLinksJob(ctx, job.ID) // reload to get the terminal status and finish time
+	if err != nil {
+		return fmt.Errorf("failed to load job for webhook delivery %w", err)
+	}
+
+	previous, err := s.repository.GetWebhookDeliveries(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook deliveries %w", err)
+	}
+
+	payload, err := json.Marshal(newWebhookPayload(job, results))
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload %w", err)
+	}
+
+	var recordErr error
+	err = s.webhookSender.Resume(ctx, job.CallbackURL, payload, len(previous), func(attempt webhook.Attempt) {
+		delivery := links.WebhookDelivery{
+			JobID:      job.ID,
+			URL:        job.CallbackURL,
+			Attempt:    attempt.Number,
+			StatusCode: attempt.StatusCode,
+			Success:    attempt.Error == nil,
+			DurationMS: attempt.Duration.Milliseconds(),
+			CreatedAt:  attempt.SentAt,
+		}
+		if attempt.Error != nil {
+			delivery.Error = attempt.Error.Error()
+		}
+
+		err := s.repository.CreateWebhookDelivery(ctx, delivery)
+		if err != nil && recordErr == nil {
+			recordErr = err
+		}
+	})
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("webhook delivery interrupted %w", ctx.Err())
+	case recordErr != nil:
+		return fmt.Errorf("failed to record webhook delivery %w", recordErr)
+	case err != nil:
+		log.Println("failed to deliver webhook #", job.ID, err)
+	}
+
+	err = s.repository.CompleteLinksJobWebhook(ctx, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to complete webhook delivery %w", err)
+	}
+
+	return nil
+}
+
+func newWebhookPayload(job links.Job, results []links.JobResult) links.WebhookPayload {
+	payload := links.WebhookPayload{
+		JobID:      publicJobID(job.Tenant, job.ID),
+		Status:     job.Status,
+		Labels:     job.Labels,
+		CreatedAt:  job.CreatedAt,
+		FinishedAt: job.FinishedAt,
+		Results:    make([]links.PageResult, 0, len(results)),
+	}
+
+	for _, result := range results {
+		payload.Summary.Total++
+		if result.Success {
+			payload.Summary.Succeeded++
+		} else {
+			payload.Summary.Failed++
+		}
+
+		payload.Results = append(payload.Results, newPageResult(result))
+	}
+
+	return payload
+}
+
+func newPageResult(result links.JobResult) links.PageResult {
+	pageResult := links.PageResult{
+		Sequence:           result.Sequence,
+		PageURL:            result.PageURL,
+		InternalLinksCount: result.InternalLinksCount,
+		ExternalLinksCount: result.ExternalLinksCount,
+		Success:            result.Success,
+	}
+	if result.Error != nil {
+		pageResult.Error = result.Error.Error()
+	}
+
+	return pageResult
+}
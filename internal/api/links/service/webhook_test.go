@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	scraperMock "github.com/buni/scraper/internal/pkg/scraper/mock"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/buni/scraper/internal/pkg/webhook"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_ExecuteLinksJobWebhook(t *testing.T) {
+	t.Parallel()
+	secret := []byte("secret")
+	payloads := make(chan links.WebhookPayload, 1)
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 { // first delivery fails so it has to be retried
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.True(t, webhook.Verify(secret, r.Header.Get(webhook.TimestampHeader), body, r.Header.Get(webhook.SignatureHeader)))
+
+		payload := links.WebhookPayload{}
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		payloads <- payload
+	}))
+	defer receiver.Close()
+
+	ctrl := gomock.NewController(t)
+	mockScraper := scraperMock.NewMockScraperService(ctrl)
+	mockScraper.EXPECT().StreamPages(gomock.Any(), gomock.Any()).Return(resultsChanHelper([]scraper.Result{
+		{PageURL: "http://localhost/", InternalLinksCount: 1, Success: true},
+		{PageURL: "http://localhost/page1", Error: scraper.ErrBadStatusCode},
+	}))
+
+	sender, err := webhook.NewSender(secret, webhook.WithBackoff(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+	repo := repository.NewInMemoryRepository()
+	s := service.NewService(repo, mockScraper, service.WithWebhookSender(sender))
+
+	callbackURL, err := url.Parse(receiver.URL + "/callback")
+	assert.NoError(t, err)
+	job, err := s.EnqueueLinksJob(context.Background(), links.EnqueueLinksJobRequest{
+		URLs:        test.StrToURL(t, []string{"http://localhost/", "http://localhost/page1"}),
+		CallbackURL: callbackURL,
+	})
+	assert.NoError(t, err)
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, job.ID, payload.JobID)
+		assert.Equal(t, links.JobStatusFinished, payload.Status)
+		assert.NotNil(t, payload.FinishedAt)
+		assert.Equal(t, links.JobSummary{Total: 2, Succeeded: 1, Failed: 1}, payload.Summary)
+		assert.Equal(t, scraper.ErrBadStatusCode.Error(), payload.Results[1].Error)
+	case <-time.After(time.Second * 5):
+		t.Fatal("webhook was not delivered")
+	}
+
+	assert.Eventually(t, func() bool {
+		deliveries, err := s.GetWebhookDeliveries(context.Background(), links.GetJobStatusRequest{JobID: job.ID})
+		return err == nil && len(deliveries) == 2
+	}, time.Second, time.Millisecond*10)
+
+	deliveries, err := s.GetWebhookDeliveries(context.Background(), links.GetJobStatusRequest{JobID: job.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].StatusCode)
+	assert.False(t, deliveries[0].Success)
+	assert.Equal(t, 2, deliveries[1].Attempt)
+	assert.True(t, deliveries[1].Success)
+}
+
+func Test_service_ExecuteLinksJobResumeWebhook(t *testing.T) {
+	t.Parallel()
+	attempts := make(chan struct{}, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	sender, err := webhook.NewSender([]byte("secret"), webhook.WithBackoff(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+	repo := repository.NewInMemoryRepository()
+	s := service.NewService(repo, nil, service.WithWebhookSender(sender))
+
+	ctx := context.Background()
+	job, err := repo.CreateLinksJob(ctx, links.Job{
+		URLs:           test.StrToURL(t, []string{"http://localhost/"}),
+		CallbackURL:    receiver.URL,
+		WebhookPending: true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CreateLinksJobResult(ctx, []links.JobResult{{JobID: job.ID, Sequence: 1, PageURL: "http://localhost/", Success: true}}))
+	assert.NoError(t, repo.FinishLinksJob(ctx, job.ID))
+	assert.NoError(t, repo.CreateWebhookDelivery(ctx, links.WebhookDelivery{JobID: job.ID, URL: receiver.URL, Attempt: 1, StatusCode: http.StatusBadGateway}))
+
+	// the job was finished by a worker that went away before the webhook was delivered
+	assert.NoError(t, s.ExecuteLinksJob(ctx, job.ID))
+	assert.Len(t, attempts, 1)
+
+	deliveries, err := s.GetWebhookDeliveries(ctx, links.GetJobStatusRequest{JobID: job.ID})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, 2, deliveries[1].Attempt)
+	assert.True(t, deliveries[1].Success)
+
+	job, err = repo.GetLinksJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.False(t, job.WebhookPending)
+
+	assert.NoError(t, s.ExecuteLinksJob(ctx, job.ID))
+	assert.Len(t, attempts, 1, "delivered webhooks aren't sent again")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	pending, err := repo.CreateLinksJob(ctx, links.Job{CallbackURL: receiver.URL, WebhookPending: true})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.FinishLinksJob(ctx, pending.ID))
+	assert.ErrorIs(t, s.ExecuteLinksJob(canceled, pending.ID), context.Canceled, "interrupted deliveries are redelivered")
+	pending, err = repo.GetLinksJob(ctx, pending.ID)
+	assert.NoError(t, err)
+	assert.True(t, pending.WebhookPending)
+}
+
+func Test_service_EnqueueLinksJobWebhooksDisabled(t *testing.T) {
+	t.Parallel()
+	s := service.NewService(repository.NewInMemoryRepository(), nil)
+	callbackURL, err := url.Parse("http://localhost/callback")
+	assert.NoError(t, err)
+
+	_, err = s.EnqueueLinksJob(context.Background(), links.EnqueueLinksJobRequest{
+		URLs:        test.StrToURL(t, []string{"http://localhost/"}),
+		CallbackURL: callbackURL,
+	})
+	assert.ErrorIs(t, err, links.ErrWebhooksDisabled)
+}
+
+func Test_service_GetWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+	s := service.NewService(repository.NewInMemoryRepository(), nil)
+	_, err := s.GetWebhookDeliveries(context.Background(), links.GetJobStatusRequest{JobID: "missing"})
+	assert.ErrorIs(t, err, repository.ErrJobNotFound)
+}
+
+func Test_service_FailLinksJob(t *testing.T) {
+	t.Parallel()
+	payloads := make(chan links.WebhookPayload, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := links.WebhookPayload{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer receiver.Close()
+
+	sender, err := webhook.NewSender([]byte("secret"), webhook.WithBackoff(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+	repo := repository.NewInMemoryRepository()
+	s := service.NewService(repo, nil, service.WithWebhookSender(sender))
+
+	ctx := context.Background()
+	job, err := repo.CreateLinksJob(ctx, links.Job{
+		URLs:           test.StrToURL(t, []string{"http://localhost/", "http://localhost/other"}),
+		CallbackURL:    receiver.URL,
+		WebhookPending: true,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CreateLinksJobResult(ctx, []links.JobResult{{JobID: job.ID, Sequence: 1, PageURL: "http://localhost/", Success: true}}))
+
+	assert.NoError(t, s.FailLinksJob(ctx, job.ID))
+	job, err = repo.GetLinksJob(ctx, job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, links.JobStatusFailed, job.Status)
+	assert.NotNil(t, job.FinishedAt)
+	assert.False(t, job.WebhookPending)
+
+	assert.Len(t, payloads, 1)
+	payload := <-payloads
+	assert.Equal(t, links.JobStatusFailed, payload.Status)
+	assert.Len(t, payload.Results, 1)
+
+	assert.NoError(t, s.FailLinksJob(ctx, job.ID), "failing it again is a no-op")
+	assert.Len(t, payloads, 0)
+	assert.ErrorIs(t, s.FailLinksJob(ctx, "missing"), repository.ErrJobNotFound)
+}
@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/repository"
+)
+
+var (
+	ErrBadConcurrencyValue = errors.New("bad concurrency value")
+	ErrBadHeartbeatValue   = errors.New("bad heartbeat interval value")
+	ErrBadSnapshotValue    = errors.New("bad circuit breaker snapshot value")
+	ErrBadMaxAttemptsValue = errors.New("bad max attempts value")
+)
+
+// Worker pulls links jobs from the queue and executes them
+// multiple workers (in the same or separate processes) can share a queue and a repository
+type Worker struct {
+	queue             links.Queue
+	service           links.Service
+	concurrency       int
+	heartbeatInterval time.Duration
+	maxAttempts       int
+	processName       string        // name the circuit breakers are published under
+	snapshotInterval  time.Duration // 0 doesn't publish them
+}
+
+type Option func(w *Worker) error
+
+// WithConcurrency sets how many jobs a single worker executes in parallel
+func WithConcurrency(concurrency int) Option {
+	return func(w *Worker) error {
+		if concurrency <= 0 {
+			return ErrBadConcurrencyValue
+		}
+		w.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithHeartbeatInterval sets how often the lease of a running job is extended
+// it should be comfortably lower than the lease duration of the queue
+func WithHeartbeatInterval(interval time.Duration) Option {
+	return func(w *Worker) error {
+		if interval <= 0 {
+			return ErrBadHeartbeatValue
+		}
+		w.heartbeatInterval = interval
+		return nil
+	}
+}
+
+// WithMaxAttempts sets how many times a job is delivered before it is marked as failed and dropped from the queue,
+// so a job that fails every time doesn't take up a worker forever
+func WithMaxAttempts(attempts int) Option {
+	return func(w *Worker) error {
+		if attempts <= 0 {
+			return ErrBadMaxAttemptsValue
+		}
+		w.maxAttempts = attempts
+		return nil
+	}
+}
+
+// WithCircuitBreakerSnapshots publishes the circuit breakers of the worker's scraper under process every interval
+// while Run is running, so the api can list them. The api drops snapshots older than a minute, interval has to be shorter
+func WithCircuitBreakerSnapshots(process string, interval time.Duration) Option {
+	return func(w *Worker) error {
+		if process == "" || interval <= 0 {
+			return ErrBadSnapshotValue
+		}
+		w.processName = process
+		w.snapshotInterval = interval
+		return nil
+	}
+}
+
+// NewWorker ...
+func NewWorker(queue links.Queue, service links.Service, options ...Option) (*Worker, error) {
+	w := &Worker{queue: queue, service: service, concurrency: 1, heartbeatInterval: time.Second * 10, maxAttempts: 5}
+
+	for _, option := range options {
+		err := option(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply worker option %w", err)
+		}
+	}
+
+	return w, nil
+}
+
+// Run - processes jobs until the context is canceled
+// jobs that are already running are finished before Run returns
+func (w *Worker) Run(ctx context.Context) {
+	wg := &sync.WaitGroup{}
+
+	if w.snapshotInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.publishCircuitBreakers(ctx)
+		}()
+	}
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msg, err := w.queue.Dequeue(ctx)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					log.Println("failed to dequeue job", err)
+					time.Sleep(time.Second) // don't spin on a broken queue
+					continue
+				}
+
+				w.process(msg)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// publishCircuitBreakers publishes the circuit breakers right away and then every snapshot interval until ctx is done
+func (w *Worker) publishCircuitBreakers(ctx context.Context) {
+	ticker := time.NewTicker(w.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		err := w.service.PublishCircuitBreakers(ctx, w.processName)
+		if err != nil && ctx.Err() == nil {
+			log.Println("failed to publish circuit breakers", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process - executes the job of msg and acks it, jobs that failed are left to be redelivered once the lease expires
+// (the results of a job are replaced by sequence, so running it again is safe) until they used up their attempts,
+// then they are marked as failed and acked. Jobs whose lease was lost are abandoned without acking them,
+// another worker runs them by then
+func (w *Worker) process(msg links.QueueMessage) {
+	if msg.Attempt > w.maxAttempts { // the last attempt didn't get to an end, e.g. the worker crashed while running it
+		log.Println("giving up on job #", msg.JobID, "after", msg.Attempt-1, "attempts")
+		w.failJob(msg)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background()) // the job is not bound to the Run context, so shutdown doesn't abort it half way
+	defer cancel()
+
+	type lease struct {
+		msg  links.QueueMessage
+		lost bool
+	}
+	leases := make(chan lease, 1)
+	go func() {
+		msg, lost := w.heartbeat(ctx, cancel, msg)
+		leases <- lease{msg: msg, lost: lost}
+	}()
+
+	err := w.service.ExecuteLinksJob(ctx, msg.JobID)
+
+	cancel()
+	last := <-leases
+	msg = last.msg
+
+	switch {
+	case last.lost:
+		log.Println("abandoned job #", msg.JobID, "its lease was lost")
+		return
+	case err != nil && !errors.Is(err, repository.ErrJobNotFound) && msg.Attempt < w.maxAttempts:
+		log.Println("failed to execute job #", msg.JobID, "attempt", msg.Attempt, "it will be redelivered", err)
+		return
+	case err != nil && !errors.Is(err, repository.ErrJobNotFound):
+		log.Println("failed to execute job #", msg.JobID, "giving up after", msg.Attempt, "attempts", err)
+		w.failJob(msg)
+		return
+	case err != nil:
+		log.Println("failed to execute job #", msg.JobID, err)
+	}
+
+	w.ack(msg)
+}
+
+// failJob marks the job of msg as failed and acks msg, the message is acked even if the job can't be marked
+// so it isn't delivered again
+func (w *Worker) failJob(msg links.QueueMessage) {
+	err := w.service.FailLinksJob(context.Background(), msg.JobID)
+	if err != nil && !errors.Is(err, repository.ErrJobNotFound) {
+		log.Println("failed to mark job as failed #", msg.JobID, err)
+	}
+
+	w.ack(msg)
+}
+
+func (w *Worker) ack(msg links.QueueMessage) {
+	err := w.queue.Ack(context.Background(), msg)
+	if err != nil {
+		log.Println("failed to ack job #", msg.JobID, err)
+	}
+}
+
+// heartbeat keeps extending the lease of msg until ctx is done, and returns the last extended message.
+// Once the lease is lost the job is abandoned, abandon is called and lost is true
+func (w *Worker) heartbeat(ctx context.Context, abandon context.CancelFunc, msg links.QueueMessage) (last links.QueueMessage, lost bool) {
+	ticker := time.NewTicker(w.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return msg, false
+		case <-ticker.C:
+			extended, err := w.queue.Extend(ctx, msg)
+			if errors.Is(err, links.ErrMessageLost) {
+				abandon()
+				return msg, true
+			}
+			if err != nil {
+				log.Println("failed to extend lease of job #", msg.JobID, err)
+				continue
+			}
+			msg = extended
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/handler"
+	"github.com/buni/scraper/internal/api/links/notifier"
+	"github.com/buni/scraper/internal/api/links/queue"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/service"
+	"github.com/buni/scraper/internal/api/links/worker"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	scraperMock "github.com/buni/scraper/internal/pkg/scraper/mock"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveHelper(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: handler}
+
+	go func() {
+		srv.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return "http://" + listener.Addr().String()
+}
+
+// startWorkerHelper runs a worker the way cmd/worker does, with its own repository and queue handles on the shared dir
+func startWorkerHelper(t *testing.T, storageDir string) {
+	t.Helper()
+	repo, err := repository.NewFileRepository(storageDir)
+	assert.NoError(t, err)
+	q, err := queue.NewFileQueue(filepath.Join(storageDir, "queue"), queue.WithPollInterval(time.Millisecond*10))
+	assert.NoError(t, err)
+	scraperSvc, err := scraper.NewScraper()
+	assert.NoError(t, err)
+	n, err := notifier.NewFileNotifier(filepath.Join(storageDir, "notify"))
+	assert.NoError(t, err)
+	w, err := worker.NewWorker(q, service.NewService(repo, scraperSvc, service.WithNotifier(n)), worker.WithConcurrency(2))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		n.Close()
+	})
+}
+
+func TestWorker_RunIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping E2E tests")
+	}
+	t.Parallel()
+
+	target := chi.NewRouter()
+	target.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><a href="/internal">internal</a><a href="https://example.com/">external</a></body></html>`))
+	})
+	targetURL := serveHelper(t, target)
+
+	storageDir := t.TempDir()
+	repo, err := repository.NewFileRepository(storageDir)
+	assert.NoError(t, err)
+	q, err := queue.NewFileQueue(filepath.Join(storageDir, "queue"))
+	assert.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	apiScraper := scraperMock.NewMockScraperService(ctrl) // no expectations, the api must not scrape anything itself
+	r := chi.NewRouter()
+	n, err := notifier.NewFileNotifier(filepath.Join(storageDir, "notify"))
+	assert.NoError(t, err)
+	defer n.Close()
+	handler.NewHandler(service.NewService(repo, apiScraper, service.WithQueue(q), service.WithNotifier(n))).RegisterRoutes(r)
+	apiURL := serveHelper(t, r)
+
+	startWorkerHelper(t, storageDir)
+	startWorkerHelper(t, storageDir)
+
+	jobIDs := []string{}
+	for i := 0; i < 6; i++ {
+		body := strings.NewReader(targetURL + "/a\n" + targetURL + "/b\n")
+		resp, err := http.Post(apiURL+"/links", "text/plain", body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		enqueueResp := struct {
+			Data links.EnqueueLinksJobResponse `json:"data"`
+		}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&enqueueResp))
+		resp.Body.Close()
+		jobIDs = append(jobIDs, enqueueResp.Data.JobID)
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, jobID := range jobIDs {
+		wg.Add(1)
+		go func(jobID string) {
+			defer wg.Done()
+			deadline := time.Now().Add(time.Second * 10)
+			for time.Now().Before(deadline) {
+				resp, err := http.Get(apiURL + "/links/status/" + jobID + "?wait=5s") // woken up by the workers
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				if resp.StatusCode == http.StatusAccepted {
+					resp.Body.Close()
+					time.Sleep(time.Millisecond * 20)
+					continue
+				}
+
+				statusResp := struct {
+					Data links.JobResultsResponse `json:"data"`
+				}{}
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&statusResp))
+				resp.Body.Close()
+
+				assert.Len(t, statusResp.Data.Results, 2)
+				for _, result := range statusResp.Data.Results {
+					assert.True(t, result.Success)
+					assert.Equal(t, uint(1), result.InternalLinksCount)
+					assert.Equal(t, uint(1), result.ExternalLinksCount)
+				}
+				return
+			}
+			t.Errorf("job %s was not finished in time", jobID)
+		}(jobID)
+	}
+	wg.Wait()
+}
+
+func TestWorker_RunCircuitBreakersIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping E2E tests")
+	}
+	t.Parallel()
+
+	target := chi.NewRouter()
+	target.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	targetURL := serveHelper(t, target)
+
+	storageDir := t.TempDir()
+	repo, err := repository.NewFileRepository(storageDir)
+	assert.NoError(t, err)
+	q, err := queue.NewFileQueue(filepath.Join(storageDir, "queue"), queue.WithPollInterval(time.Millisecond*10))
+	assert.NoError(t, err)
+	api := service.NewService(repo, nil, service.WithQueue(q)) // like cmd/api with STORAGE_DIR, no scraper of its own
+
+	scraperSvc, err := scraper.NewScraper(scraper.WithCircuitBreaker(1, time.Hour))
+	assert.NoError(t, err)
+	w, err := worker.NewWorker(q, service.NewService(repo, scraperSvc),
+		worker.WithCircuitBreakerSnapshots("worker-1", time.Millisecond*10))
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	_, err = api.EnqueueLinksJob(context.Background(), links.EnqueueLinksJobRequest{
+		URLs: test.StrToURL(t, []string{targetURL + "/a"}),
+	})
+	assert.NoError(t, err)
+
+	host := strings.TrimPrefix(targetURL, "http://")
+	assert.Eventually(t, func() bool {
+		breakers, err := api.GetCircuitBreakers(context.Background())
+		if err != nil || len(breakers) != 1 {
+			return false
+		}
+		return breakers[0].Host == host && breakers[0].State == "open" && breakers[0].Process == "worker-1"
+	}, time.Second*5, time.Millisecond*10)
+}
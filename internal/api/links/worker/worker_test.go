@@ -0,0 +1,165 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links"
+	"github.com/buni/scraper/internal/api/links/mock"
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/api/links/worker"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorker_Run(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		setup func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc)
+	}{
+		{
+			name: "successfully execute and ack job",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job"}
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").Return(nil),
+					mockQueue.EXPECT().Ack(gomock.Any(), msg).DoAndReturn(func(ctx context.Context, msg links.QueueMessage) error {
+						cancel()
+						return nil
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "leave failed job to be redelivered",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job"}
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").DoAndReturn(func(ctx context.Context, jobID string) error {
+						cancel()
+						return errors.New("some error")
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "fail and ack job that failed its last attempt",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job", Attempt: 5}
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").Return(errors.New("some error")),
+					mockService.EXPECT().FailLinksJob(gomock.Any(), "job").Return(nil),
+					mockQueue.EXPECT().Ack(gomock.Any(), msg).DoAndReturn(func(ctx context.Context, msg links.QueueMessage) error {
+						cancel()
+						return nil
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "fail and ack job past its attempts without executing it",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job", Attempt: 6}
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().FailLinksJob(gomock.Any(), "job").Return(errors.New("some error")),
+					mockQueue.EXPECT().Ack(gomock.Any(), msg).DoAndReturn(func(ctx context.Context, msg links.QueueMessage) error {
+						cancel()
+						return nil
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "ack missing job",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job"}
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").Return(fmt.Errorf("failed to fetch links job %w", repository.ErrJobNotFound)),
+					mockQueue.EXPECT().Ack(gomock.Any(), msg).DoAndReturn(func(ctx context.Context, msg links.QueueMessage) error {
+						cancel()
+						return nil
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "abandon job with a lost lease",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job"}
+				mockQueue.EXPECT().Extend(gomock.Any(), msg).Return(links.QueueMessage{}, links.ErrMessageLost).Times(1)
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").DoAndReturn(func(ctx context.Context, jobID string) error {
+						<-ctx.Done()
+						time.Sleep(time.Millisecond * 30) // no more heartbeats
+						cancel()
+						return ctx.Err()
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+		{
+			name: "extend lease of long running job",
+			setup: func(mockQueue *mock.MockQueue, mockService *mock.MockService, cancel context.CancelFunc) {
+				msg := links.QueueMessage{ID: "1", JobID: "job"}
+				extended := links.QueueMessage{ID: "1", JobID: "job", LeaseExpiresAt: time.Unix(1, 0)}
+				mockQueue.EXPECT().Extend(gomock.Any(), gomock.Any()).Return(extended, nil).MinTimes(1)
+				gomock.InOrder(
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(msg, nil),
+					mockService.EXPECT().ExecuteLinksJob(gomock.Any(), "job").DoAndReturn(func(ctx context.Context, jobID string) error {
+						time.Sleep(time.Millisecond * 50)
+						return nil
+					}),
+					mockQueue.EXPECT().Ack(gomock.Any(), extended).DoAndReturn(func(ctx context.Context, msg links.QueueMessage) error {
+						cancel()
+						return nil
+					}),
+					mockQueue.EXPECT().Dequeue(gomock.Any()).Return(links.QueueMessage{}, context.Canceled),
+				)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			queue := mock.NewMockQueue(ctrl)
+			service := mock.NewMockService(ctrl)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			tt.setup(queue, service, cancel)
+
+			w, err := worker.NewWorker(queue, service, worker.WithHeartbeatInterval(time.Millisecond*10))
+			assert.NoError(t, err)
+			w.Run(ctx)
+		})
+	}
+}
+
+func TestNewWorker(t *testing.T) {
+	t.Parallel()
+	_, err := worker.NewWorker(nil, nil, worker.WithConcurrency(0))
+	assert.ErrorIs(t, err, worker.ErrBadConcurrencyValue)
+	_, err = worker.NewWorker(nil, nil, worker.WithHeartbeatInterval(0))
+	assert.ErrorIs(t, err, worker.ErrBadHeartbeatValue)
+	_, err = worker.NewWorker(nil, nil, worker.WithMaxAttempts(0))
+	assert.ErrorIs(t, err, worker.ErrBadMaxAttemptsValue)
+	_, err = worker.NewWorker(nil, nil, worker.WithCircuitBreakerSnapshots("", time.Second))
+	assert.ErrorIs(t, err, worker.ErrBadSnapshotValue)
+	_, err = worker.NewWorker(nil, nil, worker.WithCircuitBreakerSnapshots("worker", 0))
+	assert.ErrorIs(t, err, worker.ErrBadSnapshotValue)
+}
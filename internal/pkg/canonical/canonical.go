@@ -0,0 +1,232 @@
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var ErrBadTrackingParam = errors.New("bad tracking parameter")
+
+// DefaultTrackingParams - query parameters that only carry analytics, a trailing * matches any parameter with that prefix
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"gclid",
+	"dclid",
+	"gbraid",
+	"wbraid",
+	"fbclid",
+	"msclkid",
+	"yclid",
+	"twclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_ga",
+	"_gl",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+}
+
+// defaultPorts - ports that are implied by the scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Default - canonicalizer that strips DefaultTrackingParams
+var Default, _ = New() // can't fail without options
+
+// Canonicalizer - rewrites urls that point to the same page to the same url
+type Canonicalizer struct {
+	trackingParams   map[string]bool
+	trackingPrefixes []string
+}
+
+type Option func(c *Canonicalizer) error
+
+// WithTrackingParams replaces DefaultTrackingParams with params (matched case insensitively), no params disables stripping
+func WithTrackingParams(params ...string) Option {
+	return func(c *Canonicalizer) error {
+		for _, param := range params {
+			if strings.TrimSuffix(strings.TrimSpace(param), "*") == "" {
+				return fmt.Errorf("%w %q", ErrBadTrackingParam, param)
+			}
+		}
+
+		c.trackingParams = map[string]bool{}
+		c.trackingPrefixes = nil
+		c.addTrackingParams(params)
+		return nil
+	}
+}
+
+// New - canonicalizer that strips DefaultTrackingParams unless WithTrackingParams says otherwise
+func New(options ...Option) (*Canonicalizer, error) {
+	c := &Canonicalizer{trackingParams: map[string]bool{}}
+	c.addTrackingParams(DefaultTrackingParams)
+
+	for _, option := range options {
+		err := option(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply canonical option %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Canonicalizer) addTrackingParams(params []string) {
+	for _, param := range params {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if strings.HasSuffix(param, "*") {
+			c.trackingPrefixes = append(c.trackingPrefixes, strings.TrimSuffix(param, "*"))
+			continue
+		}
+		c.trackingParams[param] = true
+	}
+}
+
+func (c *Canonicalizer) tracking(param string) bool {
+	param = strings.ToLower(param)
+	if c.trackingParams[param] {
+		return true
+	}
+
+	for _, prefix := range c.trackingPrefixes {
+		if strings.HasPrefix(param, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// URL - canonical copy of u: lower case scheme and host, no default port, dot segments resolved,
+// no trailing slash (the root path is always /), tracking parameters stripped, the query sorted by key and no fragment
+func (c *Canonicalizer) URL(u *url.URL) *url.URL {
+	canonical := *u
+	canonical.User = nil
+	if u.User != nil {
+		user := *u.User
+		canonical.User = &user
+	}
+
+	canonical.Scheme = strings.ToLower(canonical.Scheme)
+	canonical.Host = Host(u)
+	canonical.Fragment = ""
+	canonical.RawFragment = ""
+	canonical.ForceQuery = false
+	canonical.RawQuery = c.query(canonical.RawQuery)
+
+	if canonical.Opaque == "" {
+		escaped := cleanPath(canonical.EscapedPath())
+		path, err := url.PathUnescape(escaped)
+		if err == nil {
+			canonical.Path = path
+			canonical.RawPath = escaped
+		}
+	}
+
+	return &canonical
+}
+
+// String - canonical form of u, urls with the same string are the same page
+func (c *Canonicalizer) String(u *url.URL) string {
+	return c.URL(u).String()
+}
+
+// query - raw query without tracking parameters and sorted by key, the order of repeated keys and the encoding are kept
+func (c *Canonicalizer) query(rawQuery string) string {
+	type param struct {
+		key string
+		raw string
+	}
+
+	params := []param{}
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		key := raw
+		if i := strings.IndexByte(raw, '='); i >= 0 {
+			key = raw[:i]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		if c.tracking(key) {
+			continue
+		}
+		params = append(params, param{key: key, raw: raw})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool { return params[i].key < params[j].key })
+
+	raws := make([]string, 0, len(params))
+	for _, p := range params {
+		raws = append(raws, p.raw)
+	}
+
+	return strings.Join(raws, "&")
+}
+
+// Host - lower cased host of u without the trailing dot and the default port of its scheme
+func Host(u *url.URL) string {
+	host := strings.ToLower(u.Host)
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil { // no port
+		return strings.TrimSuffix(host, ".")
+	}
+
+	if port == defaultPorts[strings.ToLower(u.Scheme)] {
+		port = ""
+	}
+
+	hostname = strings.TrimSuffix(hostname, ".")
+	if port == "" {
+		if strings.Contains(hostname, ":") { // ipv6 literal
+			return "[" + hostname + "]"
+		}
+		return hostname
+	}
+
+	return net.JoinHostPort(hostname, port)
+}
+
+// Hostname - lower cased host name of u without the trailing dot
+func Hostname(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// cleanPath - escaped path with its dot segments resolved (RFC 3986 5.2.4) and without trailing slashes
+func cleanPath(escaped string) string {
+	if escaped == "" {
+		return "/"
+	}
+
+	segments := strings.Split(escaped, "/")
+	cleaned := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		switch segment {
+		case ".":
+		case "..":
+			if len(cleaned) > 1 { // the empty segment before the leading / is never removed
+				cleaned = cleaned[:len(cleaned)-1]
+			}
+		default:
+			cleaned = append(cleaned, segment)
+		}
+	}
+
+	path := strings.TrimRight(strings.Join(cleaned, "/"), "/")
+	if path == "" && strings.HasPrefix(escaped, "/") {
+		return "/"
+	}
+
+	return path
+}
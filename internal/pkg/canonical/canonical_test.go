@@ -0,0 +1,76 @@
+package canonical
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalizer_String(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawURL  string
+		options []Option
+		want    string
+	}{
+		{name: "request example", rawURL: "http://Example.com:80/a/../b?utm_source=x#top", want: "http://example.com/b"},
+		{name: "scheme and host case", rawURL: "HTTPS://WWW.Example.COM/Path", want: "https://www.example.com/Path"},
+		{name: "empty path", rawURL: "http://example.com", want: "http://example.com/"},
+		{name: "default https port", rawURL: "https://example.com:443/", want: "https://example.com/"},
+		{name: "other ports are kept", rawURL: "http://example.com:443/a", want: "http://example.com:443/a"},
+		{name: "ipv6 default port", rawURL: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "trailing dot", rawURL: "http://example.com./a", want: "http://example.com/a"},
+		{name: "dot segments", rawURL: "http://example.com/a/./b/../../c/./d", want: "http://example.com/c/d"},
+		{name: "dot segments above the root", rawURL: "http://example.com/../../a", want: "http://example.com/a"},
+		{name: "trailing slash", rawURL: "http://example.com/a/b/", want: "http://example.com/a/b"},
+		{name: "trailing dot segment", rawURL: "http://example.com/a/b/..", want: "http://example.com/a"},
+		{name: "root", rawURL: "http://example.com/a/..", want: "http://example.com/"},
+		{name: "query sorted by key", rawURL: "http://example.com/?b=2&a=1&b=1", want: "http://example.com/?a=1&b=2&b=1"},
+		{name: "tracking params", rawURL: "http://example.com/?UTM_Medium=x&id=1&gclid=y&fbclid=z", want: "http://example.com/?id=1"},
+		{name: "only tracking params", rawURL: "http://example.com/a?utm_source=x&", want: "http://example.com/a"},
+		{name: "empty query", rawURL: "http://example.com/a?", want: "http://example.com/a"},
+		{name: "encoding is kept", rawURL: "http://example.com/a%2Fb/?q=a%20b", want: "http://example.com/a%2Fb?q=a%20b"},
+		{
+			name:    "custom tracking params",
+			rawURL:  "http://example.com/?utm_source=x&ref=y&ref_id=z&session_1=a",
+			options: []Option{WithTrackingParams("ref", "session_*")},
+			want:    "http://example.com/?ref_id=z&utm_source=x",
+		},
+		{
+			name:    "stripping disabled",
+			rawURL:  "http://example.com/?utm_source=x",
+			options: []Option{WithTrackingParams()},
+			want:    "http://example.com/?utm_source=x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.options...)
+			assert.NoError(t, err)
+
+			u, err := url.Parse(tt.rawURL)
+			assert.NoError(t, err)
+			before := u.String()
+
+			assert.Equal(t, tt.want, c.String(u))
+			assert.Equal(t, before, u.String(), "the url is not modified")
+		})
+	}
+}
+
+func TestCanonicalizer_sameURLs(t *testing.T) {
+	a, err := url.Parse("http://Example.com:80/a/../b?utm_source=x#top")
+	assert.NoError(t, err)
+	b, err := url.Parse("http://example.com/b")
+	assert.NoError(t, err)
+
+	assert.Equal(t, Default.String(b), Default.String(a))
+}
+
+func TestWithTrackingParams(t *testing.T) {
+	for _, param := range []string{"", " ", "*"} {
+		_, err := New(WithTrackingParams("ref", param))
+		assert.ErrorIs(t, err, ErrBadTrackingParam)
+	}
+}
@@ -0,0 +1,360 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buni/scraper/internal/api/links/repository"
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"github.com/buni/scraper/internal/pkg/credentials"
+	"github.com/buni/scraper/internal/pkg/dnscache"
+	"github.com/buni/scraper/internal/pkg/safedial"
+	"github.com/buni/scraper/internal/pkg/scraper"
+)
+
+var ErrBadValue = errors.New("bad environment value")
+
+func badValue(name, value string) error {
+	return fmt.Errorf("%w %s=%q", ErrBadValue, name, value)
+}
+
+// RepositoryOptions - options of the file repository shared by the api and the workers,
+// STORAGE_SECRET seals the credentials of queued jobs (login fields, headers), without it they are stored as is
+func RepositoryOptions() []repository.FileRepositoryOption {
+	secret := os.Getenv("STORAGE_SECRET")
+	if secret == "" {
+		log.Println("STORAGE_SECRET isn't set, job credentials are stored unencrypted")
+		return nil
+	}
+
+	return []repository.FileRepositoryOption{repository.WithSecretKey([]byte(secret))}
+}
+
+// DialPolicy - outgoing connections (scrapes, sitemaps, webhooks) can't reach private and internal addresses,
+// DIAL_ALLOW_CIDRS (comma separated) makes exceptions and DIAL_UNRESTRICTED=true turns the check off (nil policy)
+func DialPolicy() (*safedial.Policy, error) {
+	if unrestricted, _ := strconv.ParseBool(os.Getenv("DIAL_UNRESTRICTED")); unrestricted {
+		return nil, nil
+	}
+
+	options := []safedial.Option{}
+	if v := os.Getenv("DIAL_ALLOW_CIDRS"); v != "" {
+		options = append(options, safedial.WithAllowedCIDRs(strings.Split(v, ",")...))
+	}
+
+	policy, err := safedial.NewPolicy(options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dial policy %w", err)
+	}
+
+	return policy, nil
+}
+
+// Canonicalizer - TRACKING_PARAMS (comma separated, a trailing * matches a prefix) replaces the query parameters
+// that are stripped when urls are compared, set but empty keeps every parameter
+func Canonicalizer() (*canonical.Canonicalizer, error) {
+	v, ok := os.LookupEnv("TRACKING_PARAMS")
+	if !ok {
+		return canonical.Default, nil
+	}
+
+	params := []string{}
+	for _, param := range strings.Split(v, ",") {
+		if strings.TrimSpace(param) != "" {
+			params = append(params, param)
+		}
+	}
+
+	c, err := canonical.New(canonical.WithTrackingParams(params...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create canonicalizer %w", err)
+	}
+
+	return c, nil
+}
+
+// ScraperOptions - scraper options from the environment, shared by the api and the worker so both scrape the same way.
+// Scrapes are dialed through policy unless it is nil and urls are compared with c
+func ScraperOptions(policy *safedial.Policy, c *canonical.Canonicalizer) ([]scraper.ScraperOption, error) {
+	options := []scraper.ScraperOption{scraper.WithCanonicalizer(c)}
+	if policy != nil {
+		options = append(options, scraper.WithSafeDialer(policy))
+	}
+
+	for _, fromEnv := range []func() ([]scraper.ScraperOption, error){
+		proxyOptions,
+		credentialOptions,
+		tlsOptions,
+		cacheOptions,
+		pageLimitOptions,
+		circuitBreakerOptions,
+		hostConcurrencyOptions,
+		resolverOptions,
+	} {
+		more, err := fromEnv()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, more...)
+	}
+
+	return options, nil
+}
+
+// proxyOptions - SCRAPE_PROXIES (comma separated http, https or socks5 urls) sends scrapes through a proxy pool,
+// SCRAPE_PROXY_ROTATION picks round-robin (default) or sticky (per host) rotation
+func proxyOptions() ([]scraper.ScraperOption, error) {
+	proxies := os.Getenv("SCRAPE_PROXIES")
+	if proxies == "" {
+		return nil, nil
+	}
+
+	poolOptions := []scraper.ProxyPoolOption{}
+	if rotation := os.Getenv("SCRAPE_PROXY_ROTATION"); rotation != "" {
+		poolOptions = append(poolOptions, scraper.WithProxyRotation(scraper.ProxyRotation(rotation)))
+	}
+
+	pool, err := scraper.NewProxyPool(strings.Split(proxies, ","), poolOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create proxy pool %w", err)
+	}
+
+	return []scraper.ScraperOption{scraper.WithProxyPool(pool)}, nil
+}
+
+// credentialOptions - CREDENTIALS_FILE points to a json array of credentials (see credentials.Credential)
+// the scraper sends to the hosts they are for
+func credentialOptions() ([]scraper.ScraperOption, error) {
+	path := os.Getenv("CREDENTIALS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials file %w", err)
+	}
+	defer file.Close()
+
+	store, err := credentials.Load(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials %w", err)
+	}
+	log.Printf("loaded %d credentials from %s", store.Len(), path)
+
+	return []scraper.ScraperOption{scraper.WithCredentials(store)}, nil
+}
+
+// tlsOptions - SCRAPE_ROOT_CAS (pem file) adds trusted roots, SCRAPE_CLIENT_CERT and SCRAPE_CLIENT_KEY (pem files)
+// set the mutual tls certificate, SCRAPE_MIN_TLS_VERSION (1.0-1.3) and SCRAPE_CERT_EXPIRY_WARNING (duration) the tls limits
+func tlsOptions() ([]scraper.ScraperOption, error) {
+	options := []scraper.ScraperOption{}
+
+	if path := os.Getenv("SCRAPE_ROOT_CAS"); path != "" {
+		pemCerts, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read root cas %w", err)
+		}
+		options = append(options, scraper.WithRootCAs(pemCerts))
+	}
+
+	if certPath := os.Getenv("SCRAPE_CLIENT_CERT"); certPath != "" {
+		certPEM, err := os.ReadFile(certPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client certificate %w", err)
+		}
+		keyPEM, err := os.ReadFile(os.Getenv("SCRAPE_CLIENT_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client key %w", err)
+		}
+		options = append(options, scraper.WithClientCertificate(certPEM, keyPEM))
+	}
+
+	if v := os.Getenv("SCRAPE_MIN_TLS_VERSION"); v != "" {
+		versions := map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+		version, ok := versions[v]
+		if !ok {
+			return nil, badValue("SCRAPE_MIN_TLS_VERSION", v)
+		}
+		options = append(options, scraper.WithMinTLSVersion(version))
+	}
+
+	if v := os.Getenv("SCRAPE_CERT_EXPIRY_WARNING"); v != "" {
+		window, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_CERT_EXPIRY_WARNING", v)
+		}
+		options = append(options, scraper.WithCertificateExpiryWarning(window))
+	}
+
+	return options, nil
+}
+
+// cacheOptions - SCRAPE_CACHE=memory or SCRAPE_CACHE=file (stored in SCRAPE_CACHE_DIR) makes repeated scrapes
+// conditional requests, SCRAPE_CACHE_SIZE caps the cached pages (10000 by default)
+func cacheOptions() ([]scraper.ScraperOption, error) {
+	maxEntries := 10000
+	if v := os.Getenv("SCRAPE_CACHE_SIZE"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_CACHE_SIZE", v)
+		}
+		maxEntries = parsed
+	}
+
+	var (
+		cache scraper.Cache
+		err   error
+	)
+	switch backend := os.Getenv("SCRAPE_CACHE"); backend {
+	case "":
+		return nil, nil
+	case "memory":
+		cache, err = scraper.NewMemoryCache(maxEntries)
+	case "file":
+		dir := os.Getenv("SCRAPE_CACHE_DIR")
+		if dir == "" {
+			return nil, badValue("SCRAPE_CACHE_DIR", dir)
+		}
+		cache, err = scraper.NewFileCache(dir, maxEntries)
+	default:
+		return nil, badValue("SCRAPE_CACHE", backend)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache %w", err)
+	}
+
+	return []scraper.ScraperOption{scraper.WithCache(cache)}, nil
+}
+
+// pageLimitOptions - SCRAPE_PAGE_TIMEOUT (30s by default) and SCRAPE_IDLE_TIMEOUT (10s) bound how long a single page can take,
+// SCRAPE_MAX_BODY_BYTES (10MB) how large it can be once decompressed
+func pageLimitOptions() ([]scraper.ScraperOption, error) {
+	options := []scraper.ScraperOption{}
+
+	if v := os.Getenv("SCRAPE_PAGE_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_PAGE_TIMEOUT", v)
+		}
+		options = append(options, scraper.WithPageTimeout(timeout))
+	}
+
+	if v := os.Getenv("SCRAPE_IDLE_TIMEOUT"); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_IDLE_TIMEOUT", v)
+		}
+		options = append(options, scraper.WithIdleTimeout(timeout))
+	}
+
+	if v := os.Getenv("SCRAPE_MAX_BODY_BYTES"); v != "" {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, badValue("SCRAPE_MAX_BODY_BYTES", v)
+		}
+		options = append(options, scraper.WithMaxBodyBytes(maxBytes))
+	}
+
+	return options, nil
+}
+
+// circuitBreakerOptions - pages of a host fail fast once SCRAPE_CIRCUIT_FAILURES (5 by default) of its pages in a row failed,
+// until SCRAPE_CIRCUIT_COOLDOWN (30s) passes
+func circuitBreakerOptions() ([]scraper.ScraperOption, error) {
+	failures, cooldown := 5, time.Second*30
+	set := false
+
+	if v := os.Getenv("SCRAPE_CIRCUIT_FAILURES"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_CIRCUIT_FAILURES", v)
+		}
+		failures, set = parsed, true
+	}
+
+	if v := os.Getenv("SCRAPE_CIRCUIT_COOLDOWN"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_CIRCUIT_COOLDOWN", v)
+		}
+		cooldown, set = parsed, true
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	return []scraper.ScraperOption{scraper.WithCircuitBreaker(failures, cooldown)}, nil
+}
+
+// hostConcurrencyOptions - pages of a host are fetched SCRAPE_HOST_CONCURRENCY (8 by default) at a time at first,
+// the limit adapts to the responses of the host up to SCRAPE_MAX_HOST_CONCURRENCY (64)
+func hostConcurrencyOptions() ([]scraper.ScraperOption, error) {
+	initial, max := 8, 64
+	set := false
+
+	if v := os.Getenv("SCRAPE_HOST_CONCURRENCY"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_HOST_CONCURRENCY", v)
+		}
+		initial, set = parsed, true
+	}
+
+	if v := os.Getenv("SCRAPE_MAX_HOST_CONCURRENCY"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, badValue("SCRAPE_MAX_HOST_CONCURRENCY", v)
+		}
+		max, set = parsed, true
+	}
+
+	if !set {
+		return nil, nil
+	}
+
+	return []scraper.ScraperOption{scraper.WithHostConcurrency(initial, max)}, nil
+}
+
+// resolverOptions - host names are resolved once per DNS_CACHE_TTL (1m by default, 0 turns the cache off), names that
+// don't exist once per DNS_NEGATIVE_TTL (10s), through DNS_SERVER if it's set instead of the system servers
+func resolverOptions() ([]scraper.ScraperOption, error) {
+	resolverOptions := []dnscache.Option{}
+
+	if v := os.Getenv("DNS_CACHE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("DNS_CACHE_TTL", v)
+		}
+		if ttl == 0 {
+			return nil, nil
+		}
+		resolverOptions = append(resolverOptions, dnscache.WithTTL(ttl))
+	}
+
+	if v := os.Getenv("DNS_NEGATIVE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, badValue("DNS_NEGATIVE_TTL", v)
+		}
+		resolverOptions = append(resolverOptions, dnscache.WithNegativeTTL(ttl))
+	}
+
+	if v := os.Getenv("DNS_SERVER"); v != "" {
+		resolverOptions = append(resolverOptions, dnscache.WithServer(v))
+	}
+
+	resolver, err := dnscache.New(resolverOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resolver %w", err)
+	}
+
+	return []scraper.ScraperOption{scraper.WithResolver(resolver)}, nil
+}
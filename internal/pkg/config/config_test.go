@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"github.com/buni/scraper/internal/pkg/scraper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialPolicy(t *testing.T) {
+	t.Run("restricted by default", func(t *testing.T) {
+		policy, err := DialPolicy()
+		assert.NoError(t, err)
+		assert.NotNil(t, policy)
+	})
+	t.Run("unrestricted", func(t *testing.T) {
+		t.Setenv("DIAL_UNRESTRICTED", "true")
+		policy, err := DialPolicy()
+		assert.NoError(t, err)
+		assert.Nil(t, policy)
+	})
+	t.Run("bad allowed cidr", func(t *testing.T) {
+		t.Setenv("DIAL_ALLOW_CIDRS", "10.0.0.0/8,nope")
+		_, err := DialPolicy()
+		assert.Error(t, err)
+	})
+}
+
+func TestCanonicalizer(t *testing.T) {
+	c, err := Canonicalizer()
+	assert.NoError(t, err)
+	assert.Equal(t, canonical.Default, c)
+
+	t.Setenv("TRACKING_PARAMS", "")
+	c, err = Canonicalizer()
+	assert.NoError(t, err)
+	assert.NotEqual(t, canonical.Default, c, "set but empty keeps every parameter")
+}
+
+func TestScraperOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "successfully configure everything",
+			env: map[string]string{
+				"SCRAPE_PROXIES":              "http://proxy.internal:3128",
+				"SCRAPE_MIN_TLS_VERSION":      "1.2",
+				"SCRAPE_CERT_EXPIRY_WARNING":  "72h",
+				"SCRAPE_CACHE":                "memory",
+				"SCRAPE_PAGE_TIMEOUT":         "5s",
+				"SCRAPE_IDLE_TIMEOUT":         "2s",
+				"SCRAPE_MAX_BODY_BYTES":       "1024",
+				"SCRAPE_CIRCUIT_FAILURES":     "3",
+				"SCRAPE_HOST_CONCURRENCY":     "2",
+				"SCRAPE_MAX_HOST_CONCURRENCY": "4",
+				"DNS_CACHE_TTL":               "0",
+			},
+		},
+		{name: "bad tls version", env: map[string]string{"SCRAPE_MIN_TLS_VERSION": "1.4"}, wantErr: true},
+		{name: "bad cache backend", env: map[string]string{"SCRAPE_CACHE": "redis"}, wantErr: true},
+		{name: "file cache without a directory", env: map[string]string{"SCRAPE_CACHE": "file"}, wantErr: true},
+		{name: "bad cache size", env: map[string]string{"SCRAPE_CACHE": "memory", "SCRAPE_CACHE_SIZE": "many"}, wantErr: true},
+		{name: "bad page timeout", env: map[string]string{"SCRAPE_PAGE_TIMEOUT": "soon"}, wantErr: true},
+		{name: "bad body limit", env: map[string]string{"SCRAPE_MAX_BODY_BYTES": "10MB"}, wantErr: true},
+		{name: "bad circuit cooldown", env: map[string]string{"SCRAPE_CIRCUIT_COOLDOWN": "later"}, wantErr: true},
+		{name: "bad host concurrency", env: map[string]string{"SCRAPE_HOST_CONCURRENCY": "lots"}, wantErr: true},
+		{name: "bad dns ttl", env: map[string]string{"DNS_CACHE_TTL": "forever"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			options, err := ScraperOptions(nil, canonical.Default)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBadValue)
+				return
+			}
+			assert.NoError(t, err)
+
+			_, err = scraper.NewScraper(options...)
+			assert.NoError(t, err)
+		})
+	}
+}
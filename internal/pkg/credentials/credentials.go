@@ -0,0 +1,300 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	ErrBadCredential = errors.New("bad credential")
+	ErrBadFile       = errors.New("bad credentials file")
+)
+
+// BasicAuth ...
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Credential - auth headers, cookies and extra headers sent to the hosts matching one of Hosts,
+// a host is either exact ("staging.example.com", "staging.example.com:8443") or a sub domain wildcard ("*.example.com")
+type Credential struct {
+	Hosts       []string          `json:"hosts"`
+	BasicAuth   *BasicAuth        `json:"basic_auth,omitempty"`
+	BearerToken string            `json:"bearer_token,omitempty"`
+	Cookies     map[string]string `json:"cookies,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+// String - describes the credential without its secrets, so it's safe to log
+func (c Credential) String() string {
+	kinds := []string{}
+	if c.BasicAuth != nil {
+		kinds = append(kinds, "basic auth")
+	}
+	if c.BearerToken != "" {
+		kinds = append(kinds, "bearer token")
+	}
+	if len(c.Cookies) > 0 {
+		kinds = append(kinds, fmt.Sprintf("%d cookies", len(c.Cookies)))
+	}
+	if len(c.Headers) > 0 {
+		kinds = append(kinds, fmt.Sprintf("%d headers", len(c.Headers)))
+	}
+
+	return fmt.Sprintf("%s (%s)", strings.Join(c.Hosts, ", "), strings.Join(kinds, ", "))
+}
+
+// headerNames - headers Apply sets for the credential
+func (c Credential) headerNames() []string {
+	names := []string{}
+	if c.BasicAuth != nil || c.BearerToken != "" {
+		names = append(names, "Authorization")
+	}
+	if len(c.Cookies) > 0 {
+		names = append(names, "Cookie")
+	}
+	for name := range c.Headers {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// secrets - values that must not show up in logs or results
+func (c Credential) secrets() []string {
+	secrets := []string{}
+	if c.BasicAuth != nil {
+		secrets = append(secrets, base64.StdEncoding.EncodeToString([]byte(c.BasicAuth.Username+":"+c.BasicAuth.Password)))
+		if c.BasicAuth.Password != "" {
+			secrets = append(secrets, c.BasicAuth.Password)
+		}
+	}
+	if c.BearerToken != "" {
+		secrets = append(secrets, c.BearerToken)
+	}
+	for _, value := range c.Cookies {
+		secrets = append(secrets, value)
+	}
+	for _, value := range c.Headers {
+		secrets = append(secrets, value)
+	}
+
+	return secrets
+}
+
+func (c Credential) validate() error {
+	if len(c.Hosts) == 0 {
+		return fmt.Errorf("%w at least one host is required", ErrBadCredential)
+	}
+
+	for _, host := range c.Hosts {
+		if !validHostPattern(host) {
+			return fmt.Errorf("%w invalid host %q", ErrBadCredential, host)
+		}
+	}
+
+	if c.BasicAuth != nil && c.BearerToken != "" {
+		return fmt.Errorf("%w basic_auth and bearer_token can't be combined", ErrBadCredential)
+	}
+
+	if c.BasicAuth != nil && (c.BasicAuth.Username == "" || strings.Contains(c.BasicAuth.Username, ":")) {
+		return fmt.Errorf("%w basic_auth username must be set and can't contain ':'", ErrBadCredential)
+	}
+
+	if !httpguts.ValidHeaderFieldValue(c.BearerToken) {
+		return fmt.Errorf("%w invalid bearer_token", ErrBadCredential)
+	}
+
+	for name, value := range c.Cookies {
+		if (&http.Cookie{Name: name, Value: value}).String() == "" {
+			return fmt.Errorf("%w invalid cookie %q", ErrBadCredential, name)
+		}
+	}
+
+	for name, value := range c.Headers {
+		if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("%w invalid header %q", ErrBadCredential, name)
+		}
+	}
+
+	return nil
+}
+
+func validHostPattern(pattern string) bool {
+	host := strings.TrimPrefix(pattern, "*.")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return host != "" && host == strings.ToLower(host) && !strings.ContainsAny(host, "*/ ")
+}
+
+// matchHost - reports whether pattern covers host (as in url.Host, the port is optional)
+func matchHost(pattern, host string) bool {
+	host = strings.ToLower(host)
+	if pattern == host {
+		return true
+	}
+
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(hostname, pattern[1:])
+	}
+
+	return pattern == hostname
+}
+
+// Store - credentials by host, the first credential that matches a host is the one used for it
+type Store struct {
+	credentials []Credential
+	secrets     []string
+}
+
+// NewStore ...
+func NewStore(credentials []Credential) (*Store, error) {
+	store := &Store{credentials: credentials}
+
+	for i, credential := range credentials {
+		err := credential.validate()
+		if err != nil {
+			return nil, fmt.Errorf("credential #%d %w", i, err)
+		}
+		store.secrets = append(store.secrets, credential.secrets()...)
+	}
+
+	// longer secrets first, so one that contains another is redacted as a whole
+	sort.Slice(store.secrets, func(i, j int) bool { return len(store.secrets[i]) > len(store.secrets[j]) })
+
+	return store, nil
+}
+
+// Load - reads a store from a json array of credentials
+func Load(r io.Reader) (*Store, error) {
+	credentials := []Credential{}
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&credentials)
+	if err != nil {
+		return nil, fmt.Errorf("%w %v", ErrBadFile, err)
+	}
+
+	return NewStore(credentials)
+}
+
+// Len - number of credentials in the store
+func (s *Store) Len() int {
+	return len(s.credentials)
+}
+
+// lookup - the credential of host
+func (s *Store) lookup(host string) (Credential, bool) {
+	for _, credential := range s.credentials {
+		for _, pattern := range credential.Hosts {
+			if matchHost(pattern, host) {
+				return credential, true
+			}
+		}
+	}
+
+	return Credential{}, false
+}
+
+// Apply - sets the auth header, cookies and headers of the credential matching the host of req,
+// it has the signature of scraper.ScrapeRequestOption
+func (s *Store) Apply(req *http.Request) error {
+	credential, ok := s.lookup(req.URL.Host)
+	if !ok {
+		return nil
+	}
+
+	if credential.BasicAuth != nil {
+		req.SetBasicAuth(credential.BasicAuth.Username, credential.BasicAuth.Password)
+	}
+	if credential.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+credential.BearerToken)
+	}
+
+	names := make([]string, 0, len(credential.Cookies))
+	for name := range credential.Cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		req.AddCookie(&http.Cookie{Name: name, Value: credential.Cookies[name]})
+	}
+
+	for name, value := range credential.Headers {
+		req.Header.Set(name, value)
+	}
+
+	return nil
+}
+
+// Strip - removes the headers the credential of host sets from req,
+// for redirects that carry the headers of the previous request to another host
+func (s *Store) Strip(req *http.Request, host string) {
+	credential, ok := s.lookup(host)
+	if !ok {
+		return
+	}
+
+	for _, name := range credential.headerNames() {
+		req.Header.Del(name)
+	}
+}
+
+// Redact - replaces the secrets of the store found in text
+func (s *Store) Redact(text string) string {
+	for _, secret := range s.secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+
+	return text
+}
+
+// redactedError - err with the secrets taken out of its message, errors.Is/As still see err
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// RedactError - err with the secrets of the store taken out of its message
+func (s *Store) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	message := s.Redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+
+	return &redactedError{err: err, message: message}
+}
@@ -0,0 +1,130 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials []Credential
+		wantErr     error
+	}{
+		{
+			name: "successfully create store",
+			credentials: []Credential{
+				{Hosts: []string{"staging.example.com", "*.staging.example.com:8443"}, BasicAuth: &BasicAuth{Username: "user", Password: "pass"}},
+				{Hosts: []string{"api.example.com"}, BearerToken: "token", Cookies: map[string]string{"session": "abc"}, Headers: map[string]string{"X-Env": "staging"}},
+			},
+		},
+		{name: "empty store"},
+		{name: "no hosts", credentials: []Credential{{BearerToken: "token"}}, wantErr: ErrBadCredential},
+		{name: "bad host", credentials: []Credential{{Hosts: []string{"Staging.example.com"}}}, wantErr: ErrBadCredential},
+		{name: "bad wildcard", credentials: []Credential{{Hosts: []string{"staging.*.com"}}}, wantErr: ErrBadCredential},
+		{name: "basic auth and bearer token", credentials: []Credential{{Hosts: []string{"a.com"}, BasicAuth: &BasicAuth{Username: "user"}, BearerToken: "token"}}, wantErr: ErrBadCredential},
+		{name: "bad username", credentials: []Credential{{Hosts: []string{"a.com"}, BasicAuth: &BasicAuth{Username: "us:er"}}}, wantErr: ErrBadCredential},
+		{name: "bad token", credentials: []Credential{{Hosts: []string{"a.com"}, BearerToken: "to\nken"}}, wantErr: ErrBadCredential},
+		{name: "bad cookie", credentials: []Credential{{Hosts: []string{"a.com"}, Cookies: map[string]string{"ses sion": "abc"}}}, wantErr: ErrBadCredential},
+		{name: "bad header", credentials: []Credential{{Hosts: []string{"a.com"}, Headers: map[string]string{"X Env": "staging"}}}, wantErr: ErrBadCredential},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStore(tt.credentials)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("successfully load store", func(t *testing.T) {
+		store, err := Load(strings.NewReader(`[{"hosts":["a.com"],"basic_auth":{"username":"user","password":"pass"}},{"hosts":["b.com"],"cookies":{"session":"abc"}}]`))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, store.Len())
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := Load(strings.NewReader(`[{"hosts":["a.com"],"token":"abc"}]`))
+		assert.ErrorIs(t, err, ErrBadFile)
+	})
+	t.Run("invalid credential", func(t *testing.T) {
+		_, err := Load(strings.NewReader(`[{"hosts":[]}]`))
+		assert.ErrorIs(t, err, ErrBadCredential)
+	})
+}
+
+func TestStore_Apply(t *testing.T) {
+	store, err := NewStore([]Credential{
+		{Hosts: []string{"staging.example.com"}, BasicAuth: &BasicAuth{Username: "user", Password: "pass"}},
+		{Hosts: []string{"*.example.com"}, BearerToken: "token", Cookies: map[string]string{"session": "abc", "env": "staging"}, Headers: map[string]string{"X-Env": "staging"}},
+		{Hosts: []string{"example.org:8443"}, BearerToken: "other"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantHeader http.Header
+	}{
+		{name: "exact host", url: "https://staging.example.com/", wantHeader: http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}},
+		{name: "exact host with port", url: "https://staging.example.com:8080/", wantHeader: http.Header{"Authorization": {"Basic dXNlcjpwYXNz"}}},
+		{name: "wildcard", url: "https://API.example.com/", wantHeader: http.Header{"Authorization": {"Bearer token"}, "Cookie": {"env=staging; session=abc"}, "X-Env": {"staging"}}},
+		{name: "wildcard doesn't cover the apex", url: "https://example.com/", wantHeader: http.Header{}},
+		{name: "port has to match", url: "https://example.org/", wantHeader: http.Header{}},
+		{name: "host with port", url: "https://example.org:8443/", wantHeader: http.Header{"Authorization": {"Bearer other"}}},
+		{name: "no match", url: "https://example.net/", wantHeader: http.Header{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			assert.NoError(t, err)
+
+			assert.NoError(t, store.Apply(req))
+			assert.Equal(t, tt.wantHeader, req.Header)
+		})
+	}
+}
+
+func TestStore_Strip(t *testing.T) {
+	store, err := NewStore([]Credential{{Hosts: []string{"a.com"}, BearerToken: "token", Cookies: map[string]string{"session": "abc"}, Headers: map[string]string{"X-Env": "staging"}}})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "https://b.com/", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("X-Env", "staging")
+	req.Header.Set("Accept-Language", "en")
+
+	store.Strip(req, "b.com")
+	assert.Len(t, req.Header, 4)
+
+	store.Strip(req, "a.com")
+	assert.Equal(t, http.Header{"Accept-Language": {"en"}}, req.Header)
+}
+
+func TestStore_Redact(t *testing.T) {
+	store, err := NewStore([]Credential{
+		{Hosts: []string{"a.com"}, BasicAuth: &BasicAuth{Username: "user", Password: "hunter2"}},
+		{Hosts: []string{"b.com"}, BearerToken: "secret-token", Headers: map[string]string{"X-Api-Key": "secret"}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "sent [REDACTED] and [REDACTED] as [REDACTED]", store.Redact("sent secret-token and secret as dXNlcjpodW50ZXIy"))
+	assert.Equal(t, "password [REDACTED]", store.Redact("password hunter2"))
+
+	errTest := errors.New("rejected")
+	err = store.RedactError(fmt.Errorf("token secret-token %w", errTest))
+	assert.EqualError(t, err, "token [REDACTED] rejected")
+	assert.ErrorIs(t, err, errTest)
+
+	assert.Equal(t, errTest, store.RedactError(errTest))
+	assert.NoError(t, store.RedactError(nil))
+
+	assert.NotContains(t, fmt.Sprint(store.credentials), "hunter2")
+	assert.NotContains(t, fmt.Sprint(store.credentials), "secret")
+}
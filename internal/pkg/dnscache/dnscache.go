@@ -0,0 +1,263 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadTTL    = errors.New("bad ttl")
+	ErrBadServer = errors.New("bad dns server")
+)
+
+const (
+	defaultTTL         = time.Minute
+	defaultNegativeTTL = time.Second * 10
+	lookupTimeout      = time.Second * 10
+	dialTimeout        = time.Second * 30 // split between the addresses of a name when the dial has no deadline
+	minDialTimeout     = time.Second * 2  // an address gets at least this much of the time left, unless the deadline is closer
+)
+
+// Resolver - caches the addresses of names for the ttl and the names that don't exist for the negative ttl,
+// the record ttls aren't used. Concurrent lookups of a name share a single query
+type Resolver struct {
+	resolver    *net.Resolver
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+	minDial     time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	sweptAt time.Time
+}
+
+type entry struct {
+	ips       []net.IP
+	err       error
+	expiresAt time.Time
+	done      chan struct{} // closed once the lookup is done, ips, err and expiresAt are set by then
+}
+
+type Option func(r *Resolver) error
+
+// WithTTL sets how long the addresses of a name are reused
+func WithTTL(ttl time.Duration) Option {
+	return func(r *Resolver) error {
+		if ttl <= 0 {
+			return ErrBadTTL
+		}
+		r.ttl = ttl
+		return nil
+	}
+}
+
+// WithNegativeTTL sets how long names that don't exist fail without a new query,
+// other failures (timeouts, unreachable servers) aren't cached
+func WithNegativeTTL(ttl time.Duration) Option {
+	return func(r *Resolver) error {
+		if ttl <= 0 {
+			return ErrBadTTL
+		}
+		r.negativeTTL = ttl
+		return nil
+	}
+}
+
+// WithServer sends the queries to the dns server at address (host or host:port, port 53 by default)
+// instead of the servers of the system
+func WithServer(address string) Option {
+	return func(r *Resolver) error {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || host == "" || port == "" {
+			return fmt.Errorf("%w %q", ErrBadServer, address)
+		}
+
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, address)
+			},
+		}
+		return nil
+	}
+}
+
+// New - resolver that uses the dns servers of the system and caches addresses for a minute, missing names for 10s
+func New(options ...Option) (*Resolver, error) {
+	r := &Resolver{
+		resolver:    net.DefaultResolver,
+		ttl:         defaultTTL,
+		negativeTTL: defaultNegativeTTL,
+		now:         time.Now,
+		minDial:     minDialTimeout,
+		entries:     map[string]*entry{},
+	}
+
+	for _, option := range options {
+		err := option(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply resolver option %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// LookupIP - addresses of host, the returned slice is shared and must not be modified
+func (r *Resolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	r.mu.Lock()
+	now := r.now()
+	r.sweep(now)
+
+	e, ok := r.entries[host]
+	if ok && (!isDone(e) || now.Before(e.expiresAt)) { // in flight or fresh
+		r.mu.Unlock()
+		return wait(ctx, e)
+	}
+
+	e = &entry{done: make(chan struct{})}
+	r.entries[host] = e
+	r.mu.Unlock()
+
+	go r.lookup(host, e)
+
+	return wait(ctx, e)
+}
+
+// lookup - resolves host for e, the query isn't tied to the callers so one of them giving up doesn't fail the others
+func (r *Resolver) lookup(host string, e *entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		e.ips = make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			e.ips = append(e.ips, addr.IP)
+		}
+		e.expiresAt = r.now().Add(r.ttl)
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		e.err = err
+		e.expiresAt = r.now().Add(r.negativeTTL)
+	default:
+		e.err = err
+		if r.entries[host] == e {
+			delete(r.entries, host) // the next lookup asks again
+		}
+	}
+
+	close(e.done)
+}
+
+// sweep - drops the expired entries once per ttl, has to be called with mu held
+func (r *Resolver) sweep(now time.Time) {
+	if now.Sub(r.sweptAt) < r.ttl {
+		return
+	}
+	r.sweptAt = now
+
+	for host, e := range r.entries {
+		if isDone(e) && !now.Before(e.expiresAt) {
+			delete(r.entries, host)
+		}
+	}
+}
+
+func isDone(e *entry) bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func wait(ctx context.Context, e *entry) ([]net.IP, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-e.done:
+		return e.ips, e.err
+	}
+}
+
+// DialContext - wraps dial so host names are resolved through r, the addresses of a name are dialed in order
+// until one of them connects. The time left is split between the addresses, so one that doesn't answer doesn't hold up
+// the others until the deadline. dial only sees addresses, so its checks (e.g. safedial.Policy) apply to every one of them
+func (r *Resolver) DialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		ips, err := r.LookupIP(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		addresses := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			if (network == "tcp4" && ip.To4() == nil) || (network == "tcp6" && ip.To4() != nil) {
+				continue
+			}
+			addresses = append(addresses, net.JoinHostPort(ip.String(), port))
+		}
+
+		if len(addresses) == 0 {
+			return nil, &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+		}
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			deadline = time.Now().Add(dialTimeout)
+		}
+
+		var firstErr error
+		for i, address := range addresses {
+			addressCtx, cancel := context.WithDeadline(ctx, r.partialDeadline(deadline, len(addresses)-i))
+			conn, err := dial(addressCtx, network, address)
+			cancel() // connected conns aren't tied to the context anymore
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		return nil, firstErr
+	}
+}
+
+// partialDeadline - deadline of the next of the remaining addresses, it gets its share of the time left
+// but at least minDial of it, the way net.Dialer splits the time between the addresses it resolves itself
+func (r *Resolver) partialDeadline(deadline time.Time, remaining int) time.Time {
+	timeout := time.Until(deadline) / time.Duration(remaining)
+	if timeout < r.minDial {
+		timeout = r.minDial
+	}
+
+	if partial := time.Now().Add(timeout); partial.Before(deadline) {
+		return partial
+	}
+
+	return deadline
+}
@@ -0,0 +1,162 @@
+package dnscache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver_LookupIP(t *testing.T) {
+	t.Parallel()
+	server, queries := test.DNSServer(t, map[string]string{"cached.test": "127.0.0.2"})
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+
+	r, err := New(WithServer(server), WithTTL(time.Minute), WithNegativeTTL(time.Second*10))
+	assert.NoError(t, err)
+	r.now = clock
+	ctx := context.Background()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := r.LookupIP(ctx, "cached.test")
+			assert.NoError(t, err)
+			assert.Equal(t, []net.IP{net.ParseIP("127.0.0.2").To4()}, ips)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(queries), "concurrent lookups share the query")
+
+	advance(time.Second * 59)
+	_, err = r.LookupIP(ctx, "cached.test")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(queries), "cached within the ttl")
+
+	advance(time.Second)
+	_, err = r.LookupIP(ctx, "cached.test")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(queries), "asked again after the ttl")
+
+	var dnsErr *net.DNSError
+	_, err = r.LookupIP(ctx, "missing.test")
+	assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsNotFound, err)
+	_, err = r.LookupIP(ctx, "missing.test")
+	assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsNotFound, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(queries), "missing names are cached")
+
+	advance(time.Second * 10)
+	_, err = r.LookupIP(ctx, "missing.test")
+	assert.Error(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(queries), "for the negative ttl")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = r.LookupIP(canceled, "other.test")
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestResolver_DialContext(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	t.Cleanup(srv.Close)
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	assert.NoError(t, err)
+
+	server, queries := test.DNSServer(t, map[string]string{"site.test": "127.0.0.1"})
+	r, err := New(WithServer(server))
+	assert.NoError(t, err)
+
+	dialed := []string{}
+	transport := &http.Transport{DialContext: r.DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	}), DisableKeepAlives: true}
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://site.test:" + port + "/")
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(queries))
+	assert.Equal(t, []string{"127.0.0.1:" + port, "127.0.0.1:" + port, "127.0.0.1:" + port}, dialed, "dial only sees addresses")
+
+	resp, err := client.Get(srv.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(queries), "addresses aren't resolved")
+
+	_, err = client.Get("http://missing.test:" + port + "/")
+	var dnsErr *net.DNSError
+	assert.True(t, errors.As(err, &dnsErr), err)
+}
+
+func TestResolver_DialContextUnreachableAddress(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(srv.Close)
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	assert.NoError(t, err)
+
+	r, err := New()
+	assert.NoError(t, err)
+	r.minDial = time.Millisecond * 10
+	done := make(chan struct{})
+	close(done)
+	r.entries["site.test"] = &entry{ips: []net.IP{net.ParseIP("10.255.255.1"), net.ParseIP("127.0.0.1")}, expiresAt: time.Now().Add(time.Hour), done: done}
+
+	dial := r.DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+		if strings.HasPrefix(address, "10.255.255.1:") { // blackholed, nothing ever answers
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, address)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	start := time.Now()
+	conn, err := dial(ctx, "tcp", "site.test:"+port)
+	assert.NoError(t, err, "the unreachable address doesn't use up the deadline")
+	if conn != nil {
+		conn.Close()
+	}
+	assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*1500), "it gets its share of the time")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(WithTTL(0))
+	assert.ErrorIs(t, err, ErrBadTTL)
+	_, err = New(WithNegativeTTL(-time.Second))
+	assert.ErrorIs(t, err, ErrBadTTL)
+	_, err = New(WithServer(""))
+	assert.ErrorIs(t, err, ErrBadServer)
+	_, err = New(WithServer("1.1.1.1"))
+	assert.NoError(t, err)
+}
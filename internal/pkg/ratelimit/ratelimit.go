@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadRateValue  = errors.New("bad rate value")
+	ErrBadBurstValue = errors.New("bad burst value")
+)
+
+// idleTTL - buckets of clients that haven't made a request for this long are full again, so they are dropped
+const idleTTL = time.Minute * 10
+
+// Result - outcome of a single Allow call, enough to fill the X-RateLimit-* and Retry-After headers
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // requests that can be made right away
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request is allowed, zero if Allowed
+}
+
+// Limiter - token bucket per client key, refilled at rate tokens per second up to burst
+type Limiter struct {
+	rate    float64
+	burst   int
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter - allows every key rate requests per second on average, and bursts of up to burst requests
+func NewLimiter(rate float64, burst int) (*Limiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, ErrBadRateValue
+	}
+
+	if burst <= 0 {
+		return nil, ErrBadBurstValue
+	}
+
+	return &Limiter{rate: rate, burst: burst, now: time.Now, buckets: map[string]*bucket{}}, nil
+}
+
+// Allow - takes a token from the bucket of key if there is one
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := Result{Limit: l.burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = l.duration(float64(l.burst) - b.tokens)
+
+	return result
+}
+
+// duration - time it takes to refill tokens
+func (l *Limiter) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.rate * float64(time.Second)))
+}
+
+// sweep - drops idle buckets, at most once per idleTTL so Allow stays cheap
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleTTL {
+		return
+	}
+	l.swept = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Parallel()
+	now := time.Unix(0, 0)
+	l, err := NewLimiter(2, 3) // a token every 500ms
+	assert.NoError(t, err)
+	l.now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		got := l.Allow("client")
+		assert.True(t, got.Allowed)
+		assert.Equal(t, 3, got.Limit)
+		assert.Equal(t, i, got.Remaining)
+	}
+
+	got := l.Allow("client")
+	assert.False(t, got.Allowed)
+	assert.Equal(t, time.Millisecond*500, got.RetryAfter)
+	assert.Equal(t, time.Millisecond*1500, got.Reset)
+
+	assert.True(t, l.Allow("other").Allowed, "clients have their own buckets")
+
+	now = now.Add(time.Millisecond * 500)
+	got = l.Allow("client")
+	assert.True(t, got.Allowed)
+	assert.Equal(t, 0, got.Remaining)
+
+	now = now.Add(time.Hour)
+	got = l.Allow("client")
+	assert.True(t, got.Allowed)
+	assert.Equal(t, 2, got.Remaining, "the bucket doesn't grow past burst")
+}
+
+func TestNewLimiter(t *testing.T) {
+	t.Parallel()
+	_, err := NewLimiter(0, 1)
+	assert.ErrorIs(t, err, ErrBadRateValue)
+	_, err = NewLimiter(1, 0)
+	assert.ErrorIs(t, err, ErrBadBurstValue)
+}
@@ -0,0 +1,171 @@
+package safedial
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not allowed")
+	ErrBadCIDR        = errors.New("bad cidr")
+)
+
+// deniedCIDRs - addresses that are not reachable from the internet (or shouldn't be reached through it),
+// the cloud metadata endpoints (169.254.169.254, 100.100.100.200, fd00:ec2::254) are part of these ranges
+var deniedCIDRs = []string{
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // rfc1918
+	"100.64.0.0/10",  // carrier grade nat
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link local
+	"172.16.0.0/12",  // rfc1918
+	"192.0.0.0/24",   // ietf protocol assignments
+	"192.168.0.0/16", // rfc1918
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, including broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // nat64, maps to ipv4 addresses that would have to be checked again
+	"64:ff9b:1::/48", // local use nat64
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link local
+	"ff00::/8",       // multicast
+	"2001:db8::/32",  // documentation
+}
+
+// Policy decides which addresses can be connected to, by default everything but the denied ranges is allowed
+type Policy struct {
+	denied  []*net.IPNet
+	allowed []*net.IPNet
+}
+
+type Option func(p *Policy) error
+
+// WithAllowedCIDRs allows connecting to cidrs (or single addresses) even if they are in a denied range, e.g. for intranet targets
+func WithAllowedCIDRs(cidrs ...string) Option {
+	return func(p *Policy) error {
+		nets, err := parseCIDRs(cidrs)
+		if err != nil {
+			return err
+		}
+		p.allowed = append(p.allowed, nets...)
+		return nil
+	}
+}
+
+// WithDeniedCIDRs denies cidrs on top of the default ranges
+func WithDeniedCIDRs(cidrs ...string) Option {
+	return func(p *Policy) error {
+		nets, err := parseCIDRs(cidrs)
+		if err != nil {
+			return err
+		}
+		p.denied = append(p.denied, nets...)
+		return nil
+	}
+}
+
+// NewPolicy - policy that denies private, loopback, link local and other non public ranges
+func NewPolicy(options ...Option) (*Policy, error) {
+	denied, err := parseCIDRs(deniedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{denied: denied}
+
+	for _, option := range options {
+		err := option(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply policy option %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// Allowed - true if ip can be connected to, the allow list wins over the deny list
+func (p *Policy) Allowed(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil { // ipv4 mapped ipv6 addresses are checked as ipv4
+		ip = ip4
+	}
+
+	for _, n := range p.allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, n := range p.denied {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Control - net.Dialer.Control func, it runs after the host name is resolved and right before connecting,
+// so it covers every address a name resolves to, redirects and dns rebinding
+func (p *Policy) Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w %s", ErrBlockedAddress, address)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !p.Allowed(ip) {
+		return fmt.Errorf("%w %s", ErrBlockedAddress, host)
+	}
+
+	return nil
+}
+
+// Transport - cleanhttp transport that only connects to allowed addresses
+// proxies from the environment are not used, the proxy would make the connections the policy can't see
+func (p *Policy) Transport() *http.Transport {
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   p.Control,
+	}).DialContext
+
+	return transport
+}
+
+// Client - http client with Transport and timeout
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: p.Transport(), Timeout: timeout}
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		if ip := net.ParseIP(cidr); ip != nil { // a single address
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", ErrBadCIDR, cidr)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
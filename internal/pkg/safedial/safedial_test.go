@@ -0,0 +1,91 @@
+package safedial
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Allowed(t *testing.T) {
+	t.Parallel()
+	p, err := NewPolicy(WithAllowedCIDRs("10.1.0.0/16", "192.168.1.10"), WithDeniedCIDRs("93.184.216.0/24"))
+	assert.NoError(t, err)
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "1.1.1.1", want: true},
+		{ip: "2606:4700:4700::1111", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "10.0.0.1"},
+		{ip: "172.31.255.255"},
+		{ip: "192.168.1.11"},
+		{ip: "169.254.169.254"},
+		{ip: "100.100.100.200"},
+		{ip: "0.0.0.0"},
+		{ip: "::1"},
+		{ip: "::ffff:127.0.0.1"},
+		{ip: "fd00:ec2::254"},
+		{ip: "fe80::1"},
+		{ip: "93.184.216.34"},
+		{ip: "10.1.2.3", want: true},
+		{ip: "192.168.1.10", want: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.ip, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, p.Allowed(net.ParseIP(tt.ip)))
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	t.Parallel()
+	_, err := NewPolicy(WithAllowedCIDRs("10.0.0.0/33"))
+	assert.ErrorIs(t, err, ErrBadCIDR)
+}
+
+func TestPolicy_Client(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", "127.0.0.2", 1)+"/", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Run("fail loopback", func(t *testing.T) {
+		p, err := NewPolicy()
+		assert.NoError(t, err)
+		_, err = p.Client(time.Second).Get(srv.URL)
+		assert.ErrorIs(t, err, ErrBlockedAddress)
+	})
+	t.Run("successfully connect to allowed address", func(t *testing.T) {
+		p, err := NewPolicy(WithAllowedCIDRs("127.0.0.1"))
+		assert.NoError(t, err)
+		resp, err := p.Client(time.Second).Get(srv.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+	t.Run("fail redirect to a denied address", func(t *testing.T) {
+		p, err := NewPolicy(WithAllowedCIDRs("127.0.0.1"))
+		assert.NoError(t, err)
+		_, err = p.Client(time.Second).Get(srv.URL + "/redirect")
+		assert.ErrorIs(t, err, ErrBlockedAddress)
+	})
+	t.Run("fail name resolving to a denied address", func(t *testing.T) {
+		p, err := NewPolicy()
+		assert.NoError(t, err)
+		_, err = p.Client(time.Second).Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+		assert.ErrorIs(t, err, ErrBlockedAddress)
+	})
+}
@@ -0,0 +1,264 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/canonical"
+)
+
+var ErrBadHostConcurrencyValue = errors.New("bad host concurrency value")
+
+const (
+	defaultHostConcurrency    = 8
+	defaultMaxHostConcurrency = 64
+	hostLatencyTolerance      = 2   // the smoothed latency of a host can grow to this many times its baseline before backing off
+	hostLatencySmoothing      = 0.2 // weight of the latest response in the smoothed latency
+	hostLatencyDrift          = 100 // the baseline moves 1/100 of the way towards slower responses, so a host that got slower for good isn't throttled forever
+	hostIdleTTL               = time.Minute * 10
+	hostSweepInterval         = time.Minute
+
+	decreaseReasonThrottled = "throttled"
+	decreaseReasonLatency   = "latency"
+)
+
+var (
+	// hostConcurrency - current concurrency limit by host, exposed on /debug/vars
+	hostConcurrency = expvar.NewMap("scraper_host_concurrency")
+	// hostConcurrencyDecreases - how often host limits were backed off, by reason, exposed on /debug/vars
+	hostConcurrencyDecreases = expvar.NewMap("scraper_host_concurrency_decreases")
+)
+
+// WithHostConcurrency sets how many pages of a single host are fetched in parallel, starting at initial.
+// The limit of a host grows by one per round of responses while their latency stays flat, and is halved
+// (down to 1, at most once per round) on 429 and 503 responses or once the latency grows. It can't go over max.
+// A page waits for a slot of its host in the worker that took it, so once a host is at its limit the workers
+// of a scrape pile up behind its pages and pages of other hosts wait for them too
+func WithHostConcurrency(initial, max int) ScraperOption {
+	return func(s *Scraper) error {
+		if initial <= 0 || max < initial {
+			return ErrBadHostConcurrencyValue
+		}
+		s.hostLimits = newHostLimiter(initial, max)
+		return nil
+	}
+}
+
+type hostState struct {
+	limit       int
+	flat        int // flat responses since the limit last changed, the limit grows once there were limit of them
+	inflight    int
+	baseline    time.Duration // the latency the host had without load
+	smoothed    time.Duration
+	decreasedAt time.Time
+	lastUsed    time.Time
+	wake        chan struct{} // closed when a slot frees up or the limit grows
+}
+
+// hostLimiter - aimd concurrency limits by host, hosts are forgotten once they're idle for hostIdleTTL
+type hostLimiter struct {
+	mu        sync.Mutex
+	initial   int
+	max       int
+	hosts     map[string]*hostState
+	now       func() time.Time
+	sweptAt   time.Time
+	setMetric func(host string, limit int)
+}
+
+func newHostLimiter(initial, max int) *hostLimiter {
+	return &hostLimiter{
+		initial: initial,
+		max:     max,
+		hosts:   map[string]*hostState{},
+		now:     time.Now,
+		setMetric: func(host string, limit int) {
+			if limit == 0 {
+				hostConcurrency.Delete(host)
+				return
+			}
+			value := &expvar.Int{}
+			value.Set(int64(limit))
+			hostConcurrency.Set(host, value)
+		},
+	}
+}
+
+// hostSlot - permission to fetch a page of host, it has to be released once the fetch is done
+type hostSlot struct {
+	limiter *hostLimiter
+	host    string
+	start   time.Time
+}
+
+// acquire - waits until host has a free slot, fails with the error of ctx if it is done first
+func (l *hostLimiter) acquire(ctx context.Context, host string) (*hostSlot, error) {
+	for {
+		l.mu.Lock()
+		now := l.now()
+		l.sweep(now)
+
+		h, ok := l.hosts[host]
+		if !ok {
+			h = &hostState{limit: l.initial, wake: make(chan struct{})}
+			l.hosts[host] = h
+			l.setMetric(host, l.initial)
+		}
+		h.lastUsed = now
+
+		if h.inflight < h.limit {
+			h.inflight++
+			l.mu.Unlock()
+			return &hostSlot{limiter: l, host: host, start: now}, nil
+		}
+
+		wake := h.wake
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// sweep - forgets the hosts that have been idle for hostIdleTTL, has to be called with mu held
+func (l *hostLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < hostSweepInterval {
+		return
+	}
+	l.sweptAt = now
+
+	for host, h := range l.hosts {
+		if h.inflight == 0 && now.Sub(h.lastUsed) > hostIdleTTL {
+			delete(l.hosts, host)
+			l.setMetric(host, 0)
+		}
+	}
+}
+
+// observe - adjusts the limit of the host of s to a response with status that took latency,
+// fetches that failed without a response say nothing about the load of the host and aren't observed
+func (s *hostSlot) observe(status int, latency time.Duration) {
+	if s == nil {
+		return
+	}
+
+	l := s.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[s.host]
+	if !ok {
+		return
+	}
+
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		l.decrease(s, h, decreaseReasonThrottled)
+		return
+	}
+
+	switch {
+	case h.baseline == 0 || latency < h.baseline:
+		h.baseline = latency
+		h.smoothed = latency
+	default:
+		h.baseline += (latency - h.baseline) / hostLatencyDrift
+		h.smoothed += time.Duration(float64(latency-h.smoothed) * hostLatencySmoothing)
+	}
+
+	if h.smoothed > h.baseline*hostLatencyTolerance {
+		l.decrease(s, h, decreaseReasonLatency)
+		return
+	}
+
+	h.flat++
+	if h.flat < h.limit || h.limit >= l.max {
+		return
+	}
+
+	h.limit++
+	h.flat = 0
+	l.setMetric(s.host, h.limit)
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// decrease - backs the limit of h off, once per round, responses to fetches started by the last decrease
+// were sent under the previous limit and are ignored
+func (l *hostLimiter) decrease(s *hostSlot, h *hostState, reason string) {
+	if !s.start.After(h.decreasedAt) {
+		return
+	}
+
+	h.limit /= 2
+	if h.limit < 1 {
+		h.limit = 1
+	}
+	h.flat = 0
+	h.smoothed = h.baseline // measured under the previous limit
+	h.decreasedAt = l.now()
+
+	l.setMetric(s.host, h.limit)
+	hostConcurrencyDecreases.Add(reason, 1)
+}
+
+// release - frees the slot for the next page of the host
+func (s *hostSlot) release() {
+	l := s.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[s.host]
+	if !ok {
+		return
+	}
+
+	h.inflight--
+	h.lastUsed = l.now()
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// limits - current limit by host
+func (l *hostLimiter) limits() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits := make(map[string]int, len(l.hosts))
+	for host, h := range l.hosts {
+		limits[host] = h.limit
+	}
+
+	return limits
+}
+
+type hostSlotContextKey struct{}
+
+// hostSlotFromContext - slot the fetch of ctx runs in, nil outside of the scrape pipeline
+func hostSlotFromContext(ctx context.Context) *hostSlot {
+	slot, _ := ctx.Value(hostSlotContextKey{}).(*hostSlot)
+	return slot
+}
+
+// limitedPage - recoveredPage once the host of page has a free slot, the worker is blocked until then
+func (p *Scraper) limitedPage(ctx context.Context, page *url.URL, opts scrapeOptions) Result {
+	slot, err := p.hostLimits.acquire(ctx, canonical.Host(page))
+	if err != nil {
+		return Result{PageURL: page.Redacted(), Error: err}
+	}
+	defer slot.release()
+
+	return p.recoveredPage(context.WithValue(ctx, hostSlotContextKey{}, slot), page, opts)
+}
+
+// HostConcurrency - current concurrency limit of the hosts scraped recently
+func (p *Scraper) HostConcurrency() map[string]int {
+	return p.hostLimits.limits()
+}
@@ -0,0 +1,176 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// limitedServerHelper - answers 429 while more than limit requests are in flight, counts the most requests it had in flight
+func limitedServerHelper(t *testing.T, limit int32) (host string, maxInflight *int32) {
+	inflight, maxInflight := new(int32), new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(inflight, 1)
+		defer atomic.AddInt32(inflight, -1)
+		for {
+			seen := atomic.LoadInt32(maxInflight)
+			if current <= seen || atomic.CompareAndSwapInt32(maxInflight, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond * 5)
+		if current > limit {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`<html><body><a href="/about">about</a></body></html>`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, maxInflight
+}
+
+func TestHostLimiter(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	l := newHostLimiter(2, 4)
+	l.now = func() time.Time { return now }
+	l.setMetric = func(host string, limit int) {}
+	ctx := context.Background()
+
+	acquire := func() *hostSlot {
+		slot, err := l.acquire(ctx, "example.com")
+		assert.NoError(t, err)
+		return slot
+	}
+	round := func(latency time.Duration) {
+		slots := []*hostSlot{}
+		for i := 0; i < l.limits()["example.com"]; i++ {
+			slots = append(slots, acquire())
+		}
+		for _, slot := range slots {
+			slot.observe(http.StatusOK, latency)
+			slot.release()
+		}
+	}
+
+	a, b := acquire(), acquire()
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	_, err := l.acquire(timeoutCtx, "example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the host is at its limit")
+	a.release()
+	b.release()
+
+	round(time.Millisecond * 10)
+	assert.Equal(t, 3, l.limits()["example.com"], "flat latency raises the limit by one per round")
+	round(time.Millisecond * 10)
+	round(time.Millisecond * 10)
+	assert.Equal(t, 4, l.limits()["example.com"], "up to max")
+
+	now = now.Add(time.Second)
+	a, b = acquire(), acquire()
+	a.observe(http.StatusTooManyRequests, time.Millisecond)
+	b.observe(http.StatusServiceUnavailable, time.Millisecond) // sent under the previous limit
+	a.release()
+	b.release()
+	assert.Equal(t, 2, l.limits()["example.com"], "halved once")
+
+	now = now.Add(time.Second)
+	a = acquire()
+	a.observe(http.StatusTooManyRequests, time.Millisecond)
+	a.release()
+	now = now.Add(time.Second)
+	a = acquire()
+	a.observe(http.StatusServiceUnavailable, time.Millisecond)
+	a.release()
+	assert.Equal(t, 1, l.limits()["example.com"], "down to 1")
+
+	round(time.Millisecond * 10)
+	round(time.Millisecond * 10)
+	assert.Equal(t, 3, l.limits()["example.com"])
+	now = now.Add(time.Second)
+	round(time.Millisecond * 100)
+	assert.Equal(t, 1, l.limits()["example.com"], "latency grew")
+
+	now = now.Add(hostIdleTTL + time.Minute)
+	_, err = l.acquire(ctx, "other.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"other.example.com": 2}, l.limits(), "idle hosts are forgotten")
+}
+
+func TestScraper_hostConcurrency(t *testing.T) {
+	host, maxInflight := limitedServerHelper(t, 4)
+	s, err := NewScraper(WithHostConcurrency(16, 32), WithCircuitBreaker(1000, time.Second))
+	assert.NoError(t, err)
+
+	urls := []string{}
+	for i := 0; i < 300; i++ {
+		urls = append(urls, fmt.Sprintf("%s/%d", host, i))
+	}
+
+	throttled := 0
+	for result := range s.StreamPages(context.Background(), test.StrToURL(t, urls), WithScrapeConcurrency(32)) {
+		if !result.Success {
+			throttled++
+		}
+	}
+	assert.Greater(t, throttled, 0, "the initial limit is too high")
+	assert.Less(t, throttled, 100, "the limit backed off")
+	assert.LessOrEqual(t, atomic.LoadInt32(maxInflight), int32(16))
+
+	limit := s.HostConcurrency()[strings.TrimPrefix(host, "http://")]
+	assert.GreaterOrEqual(t, limit, 1)
+	assert.LessOrEqual(t, limit, 8)
+	assert.Contains(t, hostConcurrency.String(), strings.TrimPrefix(host, "http://"))
+}
+
+func TestWithHostConcurrency(t *testing.T) {
+	_, err := NewScraper(WithHostConcurrency(0, 10))
+	assert.ErrorIs(t, err, ErrBadHostConcurrencyValue)
+	_, err = NewScraper(WithHostConcurrency(10, 5))
+	assert.ErrorIs(t, err, ErrBadHostConcurrencyValue)
+	_, err = NewScraper(WithHostConcurrency(1, 1))
+	assert.NoError(t, err)
+}
+
+func TestScraper_hostConcurrencyBlocksOtherHosts(t *testing.T) {
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write([]byte(`<html></html>`))
+	}))
+	defer slow.Close()
+	fetched := new(int32)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(fetched, 1)
+		w.Write([]byte(`<html></html>`))
+	}))
+	defer fast.Close()
+
+	s, err := NewScraper(WithHostConcurrency(1, 1))
+	assert.NoError(t, err)
+
+	// one worker fetches the slow host, the other waits for its slot and the page of the fast host waits for a worker
+	results := s.StreamPages(context.Background(), test.StrToURL(t, []string{slow.URL + "/1", slow.URL + "/2", fast.URL}), WithScrapeConcurrency(2))
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, int32(0), atomic.LoadInt32(fetched), "the page of the other host was fetched")
+
+	close(unblock)
+	succeeded := 0
+	for result := range results {
+		if result.Success {
+			succeeded++
+		}
+	}
+	assert.Equal(t, 3, succeeded)
+	assert.Equal(t, int32(1), atomic.LoadInt32(fetched))
+}
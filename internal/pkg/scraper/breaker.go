@@ -0,0 +1,204 @@
+package scraper
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/safedial"
+)
+
+var (
+	ErrCircuitOpen            = errors.New("circuit open")
+	ErrBadCircuitBreakerValue = errors.New("bad circuit breaker value")
+)
+
+// ErrorCategory - what kind of failure a result is, empty for successful results
+type ErrorCategory string
+
+const (
+	ErrorCategoryCircuitOpen ErrorCategory = "circuit_open" // not fetched, the host failed too often recently
+	ErrorCategoryDNS         ErrorCategory = "dns"          // the host name didn't resolve
+	ErrorCategoryConnect     ErrorCategory = "connect"      // connect and tls handshake failures
+	ErrorCategoryTLS         ErrorCategory = "tls"          // the certificate of the host didn't verify
+	ErrorCategoryTimeout     ErrorCategory = "timeout"
+	ErrorCategoryServer      ErrorCategory = "server_error" // 5xx responses
+	ErrorCategoryClient      ErrorCategory = "client_error" // 4xx responses
+	ErrorCategoryCanceled    ErrorCategory = "canceled"
+	ErrorCategoryOther       ErrorCategory = "other"
+)
+
+// errorCategory - category of a fetch error, bad status codes are categorized where the status is known
+func errorCategory(err error) ErrorCategory {
+	var (
+		dnsErr       *net.DNSError
+		netErr       net.Error
+		unknownCA    x509.UnknownAuthorityError
+		invalidCert  x509.CertificateInvalidError
+		hostnameCert x509.HostnameError
+	)
+
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorCategoryCircuitOpen
+	case errors.Is(err, ErrIdleTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorCategoryTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCategoryCanceled
+	case errors.Is(err, safedial.ErrBlockedAddress), errors.Is(err, ErrNoHealthyProxy):
+		return ErrorCategoryOther
+	case errors.As(err, &unknownCA), errors.As(err, &invalidCert), errors.As(err, &hostnameCert):
+		return ErrorCategoryTLS
+	case errors.As(err, &dnsErr):
+		return ErrorCategoryDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorCategoryTimeout
+	case errors.As(err, &netErr):
+		return ErrorCategoryConnect
+	default:
+		return ErrorCategoryOther
+	}
+}
+
+// WithCircuitBreaker fails pages of a host fast, without fetching them, once maxFailures pages of the host in a row
+// failed to resolve or connect, timed out or got a 5xx response. After cooldown one page is let through and its outcome
+// closes the breaker or opens it for another cooldown. Without it pages are always fetched
+func WithCircuitBreaker(maxFailures int, cooldown time.Duration) ScraperOption {
+	return func(s *Scraper) error {
+		if maxFailures <= 0 || cooldown <= 0 {
+			return ErrBadCircuitBreakerValue
+		}
+		s.breakers = newCircuitBreakers(maxFailures, cooldown)
+		return nil
+	}
+}
+
+// CircuitState ...
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open" // the cooldown is over, the next page of the host decides
+)
+
+// CircuitBreakerStatus - breaker of a host that recently failed
+type CircuitBreakerStatus struct {
+	Host     string
+	State    CircuitState
+	Failures int       // consecutive failures
+	OpenedAt time.Time // zero while closed
+	RetryAt  time.Time // when the next page is let through, zero while closed
+}
+
+type circuit struct {
+	failures int
+	openedAt time.Time
+	probing  bool // a page is let through after the cooldown, the others still fail fast
+}
+
+// circuitBreakers - breakers by host, hosts are only tracked while their last page failed, a nil *circuitBreakers
+// lets every page through
+type circuitBreakers struct {
+	mu          sync.Mutex
+	maxFailures int
+	cooldown    time.Duration
+	hosts       map[string]*circuit
+	now         func() time.Time
+}
+
+func newCircuitBreakers(maxFailures int, cooldown time.Duration) *circuitBreakers {
+	return &circuitBreakers{maxFailures: maxFailures, cooldown: cooldown, hosts: map[string]*circuit{}, now: time.Now}
+}
+
+// allow - ErrCircuitOpen if pages of host fail fast, every allowed page has to be reported with done
+func (b *circuitBreakers) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || c.openedAt.IsZero() {
+		return nil
+	}
+
+	retryAt := c.openedAt.Add(b.cooldown)
+	if b.now().Before(retryAt) || c.probing {
+		return fmt.Errorf("%w for %s after %d failures, retried at %s", ErrCircuitOpen, host, c.failures, retryAt.UTC().Format(time.RFC3339))
+	}
+
+	c.probing = true
+	return nil
+}
+
+// done - records the outcome of an allowed page, categories that don't say anything about the health of the host
+// (canceled scrapes, client errors, bad pages) leave the breaker as it is
+func (b *circuitBreakers) done(host string, success bool, category ErrorCategory) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+
+	switch {
+	case success:
+		delete(b.hosts, host)
+	case category == ErrorCategoryDNS || category == ErrorCategoryConnect || category == ErrorCategoryTimeout || category == ErrorCategoryServer:
+		if !ok {
+			c = &circuit{}
+			b.hosts[host] = c
+		}
+		c.failures++
+		if c.probing || (c.openedAt.IsZero() && c.failures >= b.maxFailures) {
+			c.openedAt = b.now()
+		}
+		c.probing = false
+	case ok:
+		c.probing = false
+	}
+}
+
+// status - breakers of the hosts that recently failed, sorted by host
+func (b *circuitBreakers) status() []CircuitBreakerStatus {
+	if b == nil {
+		return []CircuitBreakerStatus{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	statuses := make([]CircuitBreakerStatus, 0, len(b.hosts))
+	for host, c := range b.hosts {
+		status := CircuitBreakerStatus{Host: host, State: CircuitClosed, Failures: c.failures}
+		if !c.openedAt.IsZero() {
+			status.OpenedAt = c.openedAt
+			status.RetryAt = c.openedAt.Add(b.cooldown)
+			status.State = CircuitOpen
+			if !now.Before(status.RetryAt) {
+				status.State = CircuitHalfOpen
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+
+	return statuses
+}
+
+// CircuitBreakers - breakers of the hosts whose last page failed
+func (p *Scraper) CircuitBreakers() []CircuitBreakerStatus {
+	return p.breakers.status()
+}
@@ -0,0 +1,201 @@
+package scraper
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/safedial"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingServerHelper - answers with status until it's set to 200, counts the requests it gets
+func failingServerHelper(t *testing.T, status *int32) (host string, requests *int32) {
+	requests = new(int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+		w.Write([]byte(`<html><body><a href="/about">about</a></body></html>`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, requests
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreakers(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.NoError(t, b.allow("example.com"))
+	b.done("example.com", false, ErrorCategoryServer)
+	assert.NoError(t, b.allow("example.com"))
+	b.done("example.com", false, ErrorCategoryClient) // the host is up
+	assert.NoError(t, b.allow("example.com"))
+	b.done("example.com", false, ErrorCategoryConnect)
+	assert.ErrorIs(t, b.allow("example.com"), ErrCircuitOpen)
+	assert.NoError(t, b.allow("other.example.com"))
+	assert.Equal(t, []CircuitBreakerStatus{
+		{Host: "example.com", State: CircuitOpen, Failures: 2, OpenedAt: now, RetryAt: now.Add(time.Minute)},
+	}, b.status())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, b.status()[0].State)
+	assert.NoError(t, b.allow("example.com"))                 // the probe
+	assert.ErrorIs(t, b.allow("example.com"), ErrCircuitOpen) // only one at a time
+	b.done("example.com", false, ErrorCategoryTimeout)        // failed probe
+	assert.ErrorIs(t, b.allow("example.com"), ErrCircuitOpen) // opened for another cooldown
+	assert.Equal(t, now.Add(time.Minute), b.status()[0].RetryAt)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, b.allow("example.com"))
+	b.done("example.com", false, ErrorCategoryCanceled) // says nothing about the host, the next page probes
+	assert.NoError(t, b.allow("example.com"))
+	b.done("example.com", true, "")
+	assert.NoError(t, b.allow("example.com"))
+	assert.Empty(t, b.status())
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{name: "circuit open", err: fmt.Errorf("%w for example.com", ErrCircuitOpen), want: ErrorCategoryCircuitOpen},
+		{name: "deadline", err: &url.Error{Op: "Get", URL: "http://example.com", Err: context.DeadlineExceeded}, want: ErrorCategoryTimeout},
+		{name: "idle", err: ErrIdleTimeout, want: ErrorCategoryTimeout},
+		{name: "canceled", err: &url.Error{Op: "Get", URL: "http://example.com", Err: context.Canceled}, want: ErrorCategoryCanceled},
+		{name: "dns", err: &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}}, want: ErrorCategoryDNS},
+		{name: "refused", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: ErrorCategoryConnect},
+		{name: "blocked", err: &net.OpError{Op: "dial", Err: safedial.ErrBlockedAddress}, want: ErrorCategoryOther},
+		{name: "certificate", err: &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, want: ErrorCategoryTLS},
+		{name: "body", err: ErrBodyTooLarge, want: ErrorCategoryOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errorCategory(tt.err))
+		})
+	}
+}
+
+func TestScraper_circuitBreaker(t *testing.T) {
+	t.Run("failing host", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		host, requests := failingServerHelper(t, &status)
+		s, err := NewScraper(WithCircuitBreaker(3, time.Hour))
+		assert.NoError(t, err)
+
+		urls := []string{}
+		for i := 0; i < 10; i++ {
+			urls = append(urls, fmt.Sprintf("%s/%d", host, i))
+		}
+
+		categories := map[ErrorCategory]int{}
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, urls), WithScrapeConcurrency(1)) {
+			categories[result.ErrorCategory]++
+			if result.ErrorCategory == ErrorCategoryCircuitOpen {
+				assert.ErrorIs(t, result.Error, ErrCircuitOpen)
+			}
+		}
+		assert.Equal(t, map[ErrorCategory]int{ErrorCategoryServer: 3, ErrorCategoryCircuitOpen: 7}, categories)
+		assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+		breakers := s.CircuitBreakers()
+		assert.Len(t, breakers, 1)
+		assert.Equal(t, strings.TrimPrefix(host, "http://"), breakers[0].Host)
+		assert.Equal(t, CircuitOpen, breakers[0].State)
+	})
+	t.Run("recovered host", func(t *testing.T) {
+		status := int32(http.StatusBadGateway)
+		host, _ := failingServerHelper(t, &status)
+		s, err := NewScraper(WithCircuitBreaker(1, time.Millisecond*20))
+		assert.NoError(t, err)
+
+		assert.Equal(t, ErrorCategoryServer, scrapeOneHelper(t, s, host).ErrorCategory)
+		assert.Equal(t, ErrorCategoryCircuitOpen, scrapeOneHelper(t, s, host).ErrorCategory)
+
+		atomic.StoreInt32(&status, http.StatusOK)
+		time.Sleep(time.Millisecond * 30)
+		result := scrapeOneHelper(t, s, host)
+		assert.True(t, result.Success, result.Error)
+		assert.Empty(t, result.ErrorCategory)
+		assert.Empty(t, s.CircuitBreakers())
+	})
+	t.Run("client errors keep the breaker closed", func(t *testing.T) {
+		status := int32(http.StatusNotFound)
+		host, requests := failingServerHelper(t, &status)
+		s, err := NewScraper(WithCircuitBreaker(1, time.Hour))
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, ErrorCategoryClient, scrapeOneHelper(t, s, host).ErrorCategory)
+		}
+		assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+	})
+	t.Run("unreachable host", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		host := "http://" + listener.Addr().String()
+		listener.Close() // nothing listens on the port anymore
+
+		s, err := NewScraper(WithCircuitBreaker(1, time.Hour))
+		assert.NoError(t, err)
+
+		assert.Equal(t, ErrorCategoryConnect, scrapeOneHelper(t, s, host).ErrorCategory)
+		assert.Equal(t, ErrorCategoryCircuitOpen, scrapeOneHelper(t, s, host+"/other").ErrorCategory)
+	})
+	t.Run("off by default", func(t *testing.T) {
+		status := int32(http.StatusServiceUnavailable)
+		host, requests := failingServerHelper(t, &status)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, ErrorCategoryServer, scrapeOneHelper(t, s, host).ErrorCategory)
+		}
+		assert.Equal(t, int32(10), atomic.LoadInt32(requests))
+		assert.Empty(t, s.CircuitBreakers())
+	})
+	overrides := map[string]ScrapeOption{
+		"timeout":              WithTimeout(time.Second),
+		"headers":              WithRequestOptions(WithHeader("Authorization", "Bearer bad")),
+		"insecure skip verify": WithInsecureSkipVerify(),
+	}
+	for name, override := range overrides {
+		override := override
+		t.Run("scrapes with their own "+name+" don't count", func(t *testing.T) {
+			status := int32(http.StatusServiceUnavailable)
+			host, requests := failingServerHelper(t, &status)
+			s, err := NewScraper(WithCircuitBreaker(1, time.Hour))
+			assert.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				assert.Equal(t, ErrorCategoryServer, scrapeOneHelper(t, s, host, override).ErrorCategory)
+			}
+			assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+			assert.Empty(t, s.CircuitBreakers())
+
+			assert.Equal(t, ErrorCategoryServer, scrapeOneHelper(t, s, host).ErrorCategory)
+			assert.Equal(t, ErrorCategoryCircuitOpen, scrapeOneHelper(t, s, host).ErrorCategory)
+			assert.Equal(t, ErrorCategoryServer, scrapeOneHelper(t, s, host, override).ErrorCategory, "they don't fail fast either")
+		})
+	}
+}
+
+func TestWithCircuitBreaker(t *testing.T) {
+	_, err := NewScraper(WithCircuitBreaker(0, time.Minute))
+	assert.ErrorIs(t, err, ErrBadCircuitBreakerValue)
+	_, err = NewScraper(WithCircuitBreaker(1, 0))
+	assert.ErrorIs(t, err, ErrBadCircuitBreakerValue)
+}
@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBadCacheSize = errors.New("bad cache size")
+
+// Cache - validators and parse results of scraped pages, used to make conditional requests
+// and to reuse the parse result when the page didn't change
+type Cache interface {
+	Get(ctx context.Context, key string) (entry CacheEntry, ok bool, err error)
+	Set(ctx context.Context, key string, entry CacheEntry) error
+}
+
+// CacheEntry - what a cache keeps for a page
+type CacheEntry struct {
+	ETag               string    `json:"etag,omitempty"`
+	LastModified       string    `json:"last_modified,omitempty"`
+	InternalLinksCount uint      `json:"internal_links_count"`
+	ExternalLinksCount uint      `json:"external_links_count"`
+	StoredAt           time.Time `json:"stored_at"`
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry CacheEntry
+}
+
+// memoryCache - least recently used entries are evicted once the cache is full
+type memoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // front is the most recently used
+	items      map[string]*list.Element
+}
+
+// NewMemoryCache - in memory cache of at most maxEntries pages
+func NewMemoryCache(maxEntries int) (Cache, error) {
+	if maxEntries <= 0 {
+		return nil, ErrBadCacheSize
+	}
+
+	return &memoryCache{maxEntries: maxEntries, order: list.New(), items: map[string]*list.Element{}}, nil
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return CacheEntry{}, false, nil
+	}
+	c.order.MoveToFront(element)
+
+	return element.Value.(*memoryCacheItem).entry, true, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value.(*memoryCacheItem).entry = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.items[key] = c.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryCacheItem).key)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package scraper
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func cacheBackendsHelper(t *testing.T, maxEntries int) map[string]Cache {
+	memory, err := NewMemoryCache(maxEntries)
+	assert.NoError(t, err)
+	file, err := NewFileCache(t.TempDir(), maxEntries)
+	assert.NoError(t, err)
+
+	return map[string]Cache{"memory": memory, "file": file}
+}
+
+func TestCache(t *testing.T) {
+	for name, cache := range cacheBackendsHelper(t, 10) {
+		cache := cache
+		t.Run(name+" get and set", func(t *testing.T) {
+			_, ok, err := cache.Get(context.Background(), "http://localhost/")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			entry := CacheEntry{ETag: `"v1"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT", InternalLinksCount: 2, ExternalLinksCount: 1, StoredAt: time.Unix(0, 0).UTC()}
+			assert.NoError(t, cache.Set(context.Background(), "http://localhost/", entry))
+
+			got, ok, err := cache.Get(context.Background(), "http://localhost/")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, entry, got)
+
+			entry.ETag = `"v2"`
+			assert.NoError(t, cache.Set(context.Background(), "http://localhost/", entry))
+			got, _, err = cache.Get(context.Background(), "http://localhost/")
+			assert.NoError(t, err)
+			assert.Equal(t, `"v2"`, got.ETag)
+		})
+	}
+}
+
+func TestCache_eviction(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	for name, cache := range cacheBackendsHelper(t, 10) {
+		cache := cache
+		t.Run(name, func(t *testing.T) {
+			if fc, ok := cache.(*fileCache); ok { // mod times have to differ for the eviction order
+				now := time.Unix(0, 0)
+				fc.now = func() time.Time { now = now.Add(time.Second); return now }
+			}
+
+			for i, key := range keys {
+				assert.NoError(t, cache.Set(context.Background(), key, CacheEntry{InternalLinksCount: uint(i)}))
+				if fc, ok := cache.(*fileCache); ok {
+					modTime := fc.now()
+					assert.NoError(t, os.Chtimes(fc.path(key), modTime, modTime))
+				}
+			}
+
+			_, ok, err := cache.Get(context.Background(), "a") // a is now the most recently used
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			assert.NoError(t, cache.Set(context.Background(), "k", CacheEntry{}))
+
+			_, ok, err = cache.Get(context.Background(), "b")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			for _, key := range []string{"a", "k", "j"} {
+				_, ok, err = cache.Get(context.Background(), key)
+				assert.NoError(t, err)
+				assert.True(t, ok, key)
+			}
+		})
+	}
+}
+
+func TestNewFileCache(t *testing.T) {
+	t.Run("shared between instances", func(t *testing.T) {
+		dir := t.TempDir()
+		writer, err := NewFileCache(dir, 10)
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Set(context.Background(), "a", CacheEntry{ETag: `"v1"`}))
+
+		reader, err := NewFileCache(dir, 10)
+		assert.NoError(t, err)
+		got, ok, err := reader.Get(context.Background(), "a")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, `"v1"`, got.ETag)
+		assert.Equal(t, 1, reader.(*fileCache).entries)
+	})
+	t.Run("only readable by the owner", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "cache")
+		c, err := NewFileCache(dir, 10)
+		assert.NoError(t, err)
+		assert.NoError(t, c.Set(context.Background(), "a", CacheEntry{ETag: `"v1"`}))
+
+		assert.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			assert.NoError(t, err)
+			info, err := d.Info()
+			assert.NoError(t, err)
+			assert.Zero(t, info.Mode().Perm()&0o077, path)
+			return nil
+		}))
+	})
+	t.Run("bad size", func(t *testing.T) {
+		_, err := NewFileCache(t.TempDir(), 0)
+		assert.ErrorIs(t, err, ErrBadCacheSize)
+
+		_, err = NewMemoryCache(-1)
+		assert.ErrorIs(t, err, ErrBadCacheSize)
+	})
+}
+
+// conditionalServerHelper - serves the page with an ETag (or only Last-Modified on /dated) and answers 304 to matching
+// conditional requests, version changes the page
+func conditionalServerHelper(t *testing.T) (host string, version *int32, fullResponses *int32) {
+	body, err := os.ReadFile("testdata/good_links_serve.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, fullResponses = new(int32), new(int32)
+	lastModified := time.Unix(0, 0).UTC()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := lastModified.Add(time.Hour * time.Duration(atomic.LoadInt32(version)))
+		if r.URL.Path != "/dated" {
+			w.Header().Set("ETag", `"v`+current.Format("15")+`"`)
+		}
+		w.Header().Set("Last-Modified", current.Format(http.TimeFormat))
+
+		if r.URL.Path != "/dated" && r.Header.Get("If-None-Match") == w.Header().Get("ETag") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); r.URL.Path == "/dated" && err == nil && !current.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(fullResponses, 1)
+		w.Write(body)
+	})
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: handler}
+
+	go func() {
+		srv.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return strings.Replace(listener.Addr().String(), "127.0.0.1", "localhost", -1), version, fullResponses
+}
+
+func TestScraper_cache(t *testing.T) {
+	for name, cache := range cacheBackendsHelper(t, 100) {
+		cache := cache
+		t.Run(name, func(t *testing.T) {
+			host, version, fullResponses := conditionalServerHelper(t)
+			s, err := NewScraper(WithCache(cache))
+			assert.NoError(t, err)
+
+			for _, path := range []string{"/", "/dated"} {
+				page := "http://" + host + path
+				first := scrapeOneHelper(t, s, page)
+				assert.True(t, first.Success, first.Error)
+				assert.False(t, first.FromCache)
+
+				second := scrapeOneHelper(t, s, page)
+				assert.True(t, second.Success, second.Error)
+				assert.True(t, second.FromCache, path)
+				assert.Equal(t, first.InternalLinksCount, second.InternalLinksCount)
+				assert.Equal(t, first.ExternalLinksCount, second.ExternalLinksCount)
+
+				// the counts depend on the link policy, so the other policy has its own entry
+				assert.False(t, scrapeOneHelper(t, s, page, WithLinkPolicy(LinkPolicyDomain)).FromCache)
+			}
+			assert.Equal(t, int32(4), atomic.LoadInt32(fullResponses))
+
+			atomic.AddInt32(version, 1)
+			assert.False(t, scrapeOneHelper(t, s, "http://"+host+"/").FromCache)
+			assert.False(t, scrapeOneHelper(t, s, "http://"+host+"/dated").FromCache)
+			assert.True(t, scrapeOneHelper(t, s, "http://"+host+"/").FromCache)
+		})
+	}
+	t.Run("scrapes with their own headers don't use the cache", func(t *testing.T) {
+		host, _, fullResponses := conditionalServerHelper(t)
+		cache, err := NewMemoryCache(10)
+		assert.NoError(t, err)
+		s, err := NewScraper(WithCache(cache))
+		assert.NoError(t, err)
+
+		page := "http://" + host + "/"
+		withHeader := WithRequestOptions(WithHeader("Authorization", "Bearer token"))
+		assert.False(t, scrapeOneHelper(t, s, page, withHeader).FromCache)
+		assert.False(t, scrapeOneHelper(t, s, page).FromCache, "the header scrape isn't stored")
+		assert.True(t, scrapeOneHelper(t, s, page).FromCache)
+		assert.False(t, scrapeOneHelper(t, s, page, withHeader).FromCache, "the shared entry isn't used")
+		assert.Equal(t, int32(3), atomic.LoadInt32(fullResponses))
+	})
+	t.Run("pages without validators are not cached", func(t *testing.T) {
+		cache, err := NewMemoryCache(10)
+		assert.NoError(t, err)
+		s, err := NewScraper(WithCache(cache))
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host, host})) {
+			assert.True(t, result.Success, result.Error)
+			assert.False(t, result.FromCache)
+		}
+		_, ok, err := cache.Get(context.Background(), string(LinkPolicyHost)+" "+host)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
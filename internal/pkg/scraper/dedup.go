@@ -0,0 +1,153 @@
+package scraper
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadMaxAgeValue        = errors.New("bad max age value")
+	ErrBadRecentResultsValue = errors.New("bad recent results value")
+)
+
+// defaultRecentResults - how many recent results are kept for scrapes with a max age
+const defaultRecentResults = 10000
+
+// WithRecentResults sets how many recently scraped pages are kept for scrapes that accept them (WithMaxAge)
+func WithRecentResults(maxEntries int) ScraperOption {
+	return func(s *Scraper) error {
+		if maxEntries <= 0 {
+			return ErrBadRecentResultsValue
+		}
+		s.recent = newRecentResults(maxEntries)
+		return nil
+	}
+}
+
+// WithMaxAge accepts results of pages successfully scraped by any scrape within maxAge instead of fetching them again
+func WithMaxAge(maxAge time.Duration) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		if maxAge <= 0 {
+			return ErrBadMaxAgeValue
+		}
+		o.maxAge = maxAge
+		return nil
+	}
+}
+
+// shareKey - identifies fetches whose results are interchangeable between scrapes, scrapes with their own
+// headers, session or proxy can see a different page (or another tenant's) and never share results
+func (p *Scraper) shareKey(page *url.URL, opts scrapeOptions) (string, bool) {
+	if opts.login != nil || opts.proxy != nil || len(opts.reqOptions) > 0 {
+		return "", false
+	}
+
+	key := string(opts.linkPolicy) + " " + p.canonicalizer.String(page)
+	if opts.insecureSkipVerify {
+		key = "insecure " + key
+	}
+
+	return key, true
+}
+
+type flight struct {
+	done   chan struct{}
+	result Result
+}
+
+// flightGroup - merges concurrent fetches of the same key, the first caller fetches and the others wait for its result
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do - result of fetch for key, merged reports whether another caller did the fetch
+func (g *flightGroup) do(ctx context.Context, key string, fetch func() Result) (result Result, merged bool) {
+	g.mu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.result, true
+		case <-ctx.Done():
+			return Result{Error: ctx.Err()}, true
+		}
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	f.result = fetch()
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+	close(f.done)
+
+	return f.result, false
+}
+
+type recentResult struct {
+	key       string
+	result    Result
+	scrapedAt time.Time
+}
+
+// recentResults - successful results by share key, the least recently scraped are dropped once it's full
+type recentResults struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // front is the most recently scraped
+	items      map[string]*list.Element
+	now        func() time.Time
+}
+
+func newRecentResults(maxEntries int) *recentResults {
+	return &recentResults{maxEntries: maxEntries, order: list.New(), items: map[string]*list.Element{}, now: time.Now}
+}
+
+func (r *recentResults) add(key string, result Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, ok := r.items[key]; ok {
+		r.order.Remove(element)
+	}
+	r.items[key] = r.order.PushFront(&recentResult{key: key, result: result, scrapedAt: r.now()})
+
+	for r.order.Len() > r.maxEntries {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.items, oldest.Value.(*recentResult).key)
+	}
+}
+
+// get - result of key if it was scraped within maxAge
+func (r *recentResults) get(key string, maxAge time.Duration) (Result, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.items[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	recent := element.Value.(*recentResult)
+	if r.now().Sub(recent.scrapedAt) > maxAge {
+		return Result{}, false
+	}
+
+	return recent.result, true
+}
+
+// sharedResult - result of another scrape as a result of page
+func sharedResult(result Result, page *url.URL) Result {
+	result.PageURL = page.Redacted()
+	result.Shared = true
+	return result
+}
@@ -0,0 +1,225 @@
+package scraper
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowServerHelper - counts page fetches, every response waits for release to be closed
+func slowServerHelper(t *testing.T, release chan struct{}) (host string, fetches *int32) {
+	body, err := os.ReadFile("testdata/good_links_serve.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetches = new(int32)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(fetches, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write(body)
+	})}
+
+	go func() {
+		srv.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return strings.Replace(listener.Addr().String(), "127.0.0.1", "localhost", -1), fetches
+}
+
+// waitFetchesHelper - waits until the server saw want fetches
+func waitFetchesHelper(t *testing.T, fetches *int32, want int32) {
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt32(fetches) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d fetches, want %d", atomic.LoadInt32(fetches), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScraper_shareKey(t *testing.T) {
+	page := test.StrToURL(t, []string{"http://example.com/"})[0]
+	s, err := NewScraper()
+	assert.NoError(t, err)
+
+	for name, option := range map[string]ScrapeOption{
+		"headers": WithRequestOptions(WithHeader("X-Test", "test")),
+		"login":   WithLogin("http://example.com/login", nil),
+		"proxy":   WithScrapeProxy("http://proxy:3128"),
+	} {
+		opts, err := newScrapeOptions(option)
+		assert.NoError(t, err)
+		_, ok := s.shareKey(page, opts)
+		assert.False(t, ok, name)
+	}
+
+	host, err := newScrapeOptions()
+	assert.NoError(t, err)
+	domain, err := newScrapeOptions(WithLinkPolicy(LinkPolicyDomain), WithTimeout(time.Second))
+	assert.NoError(t, err)
+	insecure, err := newScrapeOptions(WithInsecureSkipVerify())
+	assert.NoError(t, err)
+
+	keys := map[string]bool{}
+	for _, opts := range []scrapeOptions{host, domain, insecure} {
+		key, ok := s.shareKey(page, opts)
+		assert.True(t, ok)
+		keys[key] = true
+	}
+	assert.Len(t, keys, 3)
+
+	for _, rawURL := range []string{"HTTP://Example.COM:80", "http://example.com/a/..?utm_source=x#top"} {
+		key, ok := s.shareKey(test.StrToURL(t, []string{rawURL})[0], host)
+		assert.True(t, ok)
+		assert.True(t, keys[key], rawURL)
+	}
+}
+
+func TestScraper_dedup(t *testing.T) {
+	t.Run("concurrent scrapes of the same page are merged", func(t *testing.T) {
+		release := make(chan struct{})
+		host, fetches := slowServerHelper(t, release)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		first := s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + host + "/"}))
+		waitFetchesHelper(t, fetches, 1)
+		second := s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + strings.ToUpper(host) + "/#links"}))
+		other := s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + host + "/"}), WithLinkPolicy(LinkPolicyDomain))
+		waitFetchesHelper(t, fetches, 2)
+		close(release)
+
+		firstResult, secondResult := <-first, <-second
+		assert.True(t, firstResult.Success, firstResult.Error)
+		assert.False(t, firstResult.Shared)
+		assert.True(t, secondResult.Success, secondResult.Error)
+		assert.True(t, secondResult.Shared)
+		assert.Equal(t, "http://"+strings.ToUpper(host)+"/#links", secondResult.PageURL)
+		assert.Equal(t, firstResult.InternalLinksCount, secondResult.InternalLinksCount)
+		assert.False(t, (<-other).Shared)
+		assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+	})
+	t.Run("scrapes with their own headers are not merged", func(t *testing.T) {
+		release := make(chan struct{})
+		host, fetches := slowServerHelper(t, release)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		pages := test.StrToURL(t, []string{"http://" + host + "/"})
+		first := s.StreamPages(context.Background(), pages, WithRequestOptions(WithHeader("X-Tenant", "a")))
+		second := s.StreamPages(context.Background(), pages, WithRequestOptions(WithHeader("X-Tenant", "b")))
+		waitFetchesHelper(t, fetches, 2)
+		close(release)
+
+		assert.False(t, (<-first).Shared)
+		assert.False(t, (<-second).Shared)
+	})
+	t.Run("canceled scrape doesn't fail the merged ones", func(t *testing.T) {
+		release := make(chan struct{})
+		host, fetches := slowServerHelper(t, release)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pages := test.StrToURL(t, []string{"http://" + host + "/"})
+		first := s.StreamPages(ctx, pages)
+		waitFetchesHelper(t, fetches, 1)
+
+		results := make(chan Result, 1)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for result := range s.StreamPages(context.Background(), pages) {
+				results <- result
+			}
+		}()
+		time.Sleep(time.Millisecond * 20) // let the second scrape join the first fetch
+		cancel()
+		for range first {
+		}
+
+		waitFetchesHelper(t, fetches, 2)
+		close(release)
+		wg.Wait()
+
+		result := <-results
+		assert.True(t, result.Success, result.Error)
+		assert.False(t, result.Shared)
+	})
+	t.Run("recent results within the max age are reused", func(t *testing.T) {
+		release := make(chan struct{})
+		close(release)
+		host, fetches := slowServerHelper(t, release)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+		now := time.Now()
+		s.recent.now = func() time.Time { return now }
+
+		page := "http://" + host + "/"
+		assert.False(t, scrapeOneHelper(t, s, page).Shared)
+
+		result := scrapeOneHelper(t, s, page, WithMaxAge(time.Minute))
+		assert.True(t, result.Success, result.Error)
+		assert.True(t, result.Shared)
+		assert.Equal(t, int32(1), atomic.LoadInt32(fetches))
+
+		assert.False(t, scrapeOneHelper(t, s, page).Shared) // no max age, no reuse
+		assert.Equal(t, int32(2), atomic.LoadInt32(fetches))
+
+		now = now.Add(time.Minute * 2)
+		assert.False(t, scrapeOneHelper(t, s, page, WithMaxAge(time.Minute)).Shared)
+		assert.Equal(t, int32(3), atomic.LoadInt32(fetches))
+	})
+	t.Run("failed pages are not reused", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		page := "http://" + deadProxyHelper(t)[len("http://"):] + "/"
+		assert.False(t, scrapeOneHelper(t, s, page).Success)
+		assert.False(t, scrapeOneHelper(t, s, page, WithMaxAge(time.Minute)).Shared)
+	})
+	t.Run("bad options", func(t *testing.T) {
+		_, err := NewScraper(WithRecentResults(0))
+		assert.ErrorIs(t, err, ErrBadRecentResultsValue)
+
+		_, err = newScrapeOptions(WithMaxAge(0))
+		assert.ErrorIs(t, err, ErrBadMaxAgeValue)
+	})
+}
+
+func Test_recentResults(t *testing.T) {
+	recent := newRecentResults(2)
+	recent.add("a", Result{PageURL: "a"})
+	recent.add("b", Result{PageURL: "b"})
+	recent.add("a", Result{PageURL: "a2"})
+	recent.add("c", Result{PageURL: "c"})
+
+	_, ok := recent.get("b", time.Minute)
+	assert.False(t, ok)
+	got, ok := recent.get("a", time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, "a2", got.PageURL)
+}
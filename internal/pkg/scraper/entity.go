@@ -1,9 +1,24 @@
 package scraper
 
+import "time"
+
 type Result struct {
 	PageURL            string
 	InternalLinksCount uint
 	ExternalLinksCount uint
 	Success            bool
 	Error              error
+	ErrorCategory      ErrorCategory // empty for successful results
+	TLS                *TLSInfo      // nil for plain http pages
+	FromCache          bool          // the page wasn't modified, the link counts are the cached ones
+	Shared             bool          // fetched for another scrape, at the same time or within the max age of this one
+}
+
+// TLSInfo - the tls connection the page was fetched over
+type TLSInfo struct {
+	Version     string
+	CipherSuite string
+	Issuer      string    // issuer of the page certificate
+	NotAfter    time.Time // expiry of the page certificate
+	ExpiresSoon bool      // NotAfter is within the expiry warning window of the scraper
 }
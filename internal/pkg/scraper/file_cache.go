@@ -0,0 +1,171 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileCache - one json file per page, the files are touched on every hit and the least recently used
+// are removed once there are more than maxEntries, processes sharing dir share the cache
+type fileCache struct {
+	dir        string
+	maxEntries int
+
+	mu      sync.Mutex
+	entries int // approximate when other processes write to dir as well
+	now     func() time.Time
+}
+
+// NewFileCache - cache of at most maxEntries pages stored in dir, the directory is created if it doesn't exist
+func NewFileCache(dir string, maxEntries int) (Cache, error) {
+	if maxEntries <= 0 {
+		return nil, ErrBadCacheSize
+	}
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache dir %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache dir %w", err)
+	}
+
+	cache := &fileCache{dir: dir, maxEntries: maxEntries, now: time.Now}
+	for _, file := range files {
+		if isCacheFile(file.Name()) {
+			cache.entries++
+		}
+	}
+
+	return cache, nil
+}
+
+func isCacheFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && !strings.HasPrefix(name, ".")
+}
+
+func (c *fileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *fileCache) Get(ctx context.Context, key string) (CacheEntry, bool, error) {
+	path := c.path(key)
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, fmt.Errorf("failed to read cache entry %w", err)
+	}
+
+	entry := CacheEntry{}
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return CacheEntry{}, false, fmt.Errorf("failed to unmarshal cache entry %w", err)
+	}
+
+	now := c.now()
+	os.Chtimes(path, now, now) // recently used entries are evicted last, a failed touch only makes eviction less precise
+
+	return entry, true, nil
+}
+
+func (c *fileCache) Set(ctx context.Context, key string, entry CacheEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry %w", err)
+	}
+
+	path := c.path(key)
+	_, statErr := os.Stat(path)
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	_, err = tmp.Write(b)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to write cache entry %w", err)
+	}
+
+	if statErr == nil { // replaced an entry
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries++
+	if c.entries <= c.maxEntries {
+		return nil
+	}
+
+	return c.evict()
+}
+
+// evict - removes the least recently used entries until the cache is 10% below its size,
+// so the directory isn't scanned on every write of a full cache
+func (c *fileCache) evict() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache dir %w", err)
+	}
+
+	type cacheFile struct {
+		name    string
+		modTime time.Time
+	}
+	cached := make([]cacheFile, 0, len(files))
+	for _, file := range files {
+		if !isCacheFile(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil { // removed by another process
+			continue
+		}
+		cached = append(cached, cacheFile{name: file.Name(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(cached, func(i, j int) bool { return cached[i].modTime.Before(cached[j].modTime) })
+
+	keep := c.maxEntries - c.maxEntries/10
+	for len(cached) > keep {
+		err = os.Remove(filepath.Join(c.dir, cached[0].name))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to evict cache entry %w", err)
+		}
+		cached = cached[1:]
+	}
+	c.entries = len(cached)
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrPanic                = errors.New("panic while scraping page")
+	ErrIdleTimeout          = errors.New("page stopped sending data")
+	ErrBodyTooLarge         = errors.New("page body too large")
+	ErrBadPageTimeoutValue  = errors.New("bad page timeout value")
+	ErrBadIdleTimeoutValue  = errors.New("bad idle timeout value")
+	ErrBadMaxBodyBytesValue = errors.New("bad max body bytes value")
+	ErrBadMaxHTMLDepthValue = errors.New("bad max html depth value")
+)
+
+const (
+	defaultPageTimeout  = time.Second * 30
+	defaultIdleTimeout  = time.Second * 10
+	defaultMaxBodyBytes = 10 << 20
+)
+
+// WithPageTimeout limits how long fetching and parsing a single page can take, scrapes with their own WithTimeout use that instead
+func WithPageTimeout(timeout time.Duration) ScraperOption {
+	return func(s *Scraper) error {
+		if timeout <= 0 {
+			return ErrBadPageTimeoutValue
+		}
+		s.pageTimeout = timeout
+		return nil
+	}
+}
+
+// WithIdleTimeout fails pages that send nothing (neither the response headers nor the body) for timeout
+func WithIdleTimeout(timeout time.Duration) ScraperOption {
+	return func(s *Scraper) error {
+		if timeout <= 0 {
+			return ErrBadIdleTimeoutValue
+		}
+		s.idleTimeout = timeout
+		return nil
+	}
+}
+
+// WithMaxBodyBytes fails pages with a larger body, the limit applies to the decompressed body so a small compressed
+// response can't expand into more than max bytes
+func WithMaxBodyBytes(max int64) ScraperOption {
+	return func(s *Scraper) error {
+		if max <= 0 {
+			return ErrBadMaxBodyBytesValue
+		}
+		s.maxBodyBytes = max
+		return nil
+	}
+}
+
+// WithMaxHTMLDepth sets how deep the html of a page is searched for links, pages nested deeper fail with ErrHTMLTooDeep
+func WithMaxHTMLDepth(depth int) ScraperOption {
+	return func(s *Scraper) error {
+		if depth <= 0 {
+			return ErrBadMaxHTMLDepthValue
+		}
+		s.maxHTMLDepth = depth
+		return nil
+	}
+}
+
+// recoveredPage - fetchPage with its panics turned into a failed result, so a single page can't take the process down
+func (p *Scraper) recoveredPage(ctx context.Context, page *url.URL, opts scrapeOptions) (result Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("recovered panic scraping %s: %v\n%s", page.Redacted(), r, debug.Stack())
+			result = Result{PageURL: page.Redacted(), Error: fmt.Errorf("%w: %v", ErrPanic, r)}
+		}
+	}()
+
+	return p.fetchPage(ctx, page, opts)
+}
+
+// idleGuard - cancels a fetch once nothing was received for timeout, every read that gets data restarts the timer
+type idleGuard struct {
+	timer   *time.Timer
+	timeout time.Duration
+	fired   int32
+}
+
+// newIdleGuard - ctx is canceled when the guard fires, stop has to be called once the fetch is done
+func newIdleGuard(ctx context.Context, timeout time.Duration) (context.Context, *idleGuard, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	guard := &idleGuard{timeout: timeout}
+	guard.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&guard.fired, 1)
+		cancel()
+	})
+
+	return ctx, guard, func() {
+		guard.timer.Stop()
+		cancel()
+	}
+}
+
+// err - ErrIdleTimeout if the guard canceled the fetch, the cancellation error alone doesn't say why
+func (g *idleGuard) err(err error) error {
+	if err == nil || atomic.LoadInt32(&g.fired) == 0 {
+		return err
+	}
+
+	return fmt.Errorf("%w, nothing received for %s", ErrIdleTimeout, g.timeout)
+}
+
+// body - body that restarts the idle timer on every read and fails with ErrBodyTooLarge after maxBytes
+func (g *idleGuard) body(body io.Reader, maxBytes int64) io.Reader {
+	return &guardedBody{r: body, guard: g, remaining: maxBytes + 1}
+}
+
+type guardedBody struct {
+	r         io.Reader
+	guard     *idleGuard
+	remaining int64 // starts one over the limit, to tell a body of exactly the limit from a larger one
+}
+
+func (b *guardedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining <= 0 {
+		return n, ErrBodyTooLarge
+	}
+
+	if n > 0 && atomic.LoadInt32(&b.guard.fired) == 0 {
+		b.guard.timer.Reset(b.guard.timeout)
+	}
+
+	return n, err
+}
@@ -0,0 +1,166 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostileServerHelper - /deep and /bomb serve the adversarial fixtures, /stall sends the headers and then nothing,
+// /trickle sends a byte every 10ms and never finishes
+func hostileServerHelper(t *testing.T) string {
+	deep, err := os.ReadFile("testdata/deep_nesting.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb, err := os.ReadFile("testdata/gzip_bomb.html.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deep", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(deep)
+	})
+	mux.HandleFunc("/bomb", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	})
+	mux.HandleFunc("/stall", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body><a href=\"/\">"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/trickle", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>"))
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond * 10):
+				w.Write([]byte(" "))
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) // the fixtures link to localhost
+}
+
+func TestScraper_hostilePages(t *testing.T) {
+	host := hostileServerHelper(t)
+
+	t.Run("panics fail only their page", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		good := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		panics := WithRequestOptions(func(r *http.Request) error {
+			if strings.HasSuffix(r.URL.Path, "/deep") {
+				panic("boom")
+			}
+			return nil
+		})
+
+		results := map[string]Result{}
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host + "/deep", good}), panics) {
+			results[result.PageURL] = result
+		}
+		assert.ErrorIs(t, results[host+"/deep"].Error, ErrPanic)
+		assert.Contains(t, results[host+"/deep"].Error.Error(), "boom")
+		assert.True(t, results[good].Success, results[good].Error)
+	})
+	t.Run("deeply nested page", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, host+"/deep")
+		assert.ErrorIs(t, result.Error, ErrHTMLTooDeep)
+		assert.Equal(t, uint(1), result.InternalLinksCount)
+		assert.Equal(t, uint(1), result.ExternalLinksCount)
+
+		s, err = NewScraper(WithMaxHTMLDepth(1000))
+		assert.NoError(t, err)
+
+		result = scrapeOneHelper(t, s, host+"/deep")
+		assert.True(t, result.Success, result.Error)
+		assert.Equal(t, uint(2), result.InternalLinksCount)
+		assert.Equal(t, uint(2), result.ExternalLinksCount)
+	})
+	t.Run("decompression bomb", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, host+"/bomb")
+		assert.ErrorIs(t, result.Error, ErrBodyTooLarge)
+	})
+	t.Run("body of exactly the limit", func(t *testing.T) {
+		body, err := os.ReadFile("testdata/good_links_serve.html")
+		assert.NoError(t, err)
+		good := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+
+		s, err := NewScraper(WithMaxBodyBytes(int64(len(body))))
+		assert.NoError(t, err)
+		result := scrapeOneHelper(t, s, good)
+		assert.True(t, result.Success, result.Error)
+
+		s, err = NewScraper(WithMaxBodyBytes(int64(len(body) - 1)))
+		assert.NoError(t, err)
+		result = scrapeOneHelper(t, s, good)
+		assert.ErrorIs(t, result.Error, ErrBodyTooLarge)
+	})
+	t.Run("stalled response", func(t *testing.T) {
+		s, err := NewScraper(WithIdleTimeout(time.Millisecond * 50))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, host+"/stall")
+		assert.ErrorIs(t, result.Error, ErrIdleTimeout)
+	})
+	t.Run("trickled response", func(t *testing.T) {
+		s, err := NewScraper(WithIdleTimeout(time.Millisecond*50), WithPageTimeout(time.Millisecond*200))
+		assert.NoError(t, err)
+
+		start := time.Now()
+		result := scrapeOneHelper(t, s, host+"/trickle")
+		assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+	t.Run("scrape timeout replaces the page timeout", func(t *testing.T) {
+		s, err := NewScraper(WithPageTimeout(time.Hour))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, host+"/trickle", WithTimeout(time.Millisecond*100))
+		assert.ErrorIs(t, result.Error, context.DeadlineExceeded)
+	})
+}
+
+func TestNewScraper_guardOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  ScraperOption
+		wantErr error
+	}{
+		{name: "bad page timeout", option: WithPageTimeout(0), wantErr: ErrBadPageTimeoutValue},
+		{name: "bad idle timeout", option: WithIdleTimeout(-time.Second), wantErr: ErrBadIdleTimeoutValue},
+		{name: "bad max body bytes", option: WithMaxBodyBytes(0), wantErr: ErrBadMaxBodyBytesValue},
+		{name: "bad max html depth", option: WithMaxHTMLDepth(0), wantErr: ErrBadMaxHTMLDepthValue},
+		{name: "limits", option: WithMaxBodyBytes(1 << 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewScraper(tt.option)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
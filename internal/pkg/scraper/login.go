@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	ErrBadLoginURL = errors.New("login url must be an absolute http or https url")
+	ErrLoginFailed = errors.New("login failed")
+)
+
+// login - form login of a scrape, it runs once before the first page is fetched
+// and its session cookies are kept in a jar only the pages of that scrape use
+type login struct {
+	url    *url.URL
+	fields url.Values
+	jar    http.CookieJar
+	mu     chan struct{} // held while logging in, a channel so the pages waiting for it can give up
+	done   bool
+	err    error
+}
+
+// WithLogin posts fields as a form to loginURL before the first page of the scrape, the cookies set by the
+// login (and the pages after it) are sent with every page of the scrape and never shared with other scrapes
+func WithLogin(loginURL string, fields map[string]string) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		parsed, err := url.Parse(loginURL)
+		if err != nil || !parsed.IsAbs() || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ErrBadLoginURL
+		}
+
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return fmt.Errorf("failed to create cookie jar %w", err)
+		}
+
+		values := url.Values{}
+		for name, value := range fields {
+			values.Set(name, value)
+		}
+
+		o.login = &login{url: parsed, fields: values, jar: jar, mu: make(chan struct{}, 1)}
+		return nil
+	}
+}
+
+// session - client with the cookie jar of the login, the login is done by the first caller
+// and the others wait for it, a failed login fails every page of the scrape. The login runs under the ctx of
+// the page that does it, a login cut short by that ctx (e.g. the page timed out) isn't remembered and the next page tries again
+func (l *login) session(ctx context.Context, p *Scraper, client *http.Client, opts scrapeOptions) (*http.Client, error) {
+	session := *client
+	session.Jar = l.jar
+
+	select {
+	case l.mu <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.mu }()
+
+	if !l.done {
+		err := p.postLogin(ctx, &session, l, opts)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		l.done, l.err = true, err
+	}
+
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	return &session, nil
+}
+
+func (p *Scraper) postLogin(ctx context.Context, client *http.Client, l *login, opts scrapeOptions) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url.String(), strings.NewReader(l.fields.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create login request %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:97.0) Gecko/20100101 Firefox/97.0")
+
+	if p.credentials != nil {
+		p.credentials.Apply(req)
+	}
+
+	for _, option := range opts.reqOptions {
+		err = option(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to log in %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) // drain so the connection can be reused
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%w with status %d", ErrLoginFailed, resp.StatusCode)
+	}
+
+	return nil
+}
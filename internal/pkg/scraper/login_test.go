@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginServerHelper - pages need the session cookie of a successful POST /login (user=user, password=hunter2)
+func loginServerHelper(t *testing.T) (host string, logins *int32) {
+	body, err := os.ReadFile("testdata/good_links_serve.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins = new(int32)
+
+	r := chi.NewRouter()
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(logins, 1)
+		if r.PostFormValue("user") != "user" || r.PostFormValue("password") != "hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3ss10n", Path: "/"})
+		http.Redirect(w, r, "/welcome", http.StatusSeeOther)
+	})
+	r.Get("/welcome", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "token", Path: "/"})
+	})
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if err != nil || session.Value != "s3ss10n" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if _, err := r.Cookie("csrf"); err != nil { // set by the page the login redirected to
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	})
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: r}
+
+	go func() {
+		srv.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return strings.Replace(listener.Addr().String(), "127.0.0.1", "localhost", -1), logins
+}
+
+func TestScraper_login(t *testing.T) {
+	t.Run("pages reuse the login session", func(t *testing.T) {
+		host, logins := loginServerHelper(t)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		pages := test.StrToURL(t, []string{"http://" + host + "/", "http://" + host + "/a", "http://" + host + "/b"})
+		login := WithLogin("http://"+host+"/login", map[string]string{"user": "user", "password": "hunter2"})
+		for result := range s.StreamPages(context.Background(), pages, login) {
+			assert.True(t, result.Success, result.Error)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(logins))
+	})
+	t.Run("failed login fails every page", func(t *testing.T) {
+		host, logins := loginServerHelper(t)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		pages := test.StrToURL(t, []string{"http://" + host + "/", "http://" + host + "/a"})
+		login := WithLogin("http://"+host+"/login", map[string]string{"user": "user", "password": "wrong"})
+		produced := 0
+		for result := range s.StreamPages(context.Background(), pages, login) {
+			assert.ErrorIs(t, result.Error, ErrLoginFailed)
+			produced++
+		}
+		assert.Equal(t, 2, produced)
+		assert.Equal(t, int32(1), atomic.LoadInt32(logins))
+	})
+	t.Run("sessions are not shared between scrapes", func(t *testing.T) {
+		host, logins := loginServerHelper(t)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		pages := test.StrToURL(t, []string{"http://" + host + "/"})
+		login := WithLogin("http://"+host+"/login", map[string]string{"user": "user", "password": "hunter2"})
+		for result := range s.StreamPages(context.Background(), pages, login) {
+			assert.True(t, result.Success, result.Error)
+		}
+
+		for result := range s.StreamPages(context.Background(), pages) {
+			assert.ErrorIs(t, result.Error, ErrBadStatusCode)
+		}
+
+		// reusing the option still logs in again with a new jar
+		for result := range s.StreamPages(context.Background(), pages, login) {
+			assert.True(t, result.Success, result.Error)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(logins))
+	})
+	t.Run("login cut short by its page is tried again", func(t *testing.T) {
+		host, logins := loginServerHelper(t)
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		opts := scrapeOptions{}
+		assert.NoError(t, WithLogin("http://"+host+"/login", map[string]string{"user": "user", "password": "hunter2"})(&opts))
+
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = opts.login.session(canceled, s, &http.Client{}, opts)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, err = opts.login.session(context.Background(), s, &http.Client{}, opts)
+		assert.NoError(t, err)
+		_, err = opts.login.session(context.Background(), s, &http.Client{}, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(logins))
+	})
+	t.Run("slow login doesn't use up the idle timeout of the page", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				time.Sleep(time.Millisecond * 300)
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3ss10n", Path: "/"})
+				return
+			}
+			if _, err := r.Cookie("session"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`<html></html>`))
+		}))
+		defer srv.Close()
+		host := strings.Replace(srv.URL, "127.0.0.1", "localhost", -1)
+
+		s, err := NewScraper(WithIdleTimeout(time.Millisecond * 100))
+		assert.NoError(t, err)
+
+		login := WithLogin(host+"/login", map[string]string{"user": "user"})
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host + "/"}), login) {
+			assert.True(t, result.Success, result.Error)
+		}
+	})
+	t.Run("bad login url", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		for _, loginURL := range []string{"/login", "ftp://localhost/login", "http:///login"} {
+			for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://localhost/"}), WithLogin(loginURL, nil)) {
+				assert.ErrorIs(t, result.Error, ErrBadLoginURL)
+			}
+		}
+	})
+}
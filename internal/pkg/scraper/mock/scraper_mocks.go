@@ -36,6 +36,20 @@ func (m *MockScraperService) EXPECT() *MockScraperServiceMockRecorder {
 	return m.recorder
 }
 
+// CircuitBreakers mocks base method.
+func (m *MockScraperService) CircuitBreakers() []scraper.CircuitBreakerStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CircuitBreakers")
+	ret0, _ := ret[0].([]scraper.CircuitBreakerStatus)
+	return ret0
+}
+
+// CircuitBreakers indicates an expected call of CircuitBreakers.
+func (mr *MockScraperServiceMockRecorder) CircuitBreakers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CircuitBreakers", reflect.TypeOf((*MockScraperService)(nil).CircuitBreakers))
+}
+
 // Close mocks base method.
 func (m *MockScraperService) Close(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -68,3 +82,22 @@ func (mr *MockScraperServiceMockRecorder) ScrapePages(ctx, urls interface{}, req
 	varargs := append([]interface{}{ctx, urls}, reqOptions...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScrapePages", reflect.TypeOf((*MockScraperService)(nil).ScrapePages), varargs...)
 }
+
+// StreamPages mocks base method.
+func (m *MockScraperService) StreamPages(ctx context.Context, urls []*url.URL, options ...scraper.ScrapeOption) <-chan scraper.Result {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, urls}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "StreamPages", varargs...)
+	ret0, _ := ret[0].(<-chan scraper.Result)
+	return ret0
+}
+
+// StreamPages indicates an expected call of StreamPages.
+func (mr *MockScraperServiceMockRecorder) StreamPages(ctx, urls interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, urls}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamPages", reflect.TypeOf((*MockScraperService)(nil).StreamPages), varargs...)
+}
@@ -1,19 +1,60 @@
 package scraper
 
 import (
+	"errors"
 	"log"
 	"net/url"
 
+	"github.com/buni/scraper/internal/pkg/canonical"
 	"golang.org/x/net/html"
+	"golang.org/x/net/publicsuffix"
 )
 
+// DefaultMaxHTMLDepth - how deep documents are searched for links, browsers stop nesting elements at the same depth
+const DefaultMaxHTMLDepth = 512
+
+var ErrHTMLTooDeep = errors.New("html nested too deep")
+
+// LinkPolicy - decides which links count as internal
+type LinkPolicy string
+
+const (
+	LinkPolicyHost   LinkPolicy = "host"   // only links to the same host are internal, sub domains are external
+	LinkPolicyDomain LinkPolicy = "domain" // links to any host under the same registrable domain (eTLD+1) are internal
+)
+
+// Valid ...
+func (p LinkPolicy) Valid() bool {
+	return p == LinkPolicyHost || p == LinkPolicyDomain
+}
+
 // ParseHTMLLinks extracts external & internal links from html document
 func ParseHTMLLinks(page *url.URL, document *html.Node) (external, internal uint, err error) {
-	var f func(*html.Node)
+	return ParseHTMLLinksWithPolicy(page, document, LinkPolicyHost)
+}
+
+// ParseHTMLLinksWithPolicy extracts external & internal links from html document, classifying them with policy
+func ParseHTMLLinksWithPolicy(page *url.URL, document *html.Node, policy LinkPolicy) (external, internal uint, err error) {
+	return parseHTMLLinks(page, document, policy, DefaultMaxHTMLDepth)
+}
+
+// parseHTMLLinks - the document is walked without recursion, elements nested deeper than maxDepth are not searched
+// and the links found up to that point are returned with ErrHTMLTooDeep
+func parseHTMLLinks(page *url.URL, document *html.Node, policy LinkPolicy, maxDepth int) (external, internal uint, err error) {
+	pageHost := canonical.Hostname(page) // Example.COM. and example.com are the same host
+
+	type nodeDepth struct {
+		node  *html.Node
+		depth int
+	}
+	stack := []nodeDepth{{node: document}}
+
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
 
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" { // ignore link/img/script tags
-			for _, attr := range n.Attr {
+		if n.node.Type == html.ElementNode && n.node.Data == "a" { // ignore link/img/script tags
+			for _, attr := range n.node.Attr {
 				if attr.Key == "href" && attr.Val != "" { // links with empty href value are not counted as internal (or at all)
 					hrefURL, err := url.Parse(attr.Val)
 					if err != nil { // its acceptable to skip this error and continue proccessing the next node
@@ -22,7 +63,9 @@ func ParseHTMLLinks(page *url.URL, document *html.Node) (external, internal uint
 					}
 
 					switch {
-					case hrefURL.Hostname() == page.Hostname(): // hostnames match (sub domains are treated as external links)
+					case canonical.Hostname(hrefURL) == pageHost: // hostnames match (sub domains are treated as external links)
+						internal++
+					case policy == LinkPolicyDomain && sameDomain(canonical.Hostname(hrefURL), pageHost):
 						internal++
 					case hrefURL.Hostname() == "" && hrefURL.Path != "": // if the host is not set but path is set the link most likely is internal
 						internal++
@@ -33,11 +76,39 @@ func ParseHTMLLinks(page *url.URL, document *html.Node) (external, internal uint
 				}
 			}
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
+
+		if n.node.FirstChild == nil {
+			continue
+		}
+
+		if n.depth == maxDepth {
+			err = ErrHTMLTooDeep
+			continue
 		}
+
+		for c := n.node.LastChild; c != nil; c = c.PrevSibling { // pushed in reverse so they are popped in document order
+			stack = append(stack, nodeDepth{node: c, depth: n.depth + 1})
+		}
+	}
+
+	return external, internal, err
+}
+
+// sameDomain - true if both hosts belong to the same registrable domain, e.g. blog.example.com and www.example.com
+func sameDomain(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+
+	domainA, err := publicsuffix.EffectiveTLDPlusOne(a)
+	if err != nil { // ips, localhost and bare suffixes have no registrable domain
+		return false
+	}
+
+	domainB, err := publicsuffix.EffectiveTLDPlusOne(b)
+	if err != nil {
+		return false
 	}
 
-	f(document)
-	return
+	return domainA == domainB
 }
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"errors"
 	"net/url"
 	"os"
 	"testing"
@@ -15,6 +16,7 @@ func TestParseHTMLLinks(t *testing.T) {
 		wantInternal uint
 		wantErr      bool
 		url          string
+		policy       LinkPolicy
 		setup        func(t *testing.T, url string) (*url.URL, *html.Node)
 	}{
 		{
@@ -42,6 +44,57 @@ func TestParseHTMLLinks(t *testing.T) {
 				return parsedBaseURL, document
 			},
 		},
+		{
+			name:         "successfully parse html of a non canonical page url",
+			url:          "http://LocalHost.COM.:80/",
+			wantExternal: 2,
+			wantInternal: 6,
+			setup: func(t *testing.T, baseURL string) (*url.URL, *html.Node) {
+				parsedBaseURL, err := url.Parse(baseURL)
+				if err != nil {
+					t.Error(err)
+				}
+
+				f, err := os.Open("testdata/good_links.html")
+				if err != nil {
+					t.Error(err)
+				}
+
+				defer f.Close()
+				document, err := html.Parse(f)
+				if err != nil {
+					t.Error(err)
+				}
+
+				return parsedBaseURL, document
+			},
+		},
+		{
+			name:         "successfully parse html with domain policy",
+			url:          "http://localhost.com/",
+			policy:       LinkPolicyDomain,
+			wantExternal: 1,
+			wantInternal: 7,
+			setup: func(t *testing.T, baseURL string) (*url.URL, *html.Node) {
+				parsedBaseURL, err := url.Parse(baseURL)
+				if err != nil {
+					t.Error(err)
+				}
+
+				f, err := os.Open("testdata/good_links.html")
+				if err != nil {
+					t.Error(err)
+				}
+
+				defer f.Close()
+				document, err := html.Parse(f)
+				if err != nil {
+					t.Error(err)
+				}
+
+				return parsedBaseURL, document
+			},
+		},
 		{
 			name:         "successfully parse html with bad links",
 			url:          "http://localhost/",
@@ -62,6 +115,30 @@ func TestParseHTMLLinks(t *testing.T) {
 					t.Error(err)
 				}
 
+				return parsedBaseURL, document
+			},
+		},
+		{
+			name:         "fail html nested too deep",
+			url:          "http://localhost/",
+			wantExternal: 1,
+			wantInternal: 1,
+			wantErr:      true,
+			setup: func(t *testing.T, baseURL string) (*url.URL, *html.Node) {
+				parsedBaseURL, err := url.Parse(baseURL)
+				if err != nil {
+					t.Error(err)
+				}
+				f, err := os.Open("testdata/deep_nesting.html")
+				if err != nil {
+					t.Error(err)
+				}
+				defer f.Close()
+				document, err := html.Parse(f)
+				if err != nil {
+					t.Error(err)
+				}
+
 				return parsedBaseURL, document
 			},
 		},
@@ -70,10 +147,16 @@ func TestParseHTMLLinks(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			testURL, document := tt.setup(t, tt.url)
 			gotExternal, gotInternal, err := ParseHTMLLinks(testURL, document)
+			if tt.policy != "" {
+				gotExternal, gotInternal, err = ParseHTMLLinksWithPolicy(testURL, document, tt.policy)
+			}
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ParseHTMLLinks() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil && !errors.Is(err, ErrHTMLTooDeep) {
+				t.Errorf("ParseHTMLLinks() error = %v, want %v", err, ErrHTMLTooDeep)
+			}
 			if gotExternal != tt.wantExternal {
 				t.Errorf("ParseHTMLLinks() gotExternal = %v, want %v", gotExternal, tt.wantExternal)
 			}
@@ -0,0 +1,268 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadProxy            = errors.New("proxy must be an http, https or socks5 url")
+	ErrBadProxyRotation    = errors.New("bad proxy rotation")
+	ErrBadProxyMaxFailures = errors.New("bad proxy max failures value")
+	ErrBadProxyCooldown    = errors.New("bad proxy cooldown value")
+	ErrNoHealthyProxy      = errors.New("no healthy proxy")
+)
+
+// ProxyRotation - how a ProxyPool picks the proxy of a request
+type ProxyRotation string
+
+const (
+	ProxyRotationRoundRobin ProxyRotation = "round-robin" // every request goes through the next healthy proxy
+	ProxyRotationSticky     ProxyRotation = "sticky"      // requests to the same host go through the same proxy while it's healthy
+)
+
+// Valid - reports whether r is a known rotation
+func (r ProxyRotation) Valid() bool {
+	return r == ProxyRotationRoundRobin || r == ProxyRotationSticky
+}
+
+// proxyPorts - default ports of the proxy schemes, the same ones http.Transport dials
+var proxyPorts = map[string]string{"http": "80", "https": "443", "socks5": "1080"}
+
+// ParseProxyURL - parses an http, https or socks5 proxy url, credentials can be passed as user info
+func ParseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, ErrBadProxy // the parse error would echo the url, credentials included
+	}
+
+	if _, ok := proxyPorts[proxyURL.Scheme]; !ok || proxyURL.Hostname() == "" {
+		return nil, ErrBadProxy
+	}
+
+	return proxyURL, nil
+}
+
+// proxyAddress - the host:port http.Transport dials to reach proxyURL
+func proxyAddress(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		port = proxyPorts[proxyURL.Scheme]
+	}
+
+	return net.JoinHostPort(strings.ToLower(proxyURL.Hostname()), port)
+}
+
+type poolProxy struct {
+	url       *url.URL
+	address   string
+	failures  int       // consecutive failed connects
+	removedAt time.Time // zero while the proxy is in rotation
+}
+
+// ProxyPool - rotates requests over a set of proxies, a proxy that fails to connect maxFailures times in a row
+// is taken out of rotation for cooldown and then gets one connect to prove it's back
+type ProxyPool struct {
+	mu          sync.Mutex
+	proxies     []*poolProxy
+	rotation    ProxyRotation
+	maxFailures int
+	cooldown    time.Duration
+	next        int
+	now         func() time.Time
+}
+
+type ProxyPoolOption func(p *ProxyPool) error
+
+// WithProxyRotation sets how the pool picks proxies, round robin by default
+func WithProxyRotation(rotation ProxyRotation) ProxyPoolOption {
+	return func(p *ProxyPool) error {
+		if !rotation.Valid() {
+			return ErrBadProxyRotation
+		}
+		p.rotation = rotation
+		return nil
+	}
+}
+
+// WithProxyMaxFailures sets after how many consecutive connect failures a proxy is taken out of rotation
+func WithProxyMaxFailures(maxFailures int) ProxyPoolOption {
+	return func(p *ProxyPool) error {
+		if maxFailures <= 0 {
+			return ErrBadProxyMaxFailures
+		}
+		p.maxFailures = maxFailures
+		return nil
+	}
+}
+
+// WithProxyCooldown sets how long an unhealthy proxy stays out of rotation
+func WithProxyCooldown(cooldown time.Duration) ProxyPoolOption {
+	return func(p *ProxyPool) error {
+		if cooldown <= 0 {
+			return ErrBadProxyCooldown
+		}
+		p.cooldown = cooldown
+		return nil
+	}
+}
+
+// NewProxyPool ...
+func NewProxyPool(proxyURLs []string, options ...ProxyPoolOption) (*ProxyPool, error) {
+	if len(proxyURLs) == 0 {
+		return nil, ErrBadProxy
+	}
+
+	pool := &ProxyPool{rotation: ProxyRotationRoundRobin, maxFailures: 3, cooldown: time.Minute, now: time.Now}
+
+	for _, rawURL := range proxyURLs {
+		proxyURL, err := ParseProxyURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		pool.proxies = append(pool.proxies, &poolProxy{url: proxyURL, address: proxyAddress(proxyURL)})
+	}
+
+	for _, option := range options {
+		err := option(pool)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply proxy pool option %w", err)
+		}
+	}
+
+	return pool, nil
+}
+
+// Proxy - picks the proxy of req, it can be used as http.Transport.Proxy
+func (p *ProxyPool) Proxy(req *http.Request) (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := p.healthy()
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyProxy
+	}
+
+	if p.rotation == ProxyRotationSticky {
+		return stickyProxy(healthy, req.URL.Host).url, nil
+	}
+
+	proxy := healthy[p.next%len(healthy)]
+	p.next++
+
+	return proxy.url, nil
+}
+
+// healthy - proxies in rotation, the ones past their cooldown are put back, one more failure takes them out again
+func (p *ProxyPool) healthy() []*poolProxy {
+	now := p.now()
+	healthy := make([]*poolProxy, 0, len(p.proxies))
+
+	for _, proxy := range p.proxies {
+		if !proxy.removedAt.IsZero() {
+			if now.Sub(proxy.removedAt) < p.cooldown {
+				continue
+			}
+			proxy.removedAt = time.Time{}
+			proxy.failures = p.maxFailures - 1
+		}
+		healthy = append(healthy, proxy)
+	}
+
+	return healthy
+}
+
+// stickyProxy - rendezvous hashing, when a proxy leaves the rotation only the hosts it served move to other proxies
+func stickyProxy(proxies []*poolProxy, host string) *poolProxy {
+	var (
+		picked *poolProxy
+		top    uint64
+	)
+
+	for _, proxy := range proxies {
+		h := fnv.New64a()
+		h.Write([]byte(proxy.address))
+		h.Write([]byte(host))
+		if score := h.Sum64(); picked == nil || score > top {
+			picked, top = proxy, score
+		}
+	}
+
+	return picked
+}
+
+// report - records the outcome of a connect to address, addresses that aren't pool proxies are ignored
+func (p *ProxyPool) report(address string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, proxy := range p.proxies {
+		if proxy.address != address {
+			continue
+		}
+
+		if err == nil {
+			proxy.failures = 0
+			continue
+		}
+
+		proxy.failures++
+		if proxy.failures >= p.maxFailures && proxy.removedAt.IsZero() {
+			proxy.removedAt = p.now()
+		}
+	}
+}
+
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// trackDial - wraps dial so connects to the pool proxies update their health,
+// connects abandoned because the request was canceled don't count against the proxy
+func (p *ProxyPool) trackDial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if ctx.Err() == nil {
+			p.report(strings.ToLower(address), err)
+		}
+		return conn, err
+	}
+}
+
+type proxyContextKey struct{}
+
+// useProxies - routes requests through the proxy of their scrape or the pool,
+// requests without either keep the proxy setting of the transport
+func (s *Scraper) useProxies() {
+	transport, ok := s.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	fallback := transport.Proxy
+	if s.proxies != nil {
+		fallback = s.proxies.Proxy
+
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		transport.DialContext = s.proxies.trackDial(dial)
+	}
+
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxyURL, ok := req.Context().Value(proxyContextKey{}).(*url.URL); ok {
+			return proxyURL, nil
+		}
+		if fallback == nil {
+			return nil, nil
+		}
+		return fallback(req)
+	}
+}
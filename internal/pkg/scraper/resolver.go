@@ -0,0 +1,31 @@
+package scraper
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/buni/scraper/internal/pkg/dnscache"
+)
+
+// WithResolver resolves the host names of pages (and proxies) through resolver, so the connections to a host
+// share its cached addresses instead of resolving them again. The addresses are still checked by WithSafeDialer
+func WithResolver(resolver *dnscache.Resolver) ScraperOption {
+	return func(s *Scraper) error {
+		s.resolver = resolver
+		return nil
+	}
+}
+
+// useResolver - plugs the resolver of the scraper into the dialer of its transport
+func (s *Scraper) useResolver() {
+	transport, ok := s.httpClient.Transport.(*http.Transport)
+	if !ok || s.resolver == nil {
+		return
+	}
+
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	transport.DialContext = s.resolver.DialContext(dial)
+}
@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/buni/scraper/internal/pkg/dnscache"
+	"github.com/buni/scraper/internal/pkg/safedial"
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScraper_resolver(t *testing.T) {
+	status := int32(http.StatusOK)
+	host, _ := failingServerHelper(t, &status)
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(host, "http://"))
+	assert.NoError(t, err)
+	server, queries := test.DNSServer(t, map[string]string{"site.test": "127.0.0.1"})
+
+	t.Run("pages share the cached addresses", func(t *testing.T) {
+		resolver, err := dnscache.New(dnscache.WithServer(server))
+		assert.NoError(t, err)
+		s, err := NewScraper(WithResolver(resolver))
+		assert.NoError(t, err)
+
+		urls := []string{}
+		for i := 0; i < 20; i++ {
+			urls = append(urls, fmt.Sprintf("http://site.test:%s/%d", port, i))
+		}
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, urls)) {
+			assert.True(t, result.Success, result.Error)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(queries))
+	})
+	t.Run("missing host", func(t *testing.T) {
+		resolver, err := dnscache.New(dnscache.WithServer(server))
+		assert.NoError(t, err)
+		s, err := NewScraper(WithResolver(resolver))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, "http://missing.test:"+port+"/")
+		assert.False(t, result.Success)
+		assert.Equal(t, ErrorCategoryDNS, result.ErrorCategory)
+	})
+	t.Run("resolved addresses are checked by the safe dialer", func(t *testing.T) {
+		resolver, err := dnscache.New(dnscache.WithServer(server))
+		assert.NoError(t, err)
+		policy, err := safedial.NewPolicy()
+		assert.NoError(t, err)
+		s, err := NewScraper(WithSafeDialer(policy), WithResolver(resolver))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, "http://site.test:"+port+"/")
+		assert.ErrorIs(t, result.Error, safedial.ErrBlockedAddress)
+	})
+}
@@ -2,26 +2,53 @@ package scraper
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"github.com/buni/scraper/internal/pkg/credentials"
+	"github.com/buni/scraper/internal/pkg/dnscache"
+	"github.com/buni/scraper/internal/pkg/safedial"
 	"github.com/hashicorp/go-cleanhttp"
 	"golang.org/x/net/html"
+	"golang.org/x/net/http/httpguts"
 )
 
 var (
 	ErrBadStatusCode       = errors.New("bad status code")
 	ErrCloseTimeout        = errors.New("close took longer than deadline")
 	ErrBadConcurrencyValue = errors.New("bad concurrency value")
+	ErrBadTimeoutValue     = errors.New("bad timeout value")
+	ErrBadLinkPolicy       = errors.New("bad link policy")
+	ErrBadHeader           = errors.New("bad header")
 )
 
 type Scraper struct {
 	httpClient        *http.Client
 	wg                *sync.WaitGroup
 	produceConcurency int
+	proxies           *ProxyPool
+	credentials       *credentials.Store
+	tls               *tls.Config
+	insecureClient    *http.Client // the client of scrapes that skip tls verification
+	expiryWarning     time.Duration
+	cache             Cache
+	flights           *flightGroup
+	recent            *recentResults
+	canonicalizer     *canonical.Canonicalizer
+	pageTimeout       time.Duration
+	idleTimeout       time.Duration
+	maxBodyBytes      int64
+	maxHTMLDepth      int
+	breakers          *circuitBreakers
+	hostLimits        *hostLimiter
+	resolver          *dnscache.Resolver
 }
 
 //go:generate mockgen -source=scraper.go -destination=mock/scraper_mocks.go -package mock
@@ -29,6 +56,8 @@ type Scraper struct {
 // ScraperService ...
 type ScraperService interface {
 	ScrapePages(ctx context.Context, urls []*url.URL, reqOptions ...ScrapeRequestOption) []Result
+	StreamPages(ctx context.Context, urls []*url.URL, options ...ScrapeOption) <-chan Result
+	CircuitBreakers() []CircuitBreakerStatus
 	Close(ctx context.Context) error
 }
 
@@ -45,15 +74,174 @@ func WithConcurrency(concurency int) ScraperOption {
 	}
 }
 
+// WithSafeDialer makes the scraper only connect to addresses policy allows, the check runs on every connection
+// (after name resolution, for redirects as well), so a page can't point the scraper to internal services
+func WithSafeDialer(policy *safedial.Policy) ScraperOption {
+	return func(s *Scraper) error {
+		s.httpClient.Transport = policy.Transport()
+		return nil
+	}
+}
+
+// WithProxy sends every request through the proxy at proxyURL (http, https or socks5)
+func WithProxy(proxyURL string) ScraperOption {
+	return func(s *Scraper) error {
+		pool, err := NewProxyPool([]string{proxyURL})
+		if err != nil {
+			return err
+		}
+		s.proxies = pool
+		return nil
+	}
+}
+
+// WithProxyPool sends requests through the proxies of pool, scrapes with their own proxy (WithScrapeProxy) bypass it
+func WithProxyPool(pool *ProxyPool) ScraperOption {
+	return func(s *Scraper) error {
+		s.proxies = pool
+		return nil
+	}
+}
+
+// WithCredentials sends the credentials of store to the hosts they are for, redirects to other hosts get their own
+// credentials instead, and the secrets are redacted from the result errors
+func WithCredentials(store *credentials.Store) ScraperOption {
+	return func(s *Scraper) error {
+		s.credentials = store
+		s.httpClient.CheckRedirect = s.checkRedirect
+		return nil
+	}
+}
+
+// WithCache makes page fetches conditional on the validators (ETag, Last-Modified) of the previous fetch,
+// pages that weren't modified get the link counts of that fetch
+func WithCache(cache Cache) ScraperOption {
+	return func(s *Scraper) error {
+		s.cache = cache
+		return nil
+	}
+}
+
+// WithCanonicalizer sets how pages are identified when results are shared or cached, canonical.Default is used without it
+func WithCanonicalizer(canonicalizer *canonical.Canonicalizer) ScraperOption {
+	return func(s *Scraper) error {
+		s.canonicalizer = canonicalizer
+		return nil
+	}
+}
+
 // ScrapeRequestOption modify http request used for scrape
 type ScrapeRequestOption func(r *http.Request) error
 
+// WithHeader sets a header on every scrape request
+func WithHeader(key, value string) ScrapeRequestOption {
+	return func(r *http.Request) error {
+		if !httpguts.ValidHeaderFieldName(key) || !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("%w %q", ErrBadHeader, key)
+		}
+		r.Header.Set(key, value)
+		return nil
+	}
+}
+
+// scrapeOptions - settings of a single scrape, zero values fall back to the scraper defaults
+type scrapeOptions struct {
+	timeout     time.Duration
+	concurrency int
+	linkPolicy  LinkPolicy
+	reqOptions  []ScrapeRequestOption
+	proxy       *url.URL
+
+	insecureSkipVerify bool
+	login              *login
+	maxAge             time.Duration
+}
+
+// ScrapeOption configures a single scrape (as opposed to ScraperOption which configures the scraper)
+type ScrapeOption func(o *scrapeOptions) error
+
+// WithTimeout limits how long fetching a single page can take
+func WithTimeout(timeout time.Duration) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		if timeout <= 0 {
+			return ErrBadTimeoutValue
+		}
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithScrapeConcurrency limits how many pages of the scrape are fetched in parallel,
+// it can't go above the concurrency of the scraper
+func WithScrapeConcurrency(concurrency int) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		if concurrency <= 0 {
+			return ErrBadConcurrencyValue
+		}
+		o.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithLinkPolicy sets how links are classified as internal or external
+func WithLinkPolicy(policy LinkPolicy) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		if !policy.Valid() {
+			return ErrBadLinkPolicy
+		}
+		o.linkPolicy = policy
+		return nil
+	}
+}
+
+// WithRequestOptions applies reqOptions to every request of the scrape
+func WithRequestOptions(reqOptions ...ScrapeRequestOption) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		o.reqOptions = append(o.reqOptions, reqOptions...)
+		return nil
+	}
+}
+
+// WithScrapeProxy sends the requests of the scrape through the proxy at proxyURL instead of the scraper proxies
+func WithScrapeProxy(proxyURL string) ScrapeOption {
+	return func(o *scrapeOptions) error {
+		parsed, err := ParseProxyURL(proxyURL)
+		if err != nil {
+			return err
+		}
+		o.proxy = parsed
+		return nil
+	}
+}
+
+func newScrapeOptions(options ...ScrapeOption) (scrapeOptions, error) {
+	opts := scrapeOptions{linkPolicy: LinkPolicyHost}
+
+	for _, option := range options {
+		err := option(&opts)
+		if err != nil {
+			return scrapeOptions{}, fmt.Errorf("failed to apply scrape option %w", err)
+		}
+	}
+
+	return opts, nil
+}
+
 // NewScraper ...
 func NewScraper(options ...ScraperOption) (*Scraper, error) {
 	scraper := &Scraper{}
 	scraper.wg = &sync.WaitGroup{}
 	scraper.httpClient = cleanhttp.DefaultClient()
 	scraper.produceConcurency = 1000
+	scraper.expiryWarning = defaultExpiryWarning
+	scraper.flights = &flightGroup{flights: map[string]*flight{}}
+	scraper.recent = newRecentResults(defaultRecentResults)
+	scraper.canonicalizer = canonical.Default
+	scraper.pageTimeout = defaultPageTimeout
+	scraper.idleTimeout = defaultIdleTimeout
+	scraper.maxBodyBytes = defaultMaxBodyBytes
+	scraper.maxHTMLDepth = DefaultMaxHTMLDepth
+	scraper.hostLimits = newHostLimiter(defaultHostConcurrency, defaultMaxHostConcurrency)
 
 	for _, option := range options {
 		err := option(scraper)
@@ -62,6 +250,10 @@ func NewScraper(options ...ScraperOption) (*Scraper, error) {
 		}
 	}
 
+	scraper.useResolver()
+	scraper.useProxies()
+	scraper.useTLSConfig()
+
 	return scraper, nil
 }
 
@@ -76,7 +268,7 @@ func (p *Scraper) ScrapePages(ctx context.Context, urls []*url.URL, reqOptions .
 
 	results := make([]Result, 0, len(urls))
 	p.enqueueURLs(ctx, wg, urlsChan, urls...)
-	p.produceResults(ctx, wg, urlsChan, resultsChan)
+	p.produceResults(ctx, wg, urlsChan, resultsChan, scrapeOptions{linkPolicy: LinkPolicyHost, reqOptions: reqOptions})
 
 	for result := range resultsChan {
 		results = append(results, result)
@@ -85,6 +277,31 @@ func (p *Scraper) ScrapePages(ctx context.Context, urls []*url.URL, reqOptions .
 	return results
 }
 
+// StreamPages - scrapes the provided urls, results are sent as soon as they are produced
+// the returned channel is closed once every url was processed or the context is done
+// if the options are invalid every url gets a failed result with the option error
+func (p *Scraper) StreamPages(ctx context.Context, urls []*url.URL, options ...ScrapeOption) <-chan Result {
+	wg := &sync.WaitGroup{}
+	resultsChan := make(chan Result)
+	urlsChan := make(chan *url.URL)
+
+	opts, err := newScrapeOptions(options...)
+	if err != nil {
+		opts = scrapeOptions{reqOptions: []ScrapeRequestOption{func(r *http.Request) error { return err }}}
+	}
+
+	p.wg.Add(1)
+	p.enqueueURLs(ctx, wg, urlsChan, urls...)
+	p.produceResults(ctx, wg, urlsChan, resultsChan, opts)
+
+	go func() {
+		wg.Wait()
+		p.wg.Done()
+	}()
+
+	return resultsChan
+}
+
 func (p *Scraper) enqueueURLs(ctx context.Context, wg *sync.WaitGroup, urlsChan chan *url.URL, urls ...*url.URL) {
 	wg.Add(1)
 	go func() {
@@ -103,8 +320,13 @@ func (p *Scraper) enqueueURLs(ctx context.Context, wg *sync.WaitGroup, urlsChan
 	}()
 }
 
-func (p *Scraper) produceResults(ctx context.Context, wg *sync.WaitGroup, urlsChan chan *url.URL, resultsChan chan Result, reqOptions ...ScrapeRequestOption) {
-	for i := 0; i < p.produceConcurency; i++ { // TODO: configure concurency
+func (p *Scraper) produceResults(ctx context.Context, wg *sync.WaitGroup, urlsChan chan *url.URL, resultsChan chan Result, opts scrapeOptions) {
+	concurrency := p.produceConcurency
+	if opts.concurrency > 0 && opts.concurrency < concurrency {
+		concurrency = opts.concurrency
+	}
+
+	for i := 0; i < concurrency; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -112,7 +334,7 @@ func (p *Scraper) produceResults(ctx context.Context, wg *sync.WaitGroup, urlsCh
 				select {
 				case <-ctx.Done():
 					return
-				case resultsChan <- p.scrapePage(ctx, u, reqOptions...):
+				case resultsChan <- p.scrapePage(ctx, u, opts):
 				}
 			}
 		}()
@@ -124,8 +346,81 @@ func (p *Scraper) produceResults(ctx context.Context, wg *sync.WaitGroup, urlsCh
 	}()
 }
 
-func (p *Scraper) scrapePage(ctx context.Context, page *url.URL, reqOptions ...ScrapeRequestOption) Result { // TODO: add options to above methods
-	result := Result{PageURL: page.String()}
+// scrapePage - scrapes page once for all the scrapes asking for it at the same time, or reuses a recent result
+// when the scrape accepts one, scrapes that can't share results fetch on their own
+func (p *Scraper) scrapePage(ctx context.Context, page *url.URL, opts scrapeOptions) Result {
+	key, ok := p.shareKey(page, opts)
+	if !ok {
+		return p.redactedPage(ctx, page, opts)
+	}
+
+	if opts.maxAge > 0 {
+		if result, ok := p.recent.get(key, opts.maxAge); ok {
+			return sharedResult(result, page)
+		}
+	}
+
+	result, merged := p.flights.do(ctx, key, func() Result {
+		result := p.redactedPage(ctx, page, opts)
+		if result.Success {
+			p.recent.add(key, result)
+		}
+		return result
+	})
+	if !merged {
+		return result
+	}
+
+	// the scrape that did the fetch was canceled, that's no reason to fail this one
+	if ctx.Err() == nil && (errors.Is(result.Error, context.Canceled) || errors.Is(result.Error, context.DeadlineExceeded)) {
+		return p.redactedPage(ctx, page, opts)
+	}
+
+	return sharedResult(result, page)
+}
+
+// redactedPage - fetches page within the concurrency limit of its host unless the circuit breaker of the host is open,
+// the errors are categorized and the credentials are redacted from them
+func (p *Scraper) redactedPage(ctx context.Context, page *url.URL, opts scrapeOptions) Result {
+	// the breakers are shared by every scrape, scrapes with their own timeout, proxy, login, headers or tls checks
+	// don't say how the host does for the others, they neither fail fast nor count
+	breakers := p.breakers
+	if opts.timeout > 0 || opts.proxy != nil || opts.login != nil || len(opts.reqOptions) > 0 || opts.insecureSkipVerify {
+		breakers = nil
+	}
+
+	host := canonical.Host(page)
+	err := breakers.allow(host)
+	if err != nil {
+		return Result{PageURL: page.Redacted(), Error: err, ErrorCategory: ErrorCategoryCircuitOpen}
+	}
+
+	result := p.limitedPage(ctx, page, opts)
+	if result.Error != nil && result.ErrorCategory == "" {
+		result.ErrorCategory = errorCategory(result.Error)
+	}
+	breakers.done(host, result.Success, result.ErrorCategory)
+
+	if p.credentials != nil {
+		result.Error = p.credentials.RedactError(result.Error)
+	}
+
+	return result
+}
+
+func (p *Scraper) fetchPage(ctx context.Context, page *url.URL, opts scrapeOptions) Result {
+	result := Result{PageURL: page.Redacted()}
+
+	timeout := p.pageTimeout
+	if opts.timeout > 0 {
+		timeout = opts.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if opts.proxy != nil {
+		ctx = context.WithValue(ctx, proxyContextKey{}, opts.proxy)
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", page.String(), nil)
 	if err != nil {
@@ -136,7 +431,26 @@ func (p *Scraper) scrapePage(ctx context.Context, page *url.URL, reqOptions ...S
 	// TODO: add content type html header
 	req.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:97.0) Gecko/20100101 Firefox/97.0")
 
-	for _, option := range reqOptions {
+	if p.credentials != nil {
+		p.credentials.Apply(req)
+	}
+
+	// the cache is shared like the results, scrapes with their own headers, session or proxy don't use it
+	cacheKey, cacheable := p.shareKey(page, opts)
+	cached, hasCached := CacheEntry{}, false
+	if cacheable {
+		cached, hasCached = p.cachedPage(ctx, cacheKey)
+	}
+	if hasCached {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	for _, option := range opts.reqOptions {
 		err = option(req)
 		if err != nil {
 			result.Error = err
@@ -144,25 +458,61 @@ func (p *Scraper) scrapePage(ctx context.Context, page *url.URL, reqOptions ...S
 		}
 	}
 
-	resp, err := p.httpClient.Do(req)
+	client, err := p.client(opts)
 	if err != nil {
 		result.Error = err
 		return result
 	}
+
+	if opts.login != nil {
+		client, err = opts.login.session(ctx, p, client, opts)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+	}
+
+	// the guard starts with the page request, the login has its own requests and isn't counted as the page idling
+	guarded, idle, stopIdle := newIdleGuard(ctx, p.idleTimeout)
+	defer stopIdle()
+	req = req.WithContext(guarded)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = idle.err(err)
+		return result
+	}
 	defer resp.Body.Close()
 
+	hostSlotFromContext(ctx).observe(resp.StatusCode, time.Since(start))
+
+	result.TLS = p.tlsInfo(resp.TLS)
+
+	if hasCached && resp.StatusCode == http.StatusNotModified {
+		result.InternalLinksCount = cached.InternalLinksCount
+		result.ExternalLinksCount = cached.ExternalLinksCount
+		result.Success = true
+		result.FromCache = true
+		return result
+	}
+
 	if resp.StatusCode >= 400 { // TODO:
 		result.Error = ErrBadStatusCode
+		result.ErrorCategory = ErrorCategoryClient
+		if resp.StatusCode >= 500 {
+			result.ErrorCategory = ErrorCategoryServer
+		}
 		return result
 	}
 
-	document, err := html.Parse(resp.Body)
+	document, err := html.Parse(idle.body(resp.Body, p.maxBodyBytes))
 	if err != nil {
-		result.Error = err
+		result.Error = idle.err(err)
 		return result
 	}
 
-	external, internal, err := ParseHTMLLinks(page, document)
+	external, internal, err := parseHTMLLinks(page, document, opts.linkPolicy, p.maxHTMLDepth)
 	if err != nil {
 		result.Error = err
 		result.ExternalLinksCount = external
@@ -174,9 +524,62 @@ func (p *Scraper) scrapePage(ctx context.Context, page *url.URL, reqOptions ...S
 	result.InternalLinksCount = internal
 	result.Success = true
 
+	if cacheable {
+		p.cachePage(ctx, cacheKey, resp, result)
+	}
+
 	return result
 }
 
+// cachedPage - cache entry of key, cache failures are treated as misses
+func (p *Scraper) cachedPage(ctx context.Context, key string) (CacheEntry, bool) {
+	if p.cache == nil {
+		return CacheEntry{}, false
+	}
+
+	entry, ok, err := p.cache.Get(ctx, key)
+	if err != nil {
+		log.Println("failed to get cached page", err)
+		return CacheEntry{}, false
+	}
+
+	return entry, ok
+}
+
+// cachePage - stores the validators of resp with the link counts of result, pages without validators are not cached
+func (p *Scraper) cachePage(ctx context.Context, key string, resp *http.Response, result Result) {
+	entry := CacheEntry{
+		ETag:               resp.Header.Get("ETag"),
+		LastModified:       resp.Header.Get("Last-Modified"),
+		InternalLinksCount: result.InternalLinksCount,
+		ExternalLinksCount: result.ExternalLinksCount,
+		StoredAt:           time.Now().UTC(),
+	}
+	if p.cache == nil || (entry.ETag == "" && entry.LastModified == "") {
+		return
+	}
+
+	err := p.cache.Set(ctx, key, entry)
+	if err != nil {
+		log.Println("failed to cache page", err)
+	}
+}
+
+// checkRedirect - the redirect keeps the headers of the first request, when it leaves that host
+// the credentials of the first host are swapped for the ones of the new host
+func (p *Scraper) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	if first := via[0]; req.URL.Host != first.URL.Host {
+		p.credentials.Strip(req, first.URL.Host)
+		p.credentials.Apply(req)
+	}
+
+	return nil
+}
+
 // Close - waits for all pipelines to end
 // passing a context with deadline/cancel, and fullfiling cancel conditions
 // will make the method exit early
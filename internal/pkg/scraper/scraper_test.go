@@ -3,6 +3,7 @@ package scraper
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
@@ -13,6 +14,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/buni/scraper/internal/pkg/credentials"
+	"github.com/buni/scraper/internal/pkg/safedial"
 	"github.com/buni/scraper/internal/pkg/test"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -71,6 +74,22 @@ func TestScraper_ScrapePages(t *testing.T) {
 			},
 			wantLen: 2,
 		},
+		{
+			name: "request options are applied",
+			ctx:  context.Background(),
+			setup: func(t *testing.T) (s *Scraper, hostURLs []*url.URL, opts []ScrapeRequestOption) {
+				s, err := NewScraper()
+				assert.NoError(t, err)
+
+				host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+				opts = []ScrapeRequestOption{WithHeader("Bad Header", "x")}
+				hostURLs = test.StrToURL(t, []string{host})
+
+				return
+			},
+			wantLen: 1,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -78,10 +97,209 @@ func TestScraper_ScrapePages(t *testing.T) {
 			got := s.ScrapePages(tt.ctx, host, opts...)
 			t.Log(got)
 			assert.Len(t, got, tt.wantLen)
+			for _, result := range got {
+				assert.Equal(t, tt.wantErr, result.Error != nil)
+			}
 		})
 	}
 }
 
+func TestScraper_StreamPages(t *testing.T) {
+	t.Run("successfully stream pages", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		urls := test.StrToURL(t, []string{host, host, host})
+
+		produced := 0
+		for result := range s.StreamPages(context.Background(), urls) {
+			assert.True(t, result.Success)
+			produced++
+		}
+		assert.Equal(t, len(urls), produced)
+		assert.NoError(t, s.Close(context.Background()))
+	})
+	t.Run("request options are applied", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		optionErr := errors.New("some error")
+		opts := []ScrapeRequestOption{
+			func(r *http.Request) error {
+				return optionErr
+			},
+		}
+
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host}), WithRequestOptions(opts...)) {
+			assert.ErrorIs(t, result.Error, optionErr)
+		}
+	})
+	t.Run("scrape options are applied", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		opts := []ScrapeOption{
+			WithTimeout(time.Second),
+			WithScrapeConcurrency(1),
+			WithLinkPolicy(LinkPolicyDomain),
+			WithRequestOptions(WithHeader("X-Test", "test")),
+		}
+
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host, host}), opts...) {
+			assert.True(t, result.Success)
+		}
+		assert.NoError(t, s.Close(context.Background()))
+	})
+	t.Run("bad scrape option fails every url", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		produced := 0
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://localhost/", "http://localhost/"}), WithLinkPolicy("sideways")) {
+			assert.ErrorIs(t, result.Error, ErrBadLinkPolicy)
+			produced++
+		}
+		assert.Equal(t, 2, produced)
+	})
+	t.Run("safe dialer blocks internal addresses", func(t *testing.T) {
+		policy, err := safedial.NewPolicy()
+		assert.NoError(t, err)
+		s, err := NewScraper(WithSafeDialer(policy))
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host, "http://169.254.169.254/latest/meta-data/"})) {
+			assert.ErrorIs(t, result.Error, safedial.ErrBlockedAddress)
+		}
+	})
+	t.Run("safe dialer allow list", func(t *testing.T) {
+		policy, err := safedial.NewPolicy(safedial.WithAllowedCIDRs("127.0.0.1", "::1"))
+		assert.NoError(t, err)
+		s, err := NewScraper(WithSafeDialer(policy))
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{host})) {
+			assert.True(t, result.Success)
+		}
+	})
+	t.Run("close waits for the stream to finish", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		host := "http://" + testServerHelper(t, "testdata/good_links_serve.html") + "/"
+		results := s.StreamPages(context.Background(), test.StrToURL(t, []string{host}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		defer cancel()
+		assert.ErrorIs(t, s.Close(ctx), ErrCloseTimeout) // nobody reads the results yet
+
+		for range results {
+		}
+		assert.NoError(t, s.Close(context.Background()))
+	})
+}
+
+// credentialsServerHelper - serves the page only with the credentials, /redirect sends the scraper to /open on
+// another host name of the same server which fails if any credential header came along
+func credentialsServerHelper(t *testing.T) (host string, otherHost string) {
+	body, err := os.ReadFile("testdata/good_links_serve.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHost = listener.Addr().String()
+	host = strings.Replace(otherHost, "127.0.0.1", "localhost", -1)
+
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		session, err := r.Cookie("session")
+		if username != "user" || password != "hunter2" || err != nil || session.Value != "abc" || r.Header.Get("X-Env") != "staging" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	})
+	r.Get("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://"+otherHost+"/open", http.StatusFound)
+	})
+	r.Get("/open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || r.Header.Get("X-Env") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	})
+	srv := &http.Server{Handler: r}
+
+	go func() {
+		srv.Serve(listener)
+	}()
+
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+	})
+
+	return host, otherHost
+}
+
+func TestScraper_credentials(t *testing.T) {
+	host, _ := credentialsServerHelper(t)
+	store, err := credentials.NewStore([]credentials.Credential{{
+		Hosts:     []string{"localhost"},
+		BasicAuth: &credentials.BasicAuth{Username: "user", Password: "hunter2"},
+		Cookies:   map[string]string{"session": "abc"},
+		Headers:   map[string]string{"X-Env": "staging"},
+	}})
+	assert.NoError(t, err)
+
+	t.Run("credentials are sent to their host", func(t *testing.T) {
+		s, err := NewScraper(WithCredentials(store))
+		assert.NoError(t, err)
+
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + host + "/"})) {
+			assert.True(t, result.Success, result.Error)
+		}
+	})
+	t.Run("credentials don't follow redirects to other hosts", func(t *testing.T) {
+		s, err := NewScraper(WithCredentials(store))
+		assert.NoError(t, err)
+
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + host + "/redirect"})) {
+			assert.True(t, result.Success, result.Error)
+		}
+	})
+	t.Run("no credentials", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://" + host + "/"})) {
+			assert.ErrorIs(t, result.Error, ErrBadStatusCode)
+		}
+	})
+	t.Run("secrets are redacted from results", func(t *testing.T) {
+		s, err := NewScraper(WithCredentials(store))
+		assert.NoError(t, err)
+
+		leak := func(r *http.Request) error {
+			return fmt.Errorf("%w %s", ErrBadHeader, r.Header.Get("Authorization"))
+		}
+		for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{"http://user:hunter2@" + host + "/"}), WithRequestOptions(leak)) {
+			assert.ErrorIs(t, result.Error, ErrBadHeader)
+			assert.NotContains(t, result.Error.Error(), "dXNlcjpodW50ZXIy")
+			assert.NotContains(t, result.PageURL, "hunter2")
+		}
+	})
+}
+
 func TestScraper_enqueueURLs(t *testing.T) {
 	t.Run("successfully enqueue urls", func(t *testing.T) {
 		wg := &sync.WaitGroup{}
@@ -141,7 +359,7 @@ func TestScraper_produceResults(t *testing.T) {
 		s.enqueueURLs(context.Background(), wg, urlsChan, urls...)
 		s.httpClient.Timeout = time.Millisecond * 100
 		s.produceConcurency = 10
-		s.produceResults(context.Background(), wg, urlsChan, resultsChan)
+		s.produceResults(context.Background(), wg, urlsChan, resultsChan, scrapeOptions{})
 		producedResults := 0
 		for range resultsChan {
 			producedResults++
@@ -168,7 +386,7 @@ func TestScraper_produceResults(t *testing.T) {
 		ctx := context.Background()
 		ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
 		defer cancel()
-		s.produceResults(ctx, wg, urlsChan, resultsChan)
+		s.produceResults(ctx, wg, urlsChan, resultsChan, scrapeOptions{})
 
 		wg.Wait() // makes sure that Done was called
 	})
@@ -236,6 +454,22 @@ func TestScraper_scrapePage(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "bad header",
+			ctx:  context.Background(),
+			setup: func(t *testing.T) (s *Scraper, hostURL *url.URL, opts []ScrapeRequestOption) {
+				s, err := NewScraper()
+				assert.NoError(t, err)
+				opts = []ScrapeRequestOption{WithHeader("Bad Header", "value")}
+				hostURL, err = url.Parse("http://localhost/")
+				assert.NoError(t, err)
+				return
+			},
+			want: Result{
+				Success: false,
+			},
+			wantErr: true,
+		},
 		{
 			name: "fail to scrape bad status code",
 			ctx:  context.Background(),
@@ -260,7 +494,7 @@ func TestScraper_scrapePage(t *testing.T) {
 			s, host, opts := tt.setup(t)
 
 			tt.want.PageURL = host.String()
-			got := s.scrapePage(tt.ctx, host, opts...)
+			got := s.scrapePage(tt.ctx, host, scrapeOptions{reqOptions: opts})
 			if tt.wantErr {
 				t.Log(tt.wantErr, got.Error)
 				assert.Error(t, got.Error)
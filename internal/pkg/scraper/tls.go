@@ -0,0 +1,154 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultExpiryWarning - certificates expiring within it are flagged in the results
+const defaultExpiryWarning = time.Hour * 24 * 30
+
+var (
+	ErrBadRootCAs            = errors.New("no certificates found in root ca pem")
+	ErrBadClientCertificate  = errors.New("bad client certificate")
+	ErrBadTLSVersion         = errors.New("bad tls version")
+	ErrBadExpiryWarningValue = errors.New("bad certificate expiry warning value")
+	ErrInsecureUnsupported   = errors.New("transport doesn't support skipping tls verification")
+)
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// tlsConfig - the tls config options write to, created on first use
+func (s *Scraper) tlsConfig() *tls.Config {
+	if s.tls == nil {
+		s.tls = &tls.Config{}
+	}
+	return s.tls
+}
+
+// WithRootCAs trusts the certificates in pemCerts on top of the system roots
+func WithRootCAs(pemCerts []byte) ScraperOption {
+	return func(s *Scraper) error {
+		config := s.tlsConfig()
+		if config.RootCAs == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			config.RootCAs = pool
+		}
+
+		if !config.RootCAs.AppendCertsFromPEM(pemCerts) {
+			return ErrBadRootCAs
+		}
+		return nil
+	}
+}
+
+// WithClientCertificate presents the certificate to sites that ask for one (mutual tls)
+func WithClientCertificate(certPEM, keyPEM []byte) ScraperOption {
+	return func(s *Scraper) error {
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("%w %v", ErrBadClientCertificate, err)
+		}
+
+		config := s.tlsConfig()
+		config.Certificates = append(config.Certificates, certificate)
+		return nil
+	}
+}
+
+// WithMinTLSVersion refuses sites that don't support version (tls.VersionTLS12, ...)
+func WithMinTLSVersion(version uint16) ScraperOption {
+	return func(s *Scraper) error {
+		if _, ok := tlsVersionNames[version]; !ok {
+			return ErrBadTLSVersion
+		}
+		s.tlsConfig().MinVersion = version
+		return nil
+	}
+}
+
+// WithCertificateExpiryWarning sets how close to its expiry a certificate is flagged in the results, 30 days by default
+func WithCertificateExpiryWarning(window time.Duration) ScraperOption {
+	return func(s *Scraper) error {
+		if window <= 0 {
+			return ErrBadExpiryWarningValue
+		}
+		s.expiryWarning = window
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify accepts any certificate for the pages of the scrape, meant for internal sites with self signed certificates
+func WithInsecureSkipVerify() ScrapeOption {
+	return func(o *scrapeOptions) error {
+		o.insecureSkipVerify = true
+		return nil
+	}
+}
+
+// useTLSConfig - sets the tls config of the scraper on its transport and prepares the client
+// of the scrapes that skip verification, it shares everything else with the scraper client
+func (s *Scraper) useTLSConfig() {
+	transport, ok := s.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	if s.tls != nil {
+		transport.TLSClientConfig = s.tls
+	}
+
+	insecure := transport.Clone()
+	if insecure.TLSClientConfig == nil {
+		insecure.TLSClientConfig = &tls.Config{}
+	}
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+
+	s.insecureClient = &http.Client{Transport: insecure, CheckRedirect: s.httpClient.CheckRedirect, Timeout: s.httpClient.Timeout}
+}
+
+// client - the http client of a scrape
+func (s *Scraper) client(opts scrapeOptions) (*http.Client, error) {
+	if !opts.insecureSkipVerify {
+		return s.httpClient, nil
+	}
+
+	if s.insecureClient == nil {
+		return nil, ErrInsecureUnsupported
+	}
+
+	return s.insecureClient, nil
+}
+
+// tlsInfo - describes the connection of state, nil when the page wasn't fetched over tls
+func (s *Scraper) tlsInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{Version: tlsVersionNames[state.Version], CipherSuite: tls.CipherSuiteName(state.CipherSuite)}
+	if info.Version == "" {
+		info.Version = fmt.Sprintf("0x%04x", state.Version)
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.Issuer = leaf.Issuer.String()
+		info.NotAfter = leaf.NotAfter.UTC()
+		info.ExpiresSoon = time.Until(leaf.NotAfter) < s.expiryWarning
+	}
+
+	return info
+}
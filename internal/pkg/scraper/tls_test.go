@@ -0,0 +1,190 @@
+package scraper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// tlsServerHelper - https server with the httptest certificate, configure can change its tls config before it starts
+func tlsServerHelper(t *testing.T, configure func(config *tls.Config)) (srv *httptest.Server, caPEM []byte) {
+	body, err := os.ReadFile("testdata/good_links_serve.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	srv.TLS = &tls.Config{}
+	if configure != nil {
+		configure(srv.TLS)
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+}
+
+// clientCertificateHelper - self signed client certificate and key
+func clientCertificateHelper(t *testing.T) (certificate *x509.Certificate, certPEM []byte, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "scraper"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func scrapeOneHelper(t *testing.T, s *Scraper, rawURL string, options ...ScrapeOption) Result {
+	results := []Result{}
+	for result := range s.StreamPages(context.Background(), test.StrToURL(t, []string{rawURL}), options...) {
+		results = append(results, result)
+	}
+	assert.Len(t, results, 1)
+
+	return results[0]
+}
+
+func TestScraper_tls(t *testing.T) {
+	srv, caPEM := tlsServerHelper(t, nil)
+
+	t.Run("unknown authority", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, srv.URL)
+		assert.False(t, result.Success)
+		assert.Nil(t, result.TLS)
+	})
+	t.Run("extra root ca", func(t *testing.T) {
+		s, err := NewScraper(WithRootCAs(caPEM))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, srv.URL)
+		assert.True(t, result.Success, result.Error)
+		assert.Equal(t, "TLS 1.3", result.TLS.Version)
+		assert.NotEmpty(t, result.TLS.CipherSuite) // depends on the hardware aes support
+		assert.Equal(t, srv.Certificate().Issuer.String(), result.TLS.Issuer)
+		assert.Equal(t, srv.Certificate().NotAfter.UTC(), result.TLS.NotAfter)
+		assert.False(t, result.TLS.ExpiresSoon)
+	})
+	t.Run("certificate about to expire", func(t *testing.T) {
+		s, err := NewScraper(WithRootCAs(caPEM), WithCertificateExpiryWarning(time.Until(srv.Certificate().NotAfter)+time.Hour))
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, srv.URL)
+		assert.True(t, result.Success, result.Error)
+		assert.True(t, result.TLS.ExpiresSoon)
+	})
+	t.Run("skip verification for a single scrape", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, srv.URL, WithInsecureSkipVerify())
+		assert.True(t, result.Success, result.Error)
+		assert.NotNil(t, result.TLS)
+
+		result = scrapeOneHelper(t, s, srv.URL)
+		assert.False(t, result.Success)
+	})
+	t.Run("plain http", func(t *testing.T) {
+		s, err := NewScraper()
+		assert.NoError(t, err)
+
+		result := scrapeOneHelper(t, s, "http://"+testServerHelper(t, "testdata/good_links_serve.html")+"/")
+		assert.True(t, result.Success, result.Error)
+		assert.Nil(t, result.TLS)
+	})
+	t.Run("minimum tls version", func(t *testing.T) {
+		oldSrv, oldCAPEM := tlsServerHelper(t, func(config *tls.Config) {
+			config.MaxVersion = tls.VersionTLS12
+		})
+
+		s, err := NewScraper(WithRootCAs(oldCAPEM), WithMinTLSVersion(tls.VersionTLS13))
+		assert.NoError(t, err)
+		assert.False(t, scrapeOneHelper(t, s, oldSrv.URL).Success)
+
+		s, err = NewScraper(WithRootCAs(oldCAPEM))
+		assert.NoError(t, err)
+		result := scrapeOneHelper(t, s, oldSrv.URL)
+		assert.True(t, result.Success, result.Error)
+		assert.Equal(t, "TLS 1.2", result.TLS.Version)
+	})
+	t.Run("client certificate", func(t *testing.T) {
+		certificate, certPEM, keyPEM := clientCertificateHelper(t)
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(certificate)
+		mtlsSrv, mtlsCAPEM := tlsServerHelper(t, func(config *tls.Config) {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+			config.ClientCAs = clientCAs
+		})
+
+		s, err := NewScraper(WithRootCAs(mtlsCAPEM))
+		assert.NoError(t, err)
+		assert.False(t, scrapeOneHelper(t, s, mtlsSrv.URL).Success)
+
+		s, err = NewScraper(WithRootCAs(mtlsCAPEM), WithClientCertificate(certPEM, keyPEM))
+		assert.NoError(t, err)
+		result := scrapeOneHelper(t, s, mtlsSrv.URL)
+		assert.True(t, result.Success, result.Error)
+	})
+}
+
+func TestNewScraper_tlsOptions(t *testing.T) {
+	_, certPEM, _ := clientCertificateHelper(t)
+
+	tests := []struct {
+		name    string
+		option  ScraperOption
+		wantErr error
+	}{
+		{name: "bad root cas", option: WithRootCAs([]byte("not a certificate")), wantErr: ErrBadRootCAs},
+		{name: "client certificate without key", option: WithClientCertificate(certPEM, nil), wantErr: ErrBadClientCertificate},
+		{name: "bad tls version", option: WithMinTLSVersion(0x0200), wantErr: ErrBadTLSVersion},
+		{name: "bad expiry warning", option: WithCertificateExpiryWarning(0), wantErr: ErrBadExpiryWarningValue},
+		{name: "tls version", option: WithMinTLSVersion(tls.VersionTLS12)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewScraper(tt.option)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
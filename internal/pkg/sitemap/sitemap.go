@@ -0,0 +1,363 @@
+package sitemap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+var (
+	ErrBadMaxURLsValue     = errors.New("bad max urls value")
+	ErrBadMaxDepthValue    = errors.New("bad max depth value")
+	ErrBadMaxSitemapsValue = errors.New("bad max sitemaps value")
+	ErrBadMaxBytesValue    = errors.New("bad max bytes value")
+	ErrInvalidSitemap      = errors.New("invalid sitemap")
+	ErrBadStatusCode       = errors.New("bad status code")
+	ErrSitemapTooLarge     = errors.New("sitemap too large")
+	ErrTooManySitemaps     = errors.New("too many sitemaps")
+	ErrMaxDepth            = errors.New("sitemap index nested too deep")
+)
+
+// lastModLayouts - W3C datetime formats allowed by the sitemap protocol
+var lastModLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Result - page urls listed by a sitemap (and the sitemaps it links to)
+type Result struct {
+	URLs      []string
+	Skipped   int  // entries left out because they were not modified since the requested time
+	Truncated bool // the sitemap listed more urls than the max, only the first max are returned
+}
+
+// Expander fetches sitemaps and expands sitemap indexes into the page urls they list
+type Expander struct {
+	httpClient  *http.Client
+	maxURLs     int
+	maxDepth    int
+	maxSitemaps int
+	maxBytes    int64
+}
+
+type ExpanderOption func(e *Expander) error
+
+// WithHTTPClient sets the client used to fetch sitemaps
+func WithHTTPClient(client *http.Client) ExpanderOption {
+	return func(e *Expander) error {
+		e.httpClient = client
+		return nil
+	}
+}
+
+// WithMaxURLs caps the number of urls returned for a single expansion
+func WithMaxURLs(max int) ExpanderOption {
+	return func(e *Expander) error {
+		if max <= 0 {
+			return ErrBadMaxURLsValue
+		}
+		e.maxURLs = max
+		return nil
+	}
+}
+
+// WithMaxDepth sets how deep sitemap indexes can be nested, 1 means an index can only list url sets
+func WithMaxDepth(max int) ExpanderOption {
+	return func(e *Expander) error {
+		if max <= 0 {
+			return ErrBadMaxDepthValue
+		}
+		e.maxDepth = max
+		return nil
+	}
+}
+
+// WithMaxSitemaps caps the number of sitemaps fetched for a single expansion
+func WithMaxSitemaps(max int) ExpanderOption {
+	return func(e *Expander) error {
+		if max <= 0 {
+			return ErrBadMaxSitemapsValue
+		}
+		e.maxSitemaps = max
+		return nil
+	}
+}
+
+// WithMaxBytes caps the (decompressed) size of a single sitemap
+func WithMaxBytes(max int64) ExpanderOption {
+	return func(e *Expander) error {
+		if max <= 0 {
+			return ErrBadMaxBytesValue
+		}
+		e.maxBytes = max
+		return nil
+	}
+}
+
+// NewExpander - the defaults follow the sitemap protocol limits, 50000 urls and 50MB per sitemap
+func NewExpander(options ...ExpanderOption) (*Expander, error) {
+	e := &Expander{
+		httpClient:  cleanhttp.DefaultClient(),
+		maxURLs:     50000,
+		maxDepth:    2,
+		maxSitemaps: 100,
+		maxBytes:    50 << 20,
+	}
+	e.httpClient.Timeout = time.Second * 30
+
+	for _, option := range options {
+		err := option(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply expander option %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// expansion - state of a single Expand/ExpandReader call
+type expansion struct {
+	*Expander
+	modifiedSince time.Time
+	fetched       int
+	visited       map[string]bool // canonical urls of the fetched sitemaps, indexes that list a sitemap twice (or themselves) fetch it once
+	result        Result
+}
+
+// Expand - fetches the sitemap at sitemapURL and returns the page urls it lists, following sitemap indexes
+// entries with a lastmod before modifiedSince are skipped (entries without lastmod are always kept), a zero modifiedSince keeps everything
+func (e *Expander) Expand(ctx context.Context, sitemapURL string, modifiedSince time.Time) (Result, error) {
+	x := &expansion{Expander: e, modifiedSince: modifiedSince, visited: map[string]bool{}}
+
+	err := x.fetch(ctx, sitemapURL, 0)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return x.result, nil
+}
+
+// ExpandReader - same as Expand, for a sitemap that was already fetched (or uploaded), sitemaps it links to are fetched
+func (e *Expander) ExpandReader(ctx context.Context, r io.Reader, modifiedSince time.Time) (Result, error) {
+	x := &expansion{Expander: e, modifiedSince: modifiedSince, visited: map[string]bool{}}
+
+	err := x.parse(ctx, r, 0)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return x.result, nil
+}
+
+func (x *expansion) fetch(ctx context.Context, sitemapURL string, depth int) error {
+	if parsed, err := url.Parse(sitemapURL); err == nil {
+		key := canonical.Default.String(parsed)
+		if x.visited[key] {
+			return nil
+		}
+		x.visited[key] = true
+	}
+
+	if x.fetched == x.maxSitemaps {
+		return fmt.Errorf("%w, at most %d are fetched", ErrTooManySitemaps, x.maxSitemaps)
+	}
+	x.fetched++
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sitemapURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create sitemap request %w", err)
+	}
+
+	resp, err := x.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch sitemap %s %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch sitemap %s %w %d", sitemapURL, ErrBadStatusCode, resp.StatusCode)
+	}
+
+	err = x.parse(ctx, resp.Body, depth)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sitemapURL, err)
+	}
+
+	return nil
+}
+
+// entry - <url> of a url set or <sitemap> of an index, they have the same shape
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// parse - streams the sitemap in r, gzip compressed sitemaps are detected by their magic bytes
+func (x *expansion) parse(ctx context.Context, r io.Reader, depth int) error {
+	buffered := bufio.NewReader(&limitedReader{r: r, remaining: x.maxBytes})
+	var body io.Reader = buffered
+
+	magic, _ := buffered.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("%w %v", ErrInvalidSitemap, err)
+		}
+		defer decompressed.Close()
+		body = &limitedReader{r: decompressed, remaining: x.maxBytes}
+	}
+
+	decoder := xml.NewDecoder(body)
+	root := ""
+	children := []entry{}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			if errors.Is(err, ErrSitemapTooLarge) {
+				return err
+			}
+			return fmt.Errorf("%w %v", ErrInvalidSitemap, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if root == "" {
+			root = start.Name.Local
+			if root != "urlset" && root != "sitemapindex" {
+				return fmt.Errorf("%w, unexpected root element %q", ErrInvalidSitemap, root)
+			}
+			continue
+		}
+
+		if start.Name.Local != "url" && start.Name.Local != "sitemap" {
+			continue
+		}
+
+		e := entry{}
+		err = decoder.DecodeElement(&e, &start)
+		if err != nil {
+			if errors.Is(err, ErrSitemapTooLarge) {
+				return err
+			}
+			return fmt.Errorf("%w %v", ErrInvalidSitemap, err)
+		}
+
+		e.Loc = strings.TrimSpace(e.Loc)
+		if e.Loc == "" {
+			continue
+		}
+
+		if !x.modified(e) {
+			x.result.Skipped++
+			continue
+		}
+
+		if root == "sitemapindex" {
+			children = append(children, e) // fetched once this document is done, so only one body is open at a time
+			continue
+		}
+
+		if len(x.result.URLs) == x.maxURLs {
+			x.result.Truncated = true
+			return nil
+		}
+		x.result.URLs = append(x.result.URLs, e.Loc)
+	}
+
+	if root == "" {
+		return fmt.Errorf("%w, empty document", ErrInvalidSitemap)
+	}
+
+	if len(children) > 0 && depth+1 > x.maxDepth {
+		return ErrMaxDepth
+	}
+
+	for _, child := range children {
+		if x.result.Truncated {
+			return nil
+		}
+
+		err := x.fetch(ctx, child.Loc, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// modified - false only if the entry has a valid lastmod that is before modifiedSince
+func (x *expansion) modified(e entry) bool {
+	if x.modifiedSince.IsZero() || e.LastMod == "" {
+		return true
+	}
+
+	lastMod, ok := ParseLastMod(e.LastMod)
+	if !ok {
+		return true
+	}
+
+	return !lastMod.Before(x.modifiedSince)
+}
+
+// ParseLastMod - parses a W3C datetime as used by sitemap lastmod elements
+func ParseLastMod(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range lastModLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// limitedReader - fails with ErrSitemapTooLarge instead of silently truncating like io.LimitReader
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, ErrSitemapTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
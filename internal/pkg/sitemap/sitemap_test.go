@@ -0,0 +1,220 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const urlSetTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">%s</urlset>`
+
+const indexTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">%s</sitemapindex>`
+
+func urlSetHelper(entries ...string) string {
+	body := ""
+	for _, e := range entries {
+		loc, lastMod := e, ""
+		if i := strings.Index(e, "|"); i >= 0 {
+			loc, lastMod = e[:i], "<lastmod>"+e[i+1:]+"</lastmod>"
+		}
+		body += "<url><loc>" + loc + "</loc>" + lastMod + "</url>"
+	}
+	return fmt.Sprintf(urlSetTemplate, body)
+}
+
+func gzipHelper(t *testing.T, body string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err := gz.Write([]byte(body))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// testServerHelper serves documents by path, the {host} placeholder is replaced with the server url
+func testServerHelper(t *testing.T, documents map[string][]byte) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		document, ok := documents[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(bytes.ReplaceAll(document, []byte("{host}"), []byte(srv.URL)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExpander_Expand(t *testing.T) {
+	t.Parallel()
+	index := fmt.Sprintf(indexTemplate, `
+		<sitemap><loc>{host}/pages.xml</loc><lastmod>2022-03-01</lastmod></sitemap>
+		<sitemap><loc>{host}/blog.xml.gz</loc></sitemap>
+		<sitemap><loc>{host}/archive.xml</loc><lastmod>2019-01-01T00:00:00Z</lastmod></sitemap>`)
+	documents := map[string][]byte{
+		"/sitemap.xml": []byte(index),
+		"/pages.xml":   []byte(urlSetHelper("https://example.com/", "https://example.com/about|2021-06-01")),
+		"/blog.xml.gz": gzipHelper(t, urlSetHelper("https://example.com/blog/1|2022-02-01T10:00:00+01:00", "https://example.com/blog/2")),
+		"/archive.xml": []byte(urlSetHelper("https://example.com/2018")),
+		"/nested.xml":  []byte(fmt.Sprintf(indexTemplate, `<sitemap><loc>{host}/sitemap.xml</loc></sitemap>`)),
+		"/broken.xml":  []byte(fmt.Sprintf(indexTemplate, `<sitemap><loc>{host}/missing.xml</loc></sitemap>`)),
+		"/feed.xml":    []byte(`<rss><channel></channel></rss>`),
+		"/loop.xml": []byte(fmt.Sprintf(indexTemplate, `
+			<sitemap><loc>{host}/loop.xml</loc></sitemap>
+			<sitemap><loc>{host}/pages.xml</loc></sitemap>
+			<sitemap><loc>{host}/feeds/../pages.xml?utm_source=index#top</loc></sitemap>`)),
+	}
+	tests := []struct {
+		name          string
+		path          string
+		options       []ExpanderOption
+		modifiedSince time.Time
+		want          Result
+		wantErr       error
+	}{
+		{
+			name: "successfully expand index",
+			path: "/sitemap.xml",
+			want: Result{URLs: []string{
+				"https://example.com/",
+				"https://example.com/about",
+				"https://example.com/blog/1",
+				"https://example.com/blog/2",
+				"https://example.com/2018",
+			}},
+		},
+		{
+			name:    "successfully fetch every sitemap once",
+			path:    "/loop.xml",
+			options: []ExpanderOption{WithMaxSitemaps(2)},
+			want: Result{URLs: []string{
+				"https://example.com/",
+				"https://example.com/about",
+			}},
+		},
+		{
+			name:          "successfully filter by lastmod",
+			path:          "/sitemap.xml",
+			modifiedSince: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: Result{
+				URLs: []string{
+					"https://example.com/",
+					"https://example.com/blog/1",
+					"https://example.com/blog/2",
+				},
+				Skipped: 2, // the about page and the whole archive sitemap
+			},
+		},
+		{
+			name:    "successfully truncate at max urls",
+			path:    "/sitemap.xml",
+			options: []ExpanderOption{WithMaxURLs(3)},
+			want: Result{
+				URLs: []string{
+					"https://example.com/",
+					"https://example.com/about",
+					"https://example.com/blog/1",
+				},
+				Truncated: true,
+			},
+		},
+		{
+			name:    "fail index nested too deep",
+			path:    "/nested.xml",
+			options: []ExpanderOption{WithMaxDepth(1)},
+			wantErr: ErrMaxDepth,
+		},
+		{
+			name:    "fail too many sitemaps",
+			path:    "/sitemap.xml",
+			options: []ExpanderOption{WithMaxSitemaps(2)},
+			wantErr: ErrTooManySitemaps,
+		},
+		{
+			name:    "fail sitemap too large",
+			path:    "/sitemap.xml",
+			options: []ExpanderOption{WithMaxBytes(64)},
+			wantErr: ErrSitemapTooLarge,
+		},
+		{
+			name:    "fail missing child sitemap",
+			path:    "/broken.xml",
+			wantErr: ErrBadStatusCode,
+		},
+		{
+			name:    "fail not a sitemap",
+			path:    "/feed.xml",
+			wantErr: ErrInvalidSitemap,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := testServerHelper(t, documents)
+			e, err := NewExpander(tt.options...)
+			assert.NoError(t, err)
+
+			got, err := e.Expand(context.Background(), srv.URL+tt.path, tt.modifiedSince)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExpander_ExpandReader(t *testing.T) {
+	t.Parallel()
+	t.Run("successfully expand uploaded gzip sitemap", func(t *testing.T) {
+		e, err := NewExpander()
+		assert.NoError(t, err)
+
+		got, err := e.ExpandReader(context.Background(), bytes.NewReader(gzipHelper(t, urlSetHelper("https://example.com/", "  https://example.com/about  "))), time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, Result{URLs: []string{"https://example.com/", "https://example.com/about"}}, got)
+	})
+	t.Run("fail empty document", func(t *testing.T) {
+		e, err := NewExpander()
+		assert.NoError(t, err)
+
+		_, err = e.ExpandReader(context.Background(), strings.NewReader(""), time.Time{})
+		assert.ErrorIs(t, err, ErrInvalidSitemap)
+	})
+}
+
+func TestParseLastMod(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		value  string
+		want   time.Time
+		wantOk bool
+	}{
+		{value: "2022-03-01", want: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), wantOk: true},
+		{value: "2022-03-01T10:30Z", want: time.Date(2022, 3, 1, 10, 30, 0, 0, time.UTC), wantOk: true},
+		{value: "2022-03-01T10:30:15.5+00:00", want: time.Date(2022, 3, 1, 10, 30, 15, 500000000, time.UTC), wantOk: true},
+		{value: "yesterday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := ParseLastMod(tt.value)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.True(t, tt.want.Equal(got), "got %v, want %v", got, tt.want)
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package tenant
+
+import "context"
+
+type contextKey struct{}
+
+// NewContext - returns a copy of ctx that belongs to tenant, repositories only return records of that tenant for it
+func NewContext(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext - the tenant ctx belongs to, false for contexts that aren't scoped to a tenant (workers, internal calls)
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(string)
+	return tenant, ok
+}
+
+// Allowed - true if a record owned by owner can be accessed with ctx
+func Allowed(ctx context.Context, owner string) bool {
+	tenant, ok := FromContext(ctx)
+	return !ok || tenant == owner
+}
@@ -0,0 +1,30 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		owner string
+		want  bool
+	}{
+		{name: "unscoped context", ctx: context.Background(), owner: "acme", want: true},
+		{name: "same tenant", ctx: NewContext(context.Background(), "acme"), owner: "acme", want: true},
+		{name: "other tenant", ctx: NewContext(context.Background(), "acme"), owner: "globex", want: false},
+		{name: "unowned record", ctx: NewContext(context.Background(), "acme"), owner: "", want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, Allowed(tt.ctx, tt.owner))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package test
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSServer - udp dns server on localhost that answers A queries for the names of records (name -> ipv4 address)
+// and NXDOMAIN for the other names, AAAA queries of known names get no answers. Counts the A queries it got
+func DNSServer(t *testing.T, records map[string]string) (address string, queries *int32) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	queries = new(int32)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return // closed
+			}
+
+			response, ok := dnsAnswer(buf[:n], records, queries)
+			if ok {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), queries
+}
+
+func dnsAnswer(query []byte, records map[string]string, queries *int32) ([]byte, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, false
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil, false
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	ip, known := records[name]
+	if question.Type == dnsmessage.TypeA {
+		atomic.AddInt32(queries, 1)
+	}
+
+	responseHeader := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeSuccess}
+	if !known {
+		responseHeader.RCode = dnsmessage.RCodeNameError
+	}
+
+	builder := dnsmessage.NewBuilder(nil, responseHeader)
+	builder.EnableCompression()
+	if builder.StartQuestions() != nil || builder.Question(question) != nil || builder.StartAnswers() != nil {
+		return nil, false
+	}
+
+	if known && question.Type == dnsmessage.TypeA {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], net.ParseIP(ip).To4())
+		err = builder.AResource(dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 300}, a)
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	response, err := builder.Finish()
+	if err != nil {
+		return nil, false
+	}
+
+	return response, true
+}
@@ -0,0 +1,109 @@
+package urls
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineReader - source of candidate urls, next returns io.EOF once the input is exhausted
+// line is the 1 based line of the input the text came from
+type lineReader interface {
+	next() (text string, line int, err error)
+}
+
+// lines - plain text lines, or a single column of csv records if WithCSVColumn is set
+func (p *parser) lines(r io.Reader) lineReader {
+	if p.csvColumn != "" {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1 // exports are not always consistent, only the url column matters
+		reader.LazyQuotes = true
+		reader.ReuseRecord = true
+		return &csvLines{reader: reader, columnName: p.csvColumn, column: -1}
+	}
+
+	scanner := bufio.NewScanner(r)
+	if p.maxURLLength+1 > bufio.MaxScanTokenSize { // lines a bit over the max url length are reported as too long instead of stopping the scan
+		scanner.Buffer(make([]byte, 0, 4096), p.maxURLLength+1)
+	}
+
+	return &textLines{scanner: scanner}
+}
+
+type textLines struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (l *textLines) next() (string, int, error) {
+	if !l.scanner.Scan() {
+		err := l.scanner.Err()
+		switch {
+		case err == nil:
+			return "", l.line, io.EOF
+		case errors.Is(err, bufio.ErrTooLong):
+			return "", l.line + 1, fmt.Errorf("failed to read url list %w", ErrURLTooLong)
+		default:
+			return "", l.line + 1, fmt.Errorf("failed to read url list %w", err)
+		}
+	}
+
+	l.line++
+
+	return l.scanner.Text(), l.line, nil
+}
+
+type csvLines struct {
+	reader     *csv.Reader
+	columnName string
+	column     int
+}
+
+func (l *csvLines) next() (string, int, error) {
+	if l.column < 0 {
+		err := l.readHeader()
+		if err != nil {
+			return "", 1, err
+		}
+	}
+
+	record, err := l.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return "", 0, io.EOF
+	}
+
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read url list %w", err)
+	}
+
+	line, _ := l.reader.FieldPos(0)
+
+	if l.column >= len(record) { // short record, treat it like an empty cell
+		return "", line, nil
+	}
+
+	return record[l.column], line, nil
+}
+
+func (l *csvLines) readHeader() error {
+	header, err := l.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w %q, the csv is empty", ErrCSVColumnNotFound, l.columnName)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read csv header %w", err)
+	}
+
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), l.columnName) { // excel likes to prefix exports with a BOM
+			l.column = i
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w %q", ErrCSVColumnNotFound, l.columnName)
+}
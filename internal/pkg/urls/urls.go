@@ -1,26 +1,144 @@
 package urls
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
+	"strings"
+
+	"github.com/buni/scraper/internal/pkg/canonical"
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid url")
+	ErrUnsupportedScheme = errors.New("unsupported url scheme")
+	ErrInvalidHost       = errors.New("invalid url host")
+	ErrDuplicateURL      = errors.New("duplicate url")
+	ErrBadDefaultScheme  = errors.New("bad default scheme")
+	ErrBadLimitValue     = errors.New("bad limit value")
+	ErrTooManyURLs       = errors.New("too many urls")
+	ErrURLTooLong        = errors.New("url too long")
+	ErrBadCSVColumn      = errors.New("bad csv column")
+	ErrCSVColumnNotFound = errors.New("csv column not found")
+	errSkipLine          = errors.New("skip line")
 )
 
-var ErrInvalidURL = errors.New("invalid url")
+var supportedSchemes = map[string]bool{"http": true, "https": true}
+
+// RejectedLine - a line ParseURLList didn't accept and why
+type RejectedLine struct {
+	Line   int
+	Text   string
+	Reason error
+}
+
+type parser struct {
+	defaultScheme string
+	maxURLs       int
+	maxURLLength  int
+	csvColumn     string
+	canonicalizer *canonical.Canonicalizer
+}
+
+type ParseOption func(p *parser) error
+
+// WithMaxURLs - lists with more urls are rejected with ErrTooManyURLs
+func WithMaxURLs(max int) ParseOption {
+	return func(p *parser) error {
+		if max <= 0 {
+			return ErrBadLimitValue
+		}
+		p.maxURLs = max
+		return nil
+	}
+}
+
+// WithMaxURLLength - lines longer than max bytes are rejected with ErrURLTooLong
+func WithMaxURLLength(max int) ParseOption {
+	return func(p *parser) error {
+		if max <= 0 {
+			return ErrBadLimitValue
+		}
+		p.maxURLLength = max
+		return nil
+	}
+}
+
+func newParser(options ...ParseOption) (*parser, error) {
+	p := &parser{}
+
+	for _, option := range options {
+		err := option(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply parse option %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// WithCSVColumn - the input is csv with a header row, urls are read from the column named column (case insensitive)
+func WithCSVColumn(column string) ParseOption {
+	return func(p *parser) error {
+		if strings.TrimSpace(column) == "" {
+			return ErrBadCSVColumn
+		}
+		p.csvColumn = column
+		return nil
+	}
+}
+
+// WithCanonicalizer - urls with the same canonical form are duplicates, ParseURLs keeps the first of them
+// and ParseURLList rejects the others (it uses canonical.Default without this option)
+func WithCanonicalizer(canonicalizer *canonical.Canonicalizer) ParseOption {
+	return func(p *parser) error {
+		p.canonicalizer = canonicalizer
+		return nil
+	}
+}
+
+// WithDefaultScheme - lines without a scheme (example.com/path) get this one instead of being rejected
+func WithDefaultScheme(scheme string) ParseOption {
+	return func(p *parser) error {
+		if !supportedSchemes[scheme] {
+			return ErrBadDefaultScheme
+		}
+		p.defaultScheme = scheme
+		return nil
+	}
+}
 
 // ParseURLs - parse a file/readcloser containing line delimited URLs
 // each line has to have a valid url other wise an error is returned
-// empty lines are also not permitted
-func ParseURLs(r io.ReadCloser) ([]*url.URL, error) {
+// empty lines are also not permitted, with WithCanonicalizer duplicates are dropped
+func ParseURLs(r io.ReadCloser, options ...ParseOption) ([]*url.URL, error) {
+	p, err := newParser(options...)
+	if err != nil {
+		return nil, err
+	}
+
 	urls := make([]*url.URL, 0, 64)
+	seen := map[string]bool{}
+	lines := p.lines(r)
 
-	scanner := bufio.NewScanner(r)
-	line := 1
+	for {
+		text, line, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil { // without this a line over the scanner buffer size silently ends the list
+			return nil, err
+		}
 
-	for scanner.Scan() {
-		parsedURL, err := url.Parse(scanner.Text())
+		if p.maxURLLength > 0 && len(text) > p.maxURLLength {
+			return nil, fmt.Errorf("url on line %v is longer than %d bytes %w", line, p.maxURLLength, ErrURLTooLong)
+		}
+
+		parsedURL, err := url.Parse(text)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse url on line %v: %w", line, err)
 		}
@@ -29,10 +147,138 @@ func ParseURLs(r io.ReadCloser) ([]*url.URL, error) {
 			return nil, fmt.Errorf("invalid url on line %v %s %w", line, parsedURL, ErrInvalidURL)
 		}
 
-		urls = append(urls, parsedURL)
+		if p.canonicalizer != nil {
+			key := p.canonicalizer.String(parsedURL)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+
+		if p.maxURLs > 0 && len(urls) == p.maxURLs {
+			return nil, fmt.Errorf("more than %d urls %w", p.maxURLs, ErrTooManyURLs)
+		}
 
-		line++
+		urls = append(urls, parsedURL)
 	}
 
 	return urls, nil
 }
+
+// ParseURLList - lenient version of ParseURLs, a bad line doesn't reject the whole list
+// blank lines and lines starting with # are skipped, only http and https urls are accepted,
+// hosts are lower cased and IDN hosts are converted to punycode, duplicates (urls with the same canonical form) are dropped.
+// Lines that are not accepted are returned as rejected along with the reason, the error is only set if reading fails
+func ParseURLList(r io.Reader, options ...ParseOption) (accepted []*url.URL, rejected []RejectedLine, err error) {
+	p, err := newParser(options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canonicalizer := p.canonicalizer
+	if canonicalizer == nil {
+		canonicalizer = canonical.Default
+	}
+
+	accepted = make([]*url.URL, 0, 64)
+	seen := map[string]int{}
+	lines := p.lines(r)
+
+	for {
+		text, line, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if p.maxURLLength > 0 && len(text) > p.maxURLLength {
+			rejected = append(rejected, RejectedLine{Line: line, Text: text[:p.maxURLLength], Reason: ErrURLTooLong})
+			continue
+		}
+
+		parsedURL, err := p.parseLine(text)
+		if errors.Is(err, errSkipLine) {
+			continue
+		}
+
+		if err != nil {
+			rejected = append(rejected, RejectedLine{Line: line, Text: text, Reason: err})
+			continue
+		}
+
+		key := canonicalizer.String(parsedURL)
+		if first, ok := seen[key]; ok {
+			rejected = append(rejected, RejectedLine{Line: line, Text: text, Reason: fmt.Errorf("%w of line %d", ErrDuplicateURL, first)})
+			continue
+		}
+		seen[key] = line
+
+		if p.maxURLs > 0 && len(accepted) == p.maxURLs {
+			return nil, nil, fmt.Errorf("more than %d urls %w", p.maxURLs, ErrTooManyURLs)
+		}
+
+		accepted = append(accepted, parsedURL)
+	}
+
+	return accepted, rejected, nil
+}
+
+func (p *parser) parseLine(text string) (*url.URL, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return nil, errSkipLine
+	}
+
+	if p.defaultScheme != "" && !strings.Contains(text, "://") {
+		text = p.defaultScheme + "://" + strings.TrimPrefix(text, "//")
+	}
+
+	parsedURL, err := url.Parse(text)
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return nil, ErrInvalidURL
+	}
+
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	if !supportedSchemes[parsedURL.Scheme] {
+		return nil, ErrUnsupportedScheme
+	}
+
+	host, err := normalizeHost(parsedURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	if port := parsedURL.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") { // ipv6 literal
+		host = "[" + host + "]"
+	}
+	parsedURL.Host = host
+
+	return parsedURL, nil
+}
+
+// normalizeHost - lower cases the host and converts IDNs to their ascii (punycode) form
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", ErrInvalidHost
+	}
+
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("%w %v", ErrInvalidHost, err)
+	}
+
+	return ascii, nil
+}
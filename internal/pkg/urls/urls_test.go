@@ -1,13 +1,17 @@
 package urls
 
 import (
+	"io"
 	"math/rand"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/buni/scraper/internal/pkg/canonical"
 	"github.com/buni/scraper/internal/pkg/test"
+	"github.com/stretchr/testify/assert"
 )
 
 func tempFileHelper(t *testing.T, urls []string) string {
@@ -31,6 +35,14 @@ func tempFileHelper(t *testing.T, urls []string) string {
 	return tempFile.Name()
 }
 
+func noTrackingHelper(t *testing.T) *canonical.Canonicalizer {
+	c, err := canonical.New(canonical.WithTrackingParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
 func TestParseURLs(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -110,3 +122,234 @@ func TestParseURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestParseURLList(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		input        string
+		options      []ParseOption
+		wantAccepted []string
+		wantRejected []RejectedLine
+		wantErr      bool
+	}{
+		{
+			name:         "successfully skip blank lines and comments",
+			input:        "# seeds\nhttps://stackoverflow.com\n\n   \nhttp://stackoverflow.com/questions\n",
+			wantAccepted: []string{"https://stackoverflow.com", "http://stackoverflow.com/questions"},
+		},
+		{
+			name:         "successfully reject bad lines and keep the rest",
+			input:        "https://stackoverflow.com\nstackoverflow.com\nftp://stackoverflow.com\nhttps://stack overflow.com\nhttps://github.com",
+			wantAccepted: []string{"https://stackoverflow.com", "https://github.com"},
+			wantRejected: []RejectedLine{
+				{Line: 2, Text: "stackoverflow.com", Reason: ErrInvalidURL},
+				{Line: 3, Text: "ftp://stackoverflow.com", Reason: ErrUnsupportedScheme},
+				{Line: 4, Text: "https://stack overflow.com", Reason: ErrInvalidURL},
+			},
+		},
+		{
+			name:         "successfully normalize hosts and drop duplicates",
+			input:        "https://Bücher.example/path\nhttps://xn--bcher-kva.example/path\nHTTPS://STACKOVERFLOW.COM:8443/Q\nhttp://[::1]:8080/",
+			wantAccepted: []string{"https://xn--bcher-kva.example/path", "https://stackoverflow.com:8443/Q", "http://[::1]:8080/"},
+			wantRejected: []RejectedLine{
+				{Line: 2, Text: "https://xn--bcher-kva.example/path", Reason: ErrDuplicateURL},
+			},
+		},
+		{
+			name:         "successfully drop canonical duplicates",
+			input:        "http://Example.com:80/a/../b?utm_source=x#top\nhttp://example.com/b\nhttp://example.com/b/?id=1&utm_medium=y\nhttp://example.com/b?id=1",
+			wantAccepted: []string{"http://example.com:80/a/../b?utm_source=x#top", "http://example.com/b/?id=1&utm_medium=y"},
+			wantRejected: []RejectedLine{
+				{Line: 2, Text: "http://example.com/b", Reason: ErrDuplicateURL},
+				{Line: 4, Text: "http://example.com/b?id=1", Reason: ErrDuplicateURL},
+			},
+		},
+		{
+			name:         "successfully keep configured params",
+			input:        "http://example.com/?utm_source=x\nhttp://example.com/",
+			options:      []ParseOption{WithCanonicalizer(noTrackingHelper(t))},
+			wantAccepted: []string{"http://example.com/?utm_source=x", "http://example.com/"},
+		},
+		{
+			name:         "successfully add default scheme",
+			input:        "stackoverflow.com/questions\n//github.com\nhttp://stackoverflow.com",
+			options:      []ParseOption{WithDefaultScheme("https")},
+			wantAccepted: []string{"https://stackoverflow.com/questions", "https://github.com", "http://stackoverflow.com"},
+		},
+		{
+			name:         "successfully reject lines over the max length",
+			input:        "https://stackoverflow.com\nhttps://stackoverflow.com/questions/1234567890",
+			options:      []ParseOption{WithMaxURLLength(30)},
+			wantAccepted: []string{"https://stackoverflow.com"},
+			wantRejected: []RejectedLine{
+				{Line: 2, Text: "https://stackoverflow.com/ques", Reason: ErrURLTooLong},
+			},
+		},
+		{
+			name:    "fail too many urls",
+			input:   "https://stackoverflow.com\nhttps://github.com\nhttps://golang.org",
+			options: []ParseOption{WithMaxURLs(2)},
+			wantErr: true,
+		},
+		{
+			name:    "fail line over the scanner buffer",
+			input:   "https://stackoverflow.com/" + strings.Repeat("a", 70*1024),
+			wantErr: true,
+		},
+		{
+			name:    "fail bad default scheme",
+			input:   "stackoverflow.com",
+			options: []ParseOption{WithDefaultScheme("gopher")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gotAccepted, gotRejected, err := ParseURLList(strings.NewReader(tt.input), tt.options...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseURLList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			gotStrings := make([]string, 0, len(gotAccepted))
+			for _, u := range gotAccepted {
+				gotStrings = append(gotStrings, u.String())
+			}
+			assert.Equal(t, tt.wantAccepted, gotStrings)
+
+			assert.Len(t, gotRejected, len(tt.wantRejected))
+			for i := range gotRejected {
+				if i >= len(tt.wantRejected) {
+					break
+				}
+				assert.Equal(t, tt.wantRejected[i].Line, gotRejected[i].Line)
+				assert.Equal(t, tt.wantRejected[i].Text, gotRejected[i].Text)
+				assert.ErrorIs(t, gotRejected[i].Reason, tt.wantRejected[i].Reason)
+			}
+		})
+	}
+}
+
+func TestParseURLsLimits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		input   string
+		options []ParseOption
+		wantLen int
+		wantErr error
+	}{
+		{
+			name:    "successfully parse within limits",
+			input:   "https://stackoverflow.com\nhttps://github.com",
+			options: []ParseOption{WithMaxURLs(2), WithMaxURLLength(30)},
+			wantLen: 2,
+		},
+		{
+			name:    "successfully drop duplicates before counting",
+			input:   "https://github.com\nhttps://GitHub.com/?utm_source=x\nhttps://golang.org",
+			options: []ParseOption{WithMaxURLs(2), WithCanonicalizer(canonical.Default)},
+			wantLen: 2,
+		},
+		{
+			name:    "fail too many urls",
+			input:   "https://stackoverflow.com\nhttps://github.com\nhttps://golang.org",
+			options: []ParseOption{WithMaxURLs(2)},
+			wantErr: ErrTooManyURLs,
+		},
+		{
+			name:    "fail url too long",
+			input:   "https://stackoverflow.com/questions/1234567890",
+			options: []ParseOption{WithMaxURLLength(30)},
+			wantErr: ErrURLTooLong,
+		},
+		{
+			name:    "fail line over the scanner buffer",
+			input:   "https://stackoverflow.com/" + strings.Repeat("a", 70*1024),
+			wantErr: ErrURLTooLong,
+		},
+		{
+			name:    "fail bad limit",
+			input:   "https://stackoverflow.com",
+			options: []ParseOption{WithMaxURLs(0)},
+			wantErr: ErrBadLimitValue,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gotUrls, err := ParseURLs(io.NopCloser(strings.NewReader(tt.input)), tt.options...)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, gotUrls, tt.wantLen)
+		})
+	}
+}
+
+func TestParseURLsCSV(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		input    string
+		column   string
+		wantUrls []string
+		wantErr  error
+	}{
+		{
+			name:     "successfully parse url column",
+			input:    "\ufeffTitle,URL,Author\nHome,https://stackoverflow.com,alice\n\"Questions, all\",https://stackoverflow.com/questions,bob\n",
+			column:   "url",
+			wantUrls: []string{"https://stackoverflow.com", "https://stackoverflow.com/questions"},
+		},
+		{
+			name:    "fail missing column",
+			input:   "title,link\nHome,https://stackoverflow.com\n",
+			column:  "url",
+			wantErr: ErrCSVColumnNotFound,
+		},
+		{
+			name:    "fail short record",
+			input:   "title,url\nHome\n",
+			column:  "url",
+			wantErr: ErrInvalidURL,
+		},
+		{
+			name:    "fail bad column option",
+			input:   "url\nhttps://stackoverflow.com\n",
+			column:  " ",
+			wantErr: ErrBadCSVColumn,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			gotUrls, err := ParseURLs(io.NopCloser(strings.NewReader(tt.input)), WithCSVColumn(tt.column))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.StrToURL(t, tt.wantUrls), gotUrls)
+		})
+	}
+	t.Run("successfully report csv lines in lenient mode", func(t *testing.T) {
+		t.Parallel()
+		input := "title,url\nHome,https://stackoverflow.com\n\"multi\nline\",ftp://stackoverflow.com\nEmpty,\n"
+		gotAccepted, gotRejected, err := ParseURLList(strings.NewReader(input), WithCSVColumn("url"))
+		assert.NoError(t, err)
+		assert.Len(t, gotAccepted, 1)
+		assert.Len(t, gotRejected, 1)
+		assert.Equal(t, 3, gotRejected[0].Line)
+		assert.ErrorIs(t, gotRejected[0].Reason, ErrUnsupportedScheme)
+	})
+}
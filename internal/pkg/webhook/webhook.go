@@ -0,0 +1,222 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+var (
+	ErrEmptySecret         = errors.New("empty webhook secret")
+	ErrBadMaxAttemptsValue = errors.New("bad max attempts value")
+	ErrBadBackoffValue     = errors.New("bad backoff value")
+	ErrBadStatusCode       = errors.New("bad status code")
+	ErrDeliveryFailed      = errors.New("webhook delivery failed")
+)
+
+// Attempt - outcome of a single delivery attempt
+type Attempt struct {
+	Number     int
+	StatusCode int
+	Error      error
+	SentAt     time.Time
+	Duration   time.Duration
+}
+
+// Sender posts signed payloads to callback urls and retries failed deliveries with exponential backoff
+type Sender struct {
+	httpClient  *http.Client
+	secret      []byte
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	now         func() time.Time
+}
+
+type SenderOption func(s *Sender) error
+
+// WithMaxAttempts sets how many times a delivery is tried before giving up
+func WithMaxAttempts(attempts int) SenderOption {
+	return func(s *Sender) error {
+		if attempts <= 0 {
+			return ErrBadMaxAttemptsValue
+		}
+		s.maxAttempts = attempts
+		return nil
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the upper bound for the delay,
+// the delay is doubled after every failed attempt
+func WithBackoff(initial, max time.Duration) SenderOption {
+	return func(s *Sender) error {
+		if initial <= 0 || max < initial {
+			return ErrBadBackoffValue
+		}
+		s.backoff = initial
+		s.maxBackoff = max
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client used for deliveries
+func WithHTTPClient(client *http.Client) SenderOption {
+	return func(s *Sender) error {
+		s.httpClient = client
+		return nil
+	}
+}
+
+// NewSender ...
+func NewSender(secret []byte, options ...SenderOption) (*Sender, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+
+	sender := &Sender{
+		secret:      secret,
+		httpClient:  cleanhttp.DefaultClient(),
+		maxAttempts: 5,
+		backoff:     time.Second,
+		maxBackoff:  time.Minute,
+		now:         time.Now,
+	}
+	sender.httpClient.Timeout = time.Second * 10
+
+	for _, option := range options {
+		err := option(sender)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply sender option %w", err)
+		}
+	}
+
+	return sender, nil
+}
+
+// Send - delivers payload to callbackURL, retrying until it gets a 2xx response, a non retryable response
+// or runs out of attempts, onAttempt is called after every attempt so they can be recorded
+func (s *Sender) Send(ctx context.Context, callbackURL string, payload []byte, onAttempt func(Attempt)) error {
+	return s.Resume(ctx, callbackURL, payload, 0, onAttempt)
+}
+
+// Resume - Send for a delivery that already made previousAttempts attempts (e.g. before its worker went away),
+// the attempts are numbered and backed off as if they were made by the same Send. An attempt cut short by ctx
+// isn't passed to onAttempt, so it doesn't count towards the attempts of the delivery
+func (s *Sender) Resume(ctx context.Context, callbackURL string, payload []byte, previousAttempts int, onAttempt func(Attempt)) error {
+	if previousAttempts >= s.maxAttempts {
+		return fmt.Errorf("%w after %d attempts", ErrDeliveryFailed, previousAttempts)
+	}
+
+	backoff := s.backoff
+	for i := 0; i < previousAttempts; i++ { // the delay after attempt n is backoff*2^(n-1)
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+
+	for i := previousAttempts + 1; i <= s.maxAttempts; i++ {
+		attempt := s.send(ctx, callbackURL, payload)
+		attempt.Number = i
+		if attempt.Error != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if onAttempt != nil {
+			onAttempt(attempt)
+		}
+
+		if attempt.Error == nil {
+			return nil
+		}
+
+		if !retryable(attempt) || i == s.maxAttempts {
+			return fmt.Errorf("%w after %d attempts: %v", ErrDeliveryFailed, i, attempt.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+
+	return ErrDeliveryFailed
+}
+
+func (s *Sender) send(ctx context.Context, callbackURL string, payload []byte) Attempt {
+	attempt := Attempt{SentAt: s.now().UTC()}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(payload))
+	if err != nil {
+		attempt.Error = err
+		return attempt
+	}
+
+	timestamp := strconv.FormatInt(attempt.SentAt.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(s.secret, timestamp, payload))
+
+	resp, err := s.httpClient.Do(req)
+	attempt.Duration = s.now().UTC().Sub(attempt.SentAt)
+	if err != nil {
+		attempt.Error = err
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16)) // drain so the connection can be reused
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Errorf("%w %d", ErrBadStatusCode, resp.StatusCode)
+	}
+
+	return attempt
+}
+
+// retryable - network errors, 5xx, 408 and 429 are retried, other 4xx mean the receiver won't accept the payload anyway
+func retryable(attempt Attempt) bool {
+	switch {
+	case attempt.StatusCode == 0:
+		return true
+	case attempt.StatusCode == http.StatusRequestTimeout, attempt.StatusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return attempt.StatusCode >= 500
+	}
+}
+
+// Sign - hex encoded HMAC-SHA256 of "<timestamp>.<payload>"
+// receivers should recompute it, compare it in constant time and reject stale timestamps
+func Sign(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - checks a signature header value produced by Sender against the payload
+func Verify(secret []byte, timestamp string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte("sha256="+Sign(secret, timestamp, payload)), []byte(signature))
+}
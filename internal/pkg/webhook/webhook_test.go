@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSender_Send(t *testing.T) {
+	t.Parallel()
+	secret := []byte("secret")
+	payload := []byte(`{"job_id":"1"}`)
+
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "successfully deliver on first attempt",
+			statusCodes:  []int{http.StatusOK},
+			wantAttempts: 1,
+		},
+		{
+			name:         "successfully deliver after retries",
+			statusCodes:  []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent},
+			wantAttempts: 3,
+		},
+		{
+			name:         "give up on non retryable status",
+			statusCodes:  []int{http.StatusBadRequest},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "give up after max attempts",
+			statusCodes:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			calls := int32(0)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, payload, body)
+				assert.True(t, Verify(secret, r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)))
+
+				i := atomic.AddInt32(&calls, 1) - 1
+				w.WriteHeader(tt.statusCodes[i])
+			}))
+			defer srv.Close()
+
+			s, err := NewSender(secret, WithMaxAttempts(3), WithBackoff(time.Millisecond, time.Millisecond*2))
+			assert.NoError(t, err)
+
+			attempts := []Attempt{}
+			err = s.Send(context.Background(), srv.URL, payload, func(attempt Attempt) {
+				attempts = append(attempts, attempt)
+			})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrDeliveryFailed)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Len(t, attempts, tt.wantAttempts)
+			for i, attempt := range attempts {
+				assert.Equal(t, i+1, attempt.Number)
+				assert.Equal(t, tt.statusCodes[i], attempt.StatusCode)
+			}
+		})
+	}
+}
+
+func TestSender_SendUnreachable(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // nothing is listening anymore
+
+	s, err := NewSender([]byte("secret"), WithMaxAttempts(2), WithBackoff(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+
+	attempts := 0
+	err = s.Send(context.Background(), srv.URL, []byte("{}"), func(attempt Attempt) {
+		attempts++
+		assert.Error(t, attempt.Error)
+		assert.Zero(t, attempt.StatusCode)
+	})
+	assert.ErrorIs(t, err, ErrDeliveryFailed)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestSender_Resume(t *testing.T) {
+	t.Parallel()
+	calls := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	s, err := NewSender([]byte("secret"), WithMaxAttempts(3), WithBackoff(time.Millisecond, time.Millisecond*2))
+	assert.NoError(t, err)
+
+	numbers := []int{}
+	err = s.Resume(context.Background(), srv.URL, []byte("{}"), 1, func(attempt Attempt) {
+		numbers = append(numbers, attempt.Number)
+	})
+	assert.ErrorIs(t, err, ErrDeliveryFailed)
+	assert.Equal(t, []int{2, 3}, numbers, "continues the numbering of the previous attempts")
+
+	err = s.Resume(context.Background(), srv.URL, []byte("{}"), 3, nil)
+	assert.ErrorIs(t, err, ErrDeliveryFailed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "out of attempts already")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = s.Resume(ctx, srv.URL, []byte("{}"), 0, func(attempt Attempt) {
+		t.Error("canceled attempts aren't recorded")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+	signature := Sign([]byte("secret"), "1600000000", []byte("{}"))
+	assert.Len(t, signature, 64)
+	assert.NotEqual(t, signature, Sign([]byte("secret"), "1600000001", []byte("{}")))
+	assert.NotEqual(t, signature, Sign([]byte("other"), "1600000000", []byte("{}")))
+	assert.True(t, Verify([]byte("secret"), "1600000000", []byte("{}"), "sha256="+signature))
+	assert.False(t, Verify([]byte("secret"), "1600000000", []byte("{ }"), "sha256="+signature))
+}
+
+func TestNewSender(t *testing.T) {
+	t.Parallel()
+	_, err := NewSender(nil)
+	assert.ErrorIs(t, err, ErrEmptySecret)
+	_, err = NewSender([]byte("secret"), WithMaxAttempts(0))
+	assert.ErrorIs(t, err, ErrBadMaxAttemptsValue)
+	_, err = NewSender([]byte("secret"), WithBackoff(time.Second, time.Millisecond))
+	assert.ErrorIs(t, err, ErrBadBackoffValue)
+}